@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/eloonstra/autowire/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func loadConfig(cmd *cobra.Command) error {
+	path := configPath
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if path = config.Find(cwd); path == "" {
+			return nil
+		}
+	}
+
+	values, err := config.Read(path)
+	if err != nil {
+		return fmt.Errorf("reading config %s: %w", path, err)
+	}
+	if err := config.Apply(cmd.Flags(), values, filepath.Dir(path)); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	logf("config: %s\n", path)
+	return nil
+}
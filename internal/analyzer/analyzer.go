@@ -1,78 +1,1491 @@
 package analyzer
 
 import (
+	"errors"
 	"fmt"
+	"go/token"
+	"path"
+	"slices"
 	"sort"
 	"strings"
 
+	"github.com/eloonstra/autowire/internal/diag"
 	"github.com/eloonstra/autowire/internal/types"
 )
 
+const (
+	contextKey     = "context.Context"
+	argsKey        = "[]string@args"
+	embedFSKey     = "embed.FS"
+	reportedChains = 3
+)
+
 type Result struct {
-	Providers        []types.Provider
-	Invocations      []types.Invocation
-	PackageName      string
-	OutputImportPath string
-	Imports          map[string]string
+	Providers          []types.Provider
+	RequestProviders   []types.Provider
+	TransientProviders []types.Provider
+	WeakProviders      []types.Provider
+	LazyProviders      []types.Provider
+	RequestParams      []types.TypeRef
+	Externals          []types.External
+	UsesContext        bool
+	UsesArgs           bool
+	Invocations        []types.Invocation
+	PackageName        string
+	OutputImportPath   string
+	Imports            map[string]string
+	Profiles           []string
+	Diagnostics        []diag.Diagnostic
+}
+
+type BuiltinPolicy int
+
+const (
+	BuiltinPolicyAllow BuiltinPolicy = iota
+	BuiltinPolicyNamedOnly
+	BuiltinPolicyForbid
+)
+
+type Options struct {
+	AllowMissing   bool
+	Builtins       BuiltinPolicy
+	ChainThreshold int
+	Strict         bool
+	Profile        string
+	Container      string
+	OnlyInvoke     []string
+	SkipInvoke     []string
+	Rules          Rules
+}
+
+type Rules struct {
+	FuncPrefix     string
+	StructPackages []string
+	InvokePackages []string
+}
+
+func Analyze(parsed *types.ParseResult, resolver types.PackageNameResolver, opts Options) (*Result, error) {
+	parsed = resolveAliases(declarationOrder(parsed))
+	filtered := make(filteredProviders)
+	parsed, profiles, err := applyProfile(parsed, opts.Profile, filtered)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err = applyContainer(parsed, opts.Container, filtered)
+	if err != nil {
+		return nil, err
+	}
+	var unusedDiagnostics []diag.Diagnostic
+	if opts.Strict {
+		unusedDiagnostics = unusedDefaults(parsed)
+	}
+	parsed, err = applyDefaults(parsed)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err = applyInvocationFilter(parsed, opts.OnlyInvoke, opts.SkipInvoke)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validatePointers(parsed); err != nil {
+		return nil, err
+	}
+
+	groups, err := buildGroups(parsed.Providers)
+	if err != nil {
+		return nil, err
+	}
+	providers := append(append([]types.Provider{}, parsed.Providers...), groups...)
+
+	invocations, err := resolveCollectors(parsed.Invocations, groups)
+	if err != nil {
+		return nil, err
+	}
+	collected := *parsed
+	collected.Invocations = invocations
+	parsed = &collected
+
+	builtinWarnings, err := checkBuiltins(parsed.Providers, parsed.Invocations, opts.Builtins)
+	if err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string]types.Provider)
+	var duplicates []error
+	for _, p := range providers {
+		if p.Group != "" {
+			continue
+		}
+		keys := []string{p.ProvidedType.Key()}
+		if p.Scope == types.ScopeLazy {
+			keys = append(keys, types.Accessor(p.ProvidedType, true).Key())
+			if !p.CanError {
+				keys = append(keys, types.Accessor(p.ProvidedType, false).Key())
+			}
+		}
+		for _, key := range keys {
+			if dup, ok := byType[key]; ok {
+				duplicates = append(duplicates, fmt.Errorf("duplicate provider for %s: %s and %s; give them distinct names with name=", key, located(dup.Name, dup.Pos), located(p.Name, p.Pos)))
+				continue
+			}
+			byType[key] = p
+		}
+	}
+	if len(duplicates) > 0 {
+		return nil, errors.Join(duplicates...)
+	}
+
+	providers, invocations = literalDefaults(providers, parsed.Invocations, byType)
+	parsed.Invocations = invocations
+
+	externals, err := declaredExternals(parsed.Externals, byType)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.AllowMissing {
+		if err := validateDeps(providers, parsed.Invocations, byType, externals, filtered); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateScopes(providers, parsed.Invocations, byType); err != nil {
+		return nil, err
+	}
+
+	ordered, err := topoSort(providers, parsed.Invocations, byType)
+	if err != nil {
+		return nil, err
+	}
+
+	resolveVarNames(ordered, externals)
+	resolveGroupMembers(ordered)
+
+	diagnostics := append(builtinWarnings, checkRules(parsed.Providers, opts.Rules)...)
+	diagnostics = append(diagnostics, checkUnexported(parsed.Providers, parsed.OutputImportPath)...)
+	diagnostics = append(diagnostics, checkInvocationRoots(parsed.Invocations, opts.Rules.InvokePackages)...)
+	diagnostics = append(diagnostics, purityHints(ordered)...)
+	diagnostics = append(diagnostics, consolidationHints(ordered, parsed.PackageNames)...)
+	diagnostics = append(diagnostics, errorChainWarnings(ordered, parsed.Invocations)...)
+	if opts.ChainThreshold > 0 {
+		diagnostics = append(diagnostics, chainWarnings(parsed.Invocations, byType, opts.ChainThreshold)...)
+	}
+	if opts.Strict {
+		diagnostics = append(diagnostics, unusedDiagnostics...)
+		diagnostics = append(diagnostics, unusedProviders(ordered, parsed.Invocations)...)
+	}
+
+	var singletons, requestScoped, transient, weak, lazy []types.Provider
+	for _, p := range ordered {
+		switch p.Scope {
+		case types.ScopeRequest:
+			requestScoped = append(requestScoped, p)
+		case types.ScopeTransient:
+			transient = append(transient, p)
+		case types.ScopeWeak:
+			weak = append(weak, p)
+		case types.ScopeLazy:
+			lazy = append(lazy, p)
+		default:
+			singletons = append(singletons, p)
+		}
+	}
+
+	used, err := usedExternals(externals, singletons, transient, weak, lazy, parsed.Invocations)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Strict {
+		diagnostics = append(diagnostics, unusedExternals(externals, used)...)
+	}
+
+	return &Result{
+		Providers:          singletons,
+		RequestProviders:   requestScoped,
+		TransientProviders: transient,
+		WeakProviders:      weak,
+		LazyProviders:      lazy,
+		RequestParams:      requestParams(requestScoped, byType),
+		Externals:          used,
+		UsesContext:        usesContext(append(append(append(singletons, transient...), weak...), lazy...), parsed.Invocations, byType),
+		UsesArgs:           usesArgs(parsed.Invocations, byType),
+		Invocations:        parsed.Invocations,
+		PackageName:        parsed.OutputPackage,
+		OutputImportPath:   parsed.OutputImportPath,
+		Imports:            collectImports(ordered, parsed.Invocations, parsed.OutputImportPath, resolver),
+		Profiles:           profiles,
+		Diagnostics:        diagnostics,
+	}, nil
+}
+
+func validateDeps(providers []types.Provider, invocations []types.Invocation, byType map[string]types.Provider, externals []types.External, filtered filteredProviders) error {
+	supplied := make(map[string]bool, len(externals))
+	for _, e := range externals {
+		supplied[e.Type.Key()] = true
+	}
+	named := make(map[string][]string)
+	ungrouped := make(map[string][]string)
+	for _, p := range providers {
+		if q := p.ProvidedType.Qualifier; q != "" && p.Group == "" {
+			base := p.ProvidedType
+			base.Qualifier = ""
+			named[base.Key()] = append(named[base.Key()], fmt.Sprintf("%s (%s)", q, p.Name))
+		}
+		if p.Group == "" && p.Kind != types.ProviderKindGroup {
+			ungrouped[p.ProvidedType.Key()] = append(ungrouped[p.ProvidedType.Key()], p.Name)
+		}
+	}
+
+	var missing []string
+	check := func(consumer string, dep types.TypeRef, hint string) {
+		if _, ok := byType[dep.Key()]; ok || dep.Key() == contextKey || supplied[dep.Key()] || dep.Default != "" {
+			return
+		}
+		if candidates := named[dep.Key()]; dep.Qualifier == "" && len(candidates) > 0 {
+			if len(candidates) == 1 {
+				missing = append(missing, fmt.Sprintf("%s requires %s, which is only provided as named %s; select it with //autowire:inject name=",
+					consumer, dep.Key(), candidates[0]))
+				return
+			}
+			sort.Strings(candidates)
+			missing = append(missing, fmt.Sprintf("%s requires %s, which is ambiguous between %s; select one with //autowire:inject name=",
+				consumer, dep.Key(), strings.Join(candidates, " and ")))
+			return
+		}
+		elem := dep
+		elem.IsSlice = false
+		if candidates := ungrouped[elem.Key()]; dep.IsSlice && len(candidates) > 0 {
+			missing = append(missing, fmt.Sprintf("%s requires %s, but its providers %s are not in a group; collect them with group=",
+				consumer, dep.Key(), strings.Join(candidates, ", ")))
+			return
+		}
+		if reasons := filtered[dep.Key()]; len(reasons) > 0 {
+			missing = append(missing, fmt.Sprintf("%s requires %s, but %s", consumer, dep.Key(), strings.Join(reasons, "; ")))
+			return
+		}
+		missing = append(missing, fmt.Sprintf("%s requires %s%s", consumer, dep.Key(), hint))
+	}
+
+	for _, p := range providers {
+		if p.Scope == types.ScopeRequest {
+			continue
+		}
+		for _, dep := range p.Dependencies {
+			var hint string
+			if p.Kind == types.ProviderKindStruct && isPlainValue(dep.Type) {
+				hint = fmt.Sprintf(" for field %s; skip the field with `autowire:\"-\"` if it is not a dependency", dep.FieldName)
+			}
+			check(located(p.Name, p.Pos), dep.Type, hint)
+		}
+	}
+
+	for _, inv := range invocations {
+		for _, dep := range inv.Dependencies {
+			if dep.Key() != argsKey {
+				check(located(inv.Name, inv.Pos), dep, "")
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return diag.NewList("missing dependencies", missing)
+	}
+	return nil
+}
+
+func checkRules(providers []types.Provider, rules Rules) []diag.Diagnostic {
+	var violations []diag.Diagnostic
+	report := func(p types.Provider, format string, args ...any) {
+		violations = append(violations, diag.Diagnostic{
+			Severity: diag.SeverityError,
+			Code:     "naming-rule",
+			Message:  fmt.Sprintf(format, args...),
+			File:     p.Pos.File,
+			Line:     p.Pos.Line,
+		})
+	}
+
+	for _, p := range providers {
+		switch p.Kind {
+		case types.ProviderKindFunc:
+			if rules.FuncPrefix != "" && !strings.HasPrefix(p.Name, rules.FuncPrefix) {
+				report(p, "function provider %s must be named %s*", p.Name, rules.FuncPrefix)
+			}
+		case types.ProviderKindStruct:
+			if len(rules.StructPackages) > 0 && !matchesAnyPackage(p.ImportPath, rules.StructPackages) {
+				report(p, "struct provider %s is in %s, but struct providers must be in %s", p.Name, p.ImportPath, strings.Join(rules.StructPackages, " or "))
+			}
+		}
+	}
+	return violations
+}
+
+func checkUnexported(providers []types.Provider, output string) []diag.Diagnostic {
+	var violations []diag.Diagnostic
+	for _, p := range providers {
+		if p.Kind == types.ProviderKindVar && p.ImportPath != output && !token.IsExported(p.Name) {
+			message := fmt.Sprintf("variable %s is unexported, so the generated code in %s cannot refer to it; export it", p.Name, output)
+			if p.ProvidedType.Key() == embedFSKey {
+				message += " (//go:embed works on exported variables too)"
+			}
+			violations = append(violations, diag.Diagnostic{
+				Severity: diag.SeverityError,
+				Code:     "unexported-type",
+				Message:  message,
+				File:     p.Pos.File,
+				Line:     p.Pos.Line,
+			})
+			continue
+		}
+		t := p.ProvidedType
+		if t.ImportPath == "" || t.ImportPath == output || token.IsExported(t.Name) {
+			continue
+		}
+		var message string
+		if p.Kind == types.ProviderKindStruct {
+			message = fmt.Sprintf("struct provider %s is unexported, so the generated code in %s cannot refer to it; export the type",
+				t.Key(), output)
+		} else {
+			message = fmt.Sprintf("%s returns unexported %s, so the generated code in %s cannot refer to it; export %s or bind it to an exported interface with //autowire:provide <Interface>",
+				p.Name, t.Key(), output, t.Name)
+		}
+		violations = append(violations, diag.Diagnostic{
+			Severity: diag.SeverityError,
+			Code:     "unexported-type",
+			Message:  message,
+			File:     p.Pos.File,
+			Line:     p.Pos.Line,
+		})
+	}
+	return violations
+}
+
+func checkInvocationRoots(invocations []types.Invocation, roots []string) []diag.Diagnostic {
+	if len(roots) == 0 {
+		return nil
+	}
+
+	var violations []diag.Diagnostic
+	for _, inv := range invocations {
+		if matchesAnyPackage(inv.ImportPath, roots) {
+			continue
+		}
+		violations = append(violations, diag.Diagnostic{
+			Severity: diag.SeverityError,
+			Code:     "invocation-root",
+			Message: fmt.Sprintf("invocation %s is in %s, but invocations must be in %s; move it to a composition root",
+				inv.Name, inv.ImportPath, strings.Join(roots, " or ")),
+			File: inv.Pos.File,
+			Line: inv.Pos.Line,
+		})
+	}
+	return violations
+}
+
+func matchesAnyPackage(importPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+			if importPath == prefix || strings.HasPrefix(importPath, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if importPath == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func checkBuiltins(providers []types.Provider, invocations []types.Invocation, policy BuiltinPolicy) ([]diag.Diagnostic, error) {
+	var uses []string
+	var positions []types.Position
+	use := func(pos types.Position, format string, args ...any) {
+		uses = append(uses, fmt.Sprintf(format, args...))
+		positions = append(positions, pos)
+	}
+	for _, p := range providers {
+		if policy == BuiltinPolicyForbid && isBuiltin(p.ProvidedType) {
+			use(p.Pos, "%s provides %s", p.Name, describeBuiltin(p.ProvidedType))
+		}
+		for _, dep := range p.Dependencies {
+			if isBuiltin(dep.Type) && dep.Type.Default == "" && (dep.Type.Qualifier == "" || policy == BuiltinPolicyForbid) {
+				use(p.Pos, "%s depends on %s", p.Name, describeBuiltin(dep.Type))
+			}
+		}
+	}
+	for _, inv := range invocations {
+		for _, dep := range inv.Dependencies {
+			if isBuiltin(dep) && dep.Default == "" && (dep.Qualifier == "" || policy == BuiltinPolicyForbid) && dep.Key() != argsKey {
+				use(inv.Pos, "%s depends on %s", inv.Name, describeBuiltin(dep))
+			}
+		}
+	}
+
+	if len(uses) == 0 {
+		return nil, nil
+	}
+	if policy != BuiltinPolicyAllow {
+		for i, pos := range positions {
+			if pos.File != "" {
+				uses[i] = fmt.Sprintf("%s:%d: %s", pos.File, pos.Line, uses[i])
+			}
+		}
+		if policy == BuiltinPolicyNamedOnly {
+			return nil, diag.NewList("unnamed builtin types are not injectable; declare a named type such as `type DSN string` or qualify them with name=", uses)
+		}
+		return nil, diag.NewList("builtin types are not injectable; declare a named type such as `type DSN string` instead", uses)
+	}
+
+	warnings := make([]diag.Diagnostic, len(uses))
+	for i, use := range uses {
+		warnings[i] = diag.Diagnostic{
+			Severity: diag.SeverityWarning,
+			Code:     "builtin-dependency",
+			Message:  use + "; declare a named type to make the dependency explicit",
+			File:     positions[i].File,
+			Line:     positions[i].Line,
+		}
+	}
+	return warnings, nil
+}
+
+func describeBuiltin(t types.TypeRef) string {
+	if t.Qualifier != "" {
+		return "builtin " + t.Key()
+	}
+	return "unnamed builtin " + t.Key()
+}
+
+func isBuiltin(t types.TypeRef) bool {
+	if t.Func != nil || t.ImportPath != "" {
+		return false
+	}
+	return t.MapKey == nil || isBuiltin(*t.MapKey)
+}
+
+func isPlainValue(t types.TypeRef) bool {
+	if t.IsPointer || t.Func != nil || t.Qualifier != "" {
+		return false
+	}
+	first, _, _ := strings.Cut(t.ImportPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+func declarationOrder(parsed *types.ParseResult) *types.ParseResult {
+	before := func(pathA, pathB string, posA, posB types.Position) bool {
+		if pathA != pathB {
+			return pathA < pathB
+		}
+		if posA.File != posB.File {
+			return posA.File < posB.File
+		}
+		return posA.Line < posB.Line
+	}
+
+	ordered := *parsed
+	ordered.Providers = slices.Clone(parsed.Providers)
+	sort.SliceStable(ordered.Providers, func(i, j int) bool {
+		a, b := ordered.Providers[i], ordered.Providers[j]
+		return before(a.ImportPath, b.ImportPath, a.Pos, b.Pos)
+	})
+	ordered.Invocations = slices.Clone(parsed.Invocations)
+	sort.SliceStable(ordered.Invocations, func(i, j int) bool {
+		a, b := ordered.Invocations[i], ordered.Invocations[j]
+		return before(a.ImportPath, b.ImportPath, a.Pos, b.Pos)
+	})
+	return &ordered
+}
+
+func resolveAliases(parsed *types.ParseResult) *types.ParseResult {
+	if len(parsed.Aliases) == 0 {
+		return parsed
+	}
+
+	targets := make(map[string]types.TypeRef)
+	for _, a := range parsed.Aliases {
+		targets[a.Alias.Key()] = a.Target
+	}
+
+	canonical := func(t types.TypeRef) types.TypeRef {
+		for range len(targets) {
+			base := types.TypeRef{Name: t.Name, ImportPath: t.ImportPath}
+			target, ok := targets[base.Key()]
+			if !ok {
+				break
+			}
+			t.Name, t.ImportPath = target.Name, target.ImportPath
+		}
+		return t
+	}
+
+	resolved := *parsed
+	resolved.Providers = make([]types.Provider, len(parsed.Providers))
+	for i, p := range parsed.Providers {
+		p.ProvidedType = canonical(p.ProvidedType)
+		deps := make([]types.Dependency, len(p.Dependencies))
+		for j, dep := range p.Dependencies {
+			dep.Type = canonical(dep.Type)
+			deps[j] = dep
+		}
+		p.Dependencies = deps
+		resolved.Providers[i] = p
+	}
+
+	resolved.Invocations = make([]types.Invocation, len(parsed.Invocations))
+	for i, inv := range parsed.Invocations {
+		deps := make([]types.TypeRef, len(inv.Dependencies))
+		for j, dep := range inv.Dependencies {
+			deps[j] = canonical(dep)
+		}
+		inv.Dependencies = deps
+		resolved.Invocations[i] = inv
+	}
+
+	resolved.Interfaces = make([]types.TypeRef, len(parsed.Interfaces))
+	for i, iface := range parsed.Interfaces {
+		resolved.Interfaces[i] = canonical(iface)
+	}
+
+	resolved.Externals = make([]types.External, len(parsed.Externals))
+	for i, e := range parsed.Externals {
+		e.Type = canonical(e.Type)
+		resolved.Externals[i] = e
+	}
+	return &resolved
+}
+
+type filteredProviders map[string][]string
+
+func (f filteredProviders) add(p types.Provider, filter string, active string) {
+	if p.Group != "" {
+		return
+	}
+	name := p.Name
+	if p.Pos.File != "" {
+		name = fmt.Sprintf("%s (%s:%d)", p.Name, p.Pos.File, p.Pos.Line)
+	}
+	key := p.ProvidedType.Key()
+	f[key] = append(f[key], fmt.Sprintf("its provider %s is excluded by %s while %s", name, filter, active))
+}
+
+func applyProfile(parsed *types.ParseResult, profile string, filtered filteredProviders) (*types.ParseResult, []string, error) {
+	seen := make(map[string]bool)
+	replaced := make(map[string]bool)
+	for _, p := range parsed.Providers {
+		if p.Profile == "" {
+			continue
+		}
+		seen[p.Profile] = true
+		if p.Profile == profile && p.Group == "" {
+			replaced[p.ProvidedType.Key()] = true
+		}
+	}
+	profiles := make([]string, 0, len(seen))
+	for name := range seen {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+
+	if profile != "" && !seen[profile] {
+		return nil, nil, fmt.Errorf("no providers are marked profile=%s", profile)
+	}
+	if len(profiles) == 0 {
+		return parsed, nil, nil
+	}
+
+	keep := func(p types.Provider) bool {
+		if p.Profile != "" {
+			return p.Profile == profile
+		}
+		return p.Group != "" || !replaced[p.ProvidedType.Key()]
+	}
+	active := "no profile is active"
+	if profile != "" {
+		active = "the active profile is " + profile
+	}
+	var providers []types.Provider
+	for _, p := range parsed.Providers {
+		switch {
+		case keep(p):
+			providers = append(providers, p)
+		case p.Profile != "":
+			filtered.add(p, "profile="+p.Profile, active)
+		}
+	}
+
+	result := *parsed
+	result.Providers = providers
+	return &result, profiles, nil
+}
+
+func applyContainer(parsed *types.ParseResult, container string, filtered filteredProviders) (*types.ParseResult, error) {
+	marked, matched := false, false
+	keep := func(containers []string) bool {
+		if len(containers) == 0 {
+			return true
+		}
+		marked = true
+		if slices.Contains(containers, container) {
+			matched = true
+			return true
+		}
+		return false
+	}
+
+	selected := "no container is selected"
+	if container != "" {
+		selected = "the selected container is " + container
+	}
+	result := *parsed
+	result.Providers = nil
+	for _, p := range parsed.Providers {
+		if keep(p.Containers) {
+			result.Providers = append(result.Providers, p)
+		} else {
+			filtered.add(p, "container="+strings.Join(p.Containers, ","), selected)
+		}
+	}
+	result.Invocations = nil
+	for _, inv := range parsed.Invocations {
+		if keep(inv.Containers) {
+			result.Invocations = append(result.Invocations, inv)
+		}
+	}
+
+	if !marked {
+		return parsed, nil
+	}
+	if container != "" && !matched {
+		return nil, fmt.Errorf("no providers or invocations are marked container=%s", container)
+	}
+	return &result, nil
+}
+
+func applyInvocationFilter(parsed *types.ParseResult, only, skip []string) (*types.ParseResult, error) {
+	if len(only) == 0 && len(skip) == 0 {
+		return parsed, nil
+	}
+
+	matches := func(pattern string, inv types.Invocation) bool {
+		pkg, ok := parsed.PackageNames[inv.ImportPath]
+		if !ok {
+			pkg = path.Base(inv.ImportPath)
+		}
+		return pattern == inv.Name || pattern == pkg+"."+inv.Name || pattern == inv.ImportPath+"."+inv.Name
+	}
+	selected := func(patterns []string, flag string) (map[int]bool, error) {
+		indexes := make(map[int]bool)
+		for _, pattern := range patterns {
+			found := false
+			for i, inv := range parsed.Invocations {
+				if matches(pattern, inv) {
+					indexes[i], found = true, true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s %s matches no invocation", flag, pattern)
+			}
+		}
+		return indexes, nil
+	}
+	kept, err := selected(only, "--only-invoke")
+	if err != nil {
+		return nil, err
+	}
+	skipped, err := selected(skip, "--skip-invoke")
+	if err != nil {
+		return nil, err
+	}
+
+	result := *parsed
+	result.Invocations = nil
+	for i, inv := range parsed.Invocations {
+		if (len(only) == 0 || kept[i]) && !skipped[i] {
+			result.Invocations = append(result.Invocations, inv)
+		}
+	}
+
+	byKey := make(map[string][]int)
+	byGroup := make(map[string][]int)
+	for i, p := range parsed.Providers {
+		if p.Group == "" {
+			byKey[p.ProvidedType.Key()] = append(byKey[p.ProvidedType.Key()], i)
+			continue
+		}
+		byKey["[]"+p.ProvidedType.Key()] = append(byKey["[]"+p.ProvidedType.Key()], i)
+		byGroup[p.Group] = append(byGroup[p.Group], i)
+	}
+	reached := make(map[int]bool)
+	var visit func(indexes []int)
+	visit = func(indexes []int) {
+		for _, i := range indexes {
+			if reached[i] {
+				continue
+			}
+			reached[i] = true
+			for _, dep := range parsed.Providers[i].Dependencies {
+				visit(byKey[dep.Type.Key()])
+			}
+		}
+	}
+	for _, inv := range result.Invocations {
+		var collected string
+		if members := byGroup[inv.Collector]; inv.Collector != "" && len(members) > 0 {
+			collected = parsed.Providers[members[0]].ProvidedType.Key()
+			visit(members)
+		}
+		for _, dep := range inv.Dependencies {
+			if dep.Key() != collected {
+				visit(byKey[dep.Key()])
+			}
+		}
+	}
+
+	result.Providers = nil
+	for i, p := range parsed.Providers {
+		if reached[i] {
+			result.Providers = append(result.Providers, p)
+		}
+	}
+	return &result, nil
+}
+
+func applyDefaults(parsed *types.ParseResult) (*types.ParseResult, error) {
+	if len(parsed.Defaults) == 0 {
+		return parsed, nil
+	}
+
+	provided := make(map[string]bool)
+	for _, p := range parsed.Providers {
+		if p.Group == "" {
+			provided[p.ProvidedType.Key()] = true
+		}
+	}
+
+	bound := make(map[string]types.TypeRef)
+	for _, d := range parsed.Defaults {
+		key := d.Interface.Key()
+		if prev, ok := bound[key]; ok {
+			return nil, fmt.Errorf("conflicting defaults for %s: %s and %s", key, prev.Key(), d.Target.Key())
+		}
+		bound[key] = d.Target
+	}
+
+	for key, target := range bound {
+		if provided[key] {
+			delete(bound, key)
+			continue
+		}
+		if !provided[target.Key()] {
+			return nil, fmt.Errorf("default for %s: no provider for %s", key, target.Key())
+		}
+	}
+
+	rebind := func(t types.TypeRef) types.TypeRef {
+		if t.IsPointer || t.IsSlice {
+			return t
+		}
+		if target, ok := bound[t.Key()]; ok {
+			return target
+		}
+		return t
+	}
+
+	resolved := *parsed
+	resolved.Providers = make([]types.Provider, len(parsed.Providers))
+	for i, p := range parsed.Providers {
+		deps := make([]types.Dependency, len(p.Dependencies))
+		for j, dep := range p.Dependencies {
+			dep.Type = rebind(dep.Type)
+			deps[j] = dep
+		}
+		p.Dependencies = deps
+		resolved.Providers[i] = p
+	}
+
+	resolved.Invocations = make([]types.Invocation, len(parsed.Invocations))
+	for i, inv := range parsed.Invocations {
+		deps := make([]types.TypeRef, len(inv.Dependencies))
+		for j, dep := range inv.Dependencies {
+			deps[j] = rebind(dep)
+		}
+		inv.Dependencies = deps
+		resolved.Invocations[i] = inv
+	}
+	return &resolved, nil
+}
+
+func validatePointers(parsed *types.ParseResult) error {
+	interfaces := make(map[string]bool)
+	for _, iface := range parsed.Interfaces {
+		interfaces[iface.Key()] = true
+	}
+
+	isInterfacePointer := func(t types.TypeRef) bool {
+		if !t.IsPointer {
+			return false
+		}
+		t.IsPointer = false
+		t.IsSlice = false
+		t.MapKey = nil
+		t.Qualifier = ""
+		return interfaces[t.Key()]
+	}
+
+	var problems []string
+	for _, p := range parsed.Providers {
+		if isInterfacePointer(p.ProvidedType) {
+			problems = append(problems, fmt.Sprintf("%s provides pointer to interface %s; provide %s instead",
+				located(p.Name, p.Pos), p.ProvidedType.Key(), strings.TrimPrefix(p.ProvidedType.Key(), "*")))
+		}
+		for _, dep := range p.Dependencies {
+			if isInterfacePointer(dep.Type) {
+				problems = append(problems, fmt.Sprintf("%s requires pointer to interface %s; depend on %s instead",
+					located(p.Name, p.Pos), dep.Type.Key(), strings.Replace(dep.Type.Key(), "*", "", 1)))
+			}
+		}
+	}
+	for _, inv := range parsed.Invocations {
+		for _, dep := range inv.Dependencies {
+			if isInterfacePointer(dep) {
+				problems = append(problems, fmt.Sprintf("%s requires pointer to interface %s; depend on %s instead",
+					located(inv.Name, inv.Pos), dep.Key(), strings.Replace(dep.Key(), "*", "", 1)))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return diag.NewList("pointer to interface types", problems)
+	}
+	return nil
 }
 
-func Analyze(parsed *types.ParseResult, resolver types.PackageNameResolver) (*Result, error) {
-	byType := make(map[string]types.Provider)
-	for _, p := range parsed.Providers {
-		key := p.ProvidedType.Key()
-		if dup, ok := byType[key]; ok {
-			return nil, fmt.Errorf("duplicate provider for %s: %s and %s", key, dup.Name, p.Name)
+func buildGroups(providers []types.Provider) ([]types.Provider, error) {
+	byName := make(map[string]*types.Provider)
+	var names []string
+
+	for _, p := range providers {
+		if p.Group == "" {
+			continue
+		}
+		if p.ProvidedType.IsSlice || p.ProvidedType.MapKey != nil {
+			return nil, fmt.Errorf("group %s: member %s provides %s, but groups collect single values", p.Group, located(p.Name, p.Pos), p.ProvidedType.Key())
 		}
-		byType[key] = p
+		group, ok := byName[p.Group]
+		if !ok {
+			elem := p.ProvidedType
+			elem.IsSlice = true
+			group = &types.Provider{
+				Name:         p.Group,
+				Kind:         types.ProviderKindGroup,
+				ProvidedType: elem,
+				VarName:      p.Group,
+			}
+			byName[p.Group] = group
+			names = append(names, p.Group)
+		}
+		if group.ProvidedType.Key() != "[]"+p.ProvidedType.Key() {
+			return nil, fmt.Errorf("group %s has members of different types: %s (%s) and %s (%s)",
+				p.Group, group.Members[0].ProvidedType.Key(), located(group.Members[0].Name, group.Members[0].Pos), p.ProvidedType.Key(), located(p.Name, p.Pos))
+		}
+		group.Members = append(group.Members, p)
 	}
 
-	if err := validateDeps(parsed.Providers, parsed.Invocations, byType); err != nil {
-		return nil, err
+	sort.Strings(names)
+	groups := make([]types.Provider, 0, len(names))
+	for _, name := range names {
+		group := byName[name]
+		sort.SliceStable(group.Members, func(i, j int) bool {
+			a, b := group.Members[i], group.Members[j]
+			if a.Order != b.Order {
+				return a.Order < b.Order
+			}
+			return a.ImportPath < b.ImportPath
+		})
+		groups = append(groups, *group)
 	}
+	return groups, nil
+}
 
-	ordered, err := topoSort(parsed.Providers, parsed.Invocations, byType)
-	if err != nil {
-		return nil, err
+func resolveCollectors(invocations []types.Invocation, groups []types.Provider) ([]types.Invocation, error) {
+	byName := make(map[string]types.Provider, len(groups))
+	for _, g := range groups {
+		byName[g.Name] = g
 	}
 
-	resolveVarNames(ordered)
+	resolved := make([]types.Invocation, len(invocations))
+	for i, inv := range invocations {
+		resolved[i] = inv
+		if inv.Collector == "" {
+			continue
+		}
+		group, ok := byName[inv.Collector]
+		if !ok {
+			return nil, fmt.Errorf("invocation %s: collector %s is not a group; no provider has group=%s", located(inv.Name, inv.Pos), inv.Collector, inv.Collector)
+		}
+		elem := group.ProvidedType
+		elem.IsSlice = false
 
-	return &Result{
-		Providers:        ordered,
-		Invocations:      parsed.Invocations,
-		PackageName:      parsed.OutputPackage,
-		OutputImportPath: parsed.OutputImportPath,
-		Imports:          collectImports(ordered, parsed.Invocations, parsed.OutputImportPath, resolver),
-	}, nil
+		var matches []int
+		for j, dep := range inv.Dependencies {
+			if dep.Key() == elem.Key() {
+				matches = append(matches, j)
+			}
+		}
+		if len(matches) != 1 {
+			return nil, fmt.Errorf("invocation %s: collector=%s requires exactly one parameter of type %s, found %d",
+				located(inv.Name, inv.Pos), inv.Collector, elem.Key(), len(matches))
+		}
+
+		deps := append([]types.TypeRef{}, inv.Dependencies...)
+		deps[matches[0]] = group.ProvidedType
+		resolved[i].Dependencies = deps
+		resolved[i].Collect = matches[0]
+	}
+	return resolved, nil
 }
 
-func validateDeps(providers []types.Provider, invocations []types.Invocation, byType map[string]types.Provider) error {
-	var missing []string
+func resolveGroupMembers(providers []types.Provider) {
+	varNames := make(map[string]string)
+	for _, p := range providers {
+		varNames[p.ID()] = p.VarName
+	}
+
+	for i := range providers {
+		if providers[i].Kind != types.ProviderKindGroup {
+			continue
+		}
+		members := make([]types.Provider, len(providers[i].Members))
+		for j, m := range providers[i].Members {
+			m.VarName = varNames[m.ID()]
+			members[j] = m
+		}
+		providers[i].Members = members
+	}
+}
 
+func lazyDependency(consumer string, p types.Provider) string {
+	return fmt.Sprintf("%s requires lazy %s (%s); depend on its accessor %s instead",
+		consumer, p.ProvidedType.Key(), p.Name, types.Accessor(p.ProvidedType, p.CanError).Key())
+}
+
+func validateScopes(providers []types.Provider, invocations []types.Invocation, byType map[string]types.Provider) error {
+	var problems []string
+
+	var cleanups, weak, lazy []string
 	for _, p := range providers {
+		if p.Scope == types.ScopeTransient && p.HasCleanup {
+			cleanups = append(cleanups, located(p.Name, p.Pos))
+		}
+		if p.Scope == types.ScopeWeak {
+			if p.HasCleanup {
+				weak = append(weak, fmt.Sprintf("%s returns a cleanup function, but nothing owns weak instances", p.Name))
+			}
+			if !p.ProvidedType.IsPointer || p.ProvidedType.IsSlice {
+				weak = append(weak, fmt.Sprintf("%s provides %s, but weak providers must provide a pointer", located(p.Name, p.Pos), p.ProvidedType.Key()))
+			}
+		}
+		if p.Scope == types.ScopeLazy && p.HasCleanup {
+			lazy = append(lazy, fmt.Sprintf("%s returns a cleanup function, but lazy instances are built after the cleanup function is returned", p.Name))
+		}
+		for _, dep := range p.Dependencies {
+			if depProvider, ok := byType[dep.Type.Key()]; ok && depProvider.Scope == types.ScopeWeak {
+				weak = append(weak, fmt.Sprintf("%s requires weak %s (%s)", located(p.Name, p.Pos), dep.Type.Key(), depProvider.Name))
+			}
+			if depProvider, ok := byType[dep.Type.Key()]; ok && depProvider.Scope == types.ScopeLazy && dep.Type.Key() == depProvider.ProvidedType.Key() {
+				lazy = append(lazy, lazyDependency(located(p.Name, p.Pos), depProvider))
+			}
+		}
+		if p.Scope == types.ScopeRequest {
+			continue
+		}
 		for _, dep := range p.Dependencies {
-			if _, ok := byType[dep.Type.Key()]; !ok {
-				missing = append(missing, fmt.Sprintf("%s requires %s", p.Name, dep.Type.Key()))
+			if depProvider, ok := byType[dep.Type.Key()]; ok && depProvider.Scope == types.ScopeRequest {
+				problems = append(problems, fmt.Sprintf("%s requires request-scoped %s (%s)", located(p.Name, p.Pos), dep.Type.Key(), depProvider.Name))
 			}
 		}
 	}
 
 	for _, inv := range invocations {
 		for _, dep := range inv.Dependencies {
-			if _, ok := byType[dep.Key()]; !ok {
-				missing = append(missing, fmt.Sprintf("%s requires %s", inv.Name, dep.Key()))
+			if depProvider, ok := byType[dep.Key()]; ok && depProvider.Scope == types.ScopeRequest {
+				problems = append(problems, fmt.Sprintf("%s requires request-scoped %s (%s)", located(inv.Name, inv.Pos), dep.Key(), depProvider.Name))
+			}
+			if depProvider, ok := byType[dep.Key()]; ok && depProvider.Scope == types.ScopeWeak {
+				weak = append(weak, fmt.Sprintf("%s requires weak %s (%s)", located(inv.Name, inv.Pos), dep.Key(), depProvider.Name))
+			}
+			if depProvider, ok := byType[dep.Key()]; ok && depProvider.Scope == types.ScopeLazy && dep.Key() == depProvider.ProvidedType.Key() {
+				lazy = append(lazy, lazyDependency(located(inv.Name, inv.Pos), depProvider))
 			}
 		}
 	}
 
-	if len(missing) > 0 {
-		return fmt.Errorf("missing dependencies:\n  %s", strings.Join(missing, "\n  "))
+	if len(problems) > 0 {
+		return diag.NewList("singletons cannot depend on request-scoped providers", problems)
+	}
+	if len(weak) > 0 {
+		return diag.NewList("invalid weak providers, which are only reachable through their App accessor", weak)
+	}
+	if len(lazy) > 0 {
+		return diag.NewList("invalid lazy providers, which are only built on first use through their accessor", lazy)
+	}
+	if len(cleanups) > 0 {
+		return fmt.Errorf("transient providers cannot return a cleanup function, since nothing owns their instances: %s", strings.Join(cleanups, ", "))
 	}
 	return nil
 }
 
-func resolveVarNames(providers []types.Provider) {
+func literalDefaults(providers []types.Provider, invocations []types.Invocation, byType map[string]types.Provider) ([]types.Provider, []types.Invocation) {
+	provided := func(t types.TypeRef) types.TypeRef {
+		if _, ok := byType[t.Key()]; ok {
+			t.Default = ""
+		}
+		return t
+	}
+
+	resolved := make([]types.Provider, len(providers))
+	for i, p := range providers {
+		deps := make([]types.Dependency, len(p.Dependencies))
+		for j, dep := range p.Dependencies {
+			dep.Type = provided(dep.Type)
+			deps[j] = dep
+		}
+		p.Dependencies = deps
+		resolved[i] = p
+		if p.Group == "" {
+			byType[p.ProvidedType.Key()] = p
+		}
+	}
+
+	resolvedInvocations := make([]types.Invocation, len(invocations))
+	for i, inv := range invocations {
+		deps := make([]types.TypeRef, len(inv.Dependencies))
+		for j, dep := range inv.Dependencies {
+			deps[j] = provided(dep)
+		}
+		inv.Dependencies = deps
+		resolvedInvocations[i] = inv
+	}
+	return resolved, resolvedInvocations
+}
+
+func declaredExternals(declared []types.External, byType map[string]types.Provider) ([]types.External, error) {
+	seen := make(map[string]types.External)
+	params := make(map[string]types.External)
+	var externals []types.External
+	var problems []string
+	for _, e := range declared {
+		key := e.Type.Key()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = e
+		if key == contextKey || key == argsKey {
+			problems = append(problems, fmt.Sprintf("%s is already supplied by the caller and cannot be declared external", located(key, e.Pos)))
+			continue
+		}
+		if p, ok := byType[key]; ok {
+			problems = append(problems, fmt.Sprintf("%s is declared external but also provided by %s", located(key, e.Pos), located(p.Name, p.Pos)))
+			continue
+		}
+		if other, ok := params[e.VarName]; ok {
+			problems = append(problems, fmt.Sprintf("externals %s and %s both become the parameter %s; rename one with name=", located(other.Type.Key(), other.Pos), located(key, e.Pos), e.VarName))
+			continue
+		}
+		params[e.VarName] = e
+		externals = append(externals, e)
+	}
+	if len(problems) > 0 {
+		return nil, diag.NewList("invalid externals", problems)
+	}
+	return externals, nil
+}
+
+func usedExternals(externals []types.External, singletons, transient, weak, lazy []types.Provider, invocations []types.Invocation) ([]types.External, error) {
+	if len(externals) == 0 {
+		return nil, nil
+	}
+	supplied := make(map[string]bool, len(externals))
+	for _, e := range externals {
+		supplied[e.Type.Key()] = true
+	}
+
+	used := make(map[string]bool)
+	var problems []string
+	for _, p := range append(append(append(append([]types.Provider{}, singletons...), transient...), weak...), lazy...) {
+		for _, dep := range p.Dependencies {
+			key := dep.Type.Key()
+			if !supplied[key] {
+				continue
+			}
+			if p.Scope == types.ScopeTransient || p.Scope == types.ScopeWeak {
+				problems = append(problems, fmt.Sprintf("%s requires external %s, but the App methods that build transient and weak providers do not receive it", located(p.Name, p.Pos), key))
+				continue
+			}
+			used[key] = true
+		}
+	}
+	for _, inv := range invocations {
+		for _, dep := range inv.Dependencies {
+			if supplied[dep.Key()] {
+				used[dep.Key()] = true
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, diag.NewList("invalid externals", problems)
+	}
+
+	var result []types.External
+	for _, e := range externals {
+		if used[e.Type.Key()] {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func unusedExternals(externals, used []types.External) []diag.Diagnostic {
+	seen := make(map[string]bool, len(used))
+	for _, e := range used {
+		seen[e.Type.Key()] = true
+	}
+	var unused []diag.Diagnostic
+	for _, e := range externals {
+		if !seen[e.Type.Key()] {
+			unused = append(unused, diag.Diagnostic{
+				Severity: diag.SeverityError,
+				Code:     "unused-external",
+				Message:  fmt.Sprintf("external %s is never required; remove the declaration", e.Type.Key()),
+				File:     e.Pos.File,
+				Line:     e.Pos.Line,
+			})
+		}
+	}
+	return unused
+}
+
+func requestParams(providers []types.Provider, byType map[string]types.Provider) []types.TypeRef {
+	seen := make(map[string]bool)
+	var params []types.TypeRef
+
+	for _, p := range providers {
+		for _, dep := range p.Dependencies {
+			key := dep.Type.Key()
+			if _, ok := byType[key]; ok || key == contextKey || dep.Type.Default != "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			params = append(params, dep.Type)
+		}
+	}
+	return params
+}
+
+func usesContext(providers []types.Provider, invocations []types.Invocation, byType map[string]types.Provider) bool {
+	if _, ok := byType[contextKey]; ok {
+		return false
+	}
+	for _, p := range providers {
+		for _, dep := range p.Dependencies {
+			if dep.Type.Key() == contextKey {
+				return true
+			}
+		}
+	}
+	for _, inv := range invocations {
+		for _, dep := range inv.Dependencies {
+			if dep.Key() == contextKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func usesArgs(invocations []types.Invocation, byType map[string]types.Provider) bool {
+	if _, ok := byType[argsKey]; ok {
+		return false
+	}
+	for _, inv := range invocations {
+		for _, dep := range inv.Dependencies {
+			if dep.Key() == argsKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func purityHints(providers []types.Provider) []diag.Diagnostic {
+	var hints []diag.Diagnostic
+	for _, p := range providers {
+		if !p.Pure || p.Kind == types.ProviderKindGroup || p.Scope == types.ScopeTransient {
+			continue
+		}
+		hints = append(hints, diag.Diagnostic{
+			Severity: diag.SeverityInfo,
+			Code:     "pure-provider",
+			Message: fmt.Sprintf("%s has no dependencies and no observable side effects; %s could be a shared or constant instance",
+				p.Name, p.ProvidedType.Key()),
+		})
+	}
+	return hints
+}
+
+func consolidationHints(providers []types.Provider, scanned map[string]string) []diag.Diagnostic {
+	byType := make(map[string][]types.Provider)
+	var keys []string
+	for _, p := range providers {
+		if p.Group != "" || p.Kind == types.ProviderKindGroup {
+			continue
+		}
+		t := p.ProvidedType
+		if p.Concrete.Name != "" {
+			t = p.Concrete
+		}
+		if _, local := scanned[t.ImportPath]; local || t.ImportPath == "" {
+			continue
+		}
+		t.Qualifier = ""
+		key := t.Key()
+		if _, ok := byType[key]; !ok {
+			keys = append(keys, key)
+		}
+		byType[key] = append(byType[key], p)
+	}
+	sort.Strings(keys)
+
+	var hints []diag.Diagnostic
+	for _, key := range keys {
+		group := byType[key]
+		if len(group) < 2 {
+			continue
+		}
+		names := make([]string, len(group))
+		bySignature := make(map[string][]string)
+		var signatures []string
+		for i, p := range group {
+			names[i] = p.Name
+			if q := p.ProvidedType.Qualifier; q != "" {
+				names[i] += " (name=" + q + ")"
+			}
+			deps := make([]string, len(p.Dependencies))
+			for j, dep := range p.Dependencies {
+				deps[j] = dep.Type.Key()
+			}
+			sort.Strings(deps)
+			signature := strings.Join(deps, ",")
+			if _, ok := bySignature[signature]; !ok {
+				signatures = append(signatures, signature)
+			}
+			bySignature[signature] = append(bySignature[signature], p.Name)
+		}
+
+		message := fmt.Sprintf("%s is constructed by %d providers: %s", key, len(group), strings.Join(names, ", "))
+		for _, signature := range signatures {
+			if same := bySignature[signature]; len(same) > 1 {
+				message += fmt.Sprintf("; %s take the same dependencies and likely build identical instances", strings.Join(same, " and "))
+			}
+		}
+		message += "; consolidate them into one provider, or give each a name that says why it is separate"
+		hints = append(hints, diag.Diagnostic{
+			Severity: diag.SeverityInfo,
+			Code:     "provider-consolidation",
+			Message:  message,
+			File:     group[0].Pos.File,
+			Line:     group[0].Pos.Line,
+		})
+	}
+	return hints
+}
+
+func unusedDefaults(parsed *types.ParseResult) []diag.Diagnostic {
+	provided := make(map[string]types.Provider)
+	for _, p := range parsed.Providers {
+		if p.Group == "" {
+			provided[p.ProvidedType.Key()] = p
+		}
+	}
+	referenced := dependencyKeys(parsed.Providers, parsed.Invocations)
+
+	var diagnostics []diag.Diagnostic
+	for _, d := range parsed.Defaults {
+		key := d.Interface.Key()
+		if p, ok := provided[key]; ok {
+			diagnostics = append(diagnostics, diag.Diagnostic{
+				Severity: diag.SeverityError,
+				Code:     "shadowed-default",
+				Message:  fmt.Sprintf("default %s -> %s is shadowed by %s, which provides %s explicitly", key, d.Target.Key(), p.Name, key),
+				File:     p.Pos.File,
+				Line:     p.Pos.Line,
+			})
+			continue
+		}
+		if !referenced[key] {
+			diagnostics = append(diagnostics, diag.Diagnostic{
+				Severity: diag.SeverityError,
+				Code:     "unused-default",
+				Message:  fmt.Sprintf("default %s -> %s is never used; nothing depends on %s", key, d.Target.Key(), key),
+			})
+		}
+	}
+	return diagnostics
+}
+
+func unusedProviders(providers []types.Provider, invocations []types.Invocation) []diag.Diagnostic {
+	used := dependencyKeys(providers, invocations)
+
+	var diagnostics []diag.Diagnostic
+	for _, p := range providers {
+		if p.Group != "" || p.Scope != types.ScopeSingleton || used[p.ProvidedType.Key()] {
+			continue
+		}
+		d := diag.Diagnostic{
+			Severity: diag.SeverityError,
+			Code:     "unused-provider",
+			Message:  fmt.Sprintf("%s provides %s, but no provider or invocation depends on it", p.Name, p.ProvidedType.Key()),
+			File:     p.Pos.File,
+			Line:     p.Pos.Line,
+		}
+		switch {
+		case p.Kind == types.ProviderKindGroup:
+			d.Message = fmt.Sprintf("group %s is never collected; no provider or invocation depends on %s", p.Name, p.ProvidedType.Key())
+			d.File, d.Line = p.Members[0].Pos.File, p.Members[0].Pos.Line
+		case p.Concrete.Name != "":
+			d.Code = "unused-binding"
+			d.Message = fmt.Sprintf("%s binds %s to %s, but no provider or invocation depends on %s", p.Name, p.Concrete.Key(), p.ProvidedType.Key(), p.ProvidedType.Key())
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+func dependencyKeys(providers []types.Provider, invocations []types.Invocation) map[string]bool {
+	keys := make(map[string]bool)
+	for _, p := range providers {
+		for _, dep := range p.Dependencies {
+			keys[dep.Type.Key()] = true
+		}
+	}
+	for _, inv := range invocations {
+		for _, dep := range inv.Dependencies {
+			keys[dep.Key()] = true
+		}
+	}
+	return keys
+}
+
+func chainWarnings(invocations []types.Invocation, byType map[string]types.Provider, threshold int) []diag.Diagnostic {
+	longest := make(map[string][]string)
+	var chain func(p types.Provider) []string
+	chain = func(p types.Provider) []string {
+		if c, ok := longest[p.ID()]; ok {
+			return c
+		}
+		var deps []types.Provider
+		deps = append(deps, p.Members...)
+		for _, dep := range p.Dependencies {
+			if depProvider, ok := byType[dep.Type.Key()]; ok {
+				deps = append(deps, depProvider)
+			}
+		}
+		var tail []string
+		for _, dep := range deps {
+			if c := chain(dep); len(c) > len(tail) {
+				tail = c
+			}
+		}
+		c := append([]string{p.Name}, tail...)
+		longest[p.ID()] = c
+		return c
+	}
+
+	var warnings []diag.Diagnostic
+	for _, inv := range invocations {
+		seen := make(map[string]bool)
+		var chains [][]string
+		for _, dep := range inv.Dependencies {
+			p, ok := byType[dep.Key()]
+			if !ok || seen[p.ID()] {
+				continue
+			}
+			seen[p.ID()] = true
+			if c := chain(p); len(c) > threshold {
+				chains = append(chains, c)
+			}
+		}
+		if len(chains) == 0 {
+			continue
+		}
+
+		sort.SliceStable(chains, func(i, j int) bool { return len(chains[i]) > len(chains[j]) })
+		if len(chains) > reportedChains {
+			chains = chains[:reportedChains]
+		}
+		lines := make([]string, len(chains))
+		for i, c := range chains {
+			lines[i] = fmt.Sprintf("%d providers: %s", len(c), strings.Join(c, " -> "))
+		}
+		warnings = append(warnings, diag.Diagnostic{
+			Severity: diag.SeverityWarning,
+			Code:     "deep-chain",
+			Message: fmt.Sprintf("%s depends on provider chains longer than %d:\n  %s",
+				inv.Name, threshold, strings.Join(lines, "\n  ")),
+		})
+	}
+	return warnings
+}
+
+func errorChainWarnings(providers []types.Provider, invocations []types.Invocation) []diag.Diagnostic {
+	consumedByProvider := make(map[string]bool)
+	for _, p := range providers {
+		for _, dep := range p.Dependencies {
+			consumedByProvider[dep.Type.Key()] = true
+		}
+	}
+
+	invokers := make(map[string][]types.Invocation)
+	for _, inv := range invocations {
+		for _, dep := range inv.Dependencies {
+			invokers[dep.Key()] = append(invokers[dep.Key()], inv)
+		}
+	}
+
+	var warnings []diag.Diagnostic
+	for _, p := range providers {
+		key := p.ProvidedType.Key()
+		if !p.CanError || p.Group != "" || consumedByProvider[key] || len(invokers[key]) == 0 {
+			continue
+		}
+
+		var names []string
+		canError := false
+		for _, inv := range invokers[key] {
+			canError = canError || inv.CanError
+			names = append(names, inv.Name)
+		}
+		if canError {
+			continue
+		}
+
+		warnings = append(warnings, diag.Diagnostic{
+			Severity: diag.SeverityWarning,
+			Code:     "error-chain",
+			Message: fmt.Sprintf("%s can fail but is only consumed by %s, which cannot return an error; consider returning an error from %s",
+				p.Name, strings.Join(names, ", "), strings.Join(names, " or ")),
+		})
+	}
+	return warnings
+}
+
+func resolveVarNames(providers []types.Provider, externals []types.External) {
 	usedNames := make(map[string]int)
+	for _, e := range externals {
+		usedNames[e.VarName] = 1
+	}
 
 	for i := range providers {
 		baseName := providers[i].VarName
@@ -91,20 +1504,25 @@ func topoSort(providers []types.Provider, invocations []types.Invocation, byType
 	inStack := make(map[string]bool)
 	var result []types.Provider
 
-	var visit func(p types.Provider, path []string) error
-	visit = func(p types.Provider, path []string) error {
-		key := p.ProvidedType.Key()
+	var visit func(p types.Provider, path []types.Provider) error
+	visit = func(p types.Provider, path []types.Provider) error {
+		id := p.ID()
 
-		if inStack[key] {
-			return fmt.Errorf("circular dependency: %s", strings.Join(append(path, key), " -> "))
+		if inStack[id] {
+			return cycleError(path, p)
 		}
-		if visited[key] {
+		if visited[id] {
 			return nil
 		}
 
-		inStack[key] = true
-		path = append(path, key)
+		inStack[id] = true
+		path = append(path, p)
 
+		for _, m := range p.Members {
+			if err := visit(m, path); err != nil {
+				return err
+			}
+		}
 		for _, dep := range p.Dependencies {
 			if depProvider, ok := byType[dep.Type.Key()]; ok {
 				if err := visit(depProvider, path); err != nil {
@@ -113,8 +1531,8 @@ func topoSort(providers []types.Provider, invocations []types.Invocation, byType
 			}
 		}
 
-		inStack[key] = false
-		visited[key] = true
+		inStack[id] = false
+		visited[id] = true
 		result = append(result, p)
 		return nil
 	}
@@ -137,6 +1555,43 @@ func topoSort(providers []types.Provider, invocations []types.Invocation, byType
 	return result, nil
 }
 
+func cycleError(path []types.Provider, repeated types.Provider) error {
+	start := 0
+	for i, p := range path {
+		if p.ID() == repeated.ID() {
+			start = i
+		}
+	}
+	cycle := append(path[start:len(path):len(path)], repeated)
+
+	keys := make([]string, len(cycle))
+	for i, p := range cycle {
+		keys[i] = p.ProvidedType.Key()
+	}
+	lines := []string{"circular dependency: " + strings.Join(keys, " -> ")}
+	for i, p := range cycle[:len(cycle)-1] {
+		lines = append(lines, fmt.Sprintf("  %s (%s%s) depends on %s", keys[i], p.Name, positionSuffix(p.Pos), keys[i+1]))
+	}
+	last := cycle[len(cycle)-2]
+	lines = append(lines, fmt.Sprintf("consider breaking the dependency of %s on %s: inject an interface or a func() returning it instead, or move the state both need into a separate provider",
+		last.Name, keys[len(keys)-1]))
+	return errors.New(strings.Join(lines, "\n"))
+}
+
+func located(name string, pos types.Position) string {
+	if pos.File == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s:%d)", name, pos.File, pos.Line)
+}
+
+func positionSuffix(pos types.Position) string {
+	if pos.File == "" {
+		return ""
+	}
+	return fmt.Sprintf(", %s:%d", pos.File, pos.Line)
+}
+
 func collectImports(providers []types.Provider, invocations []types.Invocation, outputPath string, resolver types.PackageNameResolver) map[string]string {
 	paths := make(map[string]struct{})
 
@@ -147,17 +1602,34 @@ func collectImports(providers []types.Provider, invocations []types.Invocation,
 		paths[path] = struct{}{}
 	}
 
+	var addType func(t types.TypeRef)
+	addType = func(t types.TypeRef) {
+		add(t.ImportPath)
+		if t.MapKey != nil {
+			addType(*t.MapKey)
+		}
+		if t.Func != nil {
+			for _, param := range t.Func.Params {
+				addType(param)
+			}
+			for _, result := range t.Func.Results {
+				addType(result)
+			}
+		}
+	}
+
 	for _, p := range providers {
 		add(p.ImportPath)
+		addType(p.ProvidedType)
 		for _, dep := range p.Dependencies {
-			add(dep.Type.ImportPath)
+			addType(dep.Type)
 		}
 	}
 
 	for _, inv := range invocations {
 		add(inv.ImportPath)
 		for _, dep := range inv.Dependencies {
-			add(dep.ImportPath)
+			addType(dep)
 		}
 	}
 
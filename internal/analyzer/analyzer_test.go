@@ -2,8 +2,10 @@ package analyzer
 
 import (
 	"path/filepath"
+	"slices"
 	"testing"
 
+	"github.com/eloonstra/autowire/internal/diag"
 	"github.com/eloonstra/autowire/internal/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -44,15 +46,16 @@ func TestAnalyze_DuplicateProvider(t *testing.T) {
 				ProvidedType: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true},
 				ImportPath:   "pkg/config",
 				VarName:      "config",
+				Pos:          types.Position{File: "config/b.go", Line: 7},
 			},
 		},
 		OutputPackage:    "main",
 		OutputImportPath: "example.com/app",
 	}
 
-	_, err := Analyze(parsed, &mockResolver{})
+	_, err := Analyze(parsed, &mockResolver{}, Options{})
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "duplicate provider")
+	assert.Contains(t, err.Error(), "duplicate provider for *pkg/config.Config: NewConfigA and NewConfigB (config/b.go:7)")
 }
 
 func TestAnalyze_Success(t *testing.T) {
@@ -80,7 +83,7 @@ func TestAnalyze_Success(t *testing.T) {
 		OutputImportPath: "example.com/app",
 	}
 
-	result, err := Analyze(parsed, &mockResolver{})
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
 	require.NoError(t, err)
 	assert.Equal(t, "main", result.PackageName)
 	assert.Len(t, result.Providers, 2)
@@ -139,10 +142,26 @@ func TestValidateDeps(t *testing.T) {
 					Dependencies: []types.TypeRef{
 						{Name: "Database", ImportPath: "pkg", IsPointer: true},
 					},
+					Pos: types.Position{File: "cmd/setup.go", Line: 12},
 				},
 			},
 			wantErr:     true,
-			errContains: "missing dependencies",
+			errContains: "missing dependencies:\n  Setup (cmd/setup.go:12) requires *pkg.Database",
+		}, {
+			name: "missing struct field value",
+			providers: []types.Provider{
+				{
+					Name:         "Server",
+					Kind:         types.ProviderKindStruct,
+					ProvidedType: types.TypeRef{Name: "Server", ImportPath: "example.com/app", IsPointer: true},
+					Dependencies: []types.Dependency{
+						{FieldName: "Timeout", Type: types.TypeRef{Name: "Duration", ImportPath: "time"}},
+						{FieldName: "Cache", Type: types.TypeRef{Name: "Cache", ImportPath: "example.com/app"}},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "missing dependencies:\n  Server requires time.Duration for field Timeout; skip the field with `autowire:\"-\"` if it is not a dependency\n  Server requires example.com/app.Cache",
 		},
 	}
 
@@ -153,7 +172,7 @@ func TestValidateDeps(t *testing.T) {
 				byType[p.ProvidedType.Key()] = p
 			}
 
-			err := validateDeps(tt.providers, tt.invocations, byType)
+			err := validateDeps(tt.providers, tt.invocations, byType, nil, nil)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -408,6 +427,27 @@ func TestTopoSort_CycleDetection(t *testing.T) {
 	}
 }
 
+func TestTopoSort_CycleMessage(t *testing.T) {
+	app := types.TypeRef{Name: "App", ImportPath: "pkg/app", IsPointer: true}
+	users := types.TypeRef{Name: "Users", ImportPath: "pkg/users", IsPointer: true}
+	mailer := types.TypeRef{Name: "Mailer", ImportPath: "pkg/mail", IsPointer: true}
+	providers := []types.Provider{
+		{Name: "NewApp", ImportPath: "pkg/app", ProvidedType: app, Dependencies: []types.Dependency{{Type: users}}, Pos: types.Position{File: "app/app.go", Line: 3}},
+		{Name: "NewUsers", ImportPath: "pkg/users", ProvidedType: users, Dependencies: []types.Dependency{{Type: mailer}}, Pos: types.Position{File: "users/users.go", Line: 12}},
+		{Name: "NewMailer", ImportPath: "pkg/mail", ProvidedType: mailer, Dependencies: []types.Dependency{{Type: users}}},
+	}
+	byType := make(map[string]types.Provider)
+	for _, p := range providers {
+		byType[p.ProvidedType.Key()] = p
+	}
+
+	_, err := topoSort(providers, nil, byType)
+	assert.EqualError(t, err, `circular dependency: *pkg/users.Users -> *pkg/mail.Mailer -> *pkg/users.Users
+  *pkg/users.Users (NewUsers, users/users.go:12) depends on *pkg/mail.Mailer
+  *pkg/mail.Mailer (NewMailer) depends on *pkg/users.Users
+consider breaking the dependency of NewMailer on *pkg/users.Users: inject an interface or a func() returning it instead, or move the state both need into a separate provider`)
+}
+
 func TestResolveVarNames(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -448,7 +488,7 @@ func TestResolveVarNames(t *testing.T) {
 				providers[i] = types.Provider{VarName: name}
 			}
 
-			resolveVarNames(providers)
+			resolveVarNames(providers, nil)
 
 			for i, expected := range tt.expected {
 				assert.Equal(t, expected, providers[i].VarName)
@@ -628,3 +668,1597 @@ func TestResolveImportAliases_VersionedPaths(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalyze_AllowMissing(t *testing.T) {
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{
+				Name:         "NewDatabase",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Database", ImportPath: "pkg/db", IsPointer: true},
+				Dependencies: []types.Dependency{
+					{Type: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}},
+				},
+				ImportPath: "pkg/db",
+				VarName:    "database",
+			},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	_, err := Analyze(parsed, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "missing dependencies")
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{AllowMissing: true})
+	require.NoError(t, err)
+	assert.Len(t, result.Providers, 1)
+}
+
+func TestAnalyze_Groups(t *testing.T) {
+	handler := types.TypeRef{Name: "Handler", ImportPath: "pkg/http"}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{
+				Name:         "NewMetrics",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: handler,
+				ImportPath:   "pkg/metrics",
+				VarName:      "handler",
+				Group:        "handlers",
+			},
+			{
+				Name:         "NewAuth",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: handler,
+				ImportPath:   "pkg/auth",
+				VarName:      "handler",
+				Group:        "handlers",
+				Order:        10,
+			},
+			{
+				Name:         "NewLogging",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: handler,
+				ImportPath:   "pkg/logging",
+				VarName:      "handler",
+				Group:        "handlers",
+			},
+			{
+				Name:         "NewServer",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true},
+				Dependencies: []types.Dependency{
+					{Type: types.TypeRef{Name: "Handler", ImportPath: "pkg/http", IsSlice: true}},
+				},
+				ImportPath: "pkg/http",
+				VarName:    "server",
+			},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 5)
+
+	group := result.Providers[indexOf(result.Providers, "handlers")]
+	assert.Equal(t, types.ProviderKindGroup, group.Kind)
+	assert.Equal(t, "[]pkg/http.Handler", group.ProvidedType.Key())
+	require.Len(t, group.Members, 3)
+	assert.Equal(t, "NewLogging", group.Members[0].Name)
+	assert.Equal(t, "NewMetrics", group.Members[1].Name)
+	assert.Equal(t, "NewAuth", group.Members[2].Name)
+
+	for _, m := range group.Members {
+		assert.Less(t, indexOf(result.Providers, m.Name), indexOf(result.Providers, "handlers"))
+		assert.NotEmpty(t, m.VarName)
+	}
+	assert.Less(t, indexOf(result.Providers, "handlers"), indexOf(result.Providers, "NewServer"))
+}
+
+func TestAnalyze_Collectors(t *testing.T) {
+	handler := types.TypeRef{Name: "Handler", ImportPath: "pkg/http"}
+	mux := types.TypeRef{Name: "ServeMux", ImportPath: "pkg/http", IsPointer: true}
+	providers := []types.Provider{
+		{Name: "NewAuth", Kind: types.ProviderKindFunc, ProvidedType: handler, ImportPath: "pkg/auth", VarName: "handler", Group: "handlers"},
+		{Name: "NewMux", Kind: types.ProviderKindFunc, ProvidedType: mux, ImportPath: "pkg/http", VarName: "serveMux"},
+	}
+
+	tests := []struct {
+		name     string
+		deps     []types.TypeRef
+		group    string
+		wantDeps []types.TypeRef
+		wantIdx  int
+		errMsg   string
+	}{
+		{
+			name:     "member parameter becomes group",
+			deps:     []types.TypeRef{mux, handler},
+			group:    "handlers",
+			wantDeps: []types.TypeRef{mux, {Name: "Handler", ImportPath: "pkg/http", IsSlice: true}},
+			wantIdx:  1,
+		},
+		{
+			name:   "unknown group",
+			deps:   []types.TypeRef{handler},
+			group:  "routes",
+			errMsg: "invocation Register: collector routes is not a group; no provider has group=routes",
+		},
+		{
+			name:   "no member parameter",
+			deps:   []types.TypeRef{mux},
+			group:  "handlers",
+			errMsg: "invocation Register: collector=handlers requires exactly one parameter of type pkg/http.Handler, found 0",
+		},
+		{
+			name:   "several member parameters",
+			deps:   []types.TypeRef{handler, handler},
+			group:  "handlers",
+			errMsg: "invocation Register: collector=handlers requires exactly one parameter of type pkg/http.Handler, found 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := &types.ParseResult{
+				Providers: providers,
+				Invocations: []types.Invocation{
+					{Name: "Register", ImportPath: "pkg/routes", Dependencies: tt.deps, Collector: tt.group},
+				},
+				OutputPackage:    "main",
+				OutputImportPath: "example.com/app",
+			}
+
+			result, err := Analyze(parsed, &mockResolver{}, Options{})
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, result.Invocations, 1)
+			assert.Equal(t, tt.wantDeps, result.Invocations[0].Dependencies)
+			assert.Equal(t, tt.wantIdx, result.Invocations[0].Collect)
+			assert.Equal(t, []types.TypeRef{mux, handler}, parsed.Invocations[0].Dependencies)
+		})
+	}
+}
+
+func TestAnalyze_GroupTypeMismatch(t *testing.T) {
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{
+				Name:         "NewA",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Handler", ImportPath: "pkg/http"},
+				ImportPath:   "pkg/a",
+				Group:        "handlers",
+			},
+			{
+				Name:         "NewB",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Middleware", ImportPath: "pkg/http"},
+				ImportPath:   "pkg/b",
+				Group:        "handlers",
+			},
+		},
+	}
+
+	_, err := Analyze(parsed, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "group handlers has members of different types")
+}
+
+func TestAnalyze_CompositeProviders(t *testing.T) {
+	routes := types.TypeRef{Name: "Route", ImportPath: "pkg/http", IsSlice: true}
+	roles := types.TypeRef{Name: "Role", ImportPath: "pkg/auth", IsPointer: true, MapKey: &types.TypeRef{Name: "string"}}
+
+	tests := []struct {
+		name        string
+		providers   []types.Provider
+		expectedErr string
+	}{
+		{
+			name: "slice and map providers satisfy dependencies",
+			providers: []types.Provider{
+				{Name: "NewRoutes", Kind: types.ProviderKindFunc, ProvidedType: routes, ImportPath: "pkg/http", VarName: "route"},
+				{Name: "NewRoles", Kind: types.ProviderKindFunc, ProvidedType: roles, ImportPath: "pkg/auth", VarName: "roleMap"},
+				{
+					Name:         "NewServer",
+					Kind:         types.ProviderKindFunc,
+					ProvidedType: types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true},
+					ImportPath:   "pkg/http",
+					VarName:      "server",
+					Dependencies: []types.Dependency{{Type: routes}, {Type: roles}},
+				},
+			},
+		},
+		{
+			name: "group member of a slice type",
+			providers: []types.Provider{
+				{Name: "NewRoutes", Kind: types.ProviderKindFunc, ProvidedType: routes, ImportPath: "pkg/http", Group: "routes"},
+			},
+			expectedErr: "group routes: member NewRoutes provides []pkg/http.Route, but groups collect single values",
+		},
+		{
+			name: "map dependency without provider",
+			providers: []types.Provider{
+				{
+					Name:         "NewServer",
+					Kind:         types.ProviderKindFunc,
+					ProvidedType: types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true},
+					ImportPath:   "pkg/http",
+					Dependencies: []types.Dependency{{Type: roles}},
+				},
+			},
+			expectedErr: "map[string]*pkg/auth.Role",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Analyze(&types.ParseResult{Providers: tt.providers}, &mockResolver{}, Options{})
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, result.Providers, 3)
+			assert.Equal(t, "NewServer", result.Providers[2].Name)
+		})
+	}
+}
+
+func TestAnalyze_SliceOfUngroupedProviders(t *testing.T) {
+	handler := types.TypeRef{Name: "Handler", ImportPath: "pkg/http"}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewAuth", Kind: types.ProviderKindFunc, ProvidedType: handler, ImportPath: "pkg/auth", VarName: "handler"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{{Name: "Handler", ImportPath: "pkg/http", IsSlice: true}}},
+		},
+	}
+
+	_, err := Analyze(parsed, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "Serve requires []pkg/http.Handler, but its providers NewAuth are not in a group; collect them with group=")
+}
+
+func TestAnalyze_PointerToInterface(t *testing.T) {
+	store := types.TypeRef{Name: "Store", ImportPath: "pkg/store"}
+	pointerToStore := types.TypeRef{Name: "Store", ImportPath: "pkg/store", IsPointer: true}
+
+	tests := []struct {
+		name        string
+		providers   []types.Provider
+		invocations []types.Invocation
+		errMsg      string
+	}{
+		{
+			name: "provider returns pointer to interface",
+			providers: []types.Provider{
+				{Name: "NewStore", ProvidedType: pointerToStore, ImportPath: "pkg/store"},
+			},
+			errMsg: "NewStore provides pointer to interface *pkg/store.Store; provide pkg/store.Store instead",
+		},
+		{
+			name: "provider depends on pointer to interface",
+			providers: []types.Provider{
+				{Name: "NewStore", ProvidedType: store, ImportPath: "pkg/store"},
+				{
+					Name:         "NewService",
+					ProvidedType: types.TypeRef{Name: "Service", ImportPath: "pkg/svc", IsPointer: true},
+					Dependencies: []types.Dependency{{Type: pointerToStore}},
+					ImportPath:   "pkg/svc",
+				},
+			},
+			errMsg: "NewService requires pointer to interface *pkg/store.Store; depend on pkg/store.Store instead",
+		},
+		{
+			name: "invocation depends on pointer to interface",
+			providers: []types.Provider{
+				{Name: "NewStore", ProvidedType: store, ImportPath: "pkg/store"},
+			},
+			invocations: []types.Invocation{
+				{Name: "Migrate", Dependencies: []types.TypeRef{pointerToStore}, ImportPath: "pkg/store"},
+			},
+			errMsg: "Migrate requires pointer to interface *pkg/store.Store",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := &types.ParseResult{
+				Providers:   tt.providers,
+				Invocations: tt.invocations,
+				Interfaces:  []types.TypeRef{store},
+			}
+			_, err := Analyze(parsed, &mockResolver{}, Options{})
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestAnalyze_Aliases(t *testing.T) {
+	zapLogger := types.TypeRef{Name: "Logger", ImportPath: "go.uber.org/zap", IsPointer: true}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{
+				Name:         "NewLogger",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: zapLogger,
+				ImportPath:   "pkg/logging",
+				VarName:      "logger",
+			},
+			{
+				Name:         "NewService",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Service", ImportPath: "pkg/svc", IsPointer: true},
+				Dependencies: []types.Dependency{
+					{Type: types.TypeRef{Name: "Log", ImportPath: "pkg/helper", IsPointer: true}},
+				},
+				ImportPath: "pkg/svc",
+				VarName:    "service",
+			},
+		},
+		Aliases: []types.Alias{
+			{Alias: types.TypeRef{Name: "Log", ImportPath: "pkg/helper"}, Target: types.TypeRef{Name: "Logger", ImportPath: "pkg/log"}},
+			{Alias: types.TypeRef{Name: "Logger", ImportPath: "pkg/log"}, Target: types.TypeRef{Name: "Logger", ImportPath: "go.uber.org/zap"}},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	service := result.Providers[indexOf(result.Providers, "NewService")]
+	assert.Equal(t, zapLogger, service.Dependencies[0].Type)
+	assert.Equal(t, "Log", parsed.Providers[1].Dependencies[0].Type.Name, "input must not be mutated")
+	assert.Contains(t, result.Imports, "go.uber.org/zap")
+	assert.NotContains(t, result.Imports, "pkg/helper")
+}
+
+func TestAnalyze_RequestScope(t *testing.T) {
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	user := types.TypeRef{Name: "User", ImportPath: "pkg/auth", IsPointer: true}
+	request := types.TypeRef{Name: "Request", ImportPath: "net/http", IsPointer: true}
+	ctx := types.TypeRef{Name: "Context", ImportPath: "context"}
+
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewDB", Kind: types.ProviderKindFunc, ProvidedType: db, ImportPath: "pkg/db", VarName: "db"},
+			{
+				Name:         "CurrentUser",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: user,
+				Dependencies: []types.Dependency{{Type: ctx}, {Type: db}, {Type: request}},
+				ImportPath:   "pkg/auth",
+				VarName:      "user",
+				Scope:        types.ScopeRequest,
+			},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 1)
+	assert.Equal(t, "NewDB", result.Providers[0].Name)
+	require.Len(t, result.RequestProviders, 1)
+	assert.Equal(t, "CurrentUser", result.RequestProviders[0].Name)
+	assert.Equal(t, []types.TypeRef{request}, result.RequestParams)
+}
+
+func TestAnalyze_SingletonDependsOnRequestScope(t *testing.T) {
+	user := types.TypeRef{Name: "User", ImportPath: "pkg/auth", IsPointer: true}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "CurrentUser", ProvidedType: user, ImportPath: "pkg/auth", Scope: types.ScopeRequest},
+			{
+				Name:         "NewAudit",
+				ProvidedType: types.TypeRef{Name: "Audit", ImportPath: "pkg/audit", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: user}},
+				ImportPath:   "pkg/audit",
+			},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Greet", Dependencies: []types.TypeRef{user}, ImportPath: "pkg/cmd"},
+		},
+	}
+
+	_, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NewAudit requires request-scoped *pkg/auth.User (CurrentUser)")
+	assert.Contains(t, err.Error(), "Greet requires request-scoped *pkg/auth.User (CurrentUser)")
+}
+
+func TestAnalyze_TransientScope(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	conn := types.TypeRef{Name: "Conn", ImportPath: "pkg/db", IsPointer: true}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+			{
+				Name:         "NewConn",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: conn,
+				Dependencies: []types.Dependency{{Type: config}},
+				ImportPath:   "pkg/db",
+				VarName:      "conn",
+				Scope:        types.ScopeTransient,
+				Pure:         true,
+			},
+			{
+				Name:         "NewWorker",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Worker", ImportPath: "pkg/jobs", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: conn}},
+				ImportPath:   "pkg/jobs",
+				VarName:      "worker",
+			},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, "NewConfig", result.Providers[0].Name)
+	assert.Equal(t, "NewWorker", result.Providers[1].Name)
+	require.Len(t, result.TransientProviders, 1)
+	assert.Equal(t, "NewConn", result.TransientProviders[0].Name)
+	assert.Empty(t, result.Diagnostics, "transient providers are not reported as pure")
+
+	parsed.Providers[1].HasCleanup = true
+	_, err = Analyze(parsed, &mockResolver{}, Options{})
+	assert.EqualError(t, err, "transient providers cannot return a cleanup function, since nothing owns their instances: NewConn")
+}
+
+func TestAnalyze_WeakScope(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	cache := types.TypeRef{Name: "Cache", ImportPath: "pkg/cache", IsPointer: true}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+			{
+				Name:         "NewCache",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: cache,
+				Dependencies: []types.Dependency{{Type: config}},
+				ImportPath:   "pkg/cache",
+				VarName:      "cache",
+				Scope:        types.ScopeWeak,
+			},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 1)
+	require.Len(t, result.WeakProviders, 1)
+	assert.Equal(t, "NewCache", result.WeakProviders[0].Name)
+
+	parsed.Invocations = []types.Invocation{{Name: "Warm", ImportPath: "pkg/cache", Dependencies: []types.TypeRef{cache}}}
+	parsed.Providers[1].HasCleanup = true
+	parsed.Providers[1].ProvidedType.IsPointer = false
+	parsed.Invocations[0].Dependencies[0].IsPointer = false
+	_, err = Analyze(parsed, &mockResolver{}, Options{})
+	assert.EqualError(t, err, `invalid weak providers, which are only reachable through their App accessor:
+  NewCache returns a cleanup function, but nothing owns weak instances
+  NewCache provides pkg/cache.Cache, but weak providers must provide a pointer
+  Warm requires weak pkg/cache.Cache (NewCache)`)
+}
+
+func TestAnalyze_LazyScope(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	model := types.TypeRef{Name: "Model", ImportPath: "pkg/ml", IsPointer: true}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+			{
+				Name:         "LoadModel",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: model,
+				Dependencies: []types.Dependency{{Type: config}},
+				ImportPath:   "pkg/ml",
+				VarName:      "model",
+				Scope:        types.ScopeLazy,
+			},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 1)
+	require.Len(t, result.LazyProviders, 1)
+	assert.Equal(t, "LoadModel", result.LazyProviders[0].Name)
+
+	predictor := types.TypeRef{Name: "Predictor", ImportPath: "pkg/api", IsPointer: true}
+	withConsumers := *parsed
+	withConsumers.Providers = append(slices.Clone(parsed.Providers), types.Provider{
+		Name: "NewPredictor", Kind: types.ProviderKindFunc, ProvidedType: predictor, ImportPath: "pkg/api", VarName: "predictor",
+		Dependencies: []types.Dependency{{Type: types.Accessor(model, false)}},
+	})
+	withConsumers.Invocations = []types.Invocation{{Name: "Warm", ImportPath: "pkg/ml", Dependencies: []types.TypeRef{types.Accessor(model, true)}}}
+	result, err = Analyze(&withConsumers, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, "NewPredictor", result.Providers[1].Name)
+
+	withConsumers.Providers[1].CanError = true
+	_, err = Analyze(&withConsumers, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "NewPredictor requires func() *pkg/ml.Model")
+
+	parsed.Invocations = []types.Invocation{{Name: "Predict", ImportPath: "pkg/ml", Dependencies: []types.TypeRef{model}}}
+	parsed.Providers[1].HasCleanup = true
+	_, err = Analyze(parsed, &mockResolver{}, Options{})
+	assert.EqualError(t, err, `invalid lazy providers, which are only built on first use through their accessor:
+  LoadModel returns a cleanup function, but lazy instances are built after the cleanup function is returned
+  Predict requires lazy *pkg/ml.Model (LoadModel); depend on its accessor func() *pkg/ml.Model instead`)
+}
+
+func TestAnalyze_Args(t *testing.T) {
+	args := types.TypeRef{Name: "string", IsSlice: true, Qualifier: "args"}
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, ImportPath: "pkg/db", VarName: "db"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Run", ImportPath: "pkg/cli", Dependencies: []types.TypeRef{db, args}},
+		},
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{Builtins: BuiltinPolicyForbid})
+	require.NoError(t, err)
+	assert.True(t, result.UsesArgs)
+	assert.Empty(t, result.Diagnostics)
+
+	withProvider := *parsed
+	withProvider.Providers = append(withProvider.Providers, types.Provider{Name: "Args", Kind: types.ProviderKindFunc, ProvidedType: args, ImportPath: "pkg/cli", VarName: "args"})
+	result, err = Analyze(&withProvider, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.False(t, result.UsesArgs, "a provider named args takes precedence")
+
+	fromProvider := *parsed
+	fromProvider.Providers = []types.Provider{
+		{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, Dependencies: []types.Dependency{{Type: args}}, ImportPath: "pkg/db", VarName: "db"},
+	}
+	_, err = Analyze(&fromProvider, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "Open requires []string@args")
+}
+
+func TestAnalyze_Context(t *testing.T) {
+	ctx := types.TypeRef{Name: "Context", ImportPath: "context"}
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	tests := []struct {
+		name     string
+		parsed   *types.ParseResult
+		expected bool
+	}{
+		{
+			name: "singleton",
+			parsed: &types.ParseResult{
+				Providers: []types.Provider{
+					{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, Dependencies: []types.Dependency{{Type: ctx}}, ImportPath: "pkg/db", VarName: "db"},
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "invocation",
+			parsed: &types.ParseResult{
+				Providers: []types.Provider{
+					{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, ImportPath: "pkg/db", VarName: "db"},
+				},
+				Invocations: []types.Invocation{
+					{Name: "Migrate", ImportPath: "pkg/db", Dependencies: []types.TypeRef{ctx, db}},
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "request scope only",
+			parsed: &types.ParseResult{
+				Providers: []types.Provider{
+					{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, Dependencies: []types.Dependency{{Type: ctx}}, ImportPath: "pkg/db", VarName: "db", Scope: types.ScopeRequest},
+				},
+			},
+		},
+		{
+			name: "explicit provider",
+			parsed: &types.ParseResult{
+				Providers: []types.Provider{
+					{Name: "NewContext", Kind: types.ProviderKindFunc, ProvidedType: ctx, ImportPath: "pkg/app", VarName: "context"},
+					{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, Dependencies: []types.Dependency{{Type: ctx}}, ImportPath: "pkg/db", VarName: "db"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Analyze(tt.parsed, &mockResolver{}, Options{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.UsesContext)
+		})
+	}
+}
+
+func TestPurityHints(t *testing.T) {
+	providers := []types.Provider{
+		{Name: "NewConfig", ProvidedType: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}, Pure: true},
+		{Name: "NewDB", ProvidedType: types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}},
+		{Name: "handlers", Kind: types.ProviderKindGroup, Pure: true},
+	}
+
+	hints := purityHints(providers)
+	require.Len(t, hints, 1)
+	assert.Equal(t, diag.SeverityInfo, hints[0].Severity)
+	assert.Equal(t, "pure-provider", hints[0].Code)
+	assert.Contains(t, hints[0].Message, "NewConfig has no dependencies and no observable side effects")
+}
+
+func TestConsolidationHints(t *testing.T) {
+	client := func(name string) types.TypeRef {
+		return types.TypeRef{Name: "Client", ImportPath: "github.com/redis/go-redis", IsPointer: true, Qualifier: name}
+	}
+	config := types.TypeRef{Name: "Config", ImportPath: "example.com/app/config", IsPointer: true}
+	other := types.TypeRef{Name: "Other", ImportPath: "example.com/app/config", IsPointer: true}
+	local := func(name string) types.TypeRef {
+		return types.TypeRef{Name: "Store", ImportPath: "example.com/app/store", IsPointer: true, Qualifier: name}
+	}
+	providers := []types.Provider{
+		{Name: "NewCache", ProvidedType: client("cache"), Dependencies: []types.Dependency{{Type: config}}, Pos: types.Position{File: "cache.go", Line: 3}},
+		{Name: "NewSessions", ProvidedType: client("sessions"), Dependencies: []types.Dependency{{Type: config}}},
+		{Name: "NewQueue", ProvidedType: client("queue"), Dependencies: []types.Dependency{{Type: other}}},
+		{Name: "NewPrimary", ProvidedType: local("primary")},
+		{Name: "NewReplica", ProvidedType: local("replica")},
+		{Name: "NewGrouped", ProvidedType: client(""), Group: "clients"},
+		{Name: "Lookup", ProvidedType: types.TypeRef{Name: "string", Qualifier: "a"}},
+		{Name: "Lookup2", ProvidedType: types.TypeRef{Name: "string", Qualifier: "b"}},
+	}
+	scanned := map[string]string{"example.com/app/config": "config", "example.com/app/store": "store"}
+
+	hints := consolidationHints(providers, scanned)
+	require.Len(t, hints, 1)
+	assert.Equal(t, diag.SeverityInfo, hints[0].Severity)
+	assert.Equal(t, "provider-consolidation", hints[0].Code)
+	assert.Equal(t, "cache.go", hints[0].File)
+	assert.Equal(t, 3, hints[0].Line)
+	assert.Equal(t, "*github.com/redis/go-redis.Client is constructed by 3 providers: NewCache (name=cache), NewSessions (name=sessions), NewQueue (name=queue); "+
+		"NewCache and NewSessions take the same dependencies and likely build identical instances; "+
+		"consolidate them into one provider, or give each a name that says why it is separate", hints[0].Message)
+
+	assert.Empty(t, consolidationHints(providers[:1], scanned))
+}
+
+func TestAnalyze_Profiles(t *testing.T) {
+	store := types.TypeRef{Name: "Store", ImportPath: "pkg/store"}
+	check := types.TypeRef{Name: "Check", ImportPath: "pkg/health"}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewFake", Kind: types.ProviderKindFunc, ProvidedType: store, ImportPath: "pkg/fake", VarName: "store"},
+			{Name: "NewPostgres", Kind: types.ProviderKindFunc, ProvidedType: store, ImportPath: "pkg/postgres", VarName: "store", Profile: "integration"},
+			{Name: "NewRedis", Kind: types.ProviderKindFunc, ProvidedType: store, ImportPath: "pkg/redis", VarName: "store", Profile: "staging"},
+			{Name: "PingFake", Kind: types.ProviderKindFunc, ProvidedType: check, ImportPath: "pkg/fake", VarName: "check", Group: "checks"},
+			{Name: "PingPostgres", Kind: types.ProviderKindFunc, ProvidedType: check, ImportPath: "pkg/postgres", VarName: "check", Group: "checks", Profile: "integration"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{store, {Name: "Check", ImportPath: "pkg/health", IsSlice: true}}},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	tests := []struct {
+		profile     string
+		wantStore   string
+		wantMembers []string
+		errMsg      string
+	}{
+		{profile: "", wantStore: "NewFake", wantMembers: []string{"PingFake"}},
+		{profile: "integration", wantStore: "NewPostgres", wantMembers: []string{"PingFake", "PingPostgres"}},
+		{profile: "staging", wantStore: "NewRedis", wantMembers: []string{"PingFake"}},
+		{profile: "e2e", errMsg: "no providers are marked profile=e2e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			result, err := Analyze(parsed, &mockResolver{}, Options{Profile: tt.profile})
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"integration", "staging"}, result.Profiles)
+
+			var stores, members []string
+			for _, p := range result.Providers {
+				if p.ProvidedType.Key() == store.Key() {
+					stores = append(stores, p.Name)
+				}
+				if p.Kind == types.ProviderKindGroup {
+					for _, m := range p.Members {
+						members = append(members, m.Name)
+					}
+				}
+			}
+			assert.Equal(t, []string{tt.wantStore}, stores)
+			assert.Equal(t, tt.wantMembers, members)
+		})
+	}
+}
+
+func TestAnalyze_Containers(t *testing.T) {
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	server := types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true}
+	queue := types.TypeRef{Name: "Queue", ImportPath: "pkg/queue", IsPointer: true}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewDB", Kind: types.ProviderKindFunc, ProvidedType: db, ImportPath: "pkg/db", VarName: "db"},
+			{Name: "NewServer", Kind: types.ProviderKindFunc, ProvidedType: server, Dependencies: []types.Dependency{{Type: db}}, ImportPath: "pkg/http", VarName: "server", Containers: []string{"api"}},
+			{Name: "NewQueue", Kind: types.ProviderKindFunc, ProvidedType: queue, Dependencies: []types.Dependency{{Type: db}}, ImportPath: "pkg/queue", VarName: "queue", Containers: []string{"worker", "cli"}},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{server}, ImportPath: "pkg/http", Containers: []string{"api"}},
+			{Name: "Consume", Dependencies: []types.TypeRef{queue}, ImportPath: "pkg/queue", Containers: []string{"worker"}},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	tests := []struct {
+		container       string
+		wantProviders   []string
+		wantInvocations []string
+		errMsg          string
+	}{
+		{container: "", wantProviders: []string{"NewDB"}},
+		{container: "api", wantProviders: []string{"NewDB", "NewServer"}, wantInvocations: []string{"Serve"}},
+		{container: "worker", wantProviders: []string{"NewDB", "NewQueue"}, wantInvocations: []string{"Consume"}},
+		{container: "cli", wantProviders: []string{"NewDB", "NewQueue"}},
+		{container: "cron", errMsg: "no providers or invocations are marked container=cron"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.container, func(t *testing.T) {
+			result, err := Analyze(parsed, &mockResolver{}, Options{Container: tt.container})
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			var providers, invocations []string
+			for _, p := range result.Providers {
+				providers = append(providers, p.Name)
+			}
+			for _, inv := range result.Invocations {
+				invocations = append(invocations, inv.Name)
+			}
+			assert.Equal(t, tt.wantProviders, providers)
+			assert.Equal(t, tt.wantInvocations, invocations)
+		})
+	}
+
+	unmarked := &types.ParseResult{Providers: parsed.Providers[:1], OutputPackage: "main"}
+	result, err := Analyze(unmarked, &mockResolver{}, Options{Container: "worker"})
+	require.NoError(t, err, "containers only filter when annotations use them")
+	assert.Len(t, result.Providers, 1)
+}
+
+func TestAnalyze_InvocationFilter(t *testing.T) {
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	server := types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true}
+	queue := types.TypeRef{Name: "Queue", ImportPath: "pkg/queue", IsPointer: true}
+	check := types.TypeRef{Name: "Check", ImportPath: "pkg/health"}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewDB", Kind: types.ProviderKindFunc, ProvidedType: db, ImportPath: "pkg/db", VarName: "db"},
+			{Name: "NewServer", Kind: types.ProviderKindFunc, ProvidedType: server, Dependencies: []types.Dependency{{Type: db}}, ImportPath: "pkg/http", VarName: "server"},
+			{Name: "NewQueue", Kind: types.ProviderKindFunc, ProvidedType: queue, ImportPath: "pkg/queue", VarName: "queue"},
+			{Name: "PingDB", Kind: types.ProviderKindFunc, ProvidedType: check, Dependencies: []types.Dependency{{Type: db}}, ImportPath: "pkg/health", VarName: "pingDB", Group: "checks"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{server}, ImportPath: "pkg/http"},
+			{Name: "Consume", Dependencies: []types.TypeRef{queue}, ImportPath: "pkg/queue"},
+			{Name: "Report", Dependencies: []types.TypeRef{check}, ImportPath: "pkg/health", Collector: "checks"},
+		},
+		PackageNames:     map[string]string{"pkg/http": "httpapi"},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	tests := []struct {
+		name            string
+		only            []string
+		skip            []string
+		wantProviders   []string
+		wantInvocations []string
+		errMsg          string
+	}{
+		{name: "unfiltered", wantProviders: []string{"NewDB", "NewQueue", "NewServer", "PingDB", "checks"}, wantInvocations: []string{"Report", "Serve", "Consume"}},
+		{name: "only by name", only: []string{"Consume"}, wantProviders: []string{"NewQueue"}, wantInvocations: []string{"Consume"}},
+		{name: "only by package name", only: []string{"httpapi.Serve"}, wantProviders: []string{"NewDB", "NewServer"}, wantInvocations: []string{"Serve"}},
+		{name: "only collector", only: []string{"pkg/health.Report"}, wantProviders: []string{"NewDB", "PingDB", "checks"}, wantInvocations: []string{"Report"}},
+		{name: "skip", skip: []string{"Serve", "Report"}, wantProviders: []string{"NewQueue"}, wantInvocations: []string{"Consume"}},
+		{name: "only and skip", only: []string{"Serve", "Consume"}, skip: []string{"Consume"}, wantProviders: []string{"NewDB", "NewServer"}, wantInvocations: []string{"Serve"}},
+		{name: "unknown", only: []string{"http.Serve"}, errMsg: "--only-invoke http.Serve matches no invocation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Analyze(parsed, &mockResolver{}, Options{OnlyInvoke: tt.only, SkipInvoke: tt.skip})
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			var providers, invocations []string
+			for _, p := range result.Providers {
+				providers = append(providers, p.Name)
+			}
+			for _, inv := range result.Invocations {
+				invocations = append(invocations, inv.Name)
+			}
+			assert.ElementsMatch(t, tt.wantProviders, providers)
+			assert.Equal(t, tt.wantInvocations, invocations)
+		})
+	}
+}
+
+func TestAnalyze_FilteredProviders(t *testing.T) {
+	store := types.TypeRef{Name: "Store", ImportPath: "pkg/store", IsPointer: true}
+	queue := types.TypeRef{Name: "Queue", ImportPath: "pkg/queue", IsPointer: true}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewPostgres", Kind: types.ProviderKindFunc, ProvidedType: store, ImportPath: "pkg/postgres", VarName: "store", Profile: "integration", Pos: types.Position{File: "postgres.go", Line: 12}},
+			{Name: "NewFake", Kind: types.ProviderKindFunc, ProvidedType: store, ImportPath: "pkg/fake", VarName: "store", Profile: "staging"},
+			{Name: "NewQueue", Kind: types.ProviderKindFunc, ProvidedType: queue, ImportPath: "pkg/queue", VarName: "queue", Containers: []string{"worker"}},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{store, queue}, ImportPath: "pkg/http", Containers: []string{"api"}},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	tests := []struct {
+		name      string
+		opts      Options
+		wantLines []string
+	}{
+		{
+			name: "no profile",
+			opts: Options{Container: "api"},
+			wantLines: []string{
+				"Serve requires *pkg/store.Store, but its provider NewFake is excluded by profile=staging while no profile is active; its provider NewPostgres (postgres.go:12) is excluded by profile=integration while no profile is active",
+				"Serve requires *pkg/queue.Queue, but its provider NewQueue is excluded by container=worker while the selected container is api",
+			},
+		},
+		{
+			name: "other profile",
+			opts: Options{Profile: "integration", Container: "api"},
+			wantLines: []string{
+				"Serve requires *pkg/queue.Queue, but its provider NewQueue is excluded by container=worker while the selected container is api",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Analyze(parsed, &mockResolver{}, tt.opts)
+			require.Error(t, err)
+			for _, line := range tt.wantLines {
+				assert.ErrorContains(t, err, line)
+			}
+		})
+	}
+}
+
+func TestAnalyze_Defaults(t *testing.T) {
+	store := types.TypeRef{Name: "Store", ImportPath: "pkg/store"}
+	postgres := types.TypeRef{Name: "Store", ImportPath: "pkg/postgres", IsPointer: true}
+	memory := types.TypeRef{Name: "Store", ImportPath: "pkg/memory", IsPointer: true}
+	service := types.Provider{
+		Name:         "NewService",
+		Kind:         types.ProviderKindFunc,
+		ProvidedType: types.TypeRef{Name: "Service", ImportPath: "pkg/svc", IsPointer: true},
+		Dependencies: []types.Dependency{{Type: store}},
+		ImportPath:   "pkg/svc",
+		VarName:      "service",
+	}
+	postgresProvider := types.Provider{Name: "NewPostgres", Kind: types.ProviderKindFunc, ProvidedType: postgres, ImportPath: "pkg/postgres", VarName: "store"}
+	defaults := []types.Binding{{Interface: store, Target: postgres}}
+
+	tests := []struct {
+		name      string
+		providers []types.Provider
+		defaults  []types.Binding
+		wantDep   types.TypeRef
+		errMsg    string
+	}{
+		{
+			name:      "default applies without explicit binding",
+			providers: []types.Provider{postgresProvider, service},
+			defaults:  defaults,
+			wantDep:   postgres,
+		},
+		{
+			name: "explicit binding wins",
+			providers: []types.Provider{
+				postgresProvider,
+				{Name: "NewMemory", Kind: types.ProviderKindFunc, ProvidedType: store, ImportPath: "pkg/memory", VarName: "memory"},
+				service,
+			},
+			defaults: defaults,
+			wantDep:  store,
+		},
+		{
+			name:      "default target without provider",
+			providers: []types.Provider{service},
+			defaults:  defaults,
+			errMsg:    "default for pkg/store.Store: no provider for *pkg/postgres.Store",
+		},
+		{
+			name:      "conflicting defaults",
+			providers: []types.Provider{postgresProvider, service},
+			defaults:  append(defaults, types.Binding{Interface: store, Target: memory}),
+			errMsg:    "conflicting defaults for pkg/store.Store",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := &types.ParseResult{
+				Providers:        tt.providers,
+				Defaults:         tt.defaults,
+				OutputPackage:    "main",
+				OutputImportPath: "example.com/app",
+			}
+
+			result, err := Analyze(parsed, &mockResolver{}, Options{})
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			svc := result.Providers[indexOf(result.Providers, "NewService")]
+			assert.Equal(t, tt.wantDep, svc.Dependencies[0].Type)
+		})
+	}
+}
+
+func TestErrorChainWarnings(t *testing.T) {
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	dbProvider := types.Provider{Name: "NewDB", ProvidedType: db, CanError: true}
+
+	tests := []struct {
+		name        string
+		providers   []types.Provider
+		invocations []types.Invocation
+		wantWarning string
+	}{
+		{
+			name:      "only consumed by non-error invocations",
+			providers: []types.Provider{dbProvider},
+			invocations: []types.Invocation{
+				{Name: "Migrate", Dependencies: []types.TypeRef{db}},
+				{Name: "Seed", Dependencies: []types.TypeRef{db}},
+			},
+			wantWarning: "NewDB can fail but is only consumed by Migrate, Seed, which cannot return an error; consider returning an error from Migrate or Seed",
+		},
+		{
+			name:      "consumed by error invocation",
+			providers: []types.Provider{dbProvider},
+			invocations: []types.Invocation{
+				{Name: "Migrate", Dependencies: []types.TypeRef{db}, CanError: true},
+			},
+		},
+		{
+			name: "consumed by provider",
+			providers: []types.Provider{
+				dbProvider,
+				{Name: "NewRepo", Dependencies: []types.Dependency{{Type: db}}},
+			},
+			invocations: []types.Invocation{
+				{Name: "Migrate", Dependencies: []types.TypeRef{db}},
+			},
+		},
+		{
+			name:      "provider cannot fail",
+			providers: []types.Provider{{Name: "NewDB", ProvidedType: db}},
+			invocations: []types.Invocation{
+				{Name: "Migrate", Dependencies: []types.TypeRef{db}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := errorChainWarnings(tt.providers, tt.invocations)
+			if tt.wantWarning == "" {
+				assert.Empty(t, warnings)
+				return
+			}
+			require.Len(t, warnings, 1)
+			assert.Equal(t, diag.SeverityWarning, warnings[0].Severity)
+			assert.Equal(t, tt.wantWarning, warnings[0].Message)
+		})
+	}
+}
+
+func TestCheckBuiltins(t *testing.T) {
+	dsn := types.TypeRef{Name: "string"}
+	providers := []types.Provider{
+		{Name: "NewDSN", ProvidedType: dsn},
+		{
+			Name:         "NewDB",
+			ProvidedType: types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true},
+			Dependencies: []types.Dependency{{Type: dsn}},
+		},
+	}
+	invocations := []types.Invocation{
+		{Name: "Listen", Dependencies: []types.TypeRef{{Name: "int"}}},
+	}
+
+	tests := []struct {
+		name         string
+		providers    []types.Provider
+		policy       BuiltinPolicy
+		wantErr      []string
+		wantWarnings []string
+	}{
+		{
+			name:      "allow warns about unnamed dependencies",
+			providers: providers,
+			policy:    BuiltinPolicyAllow,
+			wantWarnings: []string{
+				"NewDB depends on unnamed builtin string; declare a named type to make the dependency explicit",
+				"Listen depends on unnamed builtin int; declare a named type to make the dependency explicit",
+			},
+		},
+		{
+			name:      "named-only rejects unnamed dependencies",
+			providers: providers,
+			policy:    BuiltinPolicyNamedOnly,
+			wantErr:   []string{"NewDB depends on unnamed builtin string", "Listen depends on unnamed builtin int"},
+		},
+		{
+			name:      "forbid also rejects builtin providers",
+			providers: providers[:1],
+			policy:    BuiltinPolicyForbid,
+			wantErr:   []string{"NewDSN provides unnamed builtin string", "Listen depends on unnamed builtin int"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := checkBuiltins(tt.providers, invocations, tt.policy)
+			if len(tt.wantErr) > 0 {
+				for _, want := range tt.wantErr {
+					assert.ErrorContains(t, err, want)
+				}
+				return
+			}
+			require.NoError(t, err)
+			var messages []string
+			for _, w := range warnings {
+				assert.Equal(t, "builtin-dependency", w.Code)
+				messages = append(messages, w.Message)
+			}
+			assert.Equal(t, tt.wantWarnings, messages)
+		})
+	}
+}
+
+func TestCheckBuiltins_NamedTypes(t *testing.T) {
+	dsn := types.TypeRef{Name: "DSN", ImportPath: "pkg/config"}
+	providers := []types.Provider{
+		{Name: "NewDSN", ProvidedType: dsn},
+		{
+			Name:         "NewDB",
+			ProvidedType: types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true},
+			Dependencies: []types.Dependency{{Type: dsn}},
+		},
+	}
+
+	for _, policy := range []BuiltinPolicy{BuiltinPolicyAllow, BuiltinPolicyNamedOnly, BuiltinPolicyForbid} {
+		warnings, err := checkBuiltins(providers, nil, policy)
+		require.NoError(t, err)
+		assert.Empty(t, warnings)
+	}
+}
+
+func TestCheckBuiltins_CompositeTypes(t *testing.T) {
+	counter := types.TypeRef{Func: &types.Signature{Results: []types.TypeRef{{Name: "int"}}}}
+	byID := types.TypeRef{Name: "User", ImportPath: "pkg/user", IsPointer: true, MapKey: &types.TypeRef{Name: "string"}}
+	byName := types.TypeRef{Name: "int", MapKey: &types.TypeRef{Name: "Name", ImportPath: "pkg/user"}}
+	users := types.TypeRef{Name: "User", ImportPath: "pkg/user", IsSlice: true}
+	providers := []types.Provider{
+		{Name: "NewCounter", ProvidedType: counter},
+		{Name: "NewIndex", ProvidedType: byID},
+		{Name: "NewLookup", ProvidedType: byName},
+		{Name: "NewUsers", ProvidedType: users},
+	}
+	invocations := []types.Invocation{
+		{Name: "Run", Dependencies: []types.TypeRef{counter, byID, byName, users}},
+	}
+
+	for _, policy := range []BuiltinPolicy{BuiltinPolicyAllow, BuiltinPolicyNamedOnly, BuiltinPolicyForbid} {
+		warnings, err := checkBuiltins(providers, invocations, policy)
+		require.NoError(t, err)
+		assert.Empty(t, warnings)
+	}
+
+	scores := types.TypeRef{Name: "int", MapKey: &types.TypeRef{Name: "string"}}
+	invocations[0].Dependencies = append(invocations[0].Dependencies, scores)
+	_, err := checkBuiltins(providers, invocations, BuiltinPolicyNamedOnly)
+	assert.ErrorContains(t, err, "Run depends on unnamed builtin map[string]int")
+}
+
+func TestChainWarnings(t *testing.T) {
+	ref := func(name string) types.TypeRef { return types.TypeRef{Name: name, ImportPath: "pkg/app"} }
+	provider := func(name string, deps ...string) types.Provider {
+		p := types.Provider{Name: "New" + name, ProvidedType: ref(name), ImportPath: "pkg/app"}
+		for _, dep := range deps {
+			p.Dependencies = append(p.Dependencies, types.Dependency{Type: ref(dep)})
+		}
+		return p
+	}
+
+	byType := make(map[string]types.Provider)
+	for _, p := range []types.Provider{
+		provider("Config"),
+		provider("DB", "Config"),
+		provider("Repo", "DB"),
+		provider("Service", "Repo", "Config"),
+		provider("Logger"),
+	} {
+		byType[p.ProvidedType.Key()] = p
+	}
+
+	tests := []struct {
+		name        string
+		invocation  types.Invocation
+		threshold   int
+		wantMessage string
+	}{
+		{
+			name:       "deep chain",
+			invocation: types.Invocation{Name: "Ping", Dependencies: []types.TypeRef{ref("Logger"), ref("Service"), ref("DB")}},
+			threshold:  1,
+			wantMessage: "Ping depends on provider chains longer than 1:\n" +
+				"  4 providers: NewService -> NewRepo -> NewDB -> NewConfig\n" +
+				"  2 providers: NewDB -> NewConfig",
+		},
+		{
+			name:       "within threshold",
+			invocation: types.Invocation{Name: "Ping", Dependencies: []types.TypeRef{ref("Service")}},
+			threshold:  4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := chainWarnings([]types.Invocation{tt.invocation}, byType, tt.threshold)
+			if tt.wantMessage == "" {
+				assert.Empty(t, warnings)
+				return
+			}
+			require.Len(t, warnings, 1)
+			assert.Equal(t, "deep-chain", warnings[0].Code)
+			assert.Equal(t, tt.wantMessage, warnings[0].Message)
+		})
+	}
+}
+
+func TestBuildGroups_KeepsDeclarationOrderOnRename(t *testing.T) {
+	handler := types.TypeRef{Name: "Handler", ImportPath: "pkg/http"}
+	member := func(name string) types.Provider {
+		return types.Provider{Name: name, ProvidedType: handler, ImportPath: "pkg/http", Group: "handlers"}
+	}
+
+	for _, names := range [][]string{{"NewB", "NewA"}, {"NewB", "ZNewA"}} {
+		groups, err := buildGroups([]types.Provider{member(names[0]), member(names[1])})
+		require.NoError(t, err)
+		require.Len(t, groups, 1)
+		assert.Equal(t, names[0], groups[0].Members[0].Name)
+		assert.Equal(t, names[1], groups[0].Members[1].Name)
+	}
+}
+
+func TestAnalyze_NamedProviders(t *testing.T) {
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	named := func(name string) types.TypeRef {
+		t := db
+		t.Qualifier = name
+		return t
+	}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewPrimary", Kind: types.ProviderKindFunc, ProvidedType: named("primaryDB"), ImportPath: "pkg/db", VarName: "primaryDB"},
+			{Name: "NewReplica", Kind: types.ProviderKindFunc, ProvidedType: named("replicaDB"), ImportPath: "pkg/db", VarName: "replicaDB"},
+			{
+				Name:         "NewRepo",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Repo", ImportPath: "pkg/repo", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: named("primaryDB")}, {Type: named("replicaDB")}},
+				ImportPath:   "pkg/repo",
+				VarName:      "repo",
+			},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 3)
+	assert.Equal(t, "NewRepo", result.Providers[2].Name)
+
+	parsed.Invocations = []types.Invocation{{Name: "Migrate", Dependencies: []types.TypeRef{db}}}
+	_, err = Analyze(parsed, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "Migrate requires *pkg/db.DB, which is ambiguous between primaryDB (NewPrimary) and replicaDB (NewReplica)")
+
+	parsed.Providers = parsed.Providers[:1]
+	_, err = Analyze(parsed, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "Migrate requires *pkg/db.DB, which is only provided as named primaryDB (NewPrimary); select it with //autowire:inject name=")
+}
+
+func TestCheckBuiltins_Qualified(t *testing.T) {
+	dsn := types.TypeRef{Name: "string", Qualifier: "dsn"}
+	providers := []types.Provider{
+		{Name: "NewDSN", ProvidedType: dsn},
+		{
+			Name:         "NewDB",
+			ProvidedType: types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true},
+			Dependencies: []types.Dependency{{Type: dsn}},
+		},
+	}
+
+	warnings, err := checkBuiltins(providers, nil, BuiltinPolicyNamedOnly)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	_, err = checkBuiltins(providers, nil, BuiltinPolicyForbid)
+	assert.ErrorContains(t, err, "NewDB depends on builtin string@dsn")
+}
+
+func TestCheckRules(t *testing.T) {
+	providers := []types.Provider{
+		{Name: "NewConfig", Kind: types.ProviderKindFunc, ImportPath: "example.com/app/config"},
+		{Name: "MakeServer", Kind: types.ProviderKindFunc, ImportPath: "example.com/app/http", Pos: types.Position{File: "http/server.go", Line: 12}},
+		{Name: "Handlers", Kind: types.ProviderKindStruct, ImportPath: "example.com/app/http/handlers"},
+		{Name: "Legacy", Kind: types.ProviderKindStruct, ImportPath: "example.com/app/legacy", Pos: types.Position{File: "legacy/legacy.go", Line: 3}},
+		{Name: "handlers", Kind: types.ProviderKindGroup},
+	}
+
+	tests := []struct {
+		name     string
+		rules    Rules
+		expected []string
+	}{
+		{name: "no rules"},
+		{
+			name:     "function prefix",
+			rules:    Rules{FuncPrefix: "New"},
+			expected: []string{"http/server.go:12: error: function provider MakeServer must be named New* [naming-rule]"},
+		},
+		{
+			name:     "struct packages",
+			rules:    Rules{StructPackages: []string{"example.com/app/http/..."}},
+			expected: []string{"legacy/legacy.go:3: error: struct provider Legacy is in example.com/app/legacy, but struct providers must be in example.com/app/http/... [naming-rule]"},
+		},
+		{
+			name:  "exact struct packages",
+			rules: Rules{StructPackages: []string{"example.com/app/http/handlers", "example.com/app/legacy"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range checkRules(providers, tt.rules) {
+				got = append(got, d.String())
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCheckUnexported(t *testing.T) {
+	const output = "example.com/app/cmd"
+	tests := []struct {
+		name     string
+		provider types.Provider
+		expected []string
+	}{
+		{
+			name: "unexported return type",
+			provider: types.Provider{
+				Name:         "NewThing",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "thing", ImportPath: "example.com/app/thing", IsPointer: true},
+				ImportPath:   "example.com/app/thing",
+				Pos:          types.Position{File: "thing/thing.go", Line: 7},
+			},
+			expected: []string{"thing/thing.go:7: error: NewThing returns unexported *example.com/app/thing.thing, so the generated code in example.com/app/cmd cannot refer to it; export thing or bind it to an exported interface with //autowire:provide <Interface> [unexported-type]"},
+		},
+		{
+			name: "unexported struct",
+			provider: types.Provider{
+				Name:         "server",
+				Kind:         types.ProviderKindStruct,
+				ProvidedType: types.TypeRef{Name: "server", ImportPath: "example.com/app/http", IsPointer: true},
+				ImportPath:   "example.com/app/http",
+			},
+			expected: []string{"error: struct provider *example.com/app/http.server is unexported, so the generated code in example.com/app/cmd cannot refer to it; export the type [unexported-type]"},
+		},
+		{
+			name: "bound to exported interface",
+			provider: types.Provider{
+				Name:         "NewThing",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Thing", ImportPath: "example.com/app/thing"},
+				Concrete:     types.TypeRef{Name: "thing", ImportPath: "example.com/app/thing", IsPointer: true},
+				ImportPath:   "example.com/app/thing",
+			},
+		},
+		{
+			name: "unexported embedded files",
+			provider: types.Provider{
+				Name:         "assets",
+				Kind:         types.ProviderKindVar,
+				ProvidedType: types.TypeRef{Name: "FS", ImportPath: "embed"},
+				ImportPath:   "example.com/app/web",
+				Pos:          types.Position{File: "web/assets.go", Line: 9},
+			},
+			expected: []string{"web/assets.go:9: error: variable assets is unexported, so the generated code in example.com/app/cmd cannot refer to it; export it (//go:embed works on exported variables too) [unexported-type]"},
+		},
+		{
+			name: "unexported variable in output package",
+			provider: types.Provider{
+				Name:         "assets",
+				Kind:         types.ProviderKindVar,
+				ProvidedType: types.TypeRef{Name: "FS", ImportPath: "embed"},
+				ImportPath:   output,
+			},
+		},
+		{
+			name: "output package",
+			provider: types.Provider{
+				Name:         "newFlags",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "flags", ImportPath: output, IsPointer: true},
+				ImportPath:   output,
+			},
+		},
+		{
+			name: "builtin",
+			provider: types.Provider{
+				Name:         "NewName",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "string"},
+				ImportPath:   "example.com/app/config",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range checkUnexported([]types.Provider{tt.provider}, output) {
+				got = append(got, d.String())
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCheckInvocationRoots(t *testing.T) {
+	invocations := []types.Invocation{
+		{Name: "Serve", ImportPath: "example.com/app/cmd/server"},
+		{Name: "Migrate", ImportPath: "example.com/app/internal/db", Pos: types.Position{File: "internal/db/migrate.go", Line: 8}},
+		{Name: "Run", ImportPath: "example.com/app/cmd"},
+	}
+
+	tests := []struct {
+		name     string
+		roots    []string
+		expected []string
+	}{
+		{name: "no roots"},
+		{
+			name:  "subpackages",
+			roots: []string{"example.com/app/cmd/..."},
+			expected: []string{
+				"internal/db/migrate.go:8: error: invocation Migrate is in example.com/app/internal/db, but invocations must be in example.com/app/cmd/...; move it to a composition root [invocation-root]",
+			},
+		},
+		{
+			name:  "exact packages",
+			roots: []string{"example.com/app/cmd", "example.com/app/internal/db"},
+			expected: []string{
+				"error: invocation Serve is in example.com/app/cmd/server, but invocations must be in example.com/app/cmd or example.com/app/internal/db; move it to a composition root [invocation-root]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range checkInvocationRoots(invocations, tt.roots) {
+				got = append(got, d.String())
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestAnalyze_Strict(t *testing.T) {
+	ref := func(name string, pointer bool) types.TypeRef {
+		return types.TypeRef{Name: name, ImportPath: "example.com/app/svc", IsPointer: pointer}
+	}
+	pos := func(line int) types.Position {
+		return types.Position{File: "svc.go", Line: line}
+	}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "Config", Kind: types.ProviderKindStruct, ProvidedType: ref("Config", true), VarName: "config", Pos: pos(1)},
+			{Name: "NewDB", Kind: types.ProviderKindFunc, ProvidedType: ref("DB", true), VarName: "db", Dependencies: []types.Dependency{{Type: ref("Config", true)}}, Pos: pos(2)},
+			{Name: "NewMetrics", Kind: types.ProviderKindFunc, ProvidedType: ref("Metrics", true), VarName: "metrics", Pos: pos(3)},
+			{Name: "NewFile", Kind: types.ProviderKindFunc, ProvidedType: ref("Store", false), Concrete: ref("File", true), VarName: "store", Pos: pos(4)},
+			{Name: "PingDB", Kind: types.ProviderKindFunc, ProvidedType: ref("Check", false), VarName: "check", Group: "checks", Dependencies: []types.Dependency{{Type: ref("DB", true)}}, Pos: pos(5)},
+			{Name: "NewSystemClock", Kind: types.ProviderKindFunc, ProvidedType: ref("SystemClock", true), VarName: "systemClock", Pos: pos(6)},
+			{Name: "NewLogger", Kind: types.ProviderKindFunc, ProvidedType: ref("Logger", false), VarName: "logger", Pos: pos(7)},
+			{Name: "NewJSONLogger", Kind: types.ProviderKindFunc, ProvidedType: ref("JSONLogger", true), VarName: "jsonLogger", Pos: pos(8)},
+			{Name: "CurrentUser", Kind: types.ProviderKindFunc, ProvidedType: ref("User", true), VarName: "user", Scope: types.ScopeRequest, Pos: pos(9)},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{ref("DB", true), ref("Logger", false), ref("JSONLogger", true)}},
+		},
+		Defaults: []types.Binding{
+			{Interface: ref("Clock", false), Target: ref("SystemClock", true)},
+			{Interface: ref("Logger", false), Target: ref("JSONLogger", true)},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Diagnostics)
+
+	result, err = Analyze(parsed, &mockResolver{}, Options{Strict: true})
+	require.NoError(t, err)
+
+	var got []string
+	for _, d := range result.Diagnostics {
+		assert.Equal(t, diag.SeverityError, d.Severity)
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		"error: default example.com/app/svc.Clock -> *example.com/app/svc.SystemClock is never used; nothing depends on example.com/app/svc.Clock [unused-default]",
+		"svc.go:7: error: default example.com/app/svc.Logger -> *example.com/app/svc.JSONLogger is shadowed by NewLogger, which provides example.com/app/svc.Logger explicitly [shadowed-default]",
+		"svc.go:3: error: NewMetrics provides *example.com/app/svc.Metrics, but no provider or invocation depends on it [unused-provider]",
+		"svc.go:4: error: NewFile binds *example.com/app/svc.File to example.com/app/svc.Store, but no provider or invocation depends on example.com/app/svc.Store [unused-binding]",
+		"svc.go:6: error: NewSystemClock provides *example.com/app/svc.SystemClock, but no provider or invocation depends on it [unused-provider]",
+		"svc.go:5: error: group checks is never collected; no provider or invocation depends on []example.com/app/svc.Check [unused-provider]",
+	}, got)
+}
+
+func TestAnalyze_Externals(t *testing.T) {
+	ref := func(name string) types.TypeRef {
+		return types.TypeRef{Name: name, ImportPath: "example.com/app/svc", IsPointer: true}
+	}
+	external := func(name, varName string) types.External {
+		return types.External{Type: ref(name), VarName: varName, Pos: types.Position{File: "wire.go", Line: 1}}
+	}
+	deps := func(names ...string) []types.Dependency {
+		var deps []types.Dependency
+		for _, name := range names {
+			deps = append(deps, types.Dependency{Type: ref(name)})
+		}
+		return deps
+	}
+
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "NewDB", Kind: types.ProviderKindFunc, ProvidedType: ref("DB"), VarName: "db", Dependencies: deps("Logger")},
+			{Name: "NewAuditLogger", Kind: types.ProviderKindFunc, ProvidedType: ref("AuditLogger"), VarName: "logger", Dependencies: deps("DB")},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{ref("AuditLogger"), ref("Tracer")}},
+		},
+		Externals:        []types.External{external("Tracer", "tracer"), external("Unused", "unused"), external("Logger", "logger"), external("Logger", "logger")},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []types.External{external("Tracer", "tracer"), external("Logger", "logger")}, result.Externals)
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, "logger1", result.Providers[1].VarName)
+	assert.Empty(t, result.Diagnostics)
+
+	result, err = Analyze(parsed, &mockResolver{}, Options{Strict: true})
+	require.NoError(t, err)
+	require.Len(t, result.Diagnostics, 1)
+	assert.Equal(t, "wire.go:1: error: external *example.com/app/svc.Unused is never required; remove the declaration [unused-external]", result.Diagnostics[0].String())
+
+	tests := []struct {
+		name      string
+		providers []types.Provider
+		externals []types.External
+		errMsg    string
+	}{
+		{
+			name:      "also provided",
+			providers: []types.Provider{{Name: "NewLogger", ProvidedType: ref("Logger"), VarName: "logger"}},
+			externals: []types.External{external("Logger", "logger")},
+			errMsg:    "*example.com/app/svc.Logger (wire.go:1) is declared external but also provided by NewLogger",
+		},
+		{
+			name:      "context",
+			externals: []types.External{{Type: types.TypeRef{Name: "Context", ImportPath: "context"}, VarName: "ctx"}},
+			errMsg:    "context.Context is already supplied by the caller and cannot be declared external",
+		},
+		{
+			name:      "same parameter",
+			externals: []types.External{external("Logger", "logger"), {Type: types.TypeRef{Name: "Logger", ImportPath: "log", IsPointer: true}, VarName: "logger"}},
+			errMsg:    "externals *example.com/app/svc.Logger (wire.go:1) and *log.Logger both become the parameter logger; rename one with name=",
+		},
+		{
+			name:      "transient",
+			providers: []types.Provider{{Name: "NewConn", ProvidedType: ref("Conn"), VarName: "conn", Scope: types.ScopeTransient, Dependencies: deps("Logger")}},
+			externals: []types.External{external("Logger", "logger")},
+			errMsg:    "NewConn requires external *example.com/app/svc.Logger, but the App methods that build transient and weak providers do not receive it",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Analyze(&types.ParseResult{Providers: tt.providers, Externals: tt.externals}, &mockResolver{}, Options{})
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestAnalyze_LiteralDefaults(t *testing.T) {
+	server := types.TypeRef{Name: "Server", ImportPath: "example.com/app/svc", IsPointer: true}
+	port := types.TypeRef{Name: "int", Default: "8080"}
+	host := types.TypeRef{Name: "string", Qualifier: "host", Default: `"localhost"`}
+	parsed := &types.ParseResult{
+		Providers: []types.Provider{
+			{Name: "Server", Kind: types.ProviderKindStruct, ProvidedType: server, VarName: "server", Dependencies: []types.Dependency{{FieldName: "Port", Type: port}, {FieldName: "Host", Type: host}}},
+			{Name: "Host", Kind: types.ProviderKindVar, ProvidedType: types.TypeRef{Name: "string", Qualifier: "host"}, VarName: "host", ImportPath: "example.com/app/svc"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{server, {Name: "int", Default: "3"}}},
+		},
+		OutputPackage:    "main",
+		OutputImportPath: "example.com/app",
+	}
+
+	result, err := Analyze(parsed, &mockResolver{}, Options{Builtins: BuiltinPolicyNamedOnly})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, []types.Dependency{
+		{FieldName: "Port", Type: port},
+		{FieldName: "Host", Type: types.TypeRef{Name: "string", Qualifier: "host"}},
+	}, result.Providers[1].Dependencies)
+	assert.Equal(t, "3", result.Invocations[0].Dependencies[1].Default)
+	assert.Empty(t, result.Diagnostics)
+}
@@ -0,0 +1,119 @@
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/generator"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+const (
+	formatVersion = 1
+	manifestFile  = "manifest.json"
+	parsedFile    = "parsed.json"
+	packagesFile  = "packages.json"
+)
+
+type Settings struct {
+	ScanDirs   []string
+	OutDir     string
+	OutputName string
+	Prefixes   []string
+	Exclude    []string
+	ErrorTypes []string
+	Analyzer   analyzer.Options
+	Generator  generator.Options
+}
+
+type Bundle struct {
+	Settings Settings
+	Parsed   *types.ParseResult
+	Packages map[string]string
+}
+
+type manifest struct {
+	Version  int
+	Settings Settings
+}
+
+func Write(path string, b *Bundle) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	zw := zip.NewWriter(f)
+	entries := []struct {
+		name  string
+		value any
+	}{
+		{manifestFile, manifest{Version: formatVersion, Settings: b.Settings}},
+		{parsedFile, b.Parsed},
+		{packagesFile, b.Packages},
+	}
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(e.value); err != nil {
+			return fmt.Errorf("encoding %s: %w", e.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+func Read(path string) (*Bundle, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var m manifest
+	b := &Bundle{}
+	targets := map[string]any{
+		manifestFile: &m,
+		parsedFile:   &b.Parsed,
+		packagesFile: &b.Packages,
+	}
+	for name, target := range targets {
+		if err := decode(&zr.Reader, name, target); err != nil {
+			return nil, err
+		}
+	}
+	if m.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, expected %d", m.Version, formatVersion)
+	}
+	b.Settings = m.Settings
+	return b, nil
+}
+
+func decode(zr *zip.Reader, name string, target any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return nil
+}
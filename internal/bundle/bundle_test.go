@@ -0,0 +1,78 @@
+package bundle
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/generator"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	b := &Bundle{
+		Settings: Settings{
+			ScanDirs:   []string{"./internal"},
+			OutDir:     "./cmd",
+			OutputName: "app_gen.go",
+			Prefixes:   []string{"autowire", "di"},
+			Analyzer:   analyzer.Options{Builtins: analyzer.BuiltinPolicyForbid},
+			Generator:  generator.Options{DebugDump: true, FieldOrder: generator.FieldOrderPackage, Container: "worker"},
+		},
+		Parsed: &types.ParseResult{
+			Providers: []types.Provider{
+				{
+					Name:         "NewDatabase",
+					Kind:         types.ProviderKindFunc,
+					ProvidedType: types.TypeRef{Name: "Database", ImportPath: "pkg/db", IsPointer: true},
+					Dependencies: []types.Dependency{{Type: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}}},
+					CanError:     true,
+					ImportPath:   "pkg/db",
+					Scope:        types.ScopeRequest,
+				},
+			},
+			Invocations:      []types.Invocation{{Name: "Migrate", ImportPath: "pkg/db"}},
+			OutputPackage:    "main",
+			OutputImportPath: "example.com/app/cmd",
+		},
+		Packages: map[string]string{"pkg/db": "db"},
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	require.NoError(t, Write(path, b))
+
+	got, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, b, got)
+}
+
+func TestRead_UnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		manifestFile: `{"Version": 99}`,
+		parsedFile:   `{}`,
+		packagesFile: `{}`,
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	_, err = Read(path)
+	assert.ErrorContains(t, err, "unsupported bundle version 99")
+}
+
+func TestRead_MissingFile(t *testing.T) {
+	_, err := Read(filepath.Join(t.TempDir(), "missing.zip"))
+	assert.Error(t, err)
+}
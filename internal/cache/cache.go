@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/eloonstra/autowire/internal/parser"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/eloonstra/autowire/internal/xsync"
+)
+
+const (
+	Dir      = ".autowire"
+	fileName = "cache.json"
+	version  = 4
+)
+
+type entry struct {
+	Hash   string            `json:"hash"`
+	Deps   map[string]string `json:"deps,omitempty"`
+	Dirs   map[string]string `json:"dirs,omitempty"`
+	Result json.RawMessage   `json:"result"`
+}
+
+type data struct {
+	Version  int               `json:"version"`
+	Key      string            `json:"key"`
+	Modules  map[string]string `json:"modules"`
+	Names    map[string]string `json:"names"`
+	Packages map[string]entry  `json:"packages"`
+}
+
+type Cache struct {
+	path    string
+	data    data
+	touched map[string]bool
+	decoded xsync.ShardedMap[string, *types.ParseResult]
+	modTime time.Time
+}
+
+var opened xsync.ShardedMap[string, *Cache]
+
+func Open(root string) *Cache {
+	path := filepath.Join(root, Dir, fileName)
+	key := moduleKey(root)
+	if c, ok := opened.Load(path); ok && c.data.Key == key && c.modTime.Equal(modTime(path)) {
+		c.touched = make(map[string]bool)
+		return c
+	}
+
+	c := &Cache{
+		path:    path,
+		touched: make(map[string]bool),
+		modTime: modTime(path),
+	}
+	opened.Store(path, c)
+	if raw, err := os.ReadFile(c.path); err == nil {
+		if json.Unmarshal(raw, &c.data) == nil && c.data.Version == version && c.data.Key == key &&
+			c.data.Modules != nil && c.data.Names != nil && c.data.Packages != nil {
+			return c
+		}
+	}
+	c.data = data{
+		Version:  version,
+		Key:      key,
+		Modules:  make(map[string]string),
+		Names:    make(map[string]string),
+		Packages: make(map[string]entry),
+	}
+	return c
+}
+
+func ModuleRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func moduleKey(root string) string {
+	h := sha256.New()
+	h.Write([]byte(runtime.GOOS + "/" + runtime.GOARCH + "\x00" + os.Getenv("GOFLAGS") + "\x00"))
+	for _, name := range []string{"go.mod", "go.sum", "go.work", "go.work.sum"} {
+		content, _ := os.ReadFile(filepath.Join(root, name))
+		h.Write([]byte(name + "\x00"))
+		h.Write(content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (c *Cache) ModulePath(dir string) (string, bool) {
+	path, ok := c.data.Modules[dir]
+	return path, ok
+}
+
+func (c *Cache) SetModulePath(dir, importPath string) {
+	c.data.Modules[dir] = importPath
+}
+
+func (c *Cache) Package(importPath string) (parser.CachedPackage, bool) {
+	e, ok := c.data.Packages[importPath]
+	if !ok {
+		return parser.CachedPackage{}, false
+	}
+	result, ok := c.decoded.Load(importPath)
+	if !ok {
+		result = new(types.ParseResult)
+		if err := json.Unmarshal(e.Result, result); err != nil {
+			return parser.CachedPackage{}, false
+		}
+		c.decoded.Store(importPath, result)
+	}
+	c.touched[importPath] = true
+	return parser.CachedPackage{Hash: e.Hash, Deps: e.Deps, Dirs: e.Dirs, Result: result}, true
+}
+
+func (c *Cache) SetPackage(importPath string, pkg parser.CachedPackage) {
+	raw, err := json.Marshal(pkg.Result)
+	if err != nil {
+		delete(c.data.Packages, importPath)
+		c.decoded.Delete(importPath)
+		return
+	}
+	c.data.Packages[importPath] = entry{Hash: pkg.Hash, Deps: pkg.Deps, Dirs: pkg.Dirs, Result: raw}
+	c.decoded.Store(importPath, pkg.Result)
+	c.touched[importPath] = true
+}
+
+func (c *Cache) Names() map[string]string {
+	return c.data.Names
+}
+
+func (c *Cache) Save(names map[string]string) error {
+	for path := range c.data.Packages {
+		if !c.touched[path] {
+			delete(c.data.Packages, path)
+			c.decoded.Delete(path)
+		}
+	}
+	if names == nil {
+		names = make(map[string]string)
+	}
+	c.data.Names = names
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ignore := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(ignore); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(ignore, []byte("*\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	raw, err := json.Marshal(c.data)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, fileName+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.modTime = modTime(c.path)
+	return nil
+}
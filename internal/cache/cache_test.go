@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eloonstra/autowire/internal/parser"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGoMod(t *testing.T, dir, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte(content), 0644))
+}
+
+func reopen(dir string) *Cache {
+	opened.Delete(filepath.Join(dir, Dir, fileName))
+	return Open(dir)
+}
+
+func TestCache_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, "module example.com/app\n")
+
+	c := Open(dir)
+	_, ok := c.Package("example.com/app/a")
+	assert.False(t, ok)
+
+	result := &types.ParseResult{Providers: []types.Provider{{Name: "NewA", VarName: "a"}}}
+	c.SetPackage("example.com/app/a", parser.CachedPackage{Hash: "h1", Deps: map[string]string{"example.com/app/b": "h2"}, Dirs: map[string]string{"/src/models": "h3"}, Result: result})
+	c.SetPackage("example.com/app/b", parser.CachedPackage{Hash: "h2", Result: &types.ParseResult{}})
+	c.SetModulePath(dir, "example.com/app")
+	require.NoError(t, c.Save(map[string]string{"example.com/app/a": "a"}))
+
+	c = reopen(dir)
+	pkg, ok := c.Package("example.com/app/a")
+	require.True(t, ok)
+	assert.Equal(t, "h1", pkg.Hash)
+	assert.Equal(t, map[string]string{"example.com/app/b": "h2"}, pkg.Deps)
+	assert.Equal(t, map[string]string{"/src/models": "h3"}, pkg.Dirs)
+	assert.Equal(t, result, pkg.Result)
+	path, ok := c.ModulePath(dir)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com/app", path)
+	assert.Equal(t, map[string]string{"example.com/app/a": "a"}, c.Names())
+
+	require.NoError(t, c.Save(c.Names()))
+	c = reopen(dir)
+	_, ok = c.Package("example.com/app/b")
+	assert.False(t, ok, "packages not used in the last run are dropped")
+}
+
+func TestCache_ReusedWhileUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, "module example.com/app\n")
+
+	c := Open(dir)
+	result := &types.ParseResult{Providers: []types.Provider{{Name: "NewA", VarName: "a"}}}
+	c.SetPackage("example.com/app/a", parser.CachedPackage{Hash: "h1", Result: result})
+	require.NoError(t, c.Save(nil))
+
+	again := Open(dir)
+	assert.Same(t, c, again)
+	pkg, ok := again.Package("example.com/app/a")
+	require.True(t, ok)
+	assert.Same(t, result, pkg.Result, "decoded results are kept in memory")
+
+	path := filepath.Join(dir, Dir, fileName)
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, raw, 0644))
+	require.NoError(t, os.Chtimes(path, time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+
+	fresh := Open(dir)
+	assert.NotSame(t, c, fresh, "a cache file written by another process is reread")
+	pkg, ok = fresh.Package("example.com/app/a")
+	require.True(t, ok)
+	assert.Equal(t, result, pkg.Result)
+}
+
+func TestCache_InvalidatedByModuleChange(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, "module example.com/app\n")
+
+	c := Open(dir)
+	c.SetPackage("example.com/app/a", parser.CachedPackage{Hash: "h1", Result: &types.ParseResult{}})
+	require.NoError(t, c.Save(nil))
+
+	writeGoMod(t, dir, "module example.com/app\n\nrequire example.com/dep v1.0.0\n")
+	_, ok := Open(dir).Package("example.com/app/a")
+	assert.False(t, ok)
+}
+
+func TestCache_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, "module example.com/app\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, Dir), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, Dir, fileName), []byte("{not json"), 0644))
+
+	c := Open(dir)
+	_, ok := c.Package("example.com/app/a")
+	assert.False(t, ok)
+	require.NoError(t, c.Save(nil))
+}
+
+func TestModuleRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, "module example.com/app\n")
+	nested := filepath.Join(dir, "internal", "db")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+
+	root, ok := ModuleRoot(nested)
+	assert.True(t, ok)
+	assert.Equal(t, dir, root)
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var names = []string{"autowire.yaml", "autowire.yml", "autowire.toml"}
+
+var pathKeys = map[string]bool{
+	"scan":   true,
+	"out":    true,
+	"from":   true,
+	"ir":     true,
+	"record": true,
+	"replay": true,
+}
+
+var ignoredKeys = map[string]bool{
+	"config": true,
+	"help":   true,
+}
+
+func Find(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			for _, name := range names {
+				candidate := filepath.Join(dir, name)
+				if _, err := os.Stat(candidate); err == nil {
+					return candidate
+				}
+			}
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func Read(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]any)
+	if filepath.Ext(path) == ".toml" {
+		err = toml.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	return values, err
+}
+
+func Apply(flags *pflag.FlagSet, values map[string]any, base string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		flag := flags.Lookup(key)
+		if flag == nil || ignoredKeys[key] {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		if flag.Changed {
+			continue
+		}
+
+		items, err := toStrings(values[key])
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		for _, item := range items {
+			if pathKeys[key] && !filepath.IsAbs(item) {
+				item = filepath.Join(base, item)
+			}
+			if err := flags.Set(key, item); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func toStrings(value any) ([]string, error) {
+	switch v := value.(type) {
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := toScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, s)
+		}
+		return items, nil
+	default:
+		s, err := toScalar(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+}
+
+func toScalar(value any) (string, error) {
+	switch v := value.(type) {
+	case string, bool, int, int64, float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v: must be a string, number, boolean or list of those", value)
+}
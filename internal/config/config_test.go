@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "cmd", "server")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/app\n"), 0644))
+
+	assert.Empty(t, Find(nested))
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "autowire.toml"), nil, 0644))
+	assert.Equal(t, filepath.Join(root, "autowire.toml"), Find(nested))
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "autowire.yaml"), nil, 0644))
+	assert.Equal(t, filepath.Join(root, "autowire.yaml"), Find(nested))
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "yaml", file: "autowire.yaml", content: "scan:\n  - internal\n  - pkg\ncleanup: true\nchain-threshold: 4\n"},
+		{name: "toml", file: "autowire.toml", content: "scan = [\"internal\", \"pkg\"]\ncleanup = true\nchain-threshold = 4\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			values, err := Read(path)
+			require.NoError(t, err)
+
+			flags := testFlags()
+			require.NoError(t, Apply(flags, values, "/repo"))
+			scan, _ := flags.GetStringArray("scan")
+			assert.Equal(t, []string{"/repo/internal", "/repo/pkg"}, scan)
+			cleanup, _ := flags.GetBool("cleanup")
+			assert.True(t, cleanup)
+			threshold, _ := flags.GetInt("chain-threshold")
+			assert.Equal(t, 4, threshold)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		values  map[string]any
+		check   func(t *testing.T, flags *pflag.FlagSet)
+		wantErr string
+	}{
+		{
+			name:   "flags override file values",
+			args:   []string{"--name", "wire_gen.go"},
+			values: map[string]any{"name": "app_gen.go", "nolint": []any{"funlen", "gocyclo"}},
+			check: func(t *testing.T, flags *pflag.FlagSet) {
+				name, _ := flags.GetString("name")
+				assert.Equal(t, "wire_gen.go", name)
+				nolint, _ := flags.GetStringSlice("nolint")
+				assert.Equal(t, []string{"funlen", "gocyclo"}, nolint)
+			},
+		},
+		{
+			name:   "absolute paths are kept",
+			values: map[string]any{"out": "/abs/cmd"},
+			check: func(t *testing.T, flags *pflag.FlagSet) {
+				out, _ := flags.GetString("out")
+				assert.Equal(t, "/abs/cmd", out)
+			},
+		},
+		{
+			name:   "shard and bundle paths",
+			values: map[string]any{"from": []any{"shards/a.json", "/abs/b.json"}, "ir": "shards/c.json", "record": "bug.zip", "replay": "repro.zip"},
+			check: func(t *testing.T, flags *pflag.FlagSet) {
+				from, _ := flags.GetStringArray("from")
+				assert.Equal(t, []string{"/repo/shards/a.json", "/abs/b.json"}, from)
+				for key, expected := range map[string]string{"ir": "/repo/shards/c.json", "record": "/repo/bug.zip", "replay": "/repo/repro.zip"} {
+					value, _ := flags.GetString(key)
+					assert.Equal(t, expected, value, key)
+				}
+			},
+		},
+		{name: "unknown key", values: map[string]any{"scna": "internal"}, wantErr: `unknown key "scna"`},
+		{name: "config key", values: map[string]any{"config": "other.yaml"}, wantErr: `unknown key "config"`},
+		{name: "nested value", values: map[string]any{"out": map[string]any{"dir": "cmd"}}, wantErr: "out: unsupported value"},
+		{name: "invalid value", values: map[string]any{"cleanup": "sometimes"}, wantErr: "cleanup: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := testFlags()
+			require.NoError(t, flags.Parse(tt.args))
+
+			err := Apply(flags, tt.values, "/repo")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, flags)
+		})
+	}
+}
+
+func testFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("autowire", pflag.ContinueOnError)
+	flags.String("config", "", "")
+	flags.StringArray("scan", []string{"."}, "")
+	flags.String("out", ".", "")
+	flags.StringArray("from", nil, "")
+	flags.String("ir", "autowire.ir.json", "")
+	flags.String("record", "", "")
+	flags.String("replay", "", "")
+	flags.String("name", "app_gen.go", "")
+	flags.StringSlice("nolint", nil, "")
+	flags.Bool("cleanup", false, "")
+	flags.Int("chain-threshold", 0, "")
+	return flags
+}
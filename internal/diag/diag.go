@@ -0,0 +1,39 @@
+package diag
+
+import "fmt"
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	File     string
+	Line     int
+}
+
+func (d Diagnostic) String() string {
+	s := d.Severity.String() + ": " + d.Message + " [" + d.Code + "]"
+	if d.File != "" {
+		return fmt.Sprintf("%s:%d: %s", d.File, d.Line, s)
+	}
+	return s
+}
@@ -0,0 +1,33 @@
+package diag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeverity_String(t *testing.T) {
+	tests := []struct {
+		severity Severity
+		expected string
+	}{
+		{SeverityInfo, "info"},
+		{SeverityWarning, "warning"},
+		{SeverityError, "error"},
+		{Severity(42), "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.severity.String())
+		})
+	}
+}
+
+func TestDiagnostic_String(t *testing.T) {
+	d := Diagnostic{Severity: SeverityWarning, Code: "some-code", Message: "something happened"}
+	assert.Equal(t, "warning: something happened [some-code]", d.String())
+
+	d.File, d.Line = "store/db.go", 12
+	assert.Equal(t, "store/db.go:12: warning: something happened [some-code]", d.String())
+}
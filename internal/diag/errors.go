@@ -0,0 +1,95 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type List struct {
+	Title  string
+	Errors []error
+}
+
+func NewList(title string, items []string) *List {
+	l := &List{Title: title, Errors: make([]error, len(items))}
+	for i, item := range items {
+		l.Errors[i] = errors.New(item)
+	}
+	return l
+}
+
+func (l *List) Error() string {
+	lines := make([]string, len(l.Errors))
+	for i, err := range l.Errors {
+		lines[i] = strings.ReplaceAll(err.Error(), "\n", "\n  ")
+	}
+	return l.Title + ":\n  " + strings.Join(lines, "\n  ")
+}
+
+func (l *List) Unwrap() []error {
+	return l.Errors
+}
+
+func Count(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return 0
+	case interface{ Unwrap() []error }:
+		n := 0
+		for _, child := range e.Unwrap() {
+			n += Count(child)
+		}
+		return n
+	case interface{ Unwrap() error }:
+		if inner := e.Unwrap(); inner != nil {
+			return Count(inner)
+		}
+	}
+	return 1
+}
+
+func Truncate(err error, limit int) (error, int) {
+	if limit <= 0 {
+		return err, 0
+	}
+	return truncate(err, &limit)
+}
+
+func truncate(err error, budget *int) (error, int) {
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		var kept []error
+		omitted := 0
+		for _, child := range e.Unwrap() {
+			if *budget == 0 {
+				omitted += Count(child)
+				continue
+			}
+			t, o := truncate(child, budget)
+			kept = append(kept, t)
+			omitted += o
+		}
+		if omitted == 0 {
+			return err, 0
+		}
+		if l, ok := err.(*List); ok {
+			return &List{Title: l.Title, Errors: kept}, omitted
+		}
+		return errors.Join(kept...), omitted
+	case interface{ Unwrap() error }:
+		inner := e.Unwrap()
+		if inner == nil || !strings.HasSuffix(err.Error(), inner.Error()) {
+			*budget = max(*budget-Count(err), 0)
+			return err, 0
+		}
+		t, omitted := truncate(inner, budget)
+		if omitted == 0 {
+			return err, 0
+		}
+		prefix := strings.TrimSuffix(err.Error(), inner.Error())
+		return fmt.Errorf("%s%w", prefix, t), omitted
+	}
+	*budget--
+	return err, 0
+}
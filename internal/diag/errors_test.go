@@ -0,0 +1,97 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList_Error(t *testing.T) {
+	l := &List{Title: "missing dependencies", Errors: []error{
+		errors.New("a"),
+		errors.New("b\nc"),
+	}}
+
+	assert.Equal(t, "missing dependencies:\n  a\n  b\n  c", l.Error())
+	assert.Len(t, l.Unwrap(), 2)
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"nil", nil, 0},
+		{"single", errors.New("a"), 1},
+		{"list", NewList("t", []string{"a", "b", "c"}), 3},
+		{"join", errors.Join(errors.New("a"), NewList("t", []string{"b", "c"})), 3},
+		{"wrapped", fmt.Errorf("parsing x: %w", errors.Join(errors.New("a"), errors.New("b"))), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Count(tt.err))
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		limit    int
+		expected string
+		omitted  int
+	}{
+		{
+			name:     "no limit",
+			err:      NewList("t", []string{"a", "b", "c"}),
+			limit:    0,
+			expected: "t:\n  a\n  b\n  c",
+		},
+		{
+			name:     "under limit",
+			err:      NewList("t", []string{"a", "b"}),
+			limit:    2,
+			expected: "t:\n  a\n  b",
+		},
+		{
+			name:     "list",
+			err:      NewList("t", []string{"a", "b", "c"}),
+			limit:    2,
+			expected: "t:\n  a\n  b",
+			omitted:  1,
+		},
+		{
+			name:     "join across lists",
+			err:      errors.Join(errors.New("a"), NewList("t", []string{"b", "c"}), errors.New("d")),
+			limit:    2,
+			expected: "a\nt:\n  b",
+			omitted:  2,
+		},
+		{
+			name:     "wrapped",
+			err:      fmt.Errorf("parsing x: %w", errors.Join(errors.New("a"), errors.New("b"))),
+			limit:    1,
+			expected: "parsing x: a",
+			omitted:  1,
+		},
+		{
+			name:     "wrapped with suffix",
+			err:      fmt.Errorf("%w (see above)", errors.Join(errors.New("a"), errors.New("b"))),
+			limit:    1,
+			expected: "a\nb (see above)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err, omitted := Truncate(tt.err, tt.limit)
+			assert.EqualError(t, err, tt.expected)
+			assert.Equal(t, tt.omitted, omitted)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+)
+
+func Benchmark(r *analyzer.Result, opts Options) ([]byte, error) {
+	if opts.Partial {
+		return nil, fmt.Errorf("benchmark requires the generated initializer and is not available in partial mode")
+	}
+	if len(r.Externals) > 0 {
+		return nil, fmt.Errorf("benchmark cannot supply external %s; the initializer receives it from the caller", r.Externals[0].Type.Key())
+	}
+
+	syms := newSymbols(opts)
+	bench := "Benchmark" + syms.initialize
+	setup := "setup" + bench
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by autowire. DO NOT EDIT.\n\n")
+	buf.WriteString(buildConstraint(opts.Profile, r.Profiles))
+	buf.WriteString(fmt.Sprintf("package %s\n\n", r.PackageName))
+	if r.UsesContext {
+		buf.WriteString("import (\n\t\"context\"\n\t\"testing\"\n)\n\n")
+	} else {
+		buf.WriteString("import \"testing\"\n\n")
+	}
+	buf.WriteString(fmt.Sprintf("// %s can be assigned from an init function in another test file\n", setup))
+	buf.WriteString("// of this package to install fakes before the benchmark runs.\n")
+	buf.WriteString(fmt.Sprintf("var %s func(b *testing.B)\n\n", setup))
+	buf.WriteString(fmt.Sprintf("func %s(b *testing.B) {\n", bench))
+	buf.WriteString(fmt.Sprintf("\tif %s != nil {\n", setup))
+	buf.WriteString(fmt.Sprintf("\t\t%s(b)\n", setup))
+	buf.WriteString("\t}\n")
+	buf.WriteString("\tb.ReportAllocs()\n")
+	buf.WriteString("\tb.ResetTimer()\n")
+	var args []string
+	if r.UsesContext {
+		args = append(args, "context.Background()")
+	}
+	if syms.usesInitOptions(r) {
+		args = append(args, syms.initOptions+"{}")
+	} else if r.UsesArgs {
+		args = append(args, "nil")
+	}
+	if len(invocationFlags(r.Invocations)) > 0 {
+		args = append(args, syms.defaultRunOptions+"()")
+	}
+	buf.WriteString("\tfor i := 0; i < b.N; i++ {\n")
+	if hasCleanups(r.Providers) {
+		buf.WriteString(fmt.Sprintf("\t\t_, cleanup, err := %s(%s)\n", syms.initialize, strings.Join(args, ", ")))
+		buf.WriteString("\t\tif err != nil {\n")
+		buf.WriteString("\t\t\tb.Fatal(err)\n")
+		buf.WriteString("\t\t}\n")
+		buf.WriteString("\t\tcleanup()\n")
+	} else {
+		buf.WriteString(fmt.Sprintf("\t\tif _, err := %s(%s); err != nil {\n", syms.initialize, strings.Join(args, ", ")))
+		buf.WriteString("\t\t\tb.Fatal(err)\n")
+		buf.WriteString("\t\t}\n")
+	}
+	buf.WriteString("\t}\n")
+	buf.WriteString("}\n")
+
+	return format.Source(buf.Bytes())
+}
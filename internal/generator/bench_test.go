@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchmark(t *testing.T) {
+	result := &analyzer.Result{PackageName: "main"}
+
+	code, err := Benchmark(result, Options{})
+	require.NoError(t, err)
+	expected := `// Code generated by autowire. DO NOT EDIT.
+
+package main
+
+import "testing"
+
+// setupBenchmarkInitializeApp can be assigned from an init function in another test file
+// of this package to install fakes before the benchmark runs.
+var setupBenchmarkInitializeApp func(b *testing.B)
+
+func BenchmarkInitializeApp(b *testing.B) {
+	if setupBenchmarkInitializeApp != nil {
+		setupBenchmarkInitializeApp(b)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := InitializeApp(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+`
+	assert.Equal(t, expected, string(code))
+}
+
+func TestBenchmark_Container(t *testing.T) {
+	code, err := Benchmark(&analyzer.Result{PackageName: "main"}, Options{Container: "worker"})
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "func BenchmarkInitializeWorkerApp(b *testing.B) {")
+	assert.Contains(t, string(code), "var setupBenchmarkInitializeWorkerApp func(b *testing.B)")
+	assert.Contains(t, string(code), "if _, err := InitializeWorkerApp(); err != nil {")
+}
+
+func TestBenchmark_Partial(t *testing.T) {
+	_, err := Benchmark(&analyzer.Result{PackageName: "main"}, Options{Partial: true})
+	assert.ErrorContains(t, err, "not available in partial mode")
+}
+
+func TestBenchmark_ProviderCleanups(t *testing.T) {
+	result := &analyzer.Result{
+		PackageName: "main",
+		Providers:   []types.Provider{{Name: "NewDB", Kind: types.ProviderKindFunc, HasCleanup: true}},
+	}
+
+	code, err := Benchmark(result, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "_, cleanup, err := InitializeApp()")
+	assert.Contains(t, string(code), "\t\tcleanup()\n")
+}
+
+func TestBenchmark_InvocationFlags(t *testing.T) {
+	result := &analyzer.Result{
+		PackageName: "main",
+		Invocations: []types.Invocation{{Name: "ServeHTTP", Flag: "serve-http"}},
+	}
+
+	code, err := Benchmark(result, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "if _, err := InitializeApp(DefaultRunOptions()); err != nil {")
+}
@@ -0,0 +1,167 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+func configImports(r *analyzer.Result) []string {
+	var paths []string
+	for _, p := range r.Providers {
+		if p.Kind != types.ProviderKindConfig {
+			continue
+		}
+		paths = append(paths, "os")
+		if p.CanError {
+			paths = append(paths, "fmt")
+		}
+		for _, v := range p.Env {
+			switch v.Type {
+			case "string":
+			case "time.Duration":
+				paths = append(paths, "time")
+			case "[]string":
+				paths = append(paths, "strings")
+			default:
+				paths = append(paths, "strconv")
+			}
+		}
+	}
+	return paths
+}
+
+func checkConfigDefaults(r *analyzer.Result) error {
+	for _, p := range r.Providers {
+		for _, v := range p.Env {
+			if v.Default == "" {
+				continue
+			}
+			if _, err := configLiteral(v.Type, v.Default); err != nil {
+				return fmt.Errorf("config %s: invalid default %q for %s: %w", p.Name, v.Default, v.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func writeConfigInit(buf *bytes.Buffer, p types.Provider, fail string, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	if !p.CanError {
+		buf.WriteString(fmt.Sprintf("\t%s := ", p.VarName))
+		writeConfigLoader(buf, p, "\t", out, imports, resolver)
+		buf.WriteString("\n")
+		return
+	}
+	buf.WriteString(fmt.Sprintf("\t%s, err := ", p.VarName))
+	writeConfigLoader(buf, p, "\t", out, imports, resolver)
+	buf.WriteString(fmt.Sprintf("\n\tif err != nil {\n\t\t%s\n\t}\n\n", wrapFail(fail, "loading", p.Name, p.ImportPath, resolver)))
+}
+
+func writeConfigLoader(buf *bytes.Buffer, p types.Provider, indent string, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	typeName := formatType(p.ProvidedType, out, imports, resolver)
+	result := typeName
+	if p.CanError {
+		result = fmt.Sprintf("(%s, error)", typeName)
+	}
+
+	var defaults []string
+	for _, v := range p.Env {
+		if v.Default != "" {
+			literal, _ := configLiteral(v.Type, v.Default)
+			defaults = append(defaults, fmt.Sprintf("%s: %s", v.Field, literal))
+		}
+	}
+
+	buf.WriteString(fmt.Sprintf("func() %s {\n", result))
+	buf.WriteString(fmt.Sprintf("%s\tcfg := &%s{%s}\n", indent, strings.TrimPrefix(typeName, "*"), strings.Join(defaults, ", ")))
+	for _, v := range p.Env {
+		in := indent + "\t\t"
+		buf.WriteString(fmt.Sprintf("%s\tif v, ok := os.LookupEnv(%q); ok {\n", indent, v.Name))
+		writeEnvParse(buf, v, in)
+		if v.Required {
+			buf.WriteString(fmt.Sprintf("%s\t} else {\n%sreturn nil, fmt.Errorf(%q)\n", indent, in, "environment variable "+v.Name+" is required"))
+		}
+		buf.WriteString(fmt.Sprintf("%s\t}\n", indent))
+	}
+	if p.CanError {
+		buf.WriteString(fmt.Sprintf("%s\treturn cfg, nil\n", indent))
+	} else {
+		buf.WriteString(fmt.Sprintf("%s\treturn cfg\n", indent))
+	}
+	buf.WriteString(indent + "}()")
+}
+
+func writeEnvParse(buf *bytes.Buffer, v types.EnvVar, indent string) {
+	fail := fmt.Sprintf("%sif err != nil {\n%s\treturn nil, fmt.Errorf(%q, err)\n%s}\n", indent, indent, "parsing "+v.Name+": %w", indent)
+	switch v.Type {
+	case "string":
+		buf.WriteString(fmt.Sprintf("%scfg.%s = v\n", indent, v.Field))
+		return
+	case "[]string":
+		buf.WriteString(fmt.Sprintf("%scfg.%s = strings.Split(v, \",\")\n", indent, v.Field))
+		return
+	case "bool":
+		buf.WriteString(fmt.Sprintf("%sx, err := strconv.ParseBool(v)\n", indent))
+	case "time.Duration":
+		buf.WriteString(fmt.Sprintf("%sx, err := time.ParseDuration(v)\n", indent))
+	case "float32", "float64":
+		buf.WriteString(fmt.Sprintf("%sx, err := strconv.ParseFloat(v, %d)\n", indent, configBits(v.Type)))
+	default:
+		parse := "ParseInt"
+		if strings.HasPrefix(v.Type, "uint") {
+			parse = "ParseUint"
+		}
+		buf.WriteString(fmt.Sprintf("%sx, err := strconv.%s(v, 10, %d)\n", indent, parse, configBits(v.Type)))
+	}
+	buf.WriteString(fail)
+	switch v.Type {
+	case "bool", "time.Duration", "int64", "uint64", "float64":
+		buf.WriteString(fmt.Sprintf("%scfg.%s = x\n", indent, v.Field))
+	default:
+		buf.WriteString(fmt.Sprintf("%scfg.%s = %s(x)\n", indent, v.Field, v.Type))
+	}
+}
+
+func configLiteral(kind, value string) (string, error) {
+	switch kind {
+	case "[]string":
+		parts := strings.Split(value, ",")
+		for i, part := range parts {
+			parts[i] = strconv.Quote(part)
+		}
+		return "[]string{" + strings.Join(parts, ", ") + "}", nil
+	case "time.Duration":
+		d, err := time.ParseDuration(value)
+		return durationLiteral(d), err
+	}
+	return types.Literal(kind, value)
+}
+
+func configBits(kind string) int {
+	bits, _ := types.BitSize(kind)
+	return bits
+}
+
+func durationLiteral(d time.Duration) string {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	}
+	for _, u := range units {
+		if d != 0 && d%u.unit == 0 {
+			return fmt.Sprintf("%d * %s", d/u.unit, u.name)
+		}
+	}
+	return fmt.Sprintf("time.Duration(%d)", d)
+}
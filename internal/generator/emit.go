@@ -0,0 +1,165 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+const (
+	EmitGo   = "go"
+	EmitPlan = "plan"
+	EmitDOT  = "dot"
+
+	planFormatVersion = "1"
+)
+
+type Emitter interface {
+	Extension() string
+	Emit(r *analyzer.Result, resolver types.PackageNameResolver, opts Options) ([]byte, error)
+}
+
+type emitter struct {
+	extension string
+	emit      func(r *analyzer.Result, resolver types.PackageNameResolver, opts Options) ([]byte, error)
+}
+
+func (e emitter) Extension() string {
+	return e.extension
+}
+
+func (e emitter) Emit(r *analyzer.Result, resolver types.PackageNameResolver, opts Options) ([]byte, error) {
+	return e.emit(r, resolver, opts)
+}
+
+var emitters = map[string]Emitter{
+	EmitGo: emitter{extension: ".go", emit: Generate},
+	EmitPlan: emitter{extension: ".json", emit: func(r *analyzer.Result, _ types.PackageNameResolver, opts Options) ([]byte, error) {
+		return Plan(r, opts)
+	}},
+	EmitDOT: emitter{extension: ".dot", emit: func(r *analyzer.Result, _ types.PackageNameResolver, _ Options) ([]byte, error) {
+		return DependencyGraph(r, GraphFormatDOT)
+	}},
+}
+
+func RegisterEmitter(name string, e Emitter) error {
+	if name == "" {
+		return fmt.Errorf("emitter name must not be empty")
+	}
+	if _, ok := emitters[name]; ok {
+		return fmt.Errorf("emitter %s is already registered", name)
+	}
+	emitters[name] = e
+	return nil
+}
+
+func LookupEmitter(name string) (Emitter, error) {
+	if name == "" {
+		name = EmitGo
+	}
+	e, ok := emitters[name]
+	if !ok {
+		names := EmitterNames()
+		return nil, fmt.Errorf("unknown emitter %q: must be %s or %s", name, strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+	return e, nil
+}
+
+func EmitterNames() []string {
+	names := make([]string, 0, len(emitters))
+	for name := range emitters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type planStep struct {
+	Action    string   `json:"action"`
+	Name      string   `json:"name"`
+	Package   string   `json:"package,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Variable  string   `json:"variable,omitempty"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	Members   []string `json:"members,omitempty"`
+	Group     string   `json:"group,omitempty"`
+	Flag      string   `json:"flag,omitempty"`
+	CanError  bool     `json:"can_error,omitempty"`
+	Cleanup   bool     `json:"cleanup,omitempty"`
+}
+
+type plan struct {
+	FormatVersion string     `json:"format_version"`
+	Package       string     `json:"package"`
+	ImportPath    string     `json:"import_path"`
+	Initializer   string     `json:"initializer"`
+	Steps         []planStep `json:"steps"`
+}
+
+func Plan(r *analyzer.Result, opts Options) ([]byte, error) {
+	pl := plan{
+		FormatVersion: planFormatVersion,
+		Package:       r.PackageName,
+		ImportPath:    r.OutputImportPath,
+		Initializer:   InitializerName(opts),
+		Steps:         []planStep{},
+	}
+
+	provide := func(p types.Provider, scope string) {
+		step := planStep{
+			Action:   "provide",
+			Name:     p.Name,
+			Package:  p.ImportPath,
+			Type:     p.ProvidedType.Key(),
+			Scope:    scope,
+			Variable: p.VarName,
+			Group:    p.Group,
+			CanError: p.CanError,
+			Cleanup:  p.HasCleanup,
+		}
+		if p.Kind == types.ProviderKindGroup {
+			step.Action = "collect"
+			step.Package = ""
+			for _, m := range p.Members {
+				step.Members = append(step.Members, m.ImportPath+"."+m.Name)
+			}
+		}
+		for _, dep := range p.Dependencies {
+			step.DependsOn = append(step.DependsOn, dep.Type.Key())
+		}
+		pl.Steps = append(pl.Steps, step)
+	}
+	for _, p := range r.Providers {
+		provide(p, "singleton")
+	}
+	for _, p := range r.RequestProviders {
+		provide(p, "request")
+	}
+	for _, p := range r.TransientProviders {
+		provide(p, "transient")
+	}
+	for _, p := range r.WeakProviders {
+		provide(p, "weak")
+	}
+	for _, p := range r.LazyProviders {
+		provide(p, "lazy")
+	}
+	for _, inv := range r.Invocations {
+		step := planStep{Action: "invoke", Name: inv.Name, Package: inv.ImportPath, Flag: inv.Flag, CanError: inv.CanError}
+		for _, dep := range inv.Dependencies {
+			step.DependsOn = append(step.DependsOn, dep.Key())
+		}
+		pl.Steps = append(pl.Steps, step)
+	}
+
+	out, err := json.MarshalIndent(pl, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupEmitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		emit      string
+		extension string
+		errMsg    string
+	}{
+		{name: "default", emit: "", extension: ".go"},
+		{name: "go", emit: EmitGo, extension: ".go"},
+		{name: "plan", emit: EmitPlan, extension: ".json"},
+		{name: "dot", emit: EmitDOT, extension: ".dot"},
+		{name: "unknown", emit: "hcl", errMsg: `unknown emitter "hcl": must be dot, go or plan`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := LookupEmitter(tt.emit)
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.extension, e.Extension())
+		})
+	}
+}
+
+func TestRegisterEmitter(t *testing.T) {
+	yaml := emitter{extension: ".yaml", emit: func(*analyzer.Result, types.PackageNameResolver, Options) ([]byte, error) {
+		return []byte("steps: []\n"), nil
+	}}
+	t.Cleanup(func() { delete(emitters, "yaml") })
+
+	require.NoError(t, RegisterEmitter("yaml", yaml))
+	e, err := LookupEmitter("yaml")
+	require.NoError(t, err)
+	out, err := e.Emit(&analyzer.Result{}, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "steps: []\n", string(out))
+
+	assert.EqualError(t, RegisterEmitter("yaml", yaml), "emitter yaml is already registered")
+	assert.EqualError(t, RegisterEmitter("", yaml), "emitter name must not be empty")
+}
+
+func TestPlan(t *testing.T) {
+	r := graphResult()
+	r.PackageName = "main"
+	r.OutputImportPath = "example.com/app"
+	r.Providers[0].VarName = "config"
+	r.Providers[0].CanError = true
+	r.Invocations[0].Flag = "serve"
+
+	out, err := Plan(r, Options{Container: "worker"})
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "format_version": "1",
+  "package": "main",
+  "import_path": "example.com/app",
+  "initializer": "InitializeWorkerApp",
+  "steps": [
+    {
+      "action": "provide",
+      "name": "NewConfig",
+      "package": "pkg/config",
+      "type": "*pkg/config.Config",
+      "scope": "singleton",
+      "variable": "config",
+      "can_error": true
+    },
+    {
+      "action": "provide",
+      "name": "NewAuth",
+      "package": "pkg/auth",
+      "type": "pkg/http.Handler",
+      "scope": "singleton",
+      "depends_on": [
+        "*pkg/config.Config"
+      ],
+      "group": "handlers"
+    },
+    {
+      "action": "collect",
+      "name": "handlers",
+      "type": "[]pkg/http.Handler",
+      "scope": "singleton",
+      "members": [
+        "pkg/auth.NewAuth"
+      ]
+    },
+    {
+      "action": "provide",
+      "name": "CurrentUser",
+      "package": "pkg/user",
+      "type": "*pkg/user.User",
+      "scope": "request",
+      "depends_on": [
+        "context.Context"
+      ]
+    },
+    {
+      "action": "invoke",
+      "name": "Serve",
+      "package": "pkg/http",
+      "depends_on": [
+        "[]pkg/http.Handler"
+      ],
+      "flag": "serve"
+    }
+  ]
+}
+`, string(out))
+}
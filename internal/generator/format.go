@@ -0,0 +1,117 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	goparser "go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+func formatSource(src []byte, resolver types.PackageNameResolver) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", src, goparser.ParseComments)
+	if err != nil {
+		return format.Source(src)
+	}
+
+	used := usedPackages(f)
+	var std, external []string
+	start, end := -1, -1
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		if start < 0 {
+			start = fset.Position(gen.Pos()).Offset
+		}
+		end = fset.Position(gen.End()).Offset
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid import %s", imp.Path.Value)
+			}
+			name := ""
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			if name != "_" && name != "." {
+				local := name
+				if local == "" {
+					local = resolver.ResolveName(path)
+				}
+				if !used[local] {
+					continue
+				}
+			}
+			line := strconv.Quote(path)
+			if name != "" {
+				line = name + " " + line
+			}
+			if isStdImport(path) {
+				std = append(std, line)
+			} else {
+				external = append(external, line)
+			}
+		}
+	}
+	if start < 0 {
+		return format.Source(src)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(src[:start])
+	writeImportGroups(&buf, std, external)
+	buf.Write(bytes.TrimLeft(src[end:], "\n"))
+	return format.Source(buf.Bytes())
+}
+
+func usedPackages(f *ast.File) map[string]bool {
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	return used
+}
+
+func isStdImport(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+func writeImportGroups(buf *bytes.Buffer, groups ...[]string) {
+	var lines []string
+	for _, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return importPath(group[i]) < importPath(group[j]) })
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		for _, line := range group {
+			lines = append(lines, "\t"+line)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	buf.WriteString("import (\n" + strings.Join(lines, "\n") + "\n)\n\n")
+}
+
+func importPath(line string) string {
+	return line[strings.Index(line, `"`):]
+}
@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "prunes unused imports and groups the standard library first",
+			src: "package main\n\nimport (\n\t\"example.com/app/db\"\n\t\"fmt\"\n\t\"sync\"\n\tyaml \"gopkg.in/yaml.v3\"\n)\n\n" +
+				"var _ = fmt.Sprint(db.Open, yaml.Marshal)\n",
+			expected: "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/db\"\n\tyaml \"gopkg.in/yaml.v3\"\n)\n\n" +
+				"var _ = fmt.Sprint(db.Open, yaml.Marshal)\n",
+		},
+		{
+			name:     "resolves package names that differ from the path",
+			src:      "package main\n\nimport (\n\t\"github.com/go-chi/chi/v5\"\n)\n\nvar _ = chi.NewRouter\n",
+			expected: "package main\n\nimport (\n\t\"github.com/go-chi/chi/v5\"\n)\n\nvar _ = chi.NewRouter\n",
+		},
+		{
+			name:     "ignores identifiers shadowing a package",
+			src:      "package main\n\nimport (\n\t\"context\"\n\t\"example.com/app/cache\"\n)\n\nfunc f(cache *T) { cache.Get(context.TODO()) }\n",
+			expected: "package main\n\nimport (\n\t\"context\"\n)\n\nfunc f(cache *T) { cache.Get(context.TODO()) }\n",
+		},
+		{
+			name:     "keeps blank imports",
+			src:      "package main\n\nimport (\n\t_ \"embed\"\n\t\"fmt\"\n)\n\nvar x int\n",
+			expected: "package main\n\nimport (\n\t_ \"embed\"\n)\n\nvar x int\n",
+		},
+		{
+			name:     "drops the import block when nothing is used",
+			src:      "// Code generated by autowire. DO NOT EDIT.\n\npackage main\n\nimport (\n\t\"errors\"\n)\n\nvar x int\n",
+			expected: "// Code generated by autowire. DO NOT EDIT.\n\npackage main\n\nvar x int\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := formatSource([]byte(tt.src), &versionedPathResolver{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(output))
+		})
+	}
+}
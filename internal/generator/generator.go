@@ -3,28 +3,569 @@ package generator
 import (
 	"bytes"
 	"fmt"
-	"go/format"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/eloonstra/autowire/internal/analyzer"
 	"github.com/eloonstra/autowire/internal/types"
 )
 
-func Generate(r *analyzer.Result, resolver types.PackageNameResolver) ([]byte, error) {
+type FieldOrder int
+
+const (
+	FieldOrderTopological FieldOrder = iota
+	FieldOrderType
+	FieldOrderPackage
+)
+
+type Options struct {
+	DebugDump        bool
+	Partial          bool
+	FieldOrder       FieldOrder
+	Container        string
+	NoLint           []string
+	Cleanup          bool
+	Profile          string
+	FieldTags        []string
+	Recover          bool
+	Getters          bool
+	Services         bool
+	Lifecycle        bool
+	Emit             string
+	TestShared       []string
+	ContextAccessors bool
+	RunFuncs         bool
+	InitOptions      bool
+}
+
+const (
+	runOptionsParam  = "opts"
+	argsParam        = "args"
+	initOptionsParam = "options"
+)
+
+type symbols struct {
+	app               string
+	initialize        string
+	requestScope      string
+	runOptions        string
+	defaultRunOptions string
+	initOptions       string
+	services          string
+	stopHooks         string
+	lazyValue         string
+	prefix            string
+	getters           bool
+	declared          map[string]string
+}
+
+func newSymbols(opts Options) *symbols {
+	prefix := toUpper(opts.Container)
+	var initOptions string
+	if opts.InitOptions {
+		initOptions = prefix + "InitOptions"
+	}
+	return &symbols{
+		app:               prefix + "App",
+		initialize:        "Initialize" + prefix + "App",
+		requestScope:      prefix + "RequestScope",
+		runOptions:        prefix + "RunOptions",
+		defaultRunOptions: "Default" + prefix + "RunOptions",
+		initOptions:       initOptions,
+		services:          prefix + "AppServices",
+		stopHooks:         "stop" + prefix + "Hooks",
+		lazyValue:         "lazy" + prefix + "Value",
+		prefix:            prefix,
+		getters:           opts.Getters,
+		declared:          make(map[string]string),
+	}
+}
+
+func (s *symbols) usesInitOptions(r *analyzer.Result) bool {
+	return s.initOptions != "" && (r.UsesArgs || len(r.Externals) > 0)
+}
+
+func (s *symbols) field(varName string) string {
+	if s.getters {
+		return varName
+	}
+	return toUpper(varName)
+}
+
+func (s *symbols) declare(name, owner string) error {
+	if prev, ok := s.declared[name]; ok {
+		return fmt.Errorf("generated identifier %s conflicts: declared by %s and %s", name, prev, owner)
+	}
+	s.declared[name] = owner
+	return nil
+}
+
+func (s *symbols) lazyHolder(varName string) string {
+	return "lazy" + toUpper(varName)
+}
+
+func (s *symbols) wire(varName string) string {
+	return "wire" + s.prefix + toUpper(varName)
+}
+
+func (s *symbols) fromContext(varName string) string {
+	return s.prefix + toUpper(varName) + "FromContext"
+}
+
+func (s *symbols) withContext(varName string) string {
+	return "With" + s.prefix + toUpper(varName)
+}
+
+func (s *symbols) contextKey(varName string) string {
+	return "ctxKey" + s.prefix + toUpper(varName)
+}
+
+func (s *symbols) invoke(name string) string {
+	return "invoke" + s.prefix + toUpper(name)
+}
+
+func (s *symbols) run(name string) string {
+	return "Run" + s.prefix + toUpper(name)
+}
+
+func Generate(r *analyzer.Result, resolver types.PackageNameResolver, opts Options) ([]byte, error) {
 	var buf bytes.Buffer
 	out := r.OutputImportPath
 	imports := r.Imports
+	if opts.DebugDump {
+		imports = withStdImports(imports, "fmt", "io", "strings")
+	}
+	if len(r.RequestProviders) > 0 && !opts.Partial {
+		imports = withStdImports(imports, "context")
+	}
+	if len(r.WeakProviders) > 0 && !opts.Partial {
+		imports = withStdImports(imports, "sync", "weak")
+	}
+	if len(r.LazyProviders) > 0 && !opts.Partial {
+		imports = withStdImports(imports, "sync")
+		if err := checkLazyAccessors(r, newTransients(r.TransientProviders, nil, opts.Recover, out, imports, resolver)); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Cleanup {
+		if opts.Partial {
+			return nil, fmt.Errorf("cleanup requires the generated App and is not available in partial mode")
+		}
+		if len(closables(r.Providers))+len(r.LazyProviders) > 0 {
+			imports = withStdImports(imports, "errors", "io")
+		}
+	}
+	if opts.Lifecycle {
+		if opts.Partial {
+			return nil, fmt.Errorf("lifecycle hooks require the generated App and are not available in partial mode")
+		}
+		imports = withStdImports(imports, "context", "errors")
+	}
+	if opts.Recover && opts.Partial {
+		return nil, fmt.Errorf("recover requires the generated initializer and is not available in partial mode")
+	}
+	if opts.RunFuncs && opts.Partial {
+		return nil, fmt.Errorf("run functions are generated next to the initializer and are not available in partial mode")
+	}
+	if opts.InitOptions && opts.Partial {
+		return nil, fmt.Errorf("init options require the generated initializer and are not available in partial mode")
+	}
+	if opts.Getters && opts.Partial {
+		return nil, fmt.Errorf("getters require the generated App and are not available in partial mode")
+	}
+	if opts.Services && !opts.Getters {
+		return nil, fmt.Errorf("the services interface lists the App getters and requires getters")
+	}
+	if opts.Getters && len(opts.FieldTags) > 0 {
+		return nil, fmt.Errorf("field tags require exported App fields and cannot be combined with getters")
+	}
+	if canFail(r, opts.Recover) && !opts.Partial {
+		imports = withStdImports(imports, "fmt")
+	}
+	imports = withStdImports(imports, configImports(r)...)
+	if err := checkConfigDefaults(r); err != nil {
+		return nil, err
+	}
+	flags := invocationFlags(r.Invocations)
+	if len(flags) > 0 && !opts.Partial {
+		imports = withStdImports(imports, "flag")
+	}
+	if !opts.Partial {
+		imports = withStdImports(imports, requiredImports(r.Externals)...)
+	}
+
+	values, err := ldflagValues(r)
+	if err != nil {
+		return nil, err
+	}
+
+	syms := newSymbols(opts)
+	if err := declareSymbols(syms, r, imports, opts, resolver); err != nil {
+		return nil, err
+	}
+	nolint, err := nolintDirective(opts.NoLint)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := parseFieldTags(opts.FieldTags)
+	if err != nil {
+		return nil, err
+	}
 
 	buf.WriteString("// Code generated by autowire. DO NOT EDIT.\n\n")
+	buf.WriteString(buildConstraint(opts.Profile, r.Profiles))
 	buf.WriteString(fmt.Sprintf("package %s\n\n", r.PackageName))
 
 	writeImports(&buf, imports)
-	writeAppStruct(&buf, r.Providers, out, imports, resolver)
+	writeLdflagVars(&buf, values)
+	if opts.Partial {
+		writeWireHelpers(&buf, r, syms, out, imports, resolver)
+		return formatSource(buf.Bytes(), resolver)
+	}
+	fields := orderFields(r.Providers, opts.FieldOrder, out, imports, resolver)
+	lazy := newTransients(r.TransientProviders, nil, opts.Recover, out, imports, resolver)
+	writeAppStruct(&buf, syms.app, fields, r.LazyProviders, r.WeakProviders, func(p types.Provider) string { return lazyType(p, lazy) }, func(p types.Provider) string { return lazyHolderField(p, syms, out, imports, resolver) }, syms.field, tags, out, imports, resolver)
 	buf.WriteString("\n")
-	writeInitFunc(&buf, r, out, imports, resolver)
+	if len(r.LazyProviders) > 0 {
+		writeLazyValueType(&buf, syms)
+		buf.WriteString("\n")
+	}
+	var methods []string
+	if opts.Getters {
+		methods = writeGetters(&buf, syms, fields, out, imports, resolver)
+		methods = append(methods, writeLazyGetters(&buf, syms, r.LazyProviders, lazy)...)
+	}
+	if len(flags) > 0 {
+		writeRunOptions(&buf, syms, flags, r.Invocations)
+		buf.WriteString("\n")
+	}
+	if syms.usesInitOptions(r) {
+		writeInitOptions(&buf, r, syms, out, imports, resolver)
+		buf.WriteString("\n")
+	}
+	writeInitFunc(&buf, r, syms, fields, nolint, opts.Recover, out, imports, resolver)
+	if len(r.RequestProviders) > 0 {
+		buf.WriteString("\n")
+		writeRequestScope(&buf, r, syms, tags, nolint, opts.Recover, opts.ContextAccessors, out, imports, resolver)
+		if opts.ContextAccessors {
+			buf.WriteString("\n")
+			writeContextAccessors(&buf, syms, r.RequestProviders, out, imports, resolver)
+		}
+	}
+	if len(r.TransientProviders) > 0 {
+		buf.WriteString("\n")
+		methods = append(methods, writeTransientFactories(&buf, r, syms, nolint, opts.Recover, out, imports, resolver)...)
+	}
+	if len(r.WeakProviders) > 0 {
+		buf.WriteString("\n")
+		methods = append(methods, writeWeakAccessors(&buf, r, syms, nolint, opts.Recover, out, imports, resolver)...)
+	}
+	if opts.RunFuncs {
+		writeRunFuncs(&buf, r, syms, nolint, opts.Recover, out, imports, resolver)
+	}
+	if opts.Services {
+		buf.WriteString("\n")
+		writeServices(&buf, syms, methods)
+	}
+	if opts.Cleanup {
+		buf.WriteString("\n")
+		writeCleanup(&buf, syms, r.Providers, r.LazyProviders, nolint)
+	}
+	if opts.Lifecycle {
+		buf.WriteString("\n")
+		writeLifecycle(&buf, syms, r.Providers, nolint)
+	}
+	if opts.DebugDump {
+		buf.WriteString("\n")
+		writeDebugDump(&buf, syms, fields, r.LazyProviders, nolint, out, imports, resolver)
+	}
+
+	return formatSource(buf.Bytes(), resolver)
+}
+
+func declareSymbols(syms *symbols, r *analyzer.Result, imports map[string]string, opts Options, resolver types.PackageNameResolver) error {
+	paths := make([]string, 0, len(imports))
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := syms.declare(pkgName(path, imports, resolver), "import "+path); err != nil {
+			return err
+		}
+	}
+	for _, p := range r.Providers {
+		if p.Kind != types.ProviderKindValue {
+			continue
+		}
+		if err := syms.declare(ldflagVar(p), "value "+p.Name); err != nil {
+			return err
+		}
+	}
+
+	if !opts.Partial {
+		if err := syms.declare(syms.app, "App struct"); err != nil {
+			return err
+		}
+		if err := syms.declare(syms.initialize, "initializer"); err != nil {
+			return err
+		}
+		if len(invocationFlags(r.Invocations)) > 0 {
+			if err := declareRunOptions(syms, r.Providers); err != nil {
+				return err
+			}
+		}
+		if syms.usesInitOptions(r) {
+			if err := syms.declare(syms.initOptions, "init options struct"); err != nil {
+				return err
+			}
+			for _, p := range r.Providers {
+				if p.VarName == initOptionsParam {
+					return fmt.Errorf("provider %s conflicts with the %s parameter of %s", p.Name, initOptionsParam, syms.initialize)
+				}
+			}
+		}
+		if r.UsesArgs {
+			for _, p := range r.Providers {
+				if p.VarName == argsParam {
+					return fmt.Errorf("provider %s conflicts with the %s parameter of %s", p.Name, argsParam, syms.initialize)
+				}
+			}
+		}
+		for _, providers := range [][]types.Provider{r.Providers, r.RequestProviders} {
+			if !hasCleanups(providers) {
+				continue
+			}
+			for _, p := range providers {
+				if p.VarName == "cleanup" || p.VarName == "cleanups" {
+					return fmt.Errorf("provider %s conflicts with the %s variable collecting cleanup functions; rename it with name=", p.Name, p.VarName)
+				}
+			}
+		}
+		for _, e := range r.Externals {
+			switch e.VarName {
+			case "ctx", "err", "cleanup", "cleanups", argsParam, runOptionsParam, initOptionsParam:
+				return fmt.Errorf("external %s conflicts with the %s variable of %s; rename it with name=", e.Type.Key(), e.VarName, syms.initialize)
+			}
+		}
+		if len(r.RequestProviders) > 0 {
+			if err := syms.declare(syms.requestScope, "request scope struct"); err != nil {
+				return err
+			}
+		}
+		if opts.ContextAccessors {
+			for _, p := range r.RequestProviders {
+				if toUpper(p.VarName) == "WithContext" {
+					return fmt.Errorf("%s.WithContext conflicts with the field for %s", syms.requestScope, p.Name)
+				}
+				for _, name := range []string{syms.fromContext(p.VarName), syms.withContext(p.VarName), syms.contextKey(p.VarName)} {
+					if err := syms.declare(name, "context accessor for "+p.Name); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if opts.Services {
+			if err := syms.declare(syms.services, "services interface"); err != nil {
+				return err
+			}
+		}
+		if opts.Lifecycle {
+			if err := syms.declare(syms.stopHooks, "lifecycle helper"); err != nil {
+				return err
+			}
+		}
+		if len(r.LazyProviders) > 0 {
+			if err := syms.declare(syms.lazyValue, "lazy value type"); err != nil {
+				return err
+			}
+			names := make(map[string]string)
+			for _, p := range append(append([]types.Provider{}, r.Providers...), r.LazyProviders...) {
+				names[p.VarName] = p.Name
+			}
+			for _, p := range r.LazyProviders {
+				if owner, ok := names[syms.lazyHolder(p.VarName)]; ok {
+					return fmt.Errorf("provider %s conflicts with the %s holder of lazy %s; rename it with name=", owner, syms.lazyHolder(p.VarName), p.Name)
+				}
+			}
+		}
+		if opts.RunFuncs {
+			for _, inv := range r.Invocations {
+				if err := syms.declare(syms.run(inv.Name), "run function for invocation "+inv.ImportPath+"."+inv.Name); err != nil {
+					return err
+				}
+			}
+		}
+		return checkFactoryMethods(syms, r, opts)
+	}
+
+	for _, p := range append(append(append(append(append([]types.Provider{}, r.Providers...), r.RequestProviders...), r.TransientProviders...), r.WeakProviders...), r.LazyProviders...) {
+		if err := syms.declare(syms.wire(p.VarName), "provider "+p.Name); err != nil {
+			return err
+		}
+	}
+	for _, inv := range r.Invocations {
+		if err := syms.declare(syms.invoke(inv.Name), "invocation "+inv.ImportPath+"."+inv.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFactoryMethods(syms *symbols, r *analyzer.Result, opts Options) error {
+	members := make(map[string]string)
+	for _, p := range r.Providers {
+		if opts.Getters {
+			members[toUpper(p.VarName)] = "getter for " + p.Name
+			continue
+		}
+		members[toUpper(p.VarName)] = "field for " + p.Name
+	}
+	for _, p := range r.LazyProviders {
+		if opts.Getters {
+			members[toUpper(p.VarName)] = "getter for " + p.Name
+			continue
+		}
+		members[toUpper(p.VarName)] = "field for " + p.Name
+	}
+	if len(r.RequestProviders) > 0 {
+		members["NewRequestScope"] = "request scope constructor"
+	}
+	if opts.Cleanup {
+		members["Cleanup"] = "cleanup method"
+	}
+	if opts.DebugDump {
+		members["DebugDump"] = "debug dump method"
+		members["String"] = "debug dump method"
+	}
+	if opts.Lifecycle {
+		for _, name := range []string{"Start", "Stop"} {
+			if owner, ok := members[name]; ok {
+				return fmt.Errorf("%s.%s lifecycle method conflicts with the %s", syms.app, name, owner)
+			}
+			members[name] = "lifecycle method"
+		}
+	}
+	for _, p := range r.TransientProviders {
+		name := factoryMethod(p)
+		if owner, ok := members[name]; ok {
+			return fmt.Errorf("%s.%s for transient %s conflicts with the %s", syms.app, name, p.Name, owner)
+		}
+		members[name] = "factory for " + p.Name
+	}
+	for _, p := range r.WeakProviders {
+		name := toUpper(p.VarName)
+		if owner, ok := members[name]; ok {
+			return fmt.Errorf("%s.%s for weak %s conflicts with the %s", syms.app, name, p.Name, owner)
+		}
+		members[name] = "accessor for " + p.Name
+	}
+	return nil
+}
+
+func declareRunOptions(syms *symbols, providers []types.Provider) error {
+	if err := syms.declare(syms.runOptions, "run options struct"); err != nil {
+		return err
+	}
+	if err := syms.declare(syms.defaultRunOptions, "run options defaults"); err != nil {
+		return err
+	}
+	for _, p := range providers {
+		if p.VarName == runOptionsParam {
+			return fmt.Errorf("provider %s conflicts with the %s parameter of %s", p.Name, runOptionsParam, syms.initialize)
+		}
+	}
+	return nil
+}
 
-	return format.Source(buf.Bytes())
+func buildConstraint(profile string, profiles []string) string {
+	if profile != "" {
+		return fmt.Sprintf("//go:build %s\n\n", profile)
+	}
+	if len(profiles) == 0 {
+		return ""
+	}
+	excluded := make([]string, len(profiles))
+	for i, p := range profiles {
+		excluded[i] = "!" + p
+	}
+	return fmt.Sprintf("//go:build %s\n\n", strings.Join(excluded, " && "))
+}
+
+func ldflagValues(r *analyzer.Result) ([]types.Provider, error) {
+	target := r.OutputImportPath
+	if r.PackageName == "main" {
+		target = "main"
+	}
+
+	var values []types.Provider
+	for _, p := range r.Providers {
+		if p.Kind != types.ProviderKindValue {
+			continue
+		}
+		if pkg := strings.TrimSuffix(p.Ldflag, "."+ldflagVar(p)); pkg != target {
+			return nil, fmt.Errorf("value %s: ldflag %s must target the output package, e.g. %s.%s", p.Name, p.Ldflag, target, ldflagVar(p))
+		}
+		values = append(values, p)
+	}
+	return values, nil
+}
+
+func ldflagVar(p types.Provider) string {
+	return p.Ldflag[strings.LastIndex(p.Ldflag, ".")+1:]
+}
+
+func writeLdflagVars(buf *bytes.Buffer, values []types.Provider) {
+	if len(values) == 0 {
+		return
+	}
+	buf.WriteString("var (\n")
+	for _, p := range values {
+		buf.WriteString(fmt.Sprintf("\t%s string\n", ldflagVar(p)))
+	}
+	buf.WriteString(")\n\n")
+}
+
+func nolintDirective(linters []string) (string, error) {
+	if len(linters) == 0 {
+		return "", nil
+	}
+	for _, l := range linters {
+		if l == "all" {
+			return "//nolint:all\n", nil
+		}
+		if !validLinterName(l) {
+			return "", fmt.Errorf("invalid linter name %q", l)
+		}
+	}
+	return "//nolint:" + strings.Join(linters, ",") + "\n", nil
+}
+
+func validLinterName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func withStdImports(imports map[string]string, paths ...string) map[string]string {
+	merged := make(map[string]string, len(imports)+len(paths))
+	for p, alias := range imports {
+		merged[p] = alias
+	}
+	for _, p := range paths {
+		if _, ok := merged[p]; !ok {
+			merged[p] = ""
+		}
+	}
+	return merged
 }
 
 func writeImports(buf *bytes.Buffer, imports map[string]string) {
@@ -50,51 +591,722 @@ func writeImports(buf *bytes.Buffer, imports map[string]string) {
 	buf.WriteString(")\n\n")
 }
 
-func writeAppStruct(buf *bytes.Buffer, providers []types.Provider, out string, imports map[string]string, resolver types.PackageNameResolver) {
-	buf.WriteString("type App struct {\n")
+func orderFields(providers []types.Provider, order FieldOrder, out string, imports map[string]string, resolver types.PackageNameResolver) []types.Provider {
+	fields := append([]types.Provider{}, providers...)
+	switch order {
+	case FieldOrderType:
+		sort.SliceStable(fields, func(i, j int) bool {
+			a := strings.TrimLeft(formatType(fields[i].ProvidedType, out, imports, resolver), "[]*")
+			b := strings.TrimLeft(formatType(fields[j].ProvidedType, out, imports, resolver), "[]*")
+			if a != b {
+				return a < b
+			}
+			return fields[i].VarName < fields[j].VarName
+		})
+	case FieldOrderPackage:
+		sort.SliceStable(fields, func(i, j int) bool {
+			a, b := fields[i].ProvidedType.ImportPath, fields[j].ProvidedType.ImportPath
+			if a != b {
+				return a < b
+			}
+			return fields[i].VarName < fields[j].VarName
+		})
+	}
+	return fields
+}
+
+func writeAppStruct(buf *bytes.Buffer, name string, providers, lazy, weak []types.Provider, lazyType, lazyHolder func(types.Provider) string, field func(string) string, tags []fieldTag, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	buf.WriteString(fmt.Sprintf("type %s struct {\n", name))
 	for _, p := range providers {
-		buf.WriteString(fmt.Sprintf("\t%s %s\n", toUpper(p.VarName), formatType(p.ProvidedType, out, imports, resolver)))
+		buf.WriteString(fmt.Sprintf("\t%s %s%s\n", field(p.VarName), formatType(p.ProvidedType, out, imports, resolver), structTag(p, tags)))
+	}
+	for _, p := range lazy {
+		buf.WriteString(fmt.Sprintf("\t%s %s\n", field(p.VarName), lazyType(p)))
+	}
+	if len(lazy) > 0 {
+		buf.WriteString("\n")
+		for _, p := range lazy {
+			buf.WriteString(fmt.Sprintf("\t%s\n", lazyHolder(p)))
+		}
+	}
+	if len(weak) > 0 {
+		if len(providers)+len(lazy) > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\tweakMu sync.Mutex\n")
+		for _, p := range weak {
+			buf.WriteString(fmt.Sprintf("\t%s weak.Pointer[%s]\n", p.VarName, strings.TrimPrefix(formatType(p.ProvidedType, out, imports, resolver), "*")))
+		}
 	}
 	buf.WriteString("}\n")
 }
 
-func writeInitFunc(buf *bytes.Buffer, r *analyzer.Result, out string, imports map[string]string, resolver types.PackageNameResolver) {
-	buf.WriteString("func InitializeApp() (*App, error) {\n")
+func writeGetters(buf *bytes.Buffer, syms *symbols, fields []types.Provider, out string, imports map[string]string, resolver types.PackageNameResolver) []string {
+	methods := make([]string, len(fields))
+	for i, p := range fields {
+		methods[i] = fmt.Sprintf("%s() %s", toUpper(p.VarName), formatType(p.ProvidedType, out, imports, resolver))
+		buf.WriteString(fmt.Sprintf("func (a *%s) %s {\n\treturn a.%s\n}\n\n", syms.app, methods[i], p.VarName))
+	}
+	return methods
+}
+
+func writeServices(buf *bytes.Buffer, syms *symbols, methods []string) {
+	buf.WriteString(fmt.Sprintf("// %s lists the methods of %s, so callers can depend on an interface.\n", syms.services, syms.app))
+	buf.WriteString(fmt.Sprintf("type %s interface {\n", syms.services))
+	for _, m := range methods {
+		buf.WriteString("\t" + m + "\n")
+	}
+	buf.WriteString("}\n\n")
+	buf.WriteString(fmt.Sprintf("var _ %s = (*%s)(nil)\n", syms.services, syms.app))
+}
+
+type fieldTag struct {
+	key   string
+	value string
+	typed bool
+}
+
+func parseFieldTags(specs []string) ([]fieldTag, error) {
+	seen := make(map[string]bool)
+	tags := make([]fieldTag, 0, len(specs))
+	for _, spec := range specs {
+		key, value, fixed := strings.Cut(spec, "=")
+		if !validTagKey(key) {
+			return nil, fmt.Errorf("invalid field tag %q: key must be non-empty without spaces, quotes or colons", spec)
+		}
+		if strings.ContainsAny(value, "`\n") {
+			return nil, fmt.Errorf("invalid field tag %q: value cannot contain backquotes or newlines", spec)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate field tag %q", key)
+		}
+		seen[key] = true
+		tags = append(tags, fieldTag{key: key, value: value, typed: !fixed})
+	}
+	return tags, nil
+}
+
+func validTagKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if r <= ' ' || r == 0x7f || r == '"' || r == ':' || r == '`' {
+			return false
+		}
+	}
+	return true
+}
+
+func structTag(p types.Provider, tags []fieldTag) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	parts := make([]string, len(tags))
+	for i, tag := range tags {
+		value := tag.value
+		if tag.typed {
+			value = p.ProvidedType.Key()
+		}
+		parts[i] = tag.key + ":" + strconv.Quote(value)
+	}
+	return " `" + strings.Join(parts, " ") + "`"
+}
+
+func writeInitFunc(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, fields []types.Provider, nolint string, recoverPanics bool, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	fail := writeInitSignature(buf, r, syms, syms.initialize, "", nolint, out, imports, resolver)
+	t := newTransients(r.TransientProviders, append(append(varNames(r.Providers), varNames(r.LazyProviders)...), externalNames(r.Externals)...), recoverPanics, out, imports, resolver)
+	writeInitBody(buf, r, syms, fields, t, fail, func(buf *bytes.Buffer, p types.Provider, vars map[string]string) {
+		writeProvider(buf, p, t.inject(buf, dependencyTypes(p), vars, fail), fail, recoverPanics, out, imports, resolver)
+	}, out, imports, resolver)
+}
+
+func writeInitSignature(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, name, variadic string, nolint string, out string, imports map[string]string, resolver types.PackageNameResolver) string {
+	var params []string
+	if r.UsesContext {
+		params = append(params, "ctx context.Context")
+	}
+	if syms.usesInitOptions(r) {
+		params = append(params, initOptionsParam+" "+syms.initOptions)
+	} else {
+		if r.UsesArgs {
+			params = append(params, argsParam+" []string")
+		}
+		for _, e := range r.Externals {
+			params = append(params, e.VarName+" "+formatType(e.Type, out, imports, resolver))
+		}
+	}
+	if len(invocationFlags(r.Invocations)) > 0 {
+		params = append(params, runOptionsParam+" "+syms.runOptions)
+	}
+	if variadic != "" {
+		params = append(params, variadic)
+	}
+	buf.WriteString(nolint)
+	if hasCleanups(r.Providers) {
+		buf.WriteString(fmt.Sprintf("func %s(%s) (*%s, func(), error) {\n", name, strings.Join(params, ", "), syms.app))
+		writeRequiredChecks(buf, r, syms, "return nil, nil, ")
+		writeCleanupCollector(buf)
+		return "cleanup()\n\t\treturn nil, nil, err"
+	}
+	buf.WriteString(fmt.Sprintf("func %s(%s) (*%s, error) {\n", name, strings.Join(params, ", "), syms.app))
+	writeRequiredChecks(buf, r, syms, "return nil, ")
+	return "return nil, err"
+}
 
+func initInputs(r *analyzer.Result, syms *symbols) map[string]string {
 	vars := make(map[string]string)
+	if syms.usesInitOptions(r) {
+		if r.UsesArgs {
+			vars["[]string@"+argsParam] = initOptionsParam + ".Args"
+		}
+		for _, e := range r.Externals {
+			vars[e.Type.Key()] = initOptionsParam + "." + toUpper(e.VarName)
+		}
+		return vars
+	}
+	if r.UsesArgs {
+		vars["[]string@"+argsParam] = argsParam
+	}
+	for _, e := range r.Externals {
+		vars[e.Type.Key()] = e.VarName
+	}
+	return vars
+}
+
+func writeInitOptions(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	buf.WriteString(fmt.Sprintf("type %s struct {\n", syms.initOptions))
+	if r.UsesArgs {
+		buf.WriteString("\tArgs []string\n")
+	}
+	for _, e := range r.Externals {
+		buf.WriteString(fmt.Sprintf("\t%s %s\n", toUpper(e.VarName), formatType(e.Type, out, imports, resolver)))
+	}
+	buf.WriteString("}\n")
+}
+
+func requiredImports(externals []types.External) []string {
+	var paths []string
+	for _, e := range externals {
+		if !e.Required {
+			continue
+		}
+		if len(paths) == 0 {
+			paths = append(paths, "errors")
+		}
+		if !nillable(e.Type) && !isBuiltinType(e.Type) {
+			return append(paths, "reflect")
+		}
+	}
+	return paths
+}
+
+func writeRequiredChecks(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, ret string) {
+	vars := initInputs(r, syms)
+	written := false
+	for _, e := range r.Externals {
+		if !e.Required {
+			continue
+		}
+		value := vars[e.Type.Key()]
+		label := "external " + e.VarName
+		if syms.usesInitOptions(r) {
+			label = syms.initOptions + "." + toUpper(e.VarName)
+		}
+		var cond string
+		switch {
+		case nillable(e.Type):
+			cond = value + " == nil"
+		case isBuiltinType(e.Type):
+			cond = value + " == " + zeroLiteral(e.Type.Name)
+		default:
+			cond = fmt.Sprintf("v := reflect.ValueOf(%s); !v.IsValid() || v.IsZero()", value)
+		}
+		buf.WriteString(fmt.Sprintf("\tif %s {\n", cond))
+		buf.WriteString(fmt.Sprintf("\t\t%serrors.New(%q)\n", ret, label+" is required"))
+		buf.WriteString("\t}\n")
+		written = true
+	}
+	if written {
+		buf.WriteString("\n")
+	}
+}
+
+func nillable(t types.TypeRef) bool {
+	if t.ImportPath == "" && (t.Name == "any" || t.Name == "error") {
+		return true
+	}
+	return t.IsPointer || t.IsSlice || t.MapKey != nil || t.Func != nil
+}
+
+func isBuiltinType(t types.TypeRef) bool {
+	return t.ImportPath == "" && t.Func == nil
+}
+
+func zeroLiteral(name string) string {
+	switch name {
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	}
+	return "0"
+}
 
+func writeInitBody(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, fields []types.Provider, t *transients, fail string, provide func(buf *bytes.Buffer, p types.Provider, vars map[string]string), out string, imports map[string]string, resolver types.PackageNameResolver) {
+	vars := initInputs(r, syms)
+	if r.UsesContext {
+		vars["context.Context"] = "ctx"
+	}
+
+	lazy := newLazyWriter(r.LazyProviders, t, syms)
 	if len(r.Providers) > 0 {
 		buf.WriteString("\t// provide\n")
 		for _, p := range r.Providers {
-			writeProvider(buf, p, vars, out, imports, resolver)
-			vars[p.ProvidedType.Key()] = p.VarName
+			lazy.require(buf, dependencyTypes(p), vars)
+			provide(buf, p, vars)
+			if p.Group == "" {
+				vars[p.ProvidedType.Key()] = p.VarName
+			}
+		}
+	}
+
+	if pending := lazy.pending(r.LazyProviders); len(pending) > 0 {
+		buf.WriteString("\n\t// lazy\n")
+		for _, p := range pending {
+			lazy.require(buf, []types.TypeRef{types.Accessor(p.ProvidedType, true)}, vars)
 		}
 	}
 
 	if len(r.Invocations) > 0 {
 		buf.WriteString("\n\t// invoke\n")
 		for _, inv := range r.Invocations {
-			writeInvocation(buf, inv, vars, out, imports, resolver)
+			if inv.Flag == "" {
+				writeInvocation(buf, inv, t.inject(buf, inv.Dependencies, vars, fail), t.declared, fail, out, imports, resolver)
+				continue
+			}
+			var body bytes.Buffer
+			writeInvocation(&body, inv, t.inject(&body, inv.Dependencies, vars, fail), t.declared, fail, out, imports, resolver)
+			buf.WriteString(fmt.Sprintf("\tif %s.%s {\n", runOptionsParam, flagField(inv.Flag)))
+			buf.WriteString(strings.TrimRight(body.String(), "\n"))
+			buf.WriteString("\n\t}\n")
+			if inv.CanError {
+				buf.WriteString("\n")
+			}
 		}
 	}
 
-	buf.WriteString("\treturn &App{\n")
-	for _, p := range r.Providers {
+	buf.WriteString(fmt.Sprintf("\treturn &%s{\n", syms.app))
+	for _, p := range fields {
+		buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", syms.field(p.VarName), p.VarName))
+	}
+	for _, p := range r.LazyProviders {
+		buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", syms.field(p.VarName), lazyAccessor(p, t, syms)))
+	}
+	for _, p := range r.LazyProviders {
+		holder := syms.lazyHolder(p.VarName)
+		buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", holder, holder))
+	}
+	if hasCleanups(r.Providers) {
+		buf.WriteString("\t}, cleanup, nil\n")
+	} else {
+		buf.WriteString("\t}, nil\n")
+	}
+	buf.WriteString("}\n")
+}
+
+func invocationFlags(invocations []types.Invocation) []string {
+	seen := make(map[string]bool)
+	var flags []string
+	for _, inv := range invocations {
+		if inv.Flag == "" || seen[inv.Flag] {
+			continue
+		}
+		seen[inv.Flag] = true
+		flags = append(flags, inv.Flag)
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+func flagField(flag string) string {
+	words := strings.Split(flag, "-")
+	for i, w := range words {
+		words[i] = toUpper(w)
+	}
+	return strings.Join(words, "")
+}
+
+func writeRunOptions(buf *bytes.Buffer, syms *symbols, flags []string, invocations []types.Invocation) {
+	names := make(map[string][]string)
+	for _, inv := range invocations {
+		names[inv.Flag] = append(names[inv.Flag], inv.Name)
+	}
+
+	buf.WriteString(fmt.Sprintf("type %s struct {\n", syms.runOptions))
+	for _, f := range flags {
+		buf.WriteString(fmt.Sprintf("\t%s bool\n", flagField(f)))
+	}
+	buf.WriteString("}\n\n")
+
+	buf.WriteString(fmt.Sprintf("func %s() %s {\n", syms.defaultRunOptions, syms.runOptions))
+	buf.WriteString(fmt.Sprintf("\treturn %s{\n", syms.runOptions))
+	for _, f := range flags {
+		buf.WriteString(fmt.Sprintf("\t\t%s: true,\n", flagField(f)))
+	}
+	buf.WriteString("\t}\n")
+	buf.WriteString("}\n\n")
+
+	buf.WriteString(fmt.Sprintf("func (o *%s) RegisterFlags(fs *flag.FlagSet) {\n", syms.runOptions))
+	for _, f := range flags {
+		usage := "run " + strings.Join(names[f], ", ")
+		buf.WriteString(fmt.Sprintf("\tfs.BoolVar(&o.%s, %q, o.%s, %q)\n", flagField(f), f, flagField(f), usage))
+	}
+	buf.WriteString("}\n")
+}
+
+func hasCleanups(providers []types.Provider) bool {
+	for _, p := range providers {
+		if p.HasCleanup {
+			return true
+		}
+	}
+	return false
+}
+
+func writeCleanupCollector(buf *bytes.Buffer) {
+	buf.WriteString("\tvar cleanups []func()\n")
+	buf.WriteString("\tcleanup := func() {\n")
+	buf.WriteString("\t\tfor i := len(cleanups) - 1; i >= 0; i-- {\n")
+	buf.WriteString("\t\t\tcleanups[i]()\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t}\n\n")
+}
+
+func writeRequestScope(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, tags []fieldTag, nolint string, recoverPanics, accessors bool, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	writeAppStruct(buf, syms.requestScope, r.RequestProviders, nil, nil, nil, nil, toUpper, tags, out, imports, resolver)
+	buf.WriteString("\n")
+
+	vars := appVars(r, syms)
+	vars["context.Context"] = "ctx"
+	params, names := helperParams(r.RequestParams, map[string]string{}, out, imports, resolver)
+	declared := varNames(r.RequestProviders)
+	for key, name := range names {
+		vars[key] = name
+		declared = append(declared, name)
+	}
+	t := newTransients(r.TransientProviders, declared, recoverPanics, out, imports, resolver)
+	if params != "" {
+		params = ", " + params
+	}
+
+	buf.WriteString(nolint)
+	buf.WriteString(fmt.Sprintf("func (a *%s) NewRequestScope(ctx context.Context%s) (*%s, func(), error) {\n", syms.app, params, syms.requestScope))
+	cleanup := hasCleanups(r.RequestProviders)
+	fail := "return nil, nil, err"
+	if cleanup {
+		writeCleanupCollector(buf)
+		fail = "cleanup()\n\t\t" + fail
+	}
+	for i, p := range r.RequestProviders {
+		writeProvider(buf, p, t.inject(buf, dependencyTypes(p), vars, fail), fail, recoverPanics, out, imports, resolver)
+		vars[p.ProvidedType.Key()] = p.VarName
+		if accessors && slices.ContainsFunc(r.RequestProviders[i+1:], t.needsContext) {
+			buf.WriteString(fmt.Sprintf("\tctx = %s(ctx, %s)\n", syms.withContext(p.VarName), p.VarName))
+		}
+	}
+
+	buf.WriteString(fmt.Sprintf("\treturn &%s{\n", syms.requestScope))
+	for _, p := range r.RequestProviders {
 		buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", toUpper(p.VarName), p.VarName))
 	}
-	buf.WriteString("\t}, nil\n")
+	if cleanup {
+		buf.WriteString("\t}, cleanup, nil\n")
+	} else {
+		buf.WriteString("\t}, func() {}, nil\n")
+	}
+	buf.WriteString("}\n")
+}
+
+func writeContextAccessors(buf *bytes.Buffer, syms *symbols, providers []types.Provider, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	buf.WriteString(fmt.Sprintf("// WithContext returns a copy of ctx carrying every value of the %s.\n", syms.requestScope))
+	buf.WriteString(fmt.Sprintf("func (s *%s) WithContext(ctx context.Context) context.Context {\n", syms.requestScope))
+	for _, p := range providers {
+		buf.WriteString(fmt.Sprintf("\tctx = %s(ctx, s.%s)\n", syms.withContext(p.VarName), toUpper(p.VarName)))
+	}
+	buf.WriteString("\treturn ctx\n}\n")
+
+	for _, p := range providers {
+		typeName := formatType(p.ProvidedType, out, imports, resolver)
+		key := syms.contextKey(p.VarName)
+		buf.WriteString(fmt.Sprintf("\ntype %s struct{}\n\n", key))
+		buf.WriteString(fmt.Sprintf("func %s(ctx context.Context, v %s) context.Context {\n", syms.withContext(p.VarName), typeName))
+		buf.WriteString(fmt.Sprintf("\treturn context.WithValue(ctx, %s{}, v)\n}\n\n", key))
+		buf.WriteString(fmt.Sprintf("func %s(ctx context.Context) (%s, bool) {\n", syms.fromContext(p.VarName), typeName))
+		buf.WriteString(fmt.Sprintf("\tv, ok := ctx.Value(%s{}).(%s)\n\treturn v, ok\n}\n", key, typeName))
+	}
+}
+
+func writeDebugDump(buf *bytes.Buffer, syms *symbols, providers, lazy []types.Provider, nolint string, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	buf.WriteString(nolint)
+	buf.WriteString(fmt.Sprintf("func (a *%s) DebugDump(w io.Writer) {\n", syms.app))
+	for _, p := range providers {
+		typeName := formatType(p.ProvidedType, out, imports, resolver)
+		buf.WriteString(fmt.Sprintf("\tfmt.Fprintf(w, \"%%s\\t%%s\\t%%T\\t%%s\\n\", %q, %q, a.%s, %q)\n",
+			toUpper(p.VarName), typeName, syms.field(p.VarName), "eager"))
+	}
+	for _, p := range lazy {
+		typeName := formatType(p.ProvidedType, out, imports, resolver)
+		buf.WriteString(fmt.Sprintf("\tif v, ok := a.%s.built(); ok {\n", syms.lazyHolder(p.VarName)))
+		buf.WriteString(fmt.Sprintf("\t\tfmt.Fprintf(w, \"%%s\\t%%s\\t%%T\\t%%s\\n\", %q, %q, v, %q)\n",
+			toUpper(p.VarName), typeName, "lazy, built"))
+		buf.WriteString("\t} else {\n")
+		buf.WriteString(fmt.Sprintf("\t\tfmt.Fprintf(w, \"%%s\\t%%s\\t%%s\\t%%s\\n\", %q, %q, \"-\", %q)\n",
+			toUpper(p.VarName), typeName, "lazy, not built"))
+		buf.WriteString("\t}\n")
+	}
+	buf.WriteString("}\n\n")
+
+	buf.WriteString(fmt.Sprintf("func (a *%s) String() string {\n", syms.app))
+	buf.WriteString("\tvar sb strings.Builder\n")
+	buf.WriteString("\ta.DebugDump(&sb)\n")
+	buf.WriteString("\treturn sb.String()\n")
+	buf.WriteString("}\n")
+}
+
+func writeCleanup(buf *bytes.Buffer, syms *symbols, providers, lazy []types.Provider, nolint string) {
+	buf.WriteString(nolint)
+	buf.WriteString(fmt.Sprintf("func (a *%s) Cleanup() error {\n", syms.app))
+	closers := closables(providers)
+	if len(closers)+len(lazy) == 0 {
+		buf.WriteString("\treturn nil\n}\n")
+		return
+	}
+	buf.WriteString("\tvar errs []error\n")
+	for i := len(lazy) - 1; i >= 0; i-- {
+		buf.WriteString(fmt.Sprintf("\tif v, ok := a.%s.built(); ok {\n", syms.lazyHolder(lazy[i].VarName)))
+		buf.WriteString("\t\tif c, ok := any(v).(io.Closer); ok {\n")
+		buf.WriteString("\t\t\tif err := c.Close(); err != nil {\n")
+		buf.WriteString("\t\t\t\terrs = append(errs, err)\n")
+		buf.WriteString("\t\t\t}\n")
+		buf.WriteString("\t\t}\n")
+		buf.WriteString("\t}\n")
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		buf.WriteString(fmt.Sprintf("\tif c, ok := any(a.%s).(io.Closer); ok {\n", syms.field(closers[i].VarName)))
+		buf.WriteString("\t\tif err := c.Close(); err != nil {\n")
+		buf.WriteString("\t\t\terrs = append(errs, err)\n")
+		buf.WriteString("\t\t}\n")
+		buf.WriteString("\t}\n")
+	}
+	buf.WriteString("\treturn errors.Join(errs...)\n")
+	buf.WriteString("}\n")
+}
+
+func closables(providers []types.Provider) []types.Provider {
+	var closers []types.Provider
+	for _, p := range providers {
+		if p.Kind != types.ProviderKindGroup && !p.HasCleanup {
+			closers = append(closers, p)
+		}
+	}
+	return closers
+}
+
+func writeLifecycle(buf *bytes.Buffer, syms *symbols, providers []types.Provider, nolint string) {
+	var hooks []string
+	for _, p := range providers {
+		if p.Kind != types.ProviderKindGroup {
+			hooks = append(hooks, "a."+syms.field(p.VarName))
+		}
+	}
+	list := fmt.Sprintf("[]any{%s}", strings.Join(hooks, ", "))
+
+	buf.WriteString(nolint)
+	buf.WriteString(fmt.Sprintf("func (a *%s) Start(ctx context.Context) error {\n", syms.app))
+	buf.WriteString(fmt.Sprintf("\thooks := %s\n", list))
+	buf.WriteString("\tfor i, hook := range hooks {\n")
+	buf.WriteString("\t\ts, ok := hook.(interface{ Start(context.Context) error })\n")
+	buf.WriteString("\t\tif !ok {\n\t\t\tcontinue\n\t\t}\n")
+	buf.WriteString("\t\tif err := s.Start(ctx); err != nil {\n")
+	buf.WriteString(fmt.Sprintf("\t\t\treturn errors.Join(err, %s(ctx, hooks[:i]))\n", syms.stopHooks))
+	buf.WriteString("\t\t}\n\t}\n\treturn nil\n}\n\n")
+
+	buf.WriteString(nolint)
+	buf.WriteString(fmt.Sprintf("func (a *%s) Stop(ctx context.Context) error {\n", syms.app))
+	buf.WriteString(fmt.Sprintf("\treturn %s(ctx, %s)\n}\n\n", syms.stopHooks, list))
+
+	buf.WriteString(fmt.Sprintf("func %s(ctx context.Context, hooks []any) error {\n", syms.stopHooks))
+	buf.WriteString("\tvar errs []error\n")
+	buf.WriteString("\tfor i := len(hooks) - 1; i >= 0; i-- {\n")
+	buf.WriteString("\t\tif s, ok := hooks[i].(interface{ Stop(context.Context) error }); ok {\n")
+	buf.WriteString("\t\t\tif err := s.Stop(ctx); err != nil {\n")
+	buf.WriteString("\t\t\t\terrs = append(errs, err)\n")
+	buf.WriteString("\t\t\t}\n\t\t}\n\t}\n")
+	buf.WriteString("\treturn errors.Join(errs...)\n}\n")
+}
+
+func writeWireHelpers(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	providers := append(append(append(append(append([]types.Provider{}, r.Providers...), r.RequestProviders...), r.TransientProviders...), r.WeakProviders...), r.LazyProviders...)
+	vars := writeProviderHelpers(buf, providers, syms, out, imports, resolver)
+
+	for _, inv := range r.Invocations {
+		params, names := helperParams(inv.Dependencies, vars, out, imports, resolver)
+		args := make([]string, len(inv.Dependencies))
+		for i, dep := range inv.Dependencies {
+			args[i] = argValue(dep, names)
+		}
+		fn := qualifiedName(inv.Name, inv.ImportPath, out, imports, resolver)
+		if inv.Collector != "" {
+			declared := make(map[string]bool)
+			for _, name := range names {
+				declared[name] = true
+			}
+			if inv.CanError {
+				buf.WriteString(fmt.Sprintf("\nfunc %s(%s) error {\n", syms.invoke(inv.Name), params))
+				writeCollectorLoop(buf, inv, fn, args, "return err", declared)
+				buf.WriteString("\treturn nil\n}\n")
+				continue
+			}
+			buf.WriteString(fmt.Sprintf("\nfunc %s(%s) {\n", syms.invoke(inv.Name), params))
+			writeCollectorLoop(buf, inv, fn, args, "", declared)
+			buf.WriteString("}\n")
+			continue
+		}
+		call := fmt.Sprintf("%s(%s)", fn, strings.Join(args, ", "))
+
+		if inv.ErrorType != "" {
+			buf.WriteString(fmt.Sprintf("\nfunc %s(%s) error {\n\tif err := %s; err != nil {\n\t\treturn err\n\t}\n\treturn nil\n}\n", syms.invoke(inv.Name), params, call))
+			continue
+		}
+		if inv.CanError {
+			buf.WriteString(fmt.Sprintf("\nfunc %s(%s) error {\n\treturn %s\n}\n", syms.invoke(inv.Name), params, call))
+			continue
+		}
+		buf.WriteString(fmt.Sprintf("\nfunc %s(%s) {\n\t%s\n}\n", syms.invoke(inv.Name), params, call))
+	}
+}
+
+func writeProviderHelpers(buf *bytes.Buffer, providers []types.Provider, syms *symbols, out string, imports map[string]string, resolver types.PackageNameResolver) map[string]string {
+	vars := map[string]string{"context.Context": "ctx"}
+	for _, p := range providers {
+		if p.Group == "" {
+			vars[p.ProvidedType.Key()] = p.VarName
+		}
+	}
+
+	for _, p := range providers {
+		if p.Kind == types.ProviderKindGroup {
+			writeGroupHelper(buf, p, syms, out, imports, resolver)
+			continue
+		}
+
+		deps := make([]types.TypeRef, len(p.Dependencies))
+		for i, dep := range p.Dependencies {
+			deps[i] = dep.Type
+		}
+		params, names := helperParams(deps, vars, out, imports, resolver)
+		result := formatType(p.ProvidedType, out, imports, resolver)
+		switch {
+		case p.HasCleanup && p.CanError:
+			result = fmt.Sprintf("(%s, func(), error)", result)
+		case p.HasCleanup:
+			result = fmt.Sprintf("(%s, func())", result)
+		case p.CanError:
+			result = fmt.Sprintf("(%s, error)", result)
+		}
+
+		buf.WriteString(fmt.Sprintf("\nfunc %s(%s) %s {\n", syms.wire(p.VarName), params, result))
+		switch p.Kind {
+		case types.ProviderKindStruct:
+			typeName := strings.TrimPrefix(formatType(p.ProvidedType, out, imports, resolver), "*")
+			buf.WriteString(fmt.Sprintf("\treturn &%s{\n", typeName))
+			for _, dep := range p.Dependencies {
+				buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", dep.FieldName, argValue(dep.Type, names)))
+			}
+			buf.WriteString("\t}\n")
+		case types.ProviderKindFunc:
+			fn := qualifiedName(p.Name, p.ImportPath, out, imports, resolver)
+			buf.WriteString(fmt.Sprintf("\treturn %s\n", providerCall(p, fn, makeArgs(p.Dependencies, names), out, imports, resolver)))
+		case types.ProviderKindValue:
+			buf.WriteString(fmt.Sprintf("\treturn %s(%s)\n", result, ldflagVar(p)))
+		case types.ProviderKindVar:
+			buf.WriteString(fmt.Sprintf("\treturn %s\n", qualifiedName(p.Name, p.ImportPath, out, imports, resolver)))
+		case types.ProviderKindConfig:
+			buf.WriteString("\treturn ")
+			writeConfigLoader(buf, p, "\t", out, imports, resolver)
+			buf.WriteString("\n")
+		}
+		buf.WriteString("}\n")
+	}
+	return vars
+}
+
+func writeGroupHelper(buf *bytes.Buffer, p types.Provider, syms *symbols, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	params := make([]string, len(p.Members))
+	members := make([]string, len(p.Members))
+	for i, m := range p.Members {
+		params[i] = m.VarName + " " + formatType(m.ProvidedType, out, imports, resolver)
+		members[i] = m.VarName
+	}
+	typeName := formatType(p.ProvidedType, out, imports, resolver)
+	buf.WriteString(fmt.Sprintf("\nfunc %s(%s) %s {\n", syms.wire(p.VarName), strings.Join(params, ", "), typeName))
+	buf.WriteString(fmt.Sprintf("\treturn %s{%s}\n", typeName, strings.Join(members, ", ")))
 	buf.WriteString("}\n")
 }
 
-func writeProvider(buf *bytes.Buffer, p types.Provider, vars map[string]string, out string, imports map[string]string, resolver types.PackageNameResolver) {
+func helperParams(deps []types.TypeRef, vars map[string]string, out string, imports map[string]string, resolver types.PackageNameResolver) (string, map[string]string) {
+	names := make(map[string]string)
+	used := make(map[string]bool)
+	var params []string
+	for _, dep := range deps {
+		key := dep.Key()
+		if _, ok := names[key]; ok || dep.Default != "" {
+			continue
+		}
+		name := vars[key]
+		if name == "" && dep.Qualifier != "" {
+			name = dep.Qualifier
+		}
+		if name == "" {
+			name = toLower(dep.Name)
+		}
+		for base, i := name, 1; used[name]; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		used[name] = true
+		names[key] = name
+		params = append(params, name+" "+formatType(dep, out, imports, resolver))
+	}
+	return strings.Join(params, ", "), names
+}
+
+func writeProvider(buf *bytes.Buffer, p types.Provider, vars map[string]string, fail string, recoverPanics bool, out string, imports map[string]string, resolver types.PackageNameResolver) {
 	switch p.Kind {
 	case types.ProviderKindStruct:
 		writeStructInit(buf, p, vars, out, imports, resolver)
 	case types.ProviderKindFunc:
-		writeFuncInit(buf, p, vars, out, imports, resolver)
+		writeFuncInit(buf, p, vars, fail, recoverPanics, out, imports, resolver)
+	case types.ProviderKindGroup:
+		writeGroupInit(buf, p, out, imports, resolver)
+	case types.ProviderKindValue:
+		buf.WriteString(fmt.Sprintf("\t%s := %s(%s)\n", p.VarName, formatType(p.ProvidedType, out, imports, resolver), ldflagVar(p)))
+	case types.ProviderKindVar:
+		buf.WriteString(fmt.Sprintf("\t%s := %s\n", p.VarName, qualifiedName(p.Name, p.ImportPath, out, imports, resolver)))
+	case types.ProviderKindConfig:
+		writeConfigInit(buf, p, fail, out, imports, resolver)
 	}
 }
 
+func writeGroupInit(buf *bytes.Buffer, p types.Provider, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	members := make([]string, len(p.Members))
+	for i, m := range p.Members {
+		members[i] = m.VarName
+	}
+	typeName := formatType(p.ProvidedType, out, imports, resolver)
+	buf.WriteString(fmt.Sprintf("\t%s := %s{%s}\n", p.VarName, typeName, strings.Join(members, ", ")))
+}
+
 func writeStructInit(buf *bytes.Buffer, p types.Provider, vars map[string]string, out string, imports map[string]string, resolver types.PackageNameResolver) {
 	typeName := formatType(p.ProvidedType, out, imports, resolver)
 	typeName = strings.TrimPrefix(typeName, "*")
@@ -106,46 +1318,154 @@ func writeStructInit(buf *bytes.Buffer, p types.Provider, vars map[string]string
 
 	buf.WriteString(fmt.Sprintf("\t%s := &%s{\n", p.VarName, typeName))
 	for _, dep := range p.Dependencies {
-		buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", dep.FieldName, vars[dep.Type.Key()]))
+		buf.WriteString(fmt.Sprintf("\t\t%s: %s,\n", dep.FieldName, argValue(dep.Type, vars)))
 	}
 	buf.WriteString("\t}\n")
 }
 
-func writeFuncInit(buf *bytes.Buffer, p types.Provider, vars map[string]string, out string, imports map[string]string, resolver types.PackageNameResolver) {
+func writeFuncInit(buf *bytes.Buffer, p types.Provider, vars map[string]string, fail string, recoverPanics bool, out string, imports map[string]string, resolver types.PackageNameResolver) {
 	args := makeArgs(p.Dependencies, vars)
 	fn := qualifiedName(p.Name, p.ImportPath, out, imports, resolver)
 
+	values := p.VarName
+	if p.HasCleanup {
+		values += ", " + p.VarName + "Cleanup"
+	}
+	results := values
 	if p.CanError {
-		buf.WriteString(fmt.Sprintf("\t%s, err := %s(%s)\n", p.VarName, fn, args))
-		buf.WriteString("\tif err != nil {\n\t\treturn nil, err\n\t}\n\n")
-		return
+		results += ", err"
+	}
+	call := providerCall(p, fn, args, out, imports, resolver)
+	if recoverPanics {
+		writeRecoveredCall(buf, p, values, call, out, imports, resolver)
+		p.CanError = true
+	} else {
+		buf.WriteString(fmt.Sprintf("\t%s := %s\n", results, call))
+	}
+	if p.CanError {
+		buf.WriteString(fmt.Sprintf("\tif err != nil {\n\t\t%s\n\t}\n", wrapFail(fail, "initializing", p.Name, p.ImportPath, resolver)))
+	}
+	if p.HasCleanup {
+		buf.WriteString(fmt.Sprintf("\tcleanups = append(cleanups, %sCleanup)\n", p.VarName))
+	}
+	if p.CanError || p.HasCleanup {
+		buf.WriteString("\n")
 	}
-	buf.WriteString(fmt.Sprintf("\t%s := %s(%s)\n", p.VarName, fn, args))
 }
 
-func writeInvocation(buf *bytes.Buffer, inv types.Invocation, vars map[string]string, out string, imports map[string]string, resolver types.PackageNameResolver) {
+func providerCall(p types.Provider, fn, args string, out string, imports map[string]string, resolver types.PackageNameResolver) string {
+	call := fmt.Sprintf("%s(%s)", fn, args)
+	if p.ErrorType == "" {
+		return call
+	}
+	values := "v"
+	results := formatType(p.ProvidedType, out, imports, resolver)
+	if p.HasCleanup {
+		values += ", cleanup"
+		results += ", func()"
+	}
+	return fmt.Sprintf("func() (%s, error) {\n\t%s, err := %s\n\tif err != nil {\n\t\treturn %s, err\n\t}\n\treturn %s, nil\n}()", results, values, call, values, values)
+}
+
+func writeRecoveredCall(buf *bytes.Buffer, p types.Provider, values, call string, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	signature := "_ " + formatType(p.ProvidedType, out, imports, resolver)
+	if p.HasCleanup {
+		signature += ", _ func()"
+	}
+	buf.WriteString(fmt.Sprintf("\t%s, err := func() (%s, err error) {\n", values, signature))
+	buf.WriteString("\t\tdefer func() {\n")
+	buf.WriteString("\t\t\tif r := recover(); r != nil {\n")
+	buf.WriteString("\t\t\t\terr = fmt.Errorf(\"panic: %v\", r)\n")
+	buf.WriteString("\t\t\t}\n")
+	buf.WriteString("\t\t}()\n")
+	if p.CanError {
+		buf.WriteString(fmt.Sprintf("\t\treturn %s\n", call))
+	} else {
+		buf.WriteString(fmt.Sprintf("\t\t%s := %s\n", values, call))
+		buf.WriteString(fmt.Sprintf("\t\treturn %s, nil\n", values))
+	}
+	buf.WriteString("\t}()\n")
+}
+
+func writeInvocation(buf *bytes.Buffer, inv types.Invocation, vars map[string]string, declared map[string]bool, fail string, out string, imports map[string]string, resolver types.PackageNameResolver) {
 	args := make([]string, len(inv.Dependencies))
 	for i, dep := range inv.Dependencies {
-		args[i] = vars[dep.Key()]
+		args[i] = argValue(dep, vars)
 	}
 	fn := qualifiedName(inv.Name, inv.ImportPath, out, imports, resolver)
+	fail = wrapFail(fail, "invoking", inv.Name, inv.ImportPath, resolver)
+	if inv.Collector != "" {
+		writeCollectorLoop(buf, inv, fn, args, fail, declared)
+		if inv.CanError {
+			buf.WriteString("\n")
+		}
+		return
+	}
 	argStr := strings.Join(args, ", ")
 
 	if inv.CanError {
-		buf.WriteString(fmt.Sprintf("\tif err := %s(%s); err != nil {\n\t\treturn nil, err\n\t}\n\n", fn, argStr))
+		buf.WriteString(fmt.Sprintf("\tif err := %s(%s); err != nil {\n\t\t%s\n\t}\n\n", fn, argStr, fail))
 		return
 	}
 	buf.WriteString(fmt.Sprintf("\t%s(%s)\n", fn, argStr))
 }
 
+func writeCollectorLoop(buf *bytes.Buffer, inv types.Invocation, fn string, args []string, fail string, declared map[string]bool) {
+	elem := inv.Dependencies[inv.Collect]
+	elem.IsSlice = false
+	member := toLower(elem.Name)
+	for base, i := member, 1; member == "err" || declared[member]; i++ {
+		member = fmt.Sprintf("%s%d", base, i)
+	}
+
+	call := append([]string{}, args...)
+	call[inv.Collect] = member
+	buf.WriteString(fmt.Sprintf("\tfor _, %s := range %s {\n", member, args[inv.Collect]))
+	if inv.CanError {
+		fail = strings.ReplaceAll(fail, "\n", "\n\t")
+		buf.WriteString(fmt.Sprintf("\t\tif err := %s(%s); err != nil {\n\t\t\t%s\n\t\t}\n", fn, strings.Join(call, ", "), fail))
+	} else {
+		buf.WriteString(fmt.Sprintf("\t\t%s(%s)\n", fn, strings.Join(call, ", ")))
+	}
+	buf.WriteString("\t}\n")
+}
+
+func canFail(r *analyzer.Result, recoverPanics bool) bool {
+	for _, providers := range [][]types.Provider{r.Providers, r.RequestProviders, r.TransientProviders, r.WeakProviders, r.LazyProviders} {
+		for _, p := range providers {
+			if p.CanError || recoverPanics && p.Kind == types.ProviderKindFunc {
+				return true
+			}
+		}
+	}
+	for _, inv := range r.Invocations {
+		if inv.CanError {
+			return true
+		}
+	}
+	return false
+}
+
+func wrapFail(fail, action, name, importPath string, resolver types.PackageNameResolver) string {
+	msg := fmt.Sprintf("%s %s.%s: %%w", action, resolver.ResolveName(importPath), name)
+	return strings.TrimSuffix(fail, "err") + fmt.Sprintf("fmt.Errorf(%q, err)", msg)
+}
+
 func makeArgs(deps []types.Dependency, vars map[string]string) string {
 	args := make([]string, len(deps))
 	for i, dep := range deps {
-		args[i] = vars[dep.Type.Key()]
+		args[i] = argValue(dep.Type, vars)
 	}
 	return strings.Join(args, ", ")
 }
 
+func argValue(dep types.TypeRef, vars map[string]string) string {
+	if dep.Default != "" {
+		return dep.Default
+	}
+	return vars[dep.Key()]
+}
+
 func pkgName(importPath string, imports map[string]string, resolver types.PackageNameResolver) string {
 	if alias := imports[importPath]; alias != "" {
 		return alias
@@ -155,8 +1475,17 @@ func pkgName(importPath string, imports map[string]string, resolver types.Packag
 
 func formatType(t types.TypeRef, out string, imports map[string]string, resolver types.PackageNameResolver) string {
 	prefix := ""
+	if t.MapKey != nil {
+		prefix = "map[" + formatType(*t.MapKey, out, imports, resolver) + "]"
+	}
+	if t.IsSlice {
+		prefix += "[]"
+	}
 	if t.IsPointer {
-		prefix = "*"
+		prefix += "*"
+	}
+	if t.Func != nil {
+		return prefix + formatSignature(*t.Func, out, imports, resolver)
 	}
 	if t.ImportPath == "" || t.ImportPath == out {
 		return prefix + t.Name
@@ -164,6 +1493,27 @@ func formatType(t types.TypeRef, out string, imports map[string]string, resolver
 	return prefix + pkgName(t.ImportPath, imports, resolver) + "." + t.Name
 }
 
+func formatSignature(sig types.Signature, out string, imports map[string]string, resolver types.PackageNameResolver) string {
+	params := make([]string, len(sig.Params))
+	for i, p := range sig.Params {
+		params[i] = formatType(p, out, imports, resolver)
+	}
+	if sig.Variadic && len(params) > 0 {
+		params[len(params)-1] = "..." + params[len(params)-1]
+	}
+	results := make([]string, len(sig.Results))
+	for i, r := range sig.Results {
+		results[i] = formatType(r, out, imports, resolver)
+	}
+	switch len(results) {
+	case 0:
+		return "func(" + strings.Join(params, ", ") + ")"
+	case 1:
+		return "func(" + strings.Join(params, ", ") + ") " + results[0]
+	}
+	return "func(" + strings.Join(params, ", ") + ") (" + strings.Join(results, ", ") + ")"
+}
+
 func qualifiedName(name, importPath, out string, imports map[string]string, resolver types.PackageNameResolver) string {
 	if importPath == out {
 		return name
@@ -171,6 +1521,13 @@ func qualifiedName(name, importPath, out string, imports map[string]string, reso
 	return pkgName(importPath, imports, resolver) + "." + name
 }
 
+func toLower(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
 func toUpper(s string) string {
 	if len(s) == 0 {
 		return s
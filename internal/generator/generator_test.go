@@ -5,6 +5,7 @@ import (
 	"go/parser"
 	"go/token"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -152,6 +153,28 @@ func TestFormatType(t *testing.T) {
 			imports:  map[string]string{"pkg/config": ""},
 			expected: "config.Config",
 		},
+		{
+			name: "variadic func type",
+			typeRef: types.TypeRef{Func: &types.Signature{
+				Params:   []types.TypeRef{{Name: "Context", ImportPath: "context"}, {Name: "Option", ImportPath: outPath}},
+				Results:  []types.TypeRef{{Name: "Config", ImportPath: "pkg/config", IsPointer: true}, {Name: "error"}},
+				Variadic: true,
+			}},
+			imports:  map[string]string{"context": "", "pkg/config": ""},
+			expected: "func(context.Context, ...Option) (*config.Config, error)",
+		},
+		{
+			name:     "slice of funcs",
+			typeRef:  types.TypeRef{IsSlice: true, Func: &types.Signature{Results: []types.TypeRef{{Name: "Time", ImportPath: "time"}}}},
+			imports:  map[string]string{"time": ""},
+			expected: "[]func() time.Time",
+		},
+		{
+			name:     "map keyed by an external type",
+			typeRef:  types.TypeRef{Name: "Handler", ImportPath: outPath, IsSlice: true, MapKey: &types.TypeRef{Name: "Role", ImportPath: "pkg/auth"}},
+			imports:  map[string]string{"pkg/auth": ""},
+			expected: "map[auth.Role][]Handler",
+		},
 		{
 			name:     "external pointer",
 			typeRef:  types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true},
@@ -331,7 +354,7 @@ func TestWriteAppStruct(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	writeAppStruct(&buf, providers, outPath, imports, &mockResolver{})
+	writeAppStruct(&buf, "App", providers, nil, nil, nil, nil, toUpper, nil, outPath, imports, &mockResolver{})
 	result := buf.String()
 
 	assert.Contains(t, result, "type App struct {")
@@ -421,7 +444,7 @@ func TestWriteFuncInit(t *testing.T) {
 				},
 			},
 			vars:     map[string]string{"*pkg/config.Config": "config"},
-			contains: []string{"database, err := db.NewDatabase(config)", "if err != nil {", "return nil, err"},
+			contains: []string{"database, err := db.NewDatabase(config)", "if err != nil {", `return nil, fmt.Errorf("initializing db.NewDatabase: %w", err)`},
 		},
 	}
 
@@ -429,7 +452,7 @@ func TestWriteFuncInit(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			localImports := map[string]string{"pkg/config": "", "pkg/db": ""}
 			var buf bytes.Buffer
-			writeFuncInit(&buf, tt.provider, tt.vars, outPath, localImports, &mockResolver{})
+			writeFuncInit(&buf, tt.provider, tt.vars, "return nil, err", false, outPath, localImports, &mockResolver{})
 			result := buf.String()
 
 			for _, c := range tt.contains {
@@ -475,14 +498,14 @@ func TestWriteInvocation(t *testing.T) {
 				},
 			},
 			vars:     map[string]string{"*pkg/config.Config": "config"},
-			contains: []string{"if err := setup.SetupRoutes(config); err != nil {", "return nil, err"},
+			contains: []string{"if err := setup.SetupRoutes(config); err != nil {", `return nil, fmt.Errorf("invoking setup.SetupRoutes: %w", err)`},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			writeInvocation(&buf, tt.invocation, tt.vars, outPath, imports, &mockResolver{})
+			writeInvocation(&buf, tt.invocation, tt.vars, nil, "return nil, err", outPath, imports, &mockResolver{})
 			result := buf.String()
 
 			for _, c := range tt.contains {
@@ -504,7 +527,7 @@ func TestGenerate_EmptyResult(t *testing.T) {
 		Imports:          map[string]string{},
 	}
 
-	output, err := Generate(result, &mockResolver{})
+	output, err := Generate(result, &mockResolver{}, Options{})
 	require.NoError(t, err)
 
 	outputStr := string(output)
@@ -574,7 +597,7 @@ func TestGenerate_SingleProvider(t *testing.T) {
 				Imports:          tt.imports,
 			}
 
-			output, err := Generate(result, &mockResolver{})
+			output, err := Generate(result, &mockResolver{}, Options{})
 			require.NoError(t, err)
 
 			outputStr := string(output)
@@ -615,7 +638,7 @@ func TestGenerate_WithInvocations(t *testing.T) {
 		Imports:          map[string]string{"pkg/config": "", "pkg/setup": ""},
 	}
 
-	output, err := Generate(result, &mockResolver{})
+	output, err := Generate(result, &mockResolver{}, Options{})
 	require.NoError(t, err)
 
 	outputStr := string(output)
@@ -680,7 +703,7 @@ func TestGenerate_FullOutput(t *testing.T) {
 		},
 	}
 
-	output, err := Generate(result, &mockResolver{})
+	output, err := Generate(result, &mockResolver{}, Options{})
 	require.NoError(t, err)
 
 	outputStr := string(output)
@@ -718,3 +741,1707 @@ func TestGenerate_FullOutput(t *testing.T) {
 	assert.Less(t, configLine, dbLine, "config should be initialized before database")
 	assert.Less(t, dbLine, serviceLine, "database should be initialized before service")
 }
+
+func TestGenerate_DebugDump(t *testing.T) {
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "NewConfig",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "config",
+				ProvidedType: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true},
+				ImportPath:   "pkg/config",
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.NotContains(t, string(output), "DebugDump")
+
+	output, err = Generate(result, &mockResolver{}, Options{DebugDump: true})
+	require.NoError(t, err)
+
+	outputStr := string(output)
+	assert.Contains(t, outputStr, `"io"`)
+	assert.Contains(t, outputStr, "func (a *App) DebugDump(w io.Writer) {")
+	assert.Contains(t, outputStr, `fmt.Fprintf(w, "%s\t%s\t%T\t%s\n", "Config", "*config.Config", a.Config, "eager")`)
+	assert.Contains(t, outputStr, "func (a *App) String() string {")
+
+	fset := token.NewFileSet()
+	_, err = parser.ParseFile(fset, "", output, parser.AllErrors)
+	assert.NoError(t, err, "generated code should be valid Go")
+}
+
+func TestGenerate_Partial(t *testing.T) {
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "NewDatabase",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "database",
+				ProvidedType: types.TypeRef{Name: "Database", ImportPath: "pkg/db", IsPointer: true},
+				ImportPath:   "pkg/db",
+				CanError:     true,
+				Dependencies: []types.Dependency{
+					{Type: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}},
+				},
+			},
+			{
+				Name:         "Service",
+				Kind:         types.ProviderKindStruct,
+				VarName:      "service",
+				ProvidedType: types.TypeRef{Name: "Service", ImportPath: "pkg/service", IsPointer: true},
+				ImportPath:   "pkg/service",
+				Dependencies: []types.Dependency{
+					{FieldName: "DB", Type: types.TypeRef{Name: "Database", ImportPath: "pkg/db", IsPointer: true}},
+				},
+			},
+		},
+		Invocations: []types.Invocation{
+			{
+				Name:       "SetupRoutes",
+				ImportPath: "pkg/routes",
+				CanError:   true,
+				Dependencies: []types.TypeRef{
+					{Name: "Service", ImportPath: "pkg/service", IsPointer: true},
+				},
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports: map[string]string{
+			"pkg/config":  "",
+			"pkg/db":      "",
+			"pkg/service": "",
+			"pkg/routes":  "",
+		},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+
+	outputStr := string(output)
+	assert.NotContains(t, outputStr, "type App struct")
+	assert.NotContains(t, outputStr, "InitializeApp")
+	assert.Contains(t, outputStr, "func wireDatabase(config *config.Config) (*db.Database, error) {")
+	assert.Contains(t, outputStr, "return db.NewDatabase(config)")
+	assert.Contains(t, outputStr, "func wireService(database *db.Database) *service.Service {")
+	assert.Contains(t, outputStr, "DB: database,")
+	assert.Contains(t, outputStr, "func invokeSetupRoutes(service *service.Service) error {")
+	assert.Contains(t, outputStr, "return routes.SetupRoutes(service)")
+
+	fset := token.NewFileSet()
+	_, err = parser.ParseFile(fset, "", output, parser.AllErrors)
+	assert.NoError(t, err, "generated code should be valid Go")
+}
+
+func TestGenerate_Group(t *testing.T) {
+	handler := types.TypeRef{Name: "Handler", ImportPath: "pkg/http"}
+	auth := types.Provider{Name: "NewAuth", Kind: types.ProviderKindFunc, ProvidedType: handler, ImportPath: "pkg/auth", VarName: "handler", Group: "handlers"}
+	logging := types.Provider{Name: "NewLogging", Kind: types.ProviderKindFunc, ProvidedType: handler, ImportPath: "pkg/logging", VarName: "handler1", Group: "handlers"}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			logging,
+			auth,
+			{
+				Name:         "handlers",
+				Kind:         types.ProviderKindGroup,
+				ProvidedType: types.TypeRef{Name: "Handler", ImportPath: "pkg/http", IsSlice: true},
+				VarName:      "handlers",
+				Members:      []types.Provider{logging, auth},
+			},
+			{
+				Name:         "NewServer",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true},
+				ImportPath:   "pkg/http",
+				VarName:      "server",
+				Dependencies: []types.Dependency{
+					{Type: types.TypeRef{Name: "Handler", ImportPath: "pkg/http", IsSlice: true}},
+				},
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/http": "", "pkg/auth": "", "pkg/logging": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "Handlers []http.Handler")
+	assert.Contains(t, outputStr, "handlers := []http.Handler{handler1, handler}")
+	assert.Contains(t, outputStr, "server := http.NewServer(handlers)")
+
+	output, err = Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func wireHandlers(handler1 http.Handler, handler http.Handler) []http.Handler {")
+}
+
+func TestGenerate_RequestScope(t *testing.T) {
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	user := types.TypeRef{Name: "User", ImportPath: "pkg/auth", IsPointer: true}
+	request := types.TypeRef{Name: "Request", ImportPath: "net/http", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewDB", Kind: types.ProviderKindFunc, ProvidedType: db, ImportPath: "pkg/db", VarName: "db"},
+		},
+		RequestProviders: []types.Provider{
+			{
+				Name:         "CurrentUser",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: user,
+				Dependencies: []types.Dependency{
+					{Type: types.TypeRef{Name: "Context", ImportPath: "context"}},
+					{Type: db},
+					{Type: request},
+				},
+				CanError:   true,
+				ImportPath: "pkg/auth",
+				VarName:    "user",
+				Scope:      types.ScopeRequest,
+			},
+		},
+		RequestParams:    []types.TypeRef{request},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/db": "", "pkg/auth": "", "net/http": "", "context": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	outputStr := string(output)
+	appStruct := outputStr[strings.Index(outputStr, "type App struct"):strings.Index(outputStr, "func InitializeApp")]
+	assert.NotContains(t, appStruct, "auth.User")
+	assert.Contains(t, outputStr, "type RequestScope struct {")
+	assert.Contains(t, outputStr, "func (a *App) NewRequestScope(ctx context.Context, request *http.Request) (*RequestScope, func(), error) {")
+	assert.Contains(t, outputStr, "user, err := auth.CurrentUser(ctx, a.Db, request)")
+	assert.Contains(t, outputStr, `return nil, nil, fmt.Errorf("initializing auth.CurrentUser: %w", err)`)
+	assert.Contains(t, outputStr, "}, func() {}, nil")
+
+	fset := token.NewFileSet()
+	_, err = parser.ParseFile(fset, "", output, parser.AllErrors)
+	assert.NoError(t, err, "generated code should be valid Go")
+}
+
+func TestGenerate_RequestScopeContextAccessors(t *testing.T) {
+	ctx := types.TypeRef{Name: "Context", ImportPath: "context"}
+	user := types.TypeRef{Name: "User", ImportPath: "pkg/auth", IsPointer: true}
+	session := types.TypeRef{Name: "Session", ImportPath: "pkg/auth", IsPointer: true}
+	result := &analyzer.Result{
+		RequestProviders: []types.Provider{
+			{Name: "CurrentUser", Kind: types.ProviderKindFunc, ProvidedType: user, Dependencies: []types.Dependency{{Type: ctx}}, ImportPath: "pkg/auth", VarName: "user", Scope: types.ScopeRequest},
+			{Name: "NewSession", Kind: types.ProviderKindFunc, ProvidedType: session, Dependencies: []types.Dependency{{Type: ctx}, {Type: user}}, ImportPath: "pkg/auth", VarName: "session", Scope: types.ScopeRequest},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/auth": "", "context": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{ContextAccessors: true})
+	require.NoError(t, err)
+
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "\tuser := auth.CurrentUser(ctx)\n\tctx = WithUser(ctx, user)\n\tsession := auth.NewSession(ctx, user)\n\treturn &RequestScope{")
+	assert.NotContains(t, outputStr, "ctx = WithSession(ctx, session)")
+	assert.Contains(t, outputStr, "func (s *RequestScope) WithContext(ctx context.Context) context.Context {\n\tctx = WithUser(ctx, s.User)\n\tctx = WithSession(ctx, s.Session)\n\treturn ctx\n}")
+	assert.Contains(t, outputStr, "type ctxKeyUser struct{}")
+	assert.Contains(t, outputStr, "func WithUser(ctx context.Context, v *auth.User) context.Context {\n\treturn context.WithValue(ctx, ctxKeyUser{}, v)\n}")
+	assert.Contains(t, outputStr, "func SessionFromContext(ctx context.Context) (*auth.Session, bool) {\n\tv, ok := ctx.Value(ctxKeySession{}).(*auth.Session)\n\treturn v, ok\n}")
+
+	output, err = Generate(result, &mockResolver{}, Options{ContextAccessors: true, Container: "api"})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func WithApiUser(ctx context.Context, v *auth.User) context.Context {")
+	assert.Contains(t, string(output), "func ApiUserFromContext(ctx context.Context) (*auth.User, bool) {")
+
+	result.RequestProviders[1].VarName = "withContext"
+	_, err = Generate(result, &mockResolver{}, Options{ContextAccessors: true})
+	assert.ErrorContains(t, err, "RequestScope.WithContext conflicts with the field for NewSession")
+}
+
+func TestGenerate_Context(t *testing.T) {
+	ctx := types.TypeRef{Name: "Context", ImportPath: "context"}
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/store", IsPointer: true}
+	conn := types.TypeRef{Name: "Conn", ImportPath: "pkg/store", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, Dependencies: []types.Dependency{{Type: ctx}}, CanError: true, ImportPath: "pkg/store", VarName: "db"},
+		},
+		TransientProviders: []types.Provider{
+			{Name: "Dial", Kind: types.ProviderKindFunc, ProvidedType: conn, Dependencies: []types.Dependency{{Type: ctx}, {Type: db}}, ImportPath: "pkg/store", VarName: "conn", Scope: types.ScopeTransient},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Migrate", ImportPath: "pkg/store", Dependencies: []types.TypeRef{ctx, db}},
+		},
+		UsesContext:      true,
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"context": "", "pkg/store": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "func InitializeApp(ctx context.Context) (*App, error) {")
+	assert.Contains(t, outputStr, "db, err := store.Open(ctx)")
+	assert.Contains(t, outputStr, "store.Migrate(ctx, db)")
+	assert.Contains(t, outputStr, `func (a *App) NewConn(ctx context.Context) *store.Conn {
+	conn := store.Dial(ctx, a.Db)`)
+
+	bench, err := Benchmark(result, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(bench), "InitializeApp(context.Background()); err != nil")
+
+	result.UsesContext = false
+	result.Providers[0].Dependencies = nil
+	result.TransientProviders[0].Dependencies = []types.Dependency{{Type: db}}
+	result.Invocations[0].Dependencies = []types.TypeRef{db}
+	output, err = Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func InitializeApp() (*App, error) {")
+	assert.Contains(t, string(output), "func (a *App) NewConn() *store.Conn {")
+}
+
+func TestGenerate_Args(t *testing.T) {
+	args := types.TypeRef{Name: "string", IsSlice: true, Qualifier: "args"}
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/store", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, ImportPath: "pkg/store", VarName: "db"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Run", ImportPath: "pkg/cli", Dependencies: []types.TypeRef{db, args}, CanError: true},
+		},
+		UsesContext:      true,
+		UsesArgs:         true,
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"context": "", "pkg/cli": "", "pkg/store": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "func InitializeApp(ctx context.Context, args []string) (*App, error) {")
+	assert.Contains(t, outputStr, "if err := cli.Run(db, args); err != nil {")
+
+	bench, err := Benchmark(result, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(bench), "InitializeApp(context.Background(), nil); err != nil")
+
+	output, err = Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func invokeRun(db *store.DB, args []string) error {")
+
+	result.Providers[0].VarName = "args"
+	_, err = Generate(result, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "provider Open conflicts with the args parameter of InitializeApp")
+}
+
+func TestGenerate_CleanupVarConflict(t *testing.T) {
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/store", IsPointer: true}
+	tracker := types.TypeRef{Name: "Cleanup", ImportPath: "pkg/app", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "Open", Kind: types.ProviderKindFunc, ProvidedType: db, ImportPath: "pkg/store", VarName: "db", HasCleanup: true},
+			{Name: "NewCleanup", Kind: types.ProviderKindFunc, ProvidedType: tracker, ImportPath: "pkg/app", VarName: "cleanup"},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/app": "", "pkg/store": ""},
+	}
+
+	_, err := Generate(result, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "provider NewCleanup conflicts with the cleanup variable collecting cleanup functions; rename it with name=")
+
+	result.Providers[1].VarName = "cleanups"
+	_, err = Generate(result, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "provider NewCleanup conflicts with the cleanups variable")
+
+	result.Providers[0].HasCleanup = false
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "cleanups := app.NewCleanup()")
+}
+
+func TestGenerate_TransientScope(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	conn := types.TypeRef{Name: "Conn", ImportPath: "pkg/db", IsPointer: true}
+	job := types.TypeRef{Name: "Job", ImportPath: "pkg/jobs"}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+			{
+				Name:         "NewWorker",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Worker", ImportPath: "pkg/jobs", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: job}, {Type: conn}},
+				ImportPath:   "pkg/jobs",
+				VarName:      "worker",
+			},
+		},
+		TransientProviders: []types.Provider{
+			{
+				Name:         "NewConn",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: conn,
+				Dependencies: []types.Dependency{{Type: config}},
+				CanError:     true,
+				ImportPath:   "pkg/db",
+				VarName:      "conn",
+				Scope:        types.ScopeTransient,
+			},
+			{
+				Name:         "NewJob",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: job,
+				Dependencies: []types.Dependency{{Type: conn}},
+				ImportPath:   "pkg/jobs",
+				VarName:      "job",
+				Scope:        types.ScopeTransient,
+			},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Run", ImportPath: "pkg/jobs", Dependencies: []types.TypeRef{job}},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": "", "pkg/jobs": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	outputStr := string(output)
+
+	appStruct := outputStr[strings.Index(outputStr, "type App struct"):strings.Index(outputStr, "func InitializeApp")]
+	assert.NotContains(t, appStruct, "Conn")
+	assert.NotContains(t, appStruct, "Job")
+	assert.Contains(t, outputStr, `	conn, err := db.NewConn(config)
+	if err != nil {
+		return nil, fmt.Errorf("initializing db.NewConn: %w", err)
+	}
+
+	job := jobs.NewJob(conn)
+	conn1, err := db.NewConn(config)
+	if err != nil {
+		return nil, fmt.Errorf("initializing db.NewConn: %w", err)
+	}
+
+	worker := jobs.NewWorker(job, conn1)
+
+	// invoke
+	conn2, err := db.NewConn(config)
+	if err != nil {
+		return nil, fmt.Errorf("initializing db.NewConn: %w", err)
+	}
+
+	job1 := jobs.NewJob(conn2)
+	jobs.Run(job1)
+`)
+	assert.Contains(t, outputStr, `func (a *App) NewConn() (*db.Conn, error) {
+	conn, err := db.NewConn(a.Config)
+	if err != nil {
+		return nil, fmt.Errorf("initializing db.NewConn: %w", err)
+	}
+
+	return conn, nil
+}`)
+	assert.Contains(t, outputStr, `func (a *App) NewJob() (jobs.Job, error) {
+	conn, err := db.NewConn(a.Config)
+	if err != nil {
+		return *new(jobs.Job), fmt.Errorf("initializing db.NewConn: %w", err)
+	}
+
+	job := jobs.NewJob(conn)
+	return job, nil
+}`)
+
+	result.Providers[1].VarName = "newJob"
+	_, err = Generate(result, &mockResolver{}, Options{})
+	assert.EqualError(t, err, "App.NewJob for transient NewJob conflicts with the field for NewWorker")
+}
+
+func TestGenerate_WeakScope(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+		},
+		WeakProviders: []types.Provider{
+			{
+				Name:         "NewCache",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Cache", ImportPath: "pkg/cache", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: config}},
+				CanError:     true,
+				ImportPath:   "pkg/cache",
+				VarName:      "cache",
+				Scope:        types.ScopeWeak,
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/cache": "", "pkg/config": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "type App struct {\n\tConfig *config.Config\n\n\tweakMu sync.Mutex\n\tcache  weak.Pointer[cache.Cache]\n}")
+	assert.NotContains(t, outputStr, "cache.NewCache(config)")
+	assert.Contains(t, outputStr, `func (a *App) Cache() (*cache.Cache, error) {
+	a.weakMu.Lock()
+	defer a.weakMu.Unlock()
+	if cache := a.cache.Value(); cache != nil {
+		return cache, nil
+	}
+	cache, err := cache.NewCache(a.Config)
+	if err != nil {
+		return nil, fmt.Errorf("initializing cache.NewCache: %w", err)
+	}
+
+	a.cache = weak.Make(cache)
+	return cache, nil
+}`)
+
+	result.Providers[0].VarName = "cache"
+	_, err = Generate(result, &mockResolver{}, Options{})
+	assert.EqualError(t, err, "App.Cache for weak NewCache conflicts with the field for NewConfig")
+}
+
+func TestGenerate_LazyScope(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	model := types.TypeRef{Name: "Model", ImportPath: "pkg/ml", IsPointer: true}
+	tokenizer := types.TypeRef{Name: "Tokenizer", ImportPath: "pkg/ml", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+			{
+				Name:         "NewServer",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Server", ImportPath: "pkg/api", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: types.Accessor(model, true)}, {Type: types.Accessor(tokenizer, false)}},
+				ImportPath:   "pkg/api",
+				VarName:      "server",
+			},
+		},
+		LazyProviders: []types.Provider{
+			{
+				Name:         "LoadModel",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: model,
+				Dependencies: []types.Dependency{{Type: config}},
+				CanError:     true,
+				ImportPath:   "pkg/ml",
+				VarName:      "model",
+				Scope:        types.ScopeLazy,
+			},
+			{
+				Name:         "NewTokenizer",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: tokenizer,
+				ImportPath:   "pkg/ml",
+				VarName:      "tokenizer",
+				Scope:        types.ScopeLazy,
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/ml": "", "pkg/config": "", "pkg/api": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "type App struct {\n\tConfig    *config.Config\n\tServer    *api.Server\n\tModel     func() (*ml.Model, error)\n\tTokenizer func() *ml.Tokenizer\n\n\tlazyModel     *lazyValue[*ml.Model]\n\tlazyTokenizer *lazyValue[*ml.Tokenizer]\n}")
+	assert.Contains(t, outputStr, "type lazyValue[T any] struct {\n\tmu    sync.Mutex\n\tbuild func() (T, error)\n\tdone  bool\n\tvalue T\n\terr   error\n}")
+	assert.Contains(t, outputStr, `	// provide
+	config := config.NewConfig()
+	lazyModel := &lazyValue[*ml.Model]{build: func() (*ml.Model, error) {
+		model1, err := ml.LoadModel(config)
+		if err != nil {
+			return nil, fmt.Errorf("initializing ml.LoadModel: %w", err)
+		}
+
+		return model1, nil
+	}}
+	lazyTokenizer := &lazyValue[*ml.Tokenizer]{build: func() (*ml.Tokenizer, error) {
+		tokenizer1 := ml.NewTokenizer()
+		return tokenizer1, nil
+	}}
+	server := api.NewServer(lazyModel.get, lazyTokenizer.instance)
+`)
+	assert.NotContains(t, outputStr, "// lazy")
+	assert.Contains(t, outputStr, "\t\tModel:         lazyModel.get,\n\t\tTokenizer:     lazyTokenizer.instance,\n\t\tlazyModel:     lazyModel,\n\t\tlazyTokenizer: lazyTokenizer,\n")
+
+	output, err = Generate(result, &mockResolver{}, Options{Cleanup: true, DebugDump: true})
+	require.NoError(t, err)
+	outputStr = string(output)
+	assert.Contains(t, outputStr, `func (a *App) Cleanup() error {
+	var errs []error
+	if v, ok := a.lazyTokenizer.built(); ok {
+		if c, ok := any(v).(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if v, ok := a.lazyModel.built(); ok {`)
+	assert.Contains(t, outputStr, `	if v, ok := a.lazyModel.built(); ok {
+		fmt.Fprintf(w, "%s\t%s\t%T\t%s\n", "Model", "*ml.Model", v, "lazy, built")
+	} else {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "Model", "*ml.Model", "-", "lazy, not built")
+	}`)
+
+	unused := *result
+	unused.Providers = result.Providers[:1]
+	output, err = Generate(&unused, &mockResolver{}, Options{Getters: true})
+	require.NoError(t, err)
+	outputStr = string(output)
+	assert.Contains(t, outputStr, "\n\t// lazy\n\tlazyModel := &lazyValue[*ml.Model]{")
+	assert.Contains(t, outputStr, "func (a *App) Model() (*ml.Model, error) {\n\treturn a.model()\n}")
+
+	_, err = Generate(result, &mockResolver{}, Options{Recover: true})
+	assert.EqualError(t, err, "NewServer requires func() *pkg/ml.Tokenizer, but lazy NewTokenizer can fail; depend on func() (*pkg/ml.Tokenizer, error) instead")
+
+	unused.LazyProviders = slices.Clone(result.LazyProviders)
+	unused.LazyProviders[1].VarName = "start"
+	_, err = Generate(&unused, &mockResolver{}, Options{Lifecycle: true})
+	assert.EqualError(t, err, "App.Start lifecycle method conflicts with the field for NewTokenizer")
+
+	unused.LazyProviders[1].VarName = "lazyModel"
+	_, err = Generate(&unused, &mockResolver{}, Options{})
+	assert.EqualError(t, err, "provider NewTokenizer conflicts with the lazyModel holder of lazy LoadModel; rename it with name=")
+}
+
+func TestGenerate_Getters(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+		},
+		TransientProviders: []types.Provider{
+			{
+				Name:         "NewConn",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Conn", ImportPath: "pkg/db", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: config}},
+				ImportPath:   "pkg/db",
+				VarName:      "conn",
+				Scope:        types.ScopeTransient,
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{Getters: true, Services: true, Cleanup: true})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "type App struct {\n\tconfig *config.Config\n}")
+	assert.Contains(t, outputStr, "func (a *App) Config() *config.Config {\n\treturn a.config\n}")
+	assert.Contains(t, outputStr, "return &App{\n\t\tconfig: config,\n\t}, nil")
+	assert.Contains(t, outputStr, "conn := db.NewConn(a.config)")
+	assert.Contains(t, outputStr, "any(a.config).(io.Closer)")
+	assert.Contains(t, outputStr, `// AppServices lists the methods of App, so callers can depend on an interface.
+type AppServices interface {
+	Config() *config.Config
+	NewConn() *db.Conn
+}
+
+var _ AppServices = (*App)(nil)`)
+
+	_, err = Generate(result, &mockResolver{}, Options{Services: true})
+	assert.EqualError(t, err, "the services interface lists the App getters and requires getters")
+	_, err = Generate(result, &mockResolver{}, Options{Getters: true, FieldTags: []string{"json"}})
+	assert.EqualError(t, err, "field tags require exported App fields and cannot be combined with getters")
+	_, err = Generate(result, &mockResolver{}, Options{Getters: true, Partial: true})
+	assert.EqualError(t, err, "getters require the generated App and are not available in partial mode")
+}
+
+func TestOrderFields(t *testing.T) {
+	providers := []types.Provider{
+		{VarName: "server", ProvidedType: types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true}},
+		{VarName: "config", ProvidedType: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}},
+		{VarName: "handlers", ProvidedType: types.TypeRef{Name: "Handler", ImportPath: "pkg/http", IsSlice: true}},
+		{VarName: "database", ProvidedType: types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}},
+		{VarName: "auth", ProvidedType: types.TypeRef{Name: "Auth", ImportPath: "pkg/zeta/authz"}},
+	}
+	imports := map[string]string{"pkg/http": "", "pkg/config": "", "pkg/db": "", "pkg/zeta/authz": ""}
+
+	tests := []struct {
+		name     string
+		order    FieldOrder
+		expected []string
+	}{
+		{"topological keeps order", FieldOrderTopological, []string{"server", "config", "handlers", "database", "auth"}},
+		{"by type", FieldOrderType, []string{"auth", "config", "database", "handlers", "server"}},
+		{"by package", FieldOrderPackage, []string{"config", "database", "handlers", "server", "auth"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := orderFields(providers, tt.order, "example.com/app", imports, &mockResolver{})
+			names := make([]string, len(fields))
+			for i, f := range fields {
+				names[i] = f.VarName
+			}
+			assert.Equal(t, tt.expected, names)
+			assert.Equal(t, "server", providers[0].VarName, "input must not be reordered")
+		})
+	}
+}
+
+func TestGenerate_Container(t *testing.T) {
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "NewConfig",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "config",
+				ProvidedType: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true},
+				ImportPath:   "pkg/config",
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{Container: "worker", DebugDump: true})
+	require.NoError(t, err)
+
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "type WorkerApp struct {")
+	assert.Contains(t, outputStr, "func InitializeWorkerApp() (*WorkerApp, error) {")
+	assert.Contains(t, outputStr, "return &WorkerApp{")
+	assert.Contains(t, outputStr, "func (a *WorkerApp) DebugDump(w io.Writer) {")
+
+	output, err = Generate(result, &mockResolver{}, Options{Container: "worker", Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func wireWorkerConfig() *config.Config {")
+}
+
+func TestGenerate_LdflagValues(t *testing.T) {
+	version := types.Provider{
+		Name:         "Version",
+		Kind:         types.ProviderKindValue,
+		ProvidedType: types.TypeRef{Name: "Version", ImportPath: "pkg/build"},
+		ImportPath:   "pkg/build",
+		VarName:      "version",
+		Ldflag:       "main.version",
+	}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			version,
+			{
+				Name:         "NewInfo",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Info", ImportPath: "pkg/build", IsPointer: true},
+				ImportPath:   "pkg/build",
+				VarName:      "info",
+				Dependencies: []types.Dependency{{Type: version.ProvidedType}},
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/build": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "var (\n\tversion string\n)")
+	assert.Contains(t, outputStr, "version := build.Version(version)")
+	assert.Contains(t, outputStr, "info := build.NewInfo(version)")
+
+	output, err = Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func wireVersion() build.Version {\n\treturn build.Version(version)\n}")
+
+	result.PackageName = "app"
+	_, err = Generate(result, &mockResolver{}, Options{})
+	assert.EqualError(t, err, "value Version: ldflag main.version must target the output package, e.g. example.com/app.version")
+
+	result.Providers[0].Ldflag = "example.com/app.version"
+	_, err = Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	result.Imports = map[string]string{"pkg/build": "", "pkg/version": ""}
+	_, err = Generate(result, &mockResolver{}, Options{})
+	assert.EqualError(t, err, "generated identifier version conflicts: declared by import pkg/version and value Version")
+}
+
+func TestGenerate_VarProviders(t *testing.T) {
+	registry := types.Provider{
+		Name:         "Default",
+		Kind:         types.ProviderKindVar,
+		ProvidedType: types.TypeRef{Name: "Registry", ImportPath: "pkg/metrics", IsPointer: true},
+		ImportPath:   "pkg/metrics",
+		VarName:      "defaultRegistry",
+	}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			registry,
+			{
+				Name:         "NewExporter",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Exporter", ImportPath: "pkg/metrics", IsPointer: true},
+				ImportPath:   "pkg/metrics",
+				VarName:      "exporter",
+				Dependencies: []types.Dependency{{Type: registry.ProvidedType}},
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/metrics": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "defaultRegistry := metrics.Default\n\texporter := metrics.NewExporter(defaultRegistry)")
+
+	output, err = Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func wireDefaultRegistry() *metrics.Registry {\n\treturn metrics.Default\n}")
+}
+
+func TestGenerate_SymbolConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *analyzer.Result
+		opts   Options
+		errMsg string
+	}{
+		{
+			name: "wire helpers collide",
+			result: &analyzer.Result{
+				Invocations: []types.Invocation{
+					{Name: "Setup", ImportPath: "pkg/a"},
+					{Name: "Setup", ImportPath: "pkg/b"},
+				},
+				Imports: map[string]string{"pkg/a": "", "pkg/b": ""},
+			},
+			opts:   Options{Partial: true},
+			errMsg: "generated identifier invokeSetup conflicts: declared by invocation pkg/a.Setup and invocation pkg/b.Setup",
+		},
+		{
+			name: "import collides with container type",
+			result: &analyzer.Result{
+				Imports: map[string]string{"pkg/WorkerApp": ""},
+			},
+			opts:   Options{Container: "worker"},
+			errMsg: "generated identifier WorkerApp conflicts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.result.PackageName = "main"
+			_, err := Generate(tt.result, &mockResolver{}, tt.opts)
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestGenerate_NoLint(t *testing.T) {
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "NewConfig",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "config",
+				ProvidedType: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true},
+				ImportPath:   "pkg/config",
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{NoLint: []string{"funlen", "gocyclo"}, DebugDump: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "//nolint:funlen,gocyclo\nfunc InitializeApp() (*App, error) {")
+	assert.Contains(t, string(output), "//nolint:funlen,gocyclo\nfunc (a *App) DebugDump(w io.Writer) {")
+
+	output, err = Generate(result, &mockResolver{}, Options{NoLint: []string{"all"}})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "//nolint:all\nfunc InitializeApp() (*App, error) {")
+
+	output, err = Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.NotContains(t, string(output), "nolint")
+
+	_, err = Generate(result, &mockResolver{}, Options{NoLint: []string{"fun len"}})
+	assert.ErrorContains(t, err, `invalid linter name "fun len"`)
+}
+
+func TestGenerate_FieldTags(t *testing.T) {
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "NewConfig",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "config",
+				ProvidedType: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true},
+				ImportPath:   "pkg/config",
+			},
+		},
+		RequestProviders: []types.Provider{
+			{
+				Name:         "NewSession",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "session",
+				ProvidedType: types.TypeRef{Name: "Session", ImportPath: "pkg/auth", IsPointer: true},
+				ImportPath:   "pkg/auth",
+				Scope:        types.ScopeRequest,
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/auth": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{FieldTags: []string{"json=-", "di"}})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "\tConfig *config.Config `json:\"-\" di:\"*pkg/config.Config\"`\n")
+	assert.Contains(t, string(output), "\tSession *auth.Session `json:\"-\" di:\"*pkg/auth.Session\"`\n")
+
+	output, err = Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.NotContains(t, string(output), "`")
+
+	tests := []struct {
+		tags   []string
+		errMsg string
+	}{
+		{tags: []string{"=x"}, errMsg: `invalid field tag "=x": key must be non-empty without spaces, quotes or colons`},
+		{tags: []string{"my tag"}, errMsg: `invalid field tag "my tag": key must be non-empty without spaces, quotes or colons`},
+		{tags: []string{"json=a`b"}, errMsg: "invalid field tag \"json=a`b\": value cannot contain backquotes or newlines"},
+		{tags: []string{"json=-", "json"}, errMsg: `duplicate field tag "json"`},
+	}
+	for _, tt := range tests {
+		_, err := Generate(result, &mockResolver{}, Options{FieldTags: tt.tags})
+		assert.EqualError(t, err, tt.errMsg)
+	}
+}
+
+func TestGenerate_Cleanup(t *testing.T) {
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "NewConfig",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "config",
+				ProvidedType: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true},
+				ImportPath:   "pkg/config",
+			},
+			{
+				Name:         "NewDatabase",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "database",
+				ProvidedType: types.TypeRef{Name: "Database", ImportPath: "pkg/db", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}}},
+				ImportPath:   "pkg/db",
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{Cleanup: true})
+	require.NoError(t, err)
+
+	expected := `func (a *App) Cleanup() error {
+	var errs []error
+	if c, ok := any(a.Database).(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c, ok := any(a.Config).(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+`
+	outputStr := string(output)
+	assert.Contains(t, outputStr, expected)
+	assert.Contains(t, outputStr, `"errors"`)
+	assert.Contains(t, outputStr, `"io"`)
+
+	_, err = Generate(result, &mockResolver{}, Options{Cleanup: true, Partial: true})
+	assert.ErrorContains(t, err, "not available in partial mode")
+
+	result.Providers[1].HasCleanup = true
+	output, err = Generate(result, &mockResolver{}, Options{Cleanup: true})
+	require.NoError(t, err)
+	outputStr = string(output)
+	assert.Contains(t, outputStr, "database, databaseCleanup := db.NewDatabase(config)")
+	assert.NotContains(t, outputStr, "a.Database).(io.Closer)", "the cleanup func already tears down the database")
+	assert.Contains(t, outputStr, "any(a.Config).(io.Closer)")
+
+	result.Providers[0].HasCleanup = true
+	output, err = Generate(result, &mockResolver{}, Options{Cleanup: true})
+	require.NoError(t, err)
+	outputStr = string(output)
+	assert.Contains(t, outputStr, "func (a *App) Cleanup() error {\n\treturn nil\n}\n")
+	assert.NotContains(t, outputStr, `"io"`)
+}
+
+func TestGenerate_Lifecycle(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, VarName: "config", ProvidedType: config, ImportPath: "pkg/config"},
+			{
+				Name:         "NewServer",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "server",
+				ProvidedType: types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: config}},
+				ImportPath:   "pkg/http",
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/http": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{Lifecycle: true, Getters: true})
+	require.NoError(t, err)
+
+	expected := `func (a *App) Start(ctx context.Context) error {
+	hooks := []any{a.config, a.server}
+	for i, hook := range hooks {
+		s, ok := hook.(interface{ Start(context.Context) error })
+		if !ok {
+			continue
+		}
+		if err := s.Start(ctx); err != nil {
+			return errors.Join(err, stopHooks(ctx, hooks[:i]))
+		}
+	}
+	return nil
+}
+
+func (a *App) Stop(ctx context.Context) error {
+	return stopHooks(ctx, []any{a.config, a.server})
+}
+
+func stopHooks(ctx context.Context, hooks []any) error {
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if s, ok := hooks[i].(interface{ Stop(context.Context) error }); ok {
+			if err := s.Stop(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+`
+	outputStr := string(output)
+	assert.Contains(t, outputStr, expected)
+	assert.Contains(t, outputStr, `"context"`)
+	assert.Contains(t, outputStr, `"errors"`)
+
+	output, err = Generate(result, &mockResolver{}, Options{Lifecycle: true, Container: "worker"})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func stopWorkerHooks(ctx context.Context, hooks []any) error {")
+
+	_, err = Generate(result, &mockResolver{}, Options{Lifecycle: true, Partial: true})
+	assert.ErrorContains(t, err, "not available in partial mode")
+
+	conflicting := *result
+	conflicting.Providers = append([]types.Provider{}, result.Providers...)
+	conflicting.Providers[1].VarName = "start"
+	_, err = Generate(&conflicting, &mockResolver{}, Options{Lifecycle: true})
+	assert.ErrorContains(t, err, "App.Start lifecycle method conflicts with the field for NewServer")
+}
+
+func TestGenerate_Config(t *testing.T) {
+	settings := types.TypeRef{Name: "Settings", ImportPath: "pkg/settings", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "Settings",
+				Kind:         types.ProviderKindConfig,
+				VarName:      "settings",
+				ProvidedType: settings,
+				ImportPath:   "pkg/settings",
+				CanError:     true,
+				Env: []types.EnvVar{
+					{Field: "Token", Name: "APP_TOKEN", Type: "string", Required: true},
+					{Field: "Port", Name: "APP_PORT", Type: "uint16", Default: "8080"},
+					{Field: "Timeout", Name: "APP_TIMEOUT", Type: "time.Duration", Default: "1m30s"},
+					{Field: "Hosts", Name: "APP_HOSTS", Type: "[]string", Default: "a,b"},
+				},
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/settings": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	expected := `	settings, err := func() (*settings.Settings, error) {
+		cfg := &settings.Settings{Port: 8080, Timeout: 90 * time.Second, Hosts: []string{"a", "b"}}
+		if v, ok := os.LookupEnv("APP_TOKEN"); ok {
+			cfg.Token = v
+		} else {
+			return nil, fmt.Errorf("environment variable APP_TOKEN is required")
+		}
+		if v, ok := os.LookupEnv("APP_PORT"); ok {
+			x, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("parsing APP_PORT: %w", err)
+			}
+			cfg.Port = uint16(x)
+		}
+		if v, ok := os.LookupEnv("APP_TIMEOUT"); ok {
+			x, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("parsing APP_TIMEOUT: %w", err)
+			}
+			cfg.Timeout = x
+		}
+		if v, ok := os.LookupEnv("APP_HOSTS"); ok {
+			cfg.Hosts = strings.Split(v, ",")
+		}
+		return cfg, nil
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("loading settings.Settings: %w", err)
+	}
+`
+	outputStr := string(output)
+	assert.Contains(t, outputStr, expected)
+	for _, path := range []string{"fmt", "os", "strconv", "strings", "time"} {
+		assert.Contains(t, outputStr, `"`+path+`"`)
+	}
+
+	output, err = Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func wireSettings() (*settings.Settings, error) {\n\treturn func() (*settings.Settings, error) {")
+
+	invalid := *result
+	invalid.Providers = []types.Provider{result.Providers[0]}
+	invalid.Providers[0].Env = []types.EnvVar{{Field: "Port", Name: "APP_PORT", Type: "uint8", Default: "300"}}
+	_, err = Generate(&invalid, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, `config Settings: invalid default "300" for APP_PORT`)
+}
+
+func TestConfigLiteral(t *testing.T) {
+	tests := []struct {
+		kind, value, want string
+		wantErr           bool
+	}{
+		{kind: "string", value: `say "hi"`, want: `"say \"hi\""`},
+		{kind: "bool", value: "1", want: "true"},
+		{kind: "bool", value: "t", want: "true"},
+		{kind: "int", value: "-3", want: "-3"},
+		{kind: "int8", value: "128", wantErr: true},
+		{kind: "float64", value: "1e6", want: "1e+06"},
+		{kind: "float64", value: "NaN", wantErr: true},
+		{kind: "float64", value: "inf", wantErr: true},
+		{kind: "rune", value: "65", want: "65"},
+		{kind: "time.Duration", value: "1500ms", want: "1500 * time.Millisecond"},
+		{kind: "time.Duration", value: "2h", want: "2 * time.Hour"},
+		{kind: "time.Duration", value: "0s", want: "time.Duration(0)"},
+		{kind: "[]string", value: "a", want: `[]string{"a"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind+" "+tt.value, func(t *testing.T) {
+			got, err := configLiteral(tt.kind, tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGenerate_Recover(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	conn := types.TypeRef{Name: "Conn", ImportPath: "pkg/db", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, VarName: "config", ProvidedType: config, ImportPath: "pkg/config", HasCleanup: true},
+			{Name: "Server", Kind: types.ProviderKindStruct, VarName: "server", ProvidedType: types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true}, ImportPath: "pkg/http"},
+		},
+		TransientProviders: []types.Provider{
+			{Name: "Dial", Kind: types.ProviderKindFunc, VarName: "conn", ProvidedType: conn, Dependencies: []types.Dependency{{Type: config}}, CanError: true, ImportPath: "pkg/db", Scope: types.ScopeTransient},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": "", "pkg/http": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{Recover: true})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, `	config, configCleanup, err := func() (_ *config.Config, _ func(), err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		config, configCleanup := config.NewConfig()
+		return config, configCleanup, nil
+	}()
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("initializing config.NewConfig: %w", err)
+	}
+	cleanups = append(cleanups, configCleanup)
+
+	server := &http.Server{}
+`)
+	assert.Contains(t, outputStr, `func (a *App) NewConn() (*db.Conn, error) {
+	conn, err := func() (_ *db.Conn, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return db.Dial(a.Config)
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("initializing db.Dial: %w", err)
+	}
+`)
+
+	_, err = Generate(result, &mockResolver{}, Options{Recover: true, Partial: true})
+	assert.ErrorContains(t, err, "not available in partial mode")
+}
+
+func TestGenerate_ErrorTypes(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	pool := types.TypeRef{Name: "Pool", ImportPath: "pkg/db", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, VarName: "config", ProvidedType: config, ImportPath: "pkg/config", CanError: true, ErrorType: "*pkg/apperr.Error"},
+			{Name: "NewPool", Kind: types.ProviderKindFunc, VarName: "pool", ProvidedType: pool, Dependencies: []types.Dependency{{Type: config}}, ImportPath: "pkg/db", CanError: true, ErrorType: "*pkg/apperr.Error", HasCleanup: true},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Warm", Dependencies: []types.TypeRef{pool}, ImportPath: "pkg/db", CanError: true, ErrorType: "*pkg/apperr.Error"},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, `	config, err := func() (*config.Config, error) {
+		v, err := config.NewConfig()
+		if err != nil {
+			return v, err
+		}
+		return v, nil
+	}()
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("initializing config.NewConfig: %w", err)
+	}
+`)
+	assert.Contains(t, outputStr, `	pool, poolCleanup, err := func() (*db.Pool, func(), error) {
+		v, cleanup, err := db.NewPool(config)
+		if err != nil {
+			return v, cleanup, err
+		}
+		return v, cleanup, nil
+	}()
+`)
+	assert.Contains(t, outputStr, `	if err := db.Warm(pool); err != nil {`)
+
+	output, err = Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	outputStr = string(output)
+	assert.Contains(t, outputStr, `func wireConfig() (*config.Config, error) {
+	return func() (*config.Config, error) {
+		v, err := config.NewConfig()
+`)
+	assert.Contains(t, outputStr, `func invokeWarm(pool *db.Pool) error {
+	if err := db.Warm(pool); err != nil {
+		return err
+	}
+	return nil
+}`)
+}
+
+func TestGenerate_ProviderCleanups(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, VarName: "config", ProvidedType: config, ImportPath: "pkg/config", HasCleanup: true},
+			{
+				Name:         "NewDB",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "dB",
+				ProvidedType: db,
+				Dependencies: []types.Dependency{{Type: config}},
+				CanError:     true,
+				HasCleanup:   true,
+				ImportPath:   "pkg/db",
+			},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Migrate", ImportPath: "pkg/db", CanError: true, Dependencies: []types.TypeRef{db}},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	expected := `func InitializeApp() (*App, func(), error) {
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	// provide
+	config, configCleanup := config.NewConfig()
+	cleanups = append(cleanups, configCleanup)
+
+	dB, dBCleanup, err := db.NewDB(config)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("initializing db.NewDB: %w", err)
+	}
+	cleanups = append(cleanups, dBCleanup)
+
+	// invoke
+	if err := db.Migrate(dB); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("invoking db.Migrate: %w", err)
+	}
+
+	return &App{
+		Config: config,
+		DB:     dB,
+	}, cleanup, nil
+}
+`
+	assert.Contains(t, string(output), expected)
+
+	partial, err := Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(partial), "func wireConfig() (*config.Config, func()) {")
+	assert.Contains(t, string(partial), "func wireDB(config *config.Config) (*db.DB, func(), error) {")
+}
+
+func TestGenerate_RequestScopeCleanups(t *testing.T) {
+	result := &analyzer.Result{
+		RequestProviders: []types.Provider{
+			{
+				Name:         "BeginTx",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "tx",
+				ProvidedType: types.TypeRef{Name: "Tx", ImportPath: "pkg/db", IsPointer: true},
+				CanError:     true,
+				HasCleanup:   true,
+				ImportPath:   "pkg/db",
+				Scope:        types.ScopeRequest,
+			},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/db": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	outputStr := string(output)
+	assert.Contains(t, outputStr, "func InitializeApp() (*App, error) {")
+	assert.Contains(t, outputStr, "\ttx, txCleanup, err := db.BeginTx()\n\tif err != nil {\n\t\tcleanup()\n\t\treturn nil, nil, fmt.Errorf(\"initializing db.BeginTx: %w\", err)\n\t}\n")
+	assert.Contains(t, outputStr, "\t}, cleanup, nil\n")
+}
+
+func TestGenerate_Collectors(t *testing.T) {
+	handler := types.TypeRef{Name: "Handler", ImportPath: "pkg/http"}
+	handlers := types.TypeRef{Name: "Handler", ImportPath: "pkg/http", IsSlice: true}
+	mux := types.TypeRef{Name: "ServeMux", ImportPath: "pkg/http", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewAuth", Kind: types.ProviderKindFunc, VarName: "auth", ProvidedType: handler, ImportPath: "pkg/auth", Group: "handlers"},
+			{Name: "NewHealth", Kind: types.ProviderKindFunc, VarName: "health", ProvidedType: handler, ImportPath: "pkg/health", Group: "handlers"},
+			{
+				Name:         "handlers",
+				Kind:         types.ProviderKindGroup,
+				VarName:      "handlers",
+				ProvidedType: handlers,
+				Members: []types.Provider{
+					{Name: "NewAuth", VarName: "auth", ProvidedType: handler},
+					{Name: "NewHealth", VarName: "health", ProvidedType: handler},
+				},
+			},
+			{Name: "NewServeMux", Kind: types.ProviderKindFunc, VarName: "serveMux", ProvidedType: mux, ImportPath: "pkg/http"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Register", ImportPath: "pkg/routes", Dependencies: []types.TypeRef{mux, handlers}, Collector: "handlers", Collect: 1},
+			{Name: "Mount", ImportPath: "pkg/routes", Dependencies: []types.TypeRef{handlers}, Collector: "handlers", CanError: true},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/auth": "", "pkg/health": "", "pkg/http": "", "pkg/routes": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `func invokeRegister(serveMux *http.ServeMux, handlers []http.Handler) {
+	for _, handler := range handlers {
+		routes.Register(serveMux, handler)
+	}
+}`)
+	assert.Contains(t, string(output), `func invokeMount(handlers []http.Handler) error {
+	for _, handler := range handlers {
+		if err := routes.Mount(handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}`)
+
+	output, err = Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `	// invoke
+	for _, handler := range handlers {
+		routes.Register(serveMux, handler)
+	}
+	for _, handler := range handlers {
+		if err := routes.Mount(handler); err != nil {
+			return nil, fmt.Errorf("invoking routes.Mount: %w", err)
+		}
+	}
+`)
+}
+
+func TestGenerate_InvocationFlags(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "NewConfig",
+				Kind:         types.ProviderKindFunc,
+				VarName:      "config",
+				ProvidedType: config,
+				ImportPath:   "pkg/config",
+			},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Migrate", ImportPath: "pkg/setup", Dependencies: []types.TypeRef{config}},
+			{Name: "ServeHTTP", ImportPath: "pkg/setup", Dependencies: []types.TypeRef{config}, CanError: true, Flag: "serve-http"},
+			{Name: "RegisterRoutes", ImportPath: "pkg/setup", Dependencies: []types.TypeRef{config}, Flag: "serve-http"},
+			{Name: "StartWorker", ImportPath: "pkg/setup", Flag: "worker"},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/setup": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	expected := `type RunOptions struct {
+	ServeHttp bool
+	Worker    bool
+}
+
+func DefaultRunOptions() RunOptions {
+	return RunOptions{
+		ServeHttp: true,
+		Worker:    true,
+	}
+}
+
+func (o *RunOptions) RegisterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.ServeHttp, "serve-http", o.ServeHttp, "run ServeHTTP, RegisterRoutes")
+	fs.BoolVar(&o.Worker, "worker", o.Worker, "run StartWorker")
+}
+
+func InitializeApp(opts RunOptions) (*App, error) {
+	// provide
+	config := config.NewConfig()
+
+	// invoke
+	setup.Migrate(config)
+	if opts.ServeHttp {
+		if err := setup.ServeHTTP(config); err != nil {
+			return nil, fmt.Errorf("invoking setup.ServeHTTP: %w", err)
+		}
+	}
+
+	if opts.ServeHttp {
+		setup.RegisterRoutes(config)
+	}
+	if opts.Worker {
+		setup.StartWorker()
+	}
+	return &App{
+`
+	assert.Contains(t, string(output), expected)
+	assert.Contains(t, string(output), "\t\"flag\"\n")
+
+	output, err = Generate(result, &mockResolver{}, Options{Container: "worker"})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func DefaultWorkerRunOptions() WorkerRunOptions {")
+	assert.Contains(t, string(output), "func InitializeWorkerApp(opts WorkerRunOptions) (*WorkerApp, error) {")
+
+	result.Providers[0].VarName = "opts"
+	_, err = Generate(result, &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "provider NewConfig conflicts with the opts parameter of InitializeApp")
+}
+
+func TestGenerate_Profiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		profiles []string
+		expected string
+	}{
+		{name: "no profiles", expected: "// Code generated by autowire. DO NOT EDIT.\n\npackage main\n"},
+		{name: "default build", profiles: []string{"integration", "staging"}, expected: "// Code generated by autowire. DO NOT EDIT.\n\n//go:build !integration && !staging\n\npackage main\n"},
+		{name: "profile build", profile: "integration", profiles: []string{"integration", "staging"}, expected: "// Code generated by autowire. DO NOT EDIT.\n\n//go:build integration\n\npackage main\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &analyzer.Result{PackageName: "main", Profiles: tt.profiles}
+
+			output, err := Generate(result, &mockResolver{}, Options{Profile: tt.profile})
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(output), tt.expected), string(output))
+
+			bench, err := Benchmark(result, Options{Profile: tt.profile})
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(bench), tt.expected), string(bench))
+		})
+	}
+}
+
+func TestGenerate_RunFuncs(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	pool := types.TypeRef{Name: "Pool", ImportPath: "pkg/db", IsPointer: true}
+	cache := types.TypeRef{Name: "Cache", ImportPath: "pkg/cache", IsPointer: true}
+	ctx := types.TypeRef{Name: "Context", ImportPath: "context"}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, VarName: "config", ProvidedType: config, ImportPath: "pkg/config"},
+			{Name: "NewPool", Kind: types.ProviderKindFunc, VarName: "pool", ProvidedType: pool, Dependencies: []types.Dependency{{Type: ctx}, {Type: config}}, ImportPath: "pkg/db", CanError: true, HasCleanup: true},
+			{Name: "NewCache", Kind: types.ProviderKindFunc, VarName: "lru", ProvidedType: cache, ImportPath: "pkg/cache"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Migrate", Dependencies: []types.TypeRef{pool}, ImportPath: "pkg/db", CanError: true},
+			{Name: "Warm", Dependencies: []types.TypeRef{cache}, ImportPath: "pkg/cache"},
+		},
+		UsesContext:      true,
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": "", "pkg/cache": "", "context": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{RunFuncs: true})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, `func RunMigrate(ctx context.Context) error {
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	defer cleanup()
+
+	// provide
+	config := config.NewConfig()
+	pool, poolCleanup, err := db.NewPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("initializing db.NewPool: %w", err)
+	}
+	cleanups = append(cleanups, poolCleanup)
+
+	// invoke
+	if err := db.Migrate(pool); err != nil {
+		return fmt.Errorf("invoking db.Migrate: %w", err)
+	}
+
+	return nil
+}
+`)
+	assert.Contains(t, outputStr, `func RunWarm() error {
+	// provide
+	lru := cache.NewCache()
+
+	// invoke
+	cache.Warm(lru)
+	return nil
+}
+`)
+
+	output, err = Generate(result, &mockResolver{}, Options{RunFuncs: true, Container: "worker"})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func RunWorkerWarm() error {")
+
+	_, err = Generate(result, &mockResolver{}, Options{RunFuncs: true, Partial: true})
+	assert.ErrorContains(t, err, "not available in partial mode")
+}
+
+func TestGenerate_Externals(t *testing.T) {
+	logger := types.TypeRef{Name: "Logger", ImportPath: "pkg/log", IsPointer: true}
+	pool := types.TypeRef{Name: "Pool", ImportPath: "pkg/db", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewPool", Kind: types.ProviderKindFunc, VarName: "pool", ProvidedType: pool, Dependencies: []types.Dependency{{Type: logger}}, ImportPath: "pkg/db"},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{pool, logger}, ImportPath: "pkg/db"},
+		},
+		Externals:        []types.External{{Type: logger, VarName: "logger"}},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/db": "", "pkg/log": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{RunFuncs: true})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, `func InitializeApp(logger *log.Logger) (*App, error) {
+	// provide
+	pool := db.NewPool(logger)
+
+	// invoke
+	db.Serve(pool, logger)
+`)
+	assert.Contains(t, outputStr, "func RunServe(logger *log.Logger) error {")
+
+	result.Externals[0].VarName = "ctx"
+	_, err = Generate(result, &mockResolver{}, Options{})
+	assert.EqualError(t, err, "external *pkg/log.Logger conflicts with the ctx variable of InitializeApp; rename it with name=")
+	result.Externals[0].VarName = "logger"
+
+	_, err = Benchmark(result, Options{})
+	assert.EqualError(t, err, "benchmark cannot supply external *pkg/log.Logger; the initializer receives it from the caller")
+}
+
+func TestGenerate_LiteralDefaults(t *testing.T) {
+	server := types.TypeRef{Name: "Server", ImportPath: "pkg/http", IsPointer: true}
+	client := types.TypeRef{Name: "Client", ImportPath: "pkg/http", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "Server", Kind: types.ProviderKindStruct, VarName: "server", ProvidedType: server, ImportPath: "pkg/http", Dependencies: []types.Dependency{
+				{FieldName: "Port", Type: types.TypeRef{Name: "int", Default: "8080"}},
+				{FieldName: "Host", Type: types.TypeRef{Name: "string", Default: `"localhost"`}},
+			}},
+			{Name: "NewClient", Kind: types.ProviderKindFunc, VarName: "client", ProvidedType: client, ImportPath: "pkg/http", Dependencies: []types.Dependency{
+				{Type: server},
+				{Type: types.TypeRef{Name: "int", Qualifier: "retries", Default: "3"}},
+			}},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{client, {Name: "bool", Default: "true"}}, ImportPath: "pkg/http"},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/http": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `	server := &http.Server{
+		Port: 8080,
+		Host: "localhost",
+	}
+	client := http.NewClient(server, 3)
+
+	// invoke
+	http.Serve(client, true)
+`)
+
+	output, err = Generate(result, &mockResolver{}, Options{Partial: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "func wireClient(server *http.Server) *http.Client {\n\treturn http.NewClient(server, 3)\n}")
+}
+
+func TestGenerate_InitOptions(t *testing.T) {
+	logger := types.TypeRef{Name: "Logger", ImportPath: "pkg/log", IsPointer: true}
+	level := types.TypeRef{Name: "Level", ImportPath: "pkg/log"}
+	region := types.TypeRef{Name: "string", Qualifier: "region"}
+	result := &analyzer.Result{
+		Invocations: []types.Invocation{
+			{Name: "Serve", Dependencies: []types.TypeRef{logger, level, region, {Name: "string", IsSlice: true, Qualifier: "args"}}, ImportPath: "pkg/log"},
+		},
+		Externals: []types.External{
+			{Type: logger, VarName: "logger", Required: true},
+			{Type: level, VarName: "level", Required: true},
+			{Type: region, VarName: "region"},
+		},
+		UsesArgs:         true,
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/log": ""},
+	}
+
+	output, err := Generate(result, &mockResolver{}, Options{InitOptions: true})
+	require.NoError(t, err)
+	outputStr := string(output)
+	assert.Contains(t, outputStr, `type InitOptions struct {
+	Args   []string
+	Logger *log.Logger
+	Level  log.Level
+	Region string
+}
+
+func InitializeApp(options InitOptions) (*App, error) {
+	if options.Logger == nil {
+		return nil, errors.New("InitOptions.Logger is required")
+	}
+	if v := reflect.ValueOf(options.Level); !v.IsValid() || v.IsZero() {
+		return nil, errors.New("InitOptions.Level is required")
+	}
+
+	// invoke
+	log.Serve(options.Logger, options.Level, options.Region, options.Args)
+`)
+	assert.Contains(t, outputStr, "\t\"reflect\"\n")
+
+	output, err = Generate(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `func InitializeApp(args []string, logger *log.Logger, level log.Level, region string) (*App, error) {
+	if logger == nil {
+		return nil, errors.New("external logger is required")
+	}`)
+
+	result.Externals = nil
+	bench, err := Benchmark(result, Options{InitOptions: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(bench), "InitializeApp(InitOptions{})")
+
+	_, err = Generate(result, &mockResolver{}, Options{InitOptions: true, Partial: true})
+	assert.ErrorContains(t, err, "not available in partial mode")
+}
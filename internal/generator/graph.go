@@ -0,0 +1,204 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+type GraphFormat int
+
+const (
+	GraphFormatDOT GraphFormat = iota
+	GraphFormatMermaid
+	GraphFormatJSON
+)
+
+const (
+	nodeProvider   = "provider"
+	nodeGroup      = "group"
+	nodeInvocation = "invocation"
+	nodeExternal   = "external"
+)
+
+type graphNode struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Package string `json:"package,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+}
+
+func (n graphNode) label() string {
+	switch n.Kind {
+	case nodeGroup:
+		return "group " + n.Name
+	case nodeExternal:
+		return n.Type
+	}
+	return n.Package + "." + n.Name
+}
+
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+type graph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+func DependencyGraph(r *analyzer.Result, format GraphFormat) ([]byte, error) {
+	g := buildGraph(r)
+	switch format {
+	case GraphFormatDOT:
+		return g.dot(), nil
+	case GraphFormatMermaid:
+		return g.mermaid(), nil
+	case GraphFormatJSON:
+		out, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	}
+	return nil, fmt.Errorf("unknown graph format %d", format)
+}
+
+func buildGraph(r *analyzer.Result) graph {
+	g := graph{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	byType := make(map[string]string)
+	ids := make(map[string]string)
+
+	addProvider := func(p types.Provider, scope string) {
+		node := graphNode{Kind: nodeProvider, Name: p.Name, Package: p.ImportPath, Type: p.ProvidedType.Key(), Scope: scope}
+		if p.Kind == types.ProviderKindGroup {
+			node = graphNode{Kind: nodeGroup, Name: p.Name, Type: p.ProvidedType.Key(), Scope: scope}
+		}
+		node.ID = "n" + strconv.Itoa(len(g.Nodes))
+		g.Nodes = append(g.Nodes, node)
+		ids[providerKey(p)] = node.ID
+		if p.Group == "" {
+			byType[p.ProvidedType.Key()] = node.ID
+		}
+	}
+	for _, p := range r.Providers {
+		addProvider(p, "singleton")
+	}
+	for _, p := range r.RequestProviders {
+		addProvider(p, "request")
+	}
+	for _, p := range r.TransientProviders {
+		addProvider(p, "transient")
+	}
+	for _, p := range r.WeakProviders {
+		addProvider(p, "weak")
+	}
+	for _, p := range r.LazyProviders {
+		addProvider(p, "lazy")
+	}
+
+	dependency := func(from string, t types.TypeRef) {
+		key := t.Key()
+		to, ok := byType[key]
+		if !ok {
+			to = "n" + strconv.Itoa(len(g.Nodes))
+			g.Nodes = append(g.Nodes, graphNode{ID: to, Kind: nodeExternal, Name: t.Name, Package: t.ImportPath, Type: key})
+			byType[key] = to
+		}
+		g.Edges = append(g.Edges, graphEdge{From: from, To: to, Type: key})
+	}
+
+	providers := append(append(append(append(append([]types.Provider{}, r.Providers...), r.RequestProviders...), r.TransientProviders...), r.WeakProviders...), r.LazyProviders...)
+	for _, p := range providers {
+		from := ids[providerKey(p)]
+		if p.Kind == types.ProviderKindGroup {
+			for _, m := range p.Members {
+				g.Edges = append(g.Edges, graphEdge{From: from, To: ids[providerKey(m)], Type: m.ProvidedType.Key()})
+			}
+			continue
+		}
+		for _, dep := range p.Dependencies {
+			dependency(from, dep.Type)
+		}
+	}
+
+	for _, inv := range r.Invocations {
+		id := "n" + strconv.Itoa(len(g.Nodes))
+		g.Nodes = append(g.Nodes, graphNode{ID: id, Kind: nodeInvocation, Name: inv.Name, Package: inv.ImportPath})
+		for _, dep := range inv.Dependencies {
+			dependency(id, dep)
+		}
+	}
+	return g
+}
+
+func providerKey(p types.Provider) string {
+	if p.Kind == types.ProviderKindGroup {
+		return "group " + p.Name
+	}
+	return p.ID()
+}
+
+var dotShapes = map[string]string{
+	nodeProvider:   "shape=box",
+	nodeGroup:      "shape=box3d",
+	nodeInvocation: "shape=ellipse",
+	nodeExternal:   "shape=box, style=dashed",
+}
+
+func (g graph) dot() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("digraph autowire {\n")
+	buf.WriteString("\trankdir=LR;\n")
+	for _, n := range g.Nodes {
+		attrs := dotShapes[n.Kind]
+		switch n.Scope {
+		case "request":
+			attrs += ", style=rounded"
+		case "transient":
+			attrs += ", style=dotted"
+		}
+		fmt.Fprintf(&buf, "\t%s [label=%s, %s];\n", n.ID, strconv.Quote(n.label()), attrs)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buf, "\t%s -> %s;\n", e.From, e.To)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+var mermaidShapes = map[string][2]string{
+	nodeProvider:   {"[", "]"},
+	nodeGroup:      {"[[", "]]"},
+	nodeInvocation: {"([", "])"},
+	nodeExternal:   {"[/", "/]"},
+}
+
+func (g graph) mermaid() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		shape := mermaidShapes[n.Kind]
+		switch n.Scope {
+		case "request":
+			shape = [2]string{"(", ")"}
+		case "transient":
+			shape = [2]string{"{{", "}}"}
+		}
+		label := strings.ReplaceAll(n.label(), `"`, "#quot;")
+		fmt.Fprintf(&buf, "    %s%s\"%s\"%s\n", n.ID, shape[0], label, shape[1])
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buf, "    %s --> %s\n", e.From, e.To)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func graphResult() *analyzer.Result {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	handler := types.TypeRef{Name: "Handler", ImportPath: "pkg/http"}
+	return &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config"},
+			{
+				Name:         "NewAuth",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: handler,
+				Dependencies: []types.Dependency{{Type: config}},
+				ImportPath:   "pkg/auth",
+				Group:        "handlers",
+			},
+			{
+				Name:         "handlers",
+				Kind:         types.ProviderKindGroup,
+				ProvidedType: types.TypeRef{Name: "Handler", ImportPath: "pkg/http", IsSlice: true},
+				Members:      []types.Provider{{Name: "NewAuth", ProvidedType: handler, ImportPath: "pkg/auth", Group: "handlers"}},
+			},
+		},
+		RequestProviders: []types.Provider{
+			{
+				Name:         "CurrentUser",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "User", ImportPath: "pkg/user", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: types.TypeRef{Name: "Context", ImportPath: "context"}}},
+				ImportPath:   "pkg/user",
+				Scope:        types.ScopeRequest,
+			},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Serve", ImportPath: "pkg/http", Dependencies: []types.TypeRef{{Name: "Handler", ImportPath: "pkg/http", IsSlice: true}}},
+		},
+	}
+}
+
+func TestDependencyGraph(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   GraphFormat
+		expected string
+	}{
+		{
+			name:   "dot",
+			format: GraphFormatDOT,
+			expected: "digraph autowire {\n" +
+				"\trankdir=LR;\n" +
+				"\tn0 [label=\"pkg/config.NewConfig\", shape=box];\n" +
+				"\tn1 [label=\"pkg/auth.NewAuth\", shape=box];\n" +
+				"\tn2 [label=\"group handlers\", shape=box3d];\n" +
+				"\tn3 [label=\"pkg/user.CurrentUser\", shape=box, style=rounded];\n" +
+				"\tn4 [label=\"context.Context\", shape=box, style=dashed];\n" +
+				"\tn5 [label=\"pkg/http.Serve\", shape=ellipse];\n" +
+				"\tn1 -> n0;\n" +
+				"\tn2 -> n1;\n" +
+				"\tn3 -> n4;\n" +
+				"\tn5 -> n2;\n" +
+				"}\n",
+		},
+		{
+			name:   "mermaid",
+			format: GraphFormatMermaid,
+			expected: "flowchart LR\n" +
+				"    n0[\"pkg/config.NewConfig\"]\n" +
+				"    n1[\"pkg/auth.NewAuth\"]\n" +
+				"    n2[[\"group handlers\"]]\n" +
+				"    n3(\"pkg/user.CurrentUser\")\n" +
+				"    n4[/\"context.Context\"/]\n" +
+				"    n5([\"pkg/http.Serve\"])\n" +
+				"    n1 --> n0\n" +
+				"    n2 --> n1\n" +
+				"    n3 --> n4\n" +
+				"    n5 --> n2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := DependencyGraph(graphResult(), tt.format)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(out))
+		})
+	}
+}
+
+func TestDependencyGraph_JSON(t *testing.T) {
+	out, err := DependencyGraph(graphResult(), GraphFormatJSON)
+	require.NoError(t, err)
+
+	var g graph
+	require.NoError(t, json.Unmarshal(out, &g))
+	require.Len(t, g.Nodes, 6)
+	assert.Equal(t, graphNode{ID: "n3", Kind: "provider", Name: "CurrentUser", Package: "pkg/user", Type: "*pkg/user.User", Scope: "request"}, g.Nodes[3])
+	assert.Equal(t, graphNode{ID: "n4", Kind: "external", Name: "Context", Package: "context", Type: "context.Context"}, g.Nodes[4])
+	assert.Equal(t, graphNode{ID: "n5", Kind: "invocation", Name: "Serve", Package: "pkg/http"}, g.Nodes[5])
+	assert.Contains(t, g.Edges, graphEdge{From: "n5", To: "n2", Type: "[]pkg/http.Handler"})
+}
+
+func TestDependencyGraph_Empty(t *testing.T) {
+	out, err := DependencyGraph(&analyzer.Result{}, GraphFormatJSON)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"nodes": [], "edges": []}`, string(out))
+}
@@ -0,0 +1,148 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+func lazyType(p types.Provider, t *transients) string {
+	typeName := formatType(p.ProvidedType, t.out, t.imports, t.resolver)
+	if t.canError(p) {
+		return fmt.Sprintf("func() (%s, error)", typeName)
+	}
+	return "func() " + typeName
+}
+
+func lazyAccessor(p types.Provider, t *transients, syms *symbols) string {
+	if t.canError(p) {
+		return syms.lazyHolder(p.VarName) + ".get"
+	}
+	return syms.lazyHolder(p.VarName) + ".instance"
+}
+
+func lazyHolderField(p types.Provider, syms *symbols, out string, imports map[string]string, resolver types.PackageNameResolver) string {
+	return fmt.Sprintf("%s *%s[%s]", syms.lazyHolder(p.VarName), syms.lazyValue, formatType(p.ProvidedType, out, imports, resolver))
+}
+
+func checkLazyAccessors(r *analyzer.Result, t *transients) error {
+	failing := make(map[string]types.Provider)
+	for _, p := range r.LazyProviders {
+		if t.canError(p) {
+			failing[types.Accessor(p.ProvidedType, false).Key()] = p
+		}
+	}
+	if len(failing) == 0 {
+		return nil
+	}
+
+	check := func(consumer string, deps []types.TypeRef) error {
+		for _, dep := range deps {
+			if p, ok := failing[dep.Key()]; ok {
+				return fmt.Errorf("%s requires %s, but lazy %s can fail; depend on %s instead",
+					consumer, dep.Key(), p.Name, types.Accessor(p.ProvidedType, true).Key())
+			}
+		}
+		return nil
+	}
+	for _, providers := range [][]types.Provider{r.Providers, r.RequestProviders, r.TransientProviders, r.WeakProviders, r.LazyProviders} {
+		for _, p := range providers {
+			if err := check(p.Name, dependencyTypes(p)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, inv := range r.Invocations {
+		if err := check(inv.Name, inv.Dependencies); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeLazyValueType(buf *bytes.Buffer, syms *symbols) {
+	name := syms.lazyValue
+	buf.WriteString(fmt.Sprintf("type %s[T any] struct {\n", name))
+	buf.WriteString("\tmu    sync.Mutex\n\tbuild func() (T, error)\n\tdone  bool\n\tvalue T\n\terr   error\n}\n\n")
+
+	buf.WriteString(fmt.Sprintf("func (l *%s[T]) get() (T, error) {\n", name))
+	buf.WriteString("\tl.mu.Lock()\n\tdefer l.mu.Unlock()\n")
+	buf.WriteString("\tif !l.done {\n\t\tl.value, l.err = l.build()\n\t\tl.done = true\n\t}\n")
+	buf.WriteString("\treturn l.value, l.err\n}\n\n")
+
+	buf.WriteString(fmt.Sprintf("func (l *%s[T]) instance() T {\n", name))
+	buf.WriteString("\tv, _ := l.get()\n\treturn v\n}\n\n")
+
+	buf.WriteString(fmt.Sprintf("func (l *%s[T]) built() (T, bool) {\n", name))
+	buf.WriteString("\tl.mu.Lock()\n\tdefer l.mu.Unlock()\n")
+	buf.WriteString("\treturn l.value, l.done && l.err == nil\n}\n")
+}
+
+type lazyWriter struct {
+	byKey   map[string]types.Provider
+	written map[string]bool
+	t       *transients
+	syms    *symbols
+}
+
+func newLazyWriter(providers []types.Provider, t *transients, syms *symbols) *lazyWriter {
+	byKey := make(map[string]types.Provider, 2*len(providers))
+	for _, p := range providers {
+		byKey[types.Accessor(p.ProvidedType, true).Key()] = p
+		byKey[types.Accessor(p.ProvidedType, false).Key()] = p
+		t.declared[syms.lazyHolder(p.VarName)] = true
+	}
+	return &lazyWriter{byKey: byKey, written: make(map[string]bool), t: t, syms: syms}
+}
+
+func (l *lazyWriter) pending(providers []types.Provider) []types.Provider {
+	var pending []types.Provider
+	for _, p := range providers {
+		if !l.written[p.VarName] {
+			pending = append(pending, p)
+		}
+	}
+	return pending
+}
+
+func (l *lazyWriter) require(buf *bytes.Buffer, deps []types.TypeRef, vars map[string]string) {
+	for _, dep := range deps {
+		if p, ok := l.t.byType[dep.Key()]; ok {
+			l.require(buf, dependencyTypes(p), vars)
+			continue
+		}
+		p, ok := l.byKey[dep.Key()]
+		if !ok || l.written[p.VarName] {
+			continue
+		}
+		l.written[p.VarName] = true
+		l.require(buf, dependencyTypes(p), vars)
+		l.write(buf, p, vars)
+	}
+}
+
+func (l *lazyWriter) write(buf *bytes.Buffer, p types.Provider, vars map[string]string) {
+	t := l.t
+	typeName := formatType(p.ProvidedType, t.out, t.imports, t.resolver)
+	holder := l.syms.lazyHolder(p.VarName)
+	buf.WriteString(fmt.Sprintf("\t%s := &%s[%s]{build: func() (%s, error) {\n", holder, l.syms.lazyValue, typeName, typeName))
+	name := t.build(buf, p, vars, fmt.Sprintf("return %s, err", zeroValue(p.ProvidedType, typeName)))
+	buf.WriteString(fmt.Sprintf("\treturn %s, nil\n\t}}\n", name))
+
+	vars[types.Accessor(p.ProvidedType, true).Key()] = holder + ".get"
+	if !t.canError(p) {
+		vars[types.Accessor(p.ProvidedType, false).Key()] = holder + ".instance"
+	}
+}
+
+func writeLazyGetters(buf *bytes.Buffer, syms *symbols, providers []types.Provider, t *transients) []string {
+	methods := make([]string, len(providers))
+	for i, p := range providers {
+		signature := lazyType(p, t)
+		methods[i] = toUpper(p.VarName) + signature[len("func"):]
+		buf.WriteString(fmt.Sprintf("func (a *%s) %s {\n\treturn a.%s()\n}\n\n", syms.app, methods[i], p.VarName))
+	}
+	return methods
+}
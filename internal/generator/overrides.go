@@ -0,0 +1,161 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+func OverrideInitializer(r *analyzer.Result, resolver types.PackageNameResolver, opts Options) ([]byte, error) {
+	if opts.Partial {
+		return nil, fmt.Errorf("test initializer requires the generated App and is not available in partial mode")
+	}
+
+	out := r.OutputImportPath
+	imports := withStdImports(r.Imports, "fmt")
+	imports = withStdImports(imports, requiredImports(r.Externals)...)
+	if len(r.LazyProviders) > 0 {
+		imports = withStdImports(imports, "sync")
+	}
+	syms := newSymbols(opts)
+	shared, err := newSharedFixtures(r, opts.TestShared, syms)
+	if err != nil {
+		return nil, err
+	}
+	if len(shared.names) > 0 {
+		imports = withStdImports(imports, "sync")
+	}
+	override := syms.prefix + "Override"
+	overrides := "test" + syms.prefix + "AppOverrides"
+	nolint, err := nolintDirective(opts.NoLint)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := map[string]bool{"ctx": true, "err": true, "cleanup": true, "cleanups": true, runOptionsParam: true, argsParam: true, initOptionsParam: true}
+	for _, name := range append(append(varNames(r.Providers), varNames(r.LazyProviders)...), externalNames(r.Externals)...) {
+		taken[name] = true
+	}
+	local := func(name string) string {
+		for base, i := name, 1; taken[name]; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		taken[name] = true
+		return name
+	}
+	set, param, each := local("o"), local("overrides"), local("override")
+
+	var body bytes.Buffer
+	body.WriteString(fmt.Sprintf("// %s replaces a provider in %s with a fake.\n", override, "Initialize"+syms.prefix+"TestApp"))
+	body.WriteString(fmt.Sprintf("type %s func(*%s)\n\n", override, overrides))
+	body.WriteString(fmt.Sprintf("type %s struct {\n\tset map[string]bool\n", overrides))
+	for _, p := range r.Providers {
+		body.WriteString(fmt.Sprintf("\t%s %s\n", toUpper(p.VarName), formatType(p.ProvidedType, out, imports, resolver)))
+	}
+	body.WriteString("}\n")
+	for _, p := range r.Providers {
+		field := toUpper(p.VarName)
+		body.WriteString(fmt.Sprintf("\nfunc Override%s%s(v %s) %s {\n", syms.prefix, field, formatType(p.ProvidedType, out, imports, resolver), override))
+		body.WriteString(fmt.Sprintf("\treturn func(o *%s) {\n", overrides))
+		body.WriteString(fmt.Sprintf("\t\to.%s = v\n", field))
+		body.WriteString(fmt.Sprintf("\t\to.set[%q] = true\n", field))
+		body.WriteString("\t}\n}\n")
+	}
+	body.WriteString("\n")
+
+	name := "Initialize" + syms.prefix + "TestApp"
+	body.WriteString(fmt.Sprintf("// %s works like %s, but uses the overridden values instead of\n", name, syms.initialize))
+	body.WriteString("// calling their providers.\n")
+	fail := writeInitSignature(&body, r, syms, name, param+" ..."+override, nolint, out, imports, resolver)
+	body.WriteString(fmt.Sprintf("\t%s := %s{set: make(map[string]bool)}\n", set, overrides))
+	body.WriteString(fmt.Sprintf("\tfor _, %s := range %s {\n\t\t%s(&%s)\n\t}\n", each, param, each, set))
+	for _, p := range r.Providers {
+		if p.CanError || shared.canError[p.VarName] {
+			body.WriteString("\tvar err error\n")
+			break
+		}
+	}
+	body.WriteString("\n")
+
+	t := newTransients(r.TransientProviders, append(append(append(varNames(r.Providers), varNames(r.LazyProviders)...), externalNames(r.Externals)...), set, param, each), false, out, imports, resolver)
+	fields := orderFields(r.Providers, opts.FieldOrder, out, imports, resolver)
+	writeInitBody(&body, r, syms, fields, t, fail, func(buf *bytes.Buffer, p types.Provider, vars map[string]string) {
+		field := toUpper(p.VarName)
+		buf.WriteString(fmt.Sprintf("\t%s := %s.%s\n", p.VarName, set, field))
+		buf.WriteString(fmt.Sprintf("\tif !%s.set[%q] {\n", set, field))
+		name, ok := shared.names[p.VarName]
+		if !ok {
+			writeOverridable(buf, p, t.inject(buf, dependencyTypes(p), vars, fail), syms, fail, resolver)
+			buf.WriteString("\t}\n")
+			return
+		}
+		var overridden []string
+		for _, dep := range shared.transitive(p) {
+			overridden = append(overridden, fmt.Sprintf("%s.set[%q]", set, dep))
+		}
+		if len(overridden) > 0 {
+			buf.WriteString(fmt.Sprintf("\tif %s {\n", strings.Join(overridden, " || ")))
+			writeOverridable(buf, p, t.inject(buf, dependencyTypes(p), vars, fail), syms, fail, resolver)
+			buf.WriteString("\t} else {\n")
+		}
+		if shared.canError[p.VarName] {
+			buf.WriteString(fmt.Sprintf("\t\t%s, err = %s()\n", p.VarName, name))
+			buf.WriteString(fmt.Sprintf("\t\tif err != nil {\n\t\t\t%s\n\t\t}\n", wrapFail(fail, "initializing", p.Name, p.ImportPath, resolver)))
+		} else {
+			buf.WriteString(fmt.Sprintf("\t\t%s = %s()\n", p.VarName, name))
+		}
+		if len(overridden) > 0 {
+			buf.WriteString("\t}\n")
+		}
+		buf.WriteString("\t}\n")
+	}, out, imports, resolver)
+	writeProviderHelpers(&body, r.Providers, syms, out, imports, resolver)
+	body.WriteString("\n")
+	shared.write(&body, r, syms, out, imports, resolver)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by autowire. DO NOT EDIT.\n\n")
+	buf.WriteString(buildConstraint(opts.Profile, r.Profiles))
+	buf.WriteString(fmt.Sprintf("package %s\n\n", r.PackageName))
+	writeImports(&buf, imports)
+	buf.Write(body.Bytes())
+
+	return formatSource(buf.Bytes(), resolver)
+}
+
+func writeOverridable(buf *bytes.Buffer, p types.Provider, vars map[string]string, syms *symbols, fail string, resolver types.PackageNameResolver) {
+	var args []string
+	if p.Kind == types.ProviderKindGroup {
+		for _, m := range p.Members {
+			args = append(args, m.VarName)
+		}
+	} else {
+		seen := make(map[string]bool)
+		for _, dep := range p.Dependencies {
+			key := dep.Type.Key()
+			if !seen[key] && dep.Type.Default == "" {
+				seen[key] = true
+				args = append(args, vars[key])
+			}
+		}
+	}
+
+	results := p.VarName
+	if p.HasCleanup {
+		buf.WriteString(fmt.Sprintf("\t\tvar %sCleanup func()\n", p.VarName))
+		results += ", " + p.VarName + "Cleanup"
+	}
+	if p.CanError {
+		results += ", err"
+	}
+	buf.WriteString(fmt.Sprintf("\t\t%s = %s(%s)\n", results, syms.wire(p.VarName), strings.Join(args, ", ")))
+	if p.CanError {
+		buf.WriteString(fmt.Sprintf("\t\tif err != nil {\n\t\t\t%s\n\t\t}\n", wrapFail(fail, "initializing", p.Name, p.ImportPath, resolver)))
+	}
+	if p.HasCleanup {
+		buf.WriteString(fmt.Sprintf("\t\tcleanups = append(cleanups, %sCleanup)\n", p.VarName))
+	}
+}
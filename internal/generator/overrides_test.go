@@ -0,0 +1,219 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverrideInitializer(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+			{
+				Name:         "Open",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: db,
+				Dependencies: []types.Dependency{{Type: config}},
+				CanError:     true,
+				HasCleanup:   true,
+				ImportPath:   "pkg/db",
+				VarName:      "o",
+			},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Migrate", ImportPath: "pkg/db", Dependencies: []types.TypeRef{db}, CanError: true},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": "", "pkg/unused": ""},
+	}
+
+	code, err := OverrideInitializer(result, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	expected := `// Code generated by autowire. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"pkg/config"
+	"pkg/db"
+)
+
+// Override replaces a provider in InitializeTestApp with a fake.
+type Override func(*testAppOverrides)
+
+type testAppOverrides struct {
+	set    map[string]bool
+	Config *config.Config
+	O      *db.DB
+}
+
+func OverrideConfig(v *config.Config) Override {
+	return func(o *testAppOverrides) {
+		o.Config = v
+		o.set["Config"] = true
+	}
+}
+
+func OverrideO(v *db.DB) Override {
+	return func(o *testAppOverrides) {
+		o.O = v
+		o.set["O"] = true
+	}
+}
+
+// InitializeTestApp works like InitializeApp, but uses the overridden values instead of
+// calling their providers.
+func InitializeTestApp(overrides ...Override) (*App, func(), error) {
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	o1 := testAppOverrides{set: make(map[string]bool)}
+	for _, override := range overrides {
+		override(&o1)
+	}
+	var err error
+
+	// provide
+	config := o1.Config
+	if !o1.set["Config"] {
+		config = wireConfig()
+	}
+	o := o1.O
+	if !o1.set["O"] {
+		var oCleanup func()
+		o, oCleanup, err = wireO(config)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("initializing db.Open: %w", err)
+		}
+		cleanups = append(cleanups, oCleanup)
+	}
+
+	// invoke
+	if err := db.Migrate(o); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("invoking db.Migrate: %w", err)
+	}
+
+	return &App{
+		Config: config,
+		O:      o,
+	}, cleanup, nil
+}
+
+func wireConfig() *config.Config {
+	return config.NewConfig()
+}
+
+func wireO(config *config.Config) (*db.DB, func(), error) {
+	return db.Open(config)
+}
+`
+	assert.Equal(t, expected, string(code))
+}
+
+func TestOverrideInitializer_Partial(t *testing.T) {
+	_, err := OverrideInitializer(&analyzer.Result{PackageName: "main"}, &mockResolver{}, Options{Partial: true})
+	assert.ErrorContains(t, err, "not available in partial mode")
+}
+
+func TestOverrideInitializer_Container(t *testing.T) {
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "Logger", Kind: types.ProviderKindStruct, ProvidedType: types.TypeRef{Name: "Logger", ImportPath: "pkg/log", IsPointer: true}, ImportPath: "pkg/log", VarName: "logger"},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/log": ""},
+	}
+
+	code, err := OverrideInitializer(result, &mockResolver{}, Options{Container: "worker"})
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "func InitializeWorkerTestApp(overrides ...WorkerOverride) (*WorkerApp, error) {")
+	assert.Contains(t, string(code), "func OverrideWorkerLogger(v *log.Logger) WorkerOverride {")
+	assert.Contains(t, string(code), "type testWorkerAppOverrides struct {")
+}
+
+func TestOverrideInitializer_Shared(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	db := types.TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true}
+	conn := types.TypeRef{Name: "Conn", ImportPath: "pkg/db", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config", VarName: "config"},
+			{
+				Name:         "Open",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: db,
+				Dependencies: []types.Dependency{{Type: config}},
+				CanError:     true,
+				HasCleanup:   true,
+				ImportPath:   "pkg/db",
+				VarName:      "db",
+			},
+		},
+		TransientProviders: []types.Provider{
+			{Name: "Dial", Kind: types.ProviderKindFunc, ProvidedType: conn, ImportPath: "pkg/db", VarName: "conn", Scope: types.ScopeTransient},
+		},
+		PackageName:      "main",
+		OutputImportPath: "example.com/app",
+		Imports:          map[string]string{"pkg/config": "", "pkg/db": ""},
+	}
+
+	code, err := OverrideInitializer(result, &mockResolver{}, Options{TestShared: []string{"Db"}})
+	require.NoError(t, err)
+	for _, want := range []string{
+		"\t\"sync\"\n",
+		"\tif !o.set[\"Config\"] {\n\t\tconfig = testAppSharedConfig()\n\t}\n",
+		"\t\tif o.set[\"Config\"] {\n\t\t\tvar dbCleanup func()\n",
+		"\t\t} else {\n\t\t\tdb, err = testAppSharedDb()\n",
+		"func CleanupTestAppShared() {\n",
+		"var testAppSharedConfig = sync.OnceValue(func() *config.Config {\n\tconfig := wireConfig()\n\treturn config\n})\n",
+		"var testAppSharedDb = sync.OnceValues(func() (*db.DB, error) {\n\tconfig := testAppSharedConfig()\n\tdb, dbCleanup, err := wireDb(config)\n",
+		"\ttestAppShared.cleanups = append(testAppShared.cleanups, dbCleanup)\n",
+	} {
+		assert.Contains(t, string(code), want)
+	}
+
+	tests := []struct {
+		name        string
+		providers   []types.Provider
+		shared      string
+		expectedErr string
+	}{
+		{
+			name:        "unknown field",
+			providers:   result.Providers,
+			shared:      "Cache",
+			expectedErr: "shared test provider Cache: no App field with that name",
+		},
+		{
+			name: "transient dependency",
+			providers: []types.Provider{
+				{Name: "NewPool", Kind: types.ProviderKindFunc, ProvidedType: types.TypeRef{Name: "Pool", ImportPath: "pkg/db"}, Dependencies: []types.Dependency{{Type: conn}}, ImportPath: "pkg/db", VarName: "pool"},
+			},
+			shared:      "Pool",
+			expectedErr: "shared test provider NewPool depends on *pkg/db.Conn, which is not a singleton",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := *result
+			r.Providers = tt.providers
+			_, err := OverrideInitializer(&r, &mockResolver{}, Options{TestShared: []string{tt.shared}})
+			assert.ErrorContains(t, err, tt.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+type runGraph struct {
+	providers   []types.Provider
+	externals   []types.External
+	usesContext bool
+	usesArgs    bool
+}
+
+func newRunGraph(r *analyzer.Result, inv types.Invocation) runGraph {
+	byType := make(map[string]types.Provider)
+	for _, p := range r.Providers {
+		if p.Group == "" {
+			byType[p.ProvidedType.Key()] = p
+		}
+	}
+	transients := make(map[string]types.Provider, len(r.TransientProviders))
+	for _, p := range r.TransientProviders {
+		transients[p.ProvidedType.Key()] = p
+	}
+	externals := make(map[string]bool, len(r.Externals))
+	for _, e := range r.Externals {
+		externals[e.Type.Key()] = false
+	}
+
+	var g runGraph
+	needed := make(map[string]bool)
+	var visit func(key string)
+	var provide func(p types.Provider)
+	provide = func(p types.Provider) {
+		if needed[p.ID()] {
+			return
+		}
+		needed[p.ID()] = true
+		for _, dep := range p.Dependencies {
+			visit(dep.Type.Key())
+		}
+		for _, m := range p.Members {
+			provide(m)
+		}
+	}
+	visit = func(key string) {
+		if p, ok := byType[key]; ok {
+			provide(p)
+			return
+		}
+		if p, ok := transients[key]; ok {
+			for _, dep := range p.Dependencies {
+				visit(dep.Type.Key())
+			}
+			return
+		}
+		if _, ok := externals[key]; ok {
+			externals[key] = true
+			return
+		}
+		switch key {
+		case "context.Context":
+			g.usesContext = true
+		case "[]string@" + argsParam:
+			g.usesArgs = true
+		}
+	}
+	for _, dep := range inv.Dependencies {
+		visit(dep.Key())
+	}
+
+	for _, p := range r.Providers {
+		if needed[p.ID()] {
+			g.providers = append(g.providers, p)
+		}
+	}
+	for _, e := range r.Externals {
+		if externals[e.Type.Key()] {
+			g.externals = append(g.externals, e)
+		}
+	}
+	return g
+}
+
+func writeRunFuncs(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, nolint string, recoverPanics bool, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	for _, inv := range r.Invocations {
+		buf.WriteString("\n")
+		writeRunFunc(buf, r, inv, syms, nolint, recoverPanics, out, imports, resolver)
+	}
+}
+
+func writeRunFunc(buf *bytes.Buffer, r *analyzer.Result, inv types.Invocation, syms *symbols, nolint string, recoverPanics bool, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	g := newRunGraph(r, inv)
+	vars := make(map[string]string)
+	var params []string
+	if g.usesContext {
+		params = append(params, "ctx context.Context")
+		vars["context.Context"] = "ctx"
+	}
+	if g.usesArgs {
+		params = append(params, argsParam+" []string")
+		vars["[]string@"+argsParam] = argsParam
+	}
+	for _, e := range g.externals {
+		params = append(params, e.VarName+" "+formatType(e.Type, out, imports, resolver))
+		vars[e.Type.Key()] = e.VarName
+	}
+
+	buf.WriteString(nolint)
+	buf.WriteString(fmt.Sprintf("func %s(%s) error {\n", syms.run(inv.Name), strings.Join(params, ", ")))
+	if hasCleanups(g.providers) {
+		writeCleanupCollector(buf)
+		buf.WriteString("\tdefer cleanup()\n\n")
+	}
+
+	const fail = "return err"
+	t := newTransients(r.TransientProviders, append(varNames(g.providers), externalNames(g.externals)...), recoverPanics, out, imports, resolver)
+	if len(g.providers) > 0 {
+		buf.WriteString("\t// provide\n")
+		for _, p := range g.providers {
+			writeProvider(buf, p, t.inject(buf, dependencyTypes(p), vars, fail), fail, recoverPanics, out, imports, resolver)
+			if p.Group == "" {
+				vars[p.ProvidedType.Key()] = p.VarName
+			}
+		}
+		buf.WriteString("\n\t// invoke\n")
+	}
+	writeInvocation(buf, inv, t.inject(buf, inv.Dependencies, vars, fail), t.declared, fail, out, imports, resolver)
+	buf.WriteString("\treturn nil\n}\n")
+}
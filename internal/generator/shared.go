@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+type sharedFixtures struct {
+	names    map[string]string
+	deps     map[string][]types.Provider
+	canError map[string]bool
+	state    string
+	cleanup  string
+}
+
+func newSharedFixtures(r *analyzer.Result, fields []string, syms *symbols) (*sharedFixtures, error) {
+	s := &sharedFixtures{
+		names:    make(map[string]string),
+		deps:     make(map[string][]types.Provider),
+		canError: make(map[string]bool),
+		state:    "test" + syms.prefix + "AppShared",
+		cleanup:  "Cleanup" + syms.prefix + "TestAppShared",
+	}
+	if len(fields) == 0 {
+		return s, nil
+	}
+
+	byField := make(map[string]types.Provider)
+	byKey := make(map[string]types.Provider)
+	byVar := make(map[string]types.Provider)
+	for _, p := range r.Providers {
+		byField[toUpper(p.VarName)] = p
+		byVar[p.VarName] = p
+		if p.Group == "" {
+			byKey[p.ProvidedType.Key()] = p
+		}
+	}
+
+	var visit func(p types.Provider, path []string) error
+	visit = func(p types.Provider, path []string) error {
+		if _, ok := s.names[p.VarName]; ok {
+			return nil
+		}
+		var deps []types.Provider
+		if p.Kind == types.ProviderKindGroup {
+			for _, m := range p.Members {
+				deps = append(deps, byVar[m.VarName])
+			}
+		} else {
+			seen := make(map[string]bool)
+			for _, dep := range p.Dependencies {
+				key := dep.Type.Key()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				d, ok := byKey[key]
+				if !ok {
+					return fmt.Errorf("shared test provider %s depends on %s, which is not a singleton and cannot be shared across tests",
+						strings.Join(append(path, p.Name), " -> "), key)
+				}
+				deps = append(deps, d)
+			}
+		}
+		s.names[p.VarName] = s.state + toUpper(p.VarName)
+		s.deps[p.VarName] = deps
+		for _, d := range deps {
+			if err := visit(d, append(path, p.Name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, field := range fields {
+		p, ok := byField[field]
+		if !ok {
+			return nil, fmt.Errorf("shared test provider %s: no App field with that name", field)
+		}
+		if err := visit(p, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range r.Providers {
+		if _, ok := s.names[p.VarName]; !ok {
+			continue
+		}
+		s.canError[p.VarName] = p.CanError
+		for _, d := range s.deps[p.VarName] {
+			s.canError[p.VarName] = s.canError[p.VarName] || s.canError[d.VarName]
+		}
+	}
+	return s, nil
+}
+
+func (s *sharedFixtures) transitive(p types.Provider) []string {
+	seen := make(map[string]bool)
+	var fields []string
+	var walk func(varName string)
+	walk = func(varName string) {
+		for _, d := range s.deps[varName] {
+			if seen[d.VarName] {
+				continue
+			}
+			seen[d.VarName] = true
+			fields = append(fields, toUpper(d.VarName))
+			walk(d.VarName)
+		}
+	}
+	walk(p.VarName)
+	return fields
+}
+
+func (s *sharedFixtures) write(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, out string, imports map[string]string, resolver types.PackageNameResolver) {
+	if len(s.names) == 0 {
+		return
+	}
+	cleanups := false
+	for _, p := range r.Providers {
+		if _, ok := s.names[p.VarName]; ok && p.HasCleanup {
+			cleanups = true
+		}
+	}
+
+	if cleanups {
+		buf.WriteString(fmt.Sprintf("var %s struct {\n\tmu       sync.Mutex\n\tcleanups []func()\n}\n\n", s.state))
+		buf.WriteString(fmt.Sprintf("// %s runs the cleanup functions of the shared test providers in reverse order.\n", s.cleanup))
+		buf.WriteString("// Call it from TestMain after m.Run.\n")
+		buf.WriteString(fmt.Sprintf("func %s() {\n", s.cleanup))
+		buf.WriteString(fmt.Sprintf("\t%s.mu.Lock()\n\tdefer %s.mu.Unlock()\n", s.state, s.state))
+		buf.WriteString(fmt.Sprintf("\tfor i := len(%s.cleanups) - 1; i >= 0; i-- {\n\t\t%s.cleanups[i]()\n\t}\n", s.state, s.state))
+		buf.WriteString(fmt.Sprintf("\t%s.cleanups = nil\n}\n\n", s.state))
+	}
+
+	for _, p := range r.Providers {
+		name, ok := s.names[p.VarName]
+		if !ok {
+			continue
+		}
+		typeName := formatType(p.ProvidedType, out, imports, resolver)
+		fail := ""
+		if s.canError[p.VarName] {
+			buf.WriteString(fmt.Sprintf("var %s = sync.OnceValues(func() (%s, error) {\n", name, typeName))
+			fail = fmt.Sprintf("return %s, err", zeroValue(p.ProvidedType, typeName))
+		} else {
+			buf.WriteString(fmt.Sprintf("var %s = sync.OnceValue(func() %s {\n", name, typeName))
+		}
+
+		var args []string
+		for _, d := range s.deps[p.VarName] {
+			args = append(args, d.VarName)
+			if !s.canError[d.VarName] {
+				buf.WriteString(fmt.Sprintf("\t%s := %s()\n", d.VarName, s.names[d.VarName]))
+				continue
+			}
+			buf.WriteString(fmt.Sprintf("\t%s, err := %s()\n\tif err != nil {\n\t\t%s\n\t}\n", d.VarName, s.names[d.VarName], fail))
+		}
+
+		results := p.VarName
+		if p.HasCleanup {
+			results += ", " + p.VarName + "Cleanup"
+		}
+		if p.CanError {
+			results += ", err"
+		}
+		buf.WriteString(fmt.Sprintf("\t%s := %s(%s)\n", results, syms.wire(p.VarName), strings.Join(args, ", ")))
+		if p.CanError {
+			buf.WriteString(fmt.Sprintf("\tif err != nil {\n\t\t%s\n\t}\n", fail))
+		}
+		if p.HasCleanup {
+			buf.WriteString(fmt.Sprintf("\t%s.mu.Lock()\n", s.state))
+			buf.WriteString(fmt.Sprintf("\t%s.cleanups = append(%s.cleanups, %sCleanup)\n", s.state, s.state, p.VarName))
+			buf.WriteString(fmt.Sprintf("\t%s.mu.Unlock()\n", s.state))
+		}
+		if s.canError[p.VarName] {
+			buf.WriteString(fmt.Sprintf("\treturn %s, nil\n})\n\n", p.VarName))
+		} else {
+			buf.WriteString(fmt.Sprintf("\treturn %s\n})\n\n", p.VarName))
+		}
+	}
+}
+
+func zeroValue(t types.TypeRef, typeName string) string {
+	if t.IsPointer || t.IsSlice || t.MapKey != nil || t.Func != nil {
+		return "nil"
+	}
+	return "*new(" + typeName + ")"
+}
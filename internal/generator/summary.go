@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+func Summary(r *analyzer.Result) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("<!-- Code generated by autowire. DO NOT EDIT. -->\n\n")
+	buf.WriteString("# Wiring Summary\n\n")
+	buf.WriteString(fmt.Sprintf("Container in `%s`: %d providers, %d invocations.\n",
+		r.OutputImportPath, len(r.Providers)+len(r.RequestProviders)+len(r.TransientProviders)+len(r.WeakProviders)+len(r.LazyProviders), len(r.Invocations)))
+
+	writeProviderTable(&buf, "Providers", r.Providers)
+	if len(r.RequestProviders) > 0 {
+		writeProviderTable(&buf, "Request Scope", r.RequestProviders)
+	}
+	if len(r.TransientProviders) > 0 {
+		writeProviderTable(&buf, "Transient", r.TransientProviders)
+	}
+	if len(r.WeakProviders) > 0 {
+		writeProviderTable(&buf, "Weak", r.WeakProviders)
+	}
+	if len(r.LazyProviders) > 0 {
+		writeProviderTable(&buf, "Lazy", r.LazyProviders)
+	}
+
+	if len(r.Invocations) > 0 {
+		buf.WriteString("\n## Invocations\n\n")
+		buf.WriteString("| # | Invocation | Dependencies | Returns error |\n")
+		buf.WriteString("|---|------------|--------------|---------------|\n")
+		for i, inv := range r.Invocations {
+			deps := make([]string, len(inv.Dependencies))
+			for j, dep := range inv.Dependencies {
+				deps[j] = code(dep.Key())
+			}
+			buf.WriteString(fmt.Sprintf("| %d | %s | %s | %s |\n",
+				i+1, code(inv.ImportPath+"."+inv.Name), list(deps), yesNo(inv.CanError)))
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func writeProviderTable(buf *bytes.Buffer, title string, providers []types.Provider) {
+	buf.WriteString(fmt.Sprintf("\n## %s\n\n", title))
+	buf.WriteString("| # | Provider | Type | Dependencies | Returns error |\n")
+	buf.WriteString("|---|----------|------|--------------|---------------|\n")
+	for i, p := range providers {
+		var deps []string
+		name := code(p.ImportPath + "." + p.Name)
+		if p.Kind == types.ProviderKindGroup {
+			name = "group " + code(p.Name)
+			for _, m := range p.Members {
+				deps = append(deps, code(m.ImportPath+"."+m.Name))
+			}
+		}
+		for _, dep := range p.Dependencies {
+			deps = append(deps, code(dep.Type.Key()))
+		}
+		buf.WriteString(fmt.Sprintf("| %d | %s | %s | %s | %s |\n",
+			i+1, name, code(p.ProvidedType.Key()), list(deps), yesNo(p.CanError)))
+	}
+}
+
+func code(s string) string {
+	return "`" + s + "`"
+}
+
+func list(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, ", ")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	config := types.TypeRef{Name: "Config", ImportPath: "pkg/config", IsPointer: true}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{Name: "NewConfig", Kind: types.ProviderKindFunc, ProvidedType: config, ImportPath: "pkg/config"},
+			{
+				Name:         "NewDatabase",
+				Kind:         types.ProviderKindFunc,
+				ProvidedType: types.TypeRef{Name: "Database", ImportPath: "pkg/db", IsPointer: true},
+				Dependencies: []types.Dependency{{Type: config}},
+				CanError:     true,
+				ImportPath:   "pkg/db",
+			},
+		},
+		Invocations: []types.Invocation{
+			{Name: "Migrate", ImportPath: "pkg/db", CanError: true, Dependencies: []types.TypeRef{config}},
+		},
+		OutputImportPath: "example.com/app",
+	}
+
+	expected := "<!-- Code generated by autowire. DO NOT EDIT. -->\n\n" +
+		"# Wiring Summary\n\n" +
+		"Container in `example.com/app`: 2 providers, 1 invocations.\n\n" +
+		"## Providers\n\n" +
+		"| # | Provider | Type | Dependencies | Returns error |\n" +
+		"|---|----------|------|--------------|---------------|\n" +
+		"| 1 | `pkg/config.NewConfig` | `*pkg/config.Config` | - | no |\n" +
+		"| 2 | `pkg/db.NewDatabase` | `*pkg/db.Database` | `*pkg/config.Config` | yes |\n\n" +
+		"## Invocations\n\n" +
+		"| # | Invocation | Dependencies | Returns error |\n" +
+		"|---|------------|--------------|---------------|\n" +
+		"| 1 | `pkg/db.Migrate` | `*pkg/config.Config` | yes |\n"
+
+	assert.Equal(t, expected, string(Summary(result)))
+	assert.Equal(t, Summary(result), Summary(result))
+}
+
+func TestSummary_GroupsAndRequestScope(t *testing.T) {
+	handler := types.TypeRef{Name: "Handler", ImportPath: "pkg/http"}
+	result := &analyzer.Result{
+		Providers: []types.Provider{
+			{
+				Name:         "handlers",
+				Kind:         types.ProviderKindGroup,
+				ProvidedType: types.TypeRef{Name: "Handler", ImportPath: "pkg/http", IsSlice: true},
+				Members: []types.Provider{
+					{Name: "NewAuth", ProvidedType: handler, ImportPath: "pkg/auth"},
+				},
+			},
+		},
+		RequestProviders: []types.Provider{
+			{Name: "CurrentUser", ProvidedType: types.TypeRef{Name: "User", ImportPath: "pkg/auth", IsPointer: true}, ImportPath: "pkg/auth"},
+		},
+	}
+
+	summary := string(Summary(result))
+	assert.Contains(t, summary, "| 1 | group `handlers` | `[]pkg/http.Handler` | `pkg/auth.NewAuth` | no |")
+	assert.Contains(t, summary, "## Request Scope")
+	assert.Contains(t, summary, "| 1 | `pkg/auth.CurrentUser` | `*pkg/auth.User` | - | no |")
+	assert.NotContains(t, summary, "## Invocations")
+}
@@ -0,0 +1,221 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+type transients struct {
+	byType   map[string]types.Provider
+	declared map[string]bool
+	recover  bool
+	out      string
+	imports  map[string]string
+	resolver types.PackageNameResolver
+}
+
+func newTransients(providers []types.Provider, declared []string, recoverPanics bool, out string, imports map[string]string, resolver types.PackageNameResolver) *transients {
+	byType := make(map[string]types.Provider, len(providers))
+	for _, p := range providers {
+		byType[p.ProvidedType.Key()] = p
+	}
+	taken := map[string]bool{"err": true, "cleanup": true, "cleanups": true, "ctx": true, "a": true, runOptionsParam: true, argsParam: true, initOptionsParam: true}
+	for _, name := range declared {
+		taken[name] = true
+	}
+	return &transients{byType: byType, declared: taken, recover: recoverPanics, out: out, imports: imports, resolver: resolver}
+}
+
+func (t *transients) inject(buf *bytes.Buffer, deps []types.TypeRef, vars map[string]string, fail string) map[string]string {
+	var scoped map[string]string
+	for _, dep := range deps {
+		key := dep.Key()
+		p, ok := t.byType[key]
+		if !ok {
+			continue
+		}
+		if scoped == nil {
+			scoped = maps.Clone(vars)
+		} else if _, done := scoped[key]; done {
+			continue
+		}
+		scoped[key] = t.build(buf, p, vars, fail)
+	}
+	if scoped == nil {
+		return vars
+	}
+	return scoped
+}
+
+func (t *transients) build(buf *bytes.Buffer, p types.Provider, vars map[string]string, fail string) string {
+	deps := t.inject(buf, dependencyTypes(p), vars, fail)
+	name := p.VarName
+	for base, i := name, 1; t.declared[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	t.declared[name] = true
+	p.VarName = name
+	writeProvider(buf, p, deps, fail, t.recover, t.out, t.imports, t.resolver)
+	return name
+}
+
+func (t *transients) canError(p types.Provider) bool {
+	if p.CanError || t.recover && p.Kind == types.ProviderKindFunc {
+		return true
+	}
+	for _, dep := range p.Dependencies {
+		if d, ok := t.byType[dep.Type.Key()]; ok && t.canError(d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *transients) needsContext(p types.Provider) bool {
+	for _, dep := range p.Dependencies {
+		if dep.Type.Key() == "context.Context" {
+			return true
+		}
+		if d, ok := t.byType[dep.Type.Key()]; ok && t.needsContext(d) {
+			return true
+		}
+	}
+	return false
+}
+
+func varNames(providers []types.Provider) []string {
+	names := make([]string, len(providers))
+	for i, p := range providers {
+		names[i] = p.VarName
+	}
+	return names
+}
+
+func externalNames(externals []types.External) []string {
+	names := make([]string, len(externals))
+	for i, e := range externals {
+		names[i] = e.VarName
+	}
+	return names
+}
+
+func dependencyTypes(p types.Provider) []types.TypeRef {
+	deps := make([]types.TypeRef, len(p.Dependencies))
+	for i, dep := range p.Dependencies {
+		deps[i] = dep.Type
+	}
+	return deps
+}
+
+func factoryMethod(p types.Provider) string {
+	return "New" + toUpper(p.VarName)
+}
+
+func appVars(r *analyzer.Result, syms *symbols) map[string]string {
+	vars := make(map[string]string)
+	for _, p := range r.Providers {
+		if p.Group == "" {
+			vars[p.ProvidedType.Key()] = "a." + syms.field(p.VarName)
+		}
+	}
+	for _, p := range r.LazyProviders {
+		holder := "a." + syms.lazyHolder(p.VarName)
+		vars[types.Accessor(p.ProvidedType, true).Key()] = holder + ".get"
+		if !p.CanError {
+			vars[types.Accessor(p.ProvidedType, false).Key()] = holder + ".instance"
+		}
+	}
+	return vars
+}
+
+func writeTransientFactories(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, nolint string, recoverPanics bool, out string, imports map[string]string, resolver types.PackageNameResolver) []string {
+	vars := appVars(r, syms)
+	var methods []string
+
+	for i, p := range r.TransientProviders {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		t := newTransients(r.TransientProviders, nil, recoverPanics, out, imports, resolver)
+		typeName := formatType(p.ProvidedType, out, imports, resolver)
+		zero := "nil"
+		if !p.ProvidedType.IsPointer && !p.ProvidedType.IsSlice {
+			zero = "*new(" + typeName + ")"
+		}
+
+		scoped, params := vars, ""
+		if r.UsesContext && t.needsContext(p) {
+			scoped = maps.Clone(vars)
+			scoped["context.Context"] = "ctx"
+			params = "ctx context.Context"
+		}
+
+		buf.WriteString(nolint)
+		if t.canError(p) {
+			method := fmt.Sprintf("%s(%s) (%s, error)", factoryMethod(p), params, typeName)
+			methods = append(methods, method)
+			buf.WriteString(fmt.Sprintf("func (a *%s) %s {\n", syms.app, method))
+			name := t.build(buf, p, scoped, fmt.Sprintf("return %s, err", zero))
+			buf.WriteString(fmt.Sprintf("\treturn %s, nil\n}\n", name))
+			continue
+		}
+		method := fmt.Sprintf("%s(%s) %s", factoryMethod(p), params, typeName)
+		methods = append(methods, method)
+		buf.WriteString(fmt.Sprintf("func (a *%s) %s {\n", syms.app, method))
+		name := t.build(buf, p, scoped, "")
+		buf.WriteString(fmt.Sprintf("\treturn %s\n}\n", name))
+	}
+	return methods
+}
+
+func writeWeakAccessors(buf *bytes.Buffer, r *analyzer.Result, syms *symbols, nolint string, recoverPanics bool, out string, imports map[string]string, resolver types.PackageNameResolver) []string {
+	vars := appVars(r, syms)
+	var methods []string
+
+	for i, p := range r.WeakProviders {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		t := newTransients(r.TransientProviders, nil, recoverPanics, out, imports, resolver)
+		typeName := formatType(p.ProvidedType, out, imports, resolver)
+
+		scoped, params := vars, ""
+		if r.UsesContext && t.needsContext(p) {
+			scoped = maps.Clone(vars)
+			scoped["context.Context"] = "ctx"
+			params = "ctx context.Context"
+		}
+
+		buf.WriteString(nolint)
+		canError := t.canError(p)
+		method := fmt.Sprintf("%s(%s) %s", toUpper(p.VarName), params, typeName)
+		if canError {
+			method = fmt.Sprintf("%s(%s) (%s, error)", toUpper(p.VarName), params, typeName)
+		}
+		methods = append(methods, method)
+		buf.WriteString(fmt.Sprintf("func (a *%s) %s {\n", syms.app, method))
+		buf.WriteString("\ta.weakMu.Lock()\n\tdefer a.weakMu.Unlock()\n")
+		buf.WriteString(fmt.Sprintf("\tif %s := a.%s.Value(); %s != nil {\n", p.VarName, p.VarName, p.VarName))
+		if canError {
+			buf.WriteString(fmt.Sprintf("\t\treturn %s, nil\n\t}\n", p.VarName))
+		} else {
+			buf.WriteString(fmt.Sprintf("\t\treturn %s\n\t}\n", p.VarName))
+		}
+		fail := ""
+		if canError {
+			fail = "return nil, err"
+		}
+		name := t.build(buf, p, scoped, fail)
+		buf.WriteString(fmt.Sprintf("\ta.%s = weak.Make(%s)\n", p.VarName, name))
+		if canError {
+			buf.WriteString(fmt.Sprintf("\treturn %s, nil\n}\n", name))
+		} else {
+			buf.WriteString(fmt.Sprintf("\treturn %s\n}\n", name))
+		}
+	}
+	return methods
+}
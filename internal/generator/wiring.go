@@ -0,0 +1,187 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+type StepKind int
+
+const (
+	StepProvide StepKind = iota
+	StepInvoke
+)
+
+func (k StepKind) String() string {
+	if k == StepInvoke {
+		return "invocation"
+	}
+	return "provider"
+}
+
+type Step struct {
+	Kind StepKind
+	Name string
+	Call string
+}
+
+func (s Step) key() string {
+	return s.Kind.String() + " " + s.Name
+}
+
+func InitializerName(opts Options) string {
+	return newSymbols(opts).initialize
+}
+
+func ExtractWiring(code []byte, initializer string) ([]Step, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != initializer || fn.Body == nil {
+			continue
+		}
+		var steps []Step
+		collectSteps(fn.Body.List, &steps)
+		return steps, nil
+	}
+	return nil, fmt.Errorf("no %s function found", initializer)
+}
+
+func collectSteps(stmts []ast.Stmt, steps *[]Step) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignStmt:
+			if s.Tok != token.DEFINE || len(s.Rhs) != 1 {
+				continue
+			}
+			name, ok := s.Lhs[0].(*ast.Ident)
+			if !ok || name.Name == "cleanup" {
+				continue
+			}
+			*steps = append(*steps, Step{Kind: StepProvide, Name: name.Name, Call: render(s.Rhs[0])})
+		case *ast.ExprStmt:
+			call, ok := s.X.(*ast.CallExpr)
+			if !ok || isCleanupCall(call) {
+				continue
+			}
+			*steps = append(*steps, invokeStep(call))
+		case *ast.IfStmt:
+			if init, ok := s.Init.(*ast.AssignStmt); ok && len(init.Rhs) == 1 {
+				if call, ok := init.Rhs[0].(*ast.CallExpr); ok {
+					*steps = append(*steps, invokeStep(call))
+					continue
+				}
+			}
+			if s.Init == nil && !isErrCheck(s.Cond) {
+				collectSteps(s.Body.List, steps)
+			}
+		}
+	}
+}
+
+func invokeStep(call *ast.CallExpr) Step {
+	return Step{Kind: StepInvoke, Name: render(call.Fun), Call: render(call)}
+}
+
+func isCleanupCall(call *ast.CallExpr) bool {
+	ident, ok := call.Fun.(*ast.Ident)
+	return ok && ident.Name == "cleanup"
+}
+
+func isErrCheck(cond ast.Expr) bool {
+	bin, ok := cond.(*ast.BinaryExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := bin.X.(*ast.Ident)
+	return ok && ident.Name == "err"
+}
+
+func render(node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func DiffWiring(before, after []Step) []string {
+	oldByKey := make(map[string]Step, len(before))
+	for _, s := range before {
+		oldByKey[s.key()] = s
+	}
+	newByKey := make(map[string]Step, len(after))
+	for _, s := range after {
+		newByKey[s.key()] = s
+	}
+
+	var diffs []string
+	var oldCommon, newCommon []string
+	for _, s := range before {
+		if _, ok := newByKey[s.key()]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s removed: %s", s.key(), s.Call))
+			continue
+		}
+		oldCommon = append(oldCommon, s.key())
+	}
+	for _, s := range after {
+		prev, ok := oldByKey[s.key()]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s added: %s", s.key(), s.Call))
+			continue
+		}
+		newCommon = append(newCommon, s.key())
+		if prev.Call != s.Call {
+			diffs = append(diffs, fmt.Sprintf("%s changed: %s -> %s", s.key(), prev.Call, s.Call))
+		}
+	}
+
+	stable := longestCommonSubsequence(oldCommon, newCommon)
+	for _, key := range newCommon {
+		if !stable[key] {
+			diffs = append(diffs, fmt.Sprintf("%s reordered", key))
+		}
+	}
+	return diffs
+}
+
+func longestCommonSubsequence(a, b []string) map[string]bool {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	kept := make(map[string]bool)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			kept[a[i]] = true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return kept
+}
@@ -0,0 +1,84 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const wiringSource = `package main
+
+func InitializeApp(opts RunOptions) (*App, func(), error) {
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	config := config.NewConfig()
+	dB, dBCleanup, err := db.NewDB(config)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	cleanups = append(cleanups, dBCleanup)
+	repo := &store.Repo{
+		DB: dB,
+	}
+	handlers := []http.Handler{auth, logging}
+
+	setup.Migrate(dB)
+	if opts.ServeHttp {
+		if err := setup.Serve(repo); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+	return &App{}, cleanup, nil
+}
+`
+
+func TestExtractWiring(t *testing.T) {
+	steps, err := ExtractWiring([]byte(wiringSource), "InitializeApp")
+	require.NoError(t, err)
+
+	assert.Equal(t, []Step{
+		{Kind: StepProvide, Name: "config", Call: "config.NewConfig()"},
+		{Kind: StepProvide, Name: "dB", Call: "db.NewDB(config)"},
+		{Kind: StepProvide, Name: "repo", Call: "&store.Repo{DB: dB}"},
+		{Kind: StepProvide, Name: "handlers", Call: "[]http.Handler{auth, logging}"},
+		{Kind: StepInvoke, Name: "setup.Migrate", Call: "setup.Migrate(dB)"},
+		{Kind: StepInvoke, Name: "setup.Serve", Call: "setup.Serve(repo)"},
+	}, steps)
+
+	_, err = ExtractWiring([]byte(wiringSource), "InitializeWorkerApp")
+	assert.ErrorContains(t, err, "no InitializeWorkerApp function found")
+}
+
+func TestDiffWiring(t *testing.T) {
+	provide := func(name, call string) Step { return Step{Kind: StepProvide, Name: name, Call: call} }
+	before := []Step{
+		provide("config", "config.NewConfig()"),
+		provide("cache", "cache.New(config)"),
+		provide("db", "db.New(config)"),
+		provide("repo", "repo.New(db)"),
+		{Kind: StepInvoke, Name: "setup.Migrate", Call: "setup.Migrate(db)"},
+	}
+	after := []Step{
+		provide("db", "db.New(config)"),
+		provide("config", "config.NewConfig()"),
+		provide("repo", "repo.New(db, config)"),
+		provide("mailer", "mail.New(config)"),
+		{Kind: StepInvoke, Name: "setup.Migrate", Call: "setup.Migrate(db)"},
+	}
+
+	assert.Equal(t, []string{
+		"provider cache removed: cache.New(config)",
+		"provider repo changed: repo.New(db) -> repo.New(db, config)",
+		"provider mailer added: mail.New(config)",
+		"provider config reordered",
+	}, DiffWiring(before, after))
+	assert.Empty(t, DiffWiring(before, before))
+}
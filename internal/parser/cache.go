@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+type Modules interface {
+	ModulePath(dir string) (string, bool)
+	SetModulePath(dir, importPath string)
+}
+
+type Cache interface {
+	Modules
+	Package(importPath string) (CachedPackage, bool)
+	SetPackage(importPath string, pkg CachedPackage)
+}
+
+type CachedPackage struct {
+	Hash   string
+	Deps   map[string]string
+	Dirs   map[string]string
+	Result *types.ParseResult
+}
+
+type ModuleCache map[string]string
+
+func (m ModuleCache) ModulePath(dir string) (string, bool) {
+	path, ok := m[dir]
+	return path, ok
+}
+
+func (m ModuleCache) SetModulePath(dir, importPath string) {
+	m[dir] = importPath
+}
+
+func modulePath(dir string, modules Modules) (string, error) {
+	if modules == nil {
+		return getBasePath(dir)
+	}
+	if path, ok := modules.ModulePath(dir); ok {
+		return path, nil
+	}
+
+	root, ok := moduleRoot(dir)
+	if !ok {
+		root = dir
+	}
+	base, ok := modules.ModulePath(root)
+	if !ok {
+		var err error
+		if base, err = getBasePath(root); err != nil {
+			return "", err
+		}
+		modules.SetModulePath(root, base)
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", err
+	}
+	path := base
+	if rel != "." {
+		path += "/" + filepath.ToSlash(rel)
+	}
+	modules.SetModulePath(dir, path)
+	return path, nil
+}
+
+func moduleRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func hashPackages(fsys fs.FS, packages [][]sourceFile, prefixes, errorTypes []string) ([]string, error) {
+	hashes := make([]string, len(packages))
+	for i, files := range packages {
+		h := sha256.New()
+		h.Write([]byte(strings.Join(prefixes, ",") + "\x00"))
+		h.Write([]byte(strings.Join(errorTypes, ",") + "\x00"))
+		for j, f := range files {
+			src, err := fs.ReadFile(fsys, f.path)
+			if err != nil {
+				return nil, err
+			}
+			packages[i][j].src = src
+			h.Write([]byte(f.path + "\x00" + strconv.Itoa(len(src)) + "\x00"))
+			h.Write(src)
+		}
+		hashes[i] = hex.EncodeToString(h.Sum(nil))
+	}
+	return hashes, nil
+}
+
+func hashDir(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		h.Write([]byte(name + "\x00" + strconv.Itoa(len(src)) + "\x00"))
+		h.Write(src)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func cachedPackages(cache Cache, packages [][]sourceFile, hashes []string) []*types.ParseResult {
+	byPath := make(map[string]int, len(packages))
+	for i, files := range packages {
+		byPath[files[0].importPath] = i
+	}
+
+	dirHashes := make(map[string]string)
+	dirsChanged := func(dirs map[string]string) bool {
+		for dir, hash := range dirs {
+			current, ok := dirHashes[dir]
+			if !ok {
+				current = hashDir(dir)
+				dirHashes[dir] = current
+			}
+			if current != hash {
+				return true
+			}
+		}
+		return false
+	}
+
+	entries := make([]CachedPackage, len(packages))
+	stale := make([]bool, len(packages))
+	for i, files := range packages {
+		entry, ok := cache.Package(files[0].importPath)
+		entries[i] = entry
+		stale[i] = !ok || entry.Hash != hashes[i] || entry.Result == nil || dirsChanged(entry.Dirs)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := range packages {
+			if stale[i] {
+				continue
+			}
+			for dep, hash := range entries[i].Deps {
+				if j, ok := byPath[dep]; ok {
+					if !stale[j] {
+						continue
+					}
+				} else if other, ok := cache.Package(dep); ok && other.Hash == hash {
+					continue
+				}
+				stale[i], changed = true, true
+				break
+			}
+		}
+	}
+
+	results := make([]*types.ParseResult, len(packages))
+	for i := range packages {
+		if !stale[i] {
+			results[i] = entries[i].Result
+		}
+	}
+	return results
+}
+
+func storePackages(cache Cache, packages [][]sourceFile, hashes []string, parsed [][]typedFile, imported map[string]map[string]string, extracted []*types.ParseResult, fresh []*types.ParseResult) {
+	byPath := make(map[string]int, len(packages))
+	for i, files := range packages {
+		byPath[files[0].importPath] = i
+	}
+
+	for i, files := range packages {
+		if fresh[i] != nil {
+			continue
+		}
+		deps := make(map[string]string)
+		for _, tf := range parsed[i] {
+			for _, imp := range tf.file.Imports {
+				path, err := strconv.Unquote(imp.Path.Value)
+				if err != nil {
+					continue
+				}
+				if j, ok := byPath[path]; ok {
+					deps[path] = hashes[j]
+				}
+			}
+		}
+		dirs := make(map[string]string)
+		for path, dir := range imported[files[0].importPath] {
+			if _, ok := byPath[path]; !ok {
+				dirs[dir] = hashDir(dir)
+			}
+		}
+		cache.SetPackage(files[0].importPath, CachedPackage{Hash: hashes[i], Deps: deps, Dirs: dirs, Result: extracted[i]})
+	}
+}
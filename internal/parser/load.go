@@ -0,0 +1,397 @@
+package parser
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	gotypes "go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/diag"
+	"github.com/eloonstra/autowire/internal/types"
+	"golang.org/x/tools/go/packages"
+)
+
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedImports |
+	packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedModule
+
+type typedFile struct {
+	file *ast.File
+	info *gotypes.Info
+}
+
+type registrar interface {
+	Register(importPath, name string)
+}
+
+func loadTypes(fset *token.FileSet, root string, dirs []string, resolver types.PackageNameResolver) (map[string]typedFile, map[string]map[string]string, []diag.Diagnostic) {
+	patterns := make([]string, len(dirs))
+	for i, dir := range dirs {
+		patterns[i] = "./" + dir
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: loadMode, Dir: root, Fset: fset}, patterns...)
+	if err != nil {
+		return nil, nil, []diag.Diagnostic{typesUnavailable(strings.Join(patterns, ", "), err.Error())}
+	}
+
+	r, canRegister := resolver.(registrar)
+	files := make(map[string]typedFile)
+	deps := make(map[string]map[string]string)
+	var diagnostics []diag.Diagnostic
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			reason := "no type information"
+			if len(pkg.Errors) > 0 {
+				reason = pkg.Errors[0].Msg
+			}
+			diagnostics = append(diagnostics, typesUnavailable(pkg.PkgPath, reason))
+			continue
+		}
+		broken := make(map[string]bool)
+		for _, e := range pkg.Errors {
+			if e.Kind == packages.ParseError {
+				broken[errorFile(e.Pos)] = true
+			}
+		}
+		for _, file := range pkg.Syntax {
+			name := filepath.Clean(fset.File(file.Pos()).Name())
+			if !broken[name] {
+				files[name] = typedFile{file: file, info: pkg.TypesInfo}
+			}
+		}
+		if pkg.Module != nil && pkg.Types != nil {
+			deps[pkg.PkgPath] = moduleImports(pkg.Types, pkg.Module.Path, pkg.Module.Dir)
+		}
+		if canRegister {
+			for path, imp := range pkg.Imports {
+				if imp.Name != "" {
+					r.Register(path, imp.Name)
+				}
+			}
+		}
+	}
+	return files, deps, diagnostics
+}
+
+func moduleImports(pkg *gotypes.Package, modPath, modDir string) map[string]string {
+	dirs := make(map[string]string)
+	var walk func(*gotypes.Package)
+	walk = func(p *gotypes.Package) {
+		for _, imp := range p.Imports() {
+			path := imp.Path()
+			if _, ok := dirs[path]; ok {
+				continue
+			}
+			rel, ok := strings.CutPrefix(path, modPath)
+			if !ok || rel != "" && !strings.HasPrefix(rel, "/") {
+				continue
+			}
+			dirs[path] = filepath.Join(modDir, filepath.FromSlash(rel))
+			walk(imp)
+		}
+	}
+	walk(pkg)
+	return dirs
+}
+
+func typesUnavailable(what, reason string) diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity: diag.SeverityInfo,
+		Code:     "types-unavailable",
+		Message: fmt.Sprintf("loading types of %s failed (%s); resolving its annotations from syntax only, so aliases, dot imports and bound signatures from other packages are not resolved",
+			what, reason),
+	}
+}
+
+func errorFile(pos string) string {
+	for range 2 {
+		i := strings.LastIndex(pos, ":")
+		if i < 0 {
+			break
+		}
+		if _, err := strconv.Atoi(pos[i+1:]); err != nil {
+			break
+		}
+		pos = pos[:i]
+	}
+	return filepath.Clean(pos)
+}
+
+func typeRefOf(t gotypes.Type) (types.TypeRef, bool) {
+	switch t := gotypes.Unalias(t).(type) {
+	case *gotypes.Basic:
+		if t.Kind() == gotypes.Invalid {
+			return types.TypeRef{}, false
+		}
+		return types.TypeRef{Name: t.Name()}, true
+	case *gotypes.Named:
+		if t.TypeArgs().Len() > 0 {
+			return types.TypeRef{}, false
+		}
+		obj := t.Obj()
+		if obj.Pkg() == nil {
+			return types.TypeRef{Name: obj.Name()}, true
+		}
+		return types.TypeRef{Name: obj.Name(), ImportPath: obj.Pkg().Path()}, true
+	case *gotypes.Pointer:
+		inner, ok := typeRefOf(t.Elem())
+		if !ok || inner.IsPointer || inner.IsSlice || inner.MapKey != nil || inner.Func != nil {
+			return types.TypeRef{}, false
+		}
+		inner.IsPointer = true
+		return inner, true
+	case *gotypes.Slice:
+		elem, ok := typeRefOf(t.Elem())
+		if !ok || elem.IsSlice || elem.MapKey != nil {
+			return types.TypeRef{}, false
+		}
+		elem.IsSlice = true
+		return elem, true
+	case *gotypes.Map:
+		key, ok := typeRefOf(t.Key())
+		if !ok {
+			return types.TypeRef{}, false
+		}
+		value, ok := typeRefOf(t.Elem())
+		if !ok {
+			return types.TypeRef{}, false
+		}
+		ref, err := mapTypeRef(key, value)
+		return ref, err == nil
+	case *gotypes.Signature:
+		if t.TypeParams().Len() > 0 || t.Recv() != nil {
+			return types.TypeRef{}, false
+		}
+		sig := types.Signature{Variadic: t.Variadic()}
+		for i := range t.Params().Len() {
+			typ := t.Params().At(i).Type()
+			if sig.Variadic && i == t.Params().Len()-1 {
+				typ = typ.(*gotypes.Slice).Elem()
+			}
+			ref, ok := typeRefOf(typ)
+			if !ok {
+				return types.TypeRef{}, false
+			}
+			sig.Params = append(sig.Params, ref)
+		}
+		for v := range t.Results().Variables() {
+			ref, ok := typeRefOf(v.Type())
+			if !ok {
+				return types.TypeRef{}, false
+			}
+			sig.Results = append(sig.Results, ref)
+		}
+		return types.TypeRef{Func: &sig}, true
+	}
+	return types.TypeRef{}, false
+}
+
+func funcProvider(fn *gotypes.Func) (types.Provider, error) {
+	sig := fn.Type().(*gotypes.Signature)
+	if sig.TypeParams().Len() > 0 {
+		return types.Provider{}, fmt.Errorf("generic functions are not supported")
+	}
+	params, err := signatureDeps(sig)
+	if err != nil {
+		return types.Provider{}, err
+	}
+
+	results := sig.Results()
+	var canError, hasCleanup bool
+	switch results.Len() {
+	case 1:
+	case 2:
+		canError = isErrorObject(results.At(1).Type())
+		hasCleanup = isCleanupObject(results.At(1).Type())
+		if !canError && !hasCleanup {
+			return types.Provider{}, fmt.Errorf("second return value must be error or a cleanup func()")
+		}
+	case 3:
+		if !isCleanupObject(results.At(1).Type()) || !isErrorObject(results.At(2).Type()) {
+			return types.Provider{}, fmt.Errorf("constructor returning 3 values must return (T, func(), error)")
+		}
+		canError, hasCleanup = true, true
+	default:
+		return types.Provider{}, fmt.Errorf("constructor must return 1 to 3 values, got %d", results.Len())
+	}
+	provided, ok := typeRefOf(results.At(0).Type())
+	if !ok {
+		return types.Provider{}, fmt.Errorf("unsupported return type %s", results.At(0).Type())
+	}
+
+	deps := make([]types.Dependency, len(params))
+	for i, t := range params {
+		deps[i] = types.Dependency{Type: t}
+	}
+	return types.Provider{
+		Name:         fn.Name(),
+		Kind:         types.ProviderKindFunc,
+		ProvidedType: provided,
+		Dependencies: deps,
+		CanError:     canError,
+		HasCleanup:   hasCleanup,
+		ImportPath:   fn.Pkg().Path(),
+		VarName:      typeVarName(provided),
+	}, nil
+}
+
+func signatureDeps(sig *gotypes.Signature) ([]types.TypeRef, error) {
+	var deps []types.TypeRef
+	params := sig.Params()
+	for i := range params.Len() {
+		if sig.Variadic() && i == params.Len()-1 {
+			break
+		}
+		t, ok := typeRefOf(params.At(i).Type())
+		if !ok {
+			return nil, fmt.Errorf("unsupported parameter type %s", params.At(i).Type())
+		}
+		deps = append(deps, t)
+	}
+	return deps, nil
+}
+
+func isErrorObject(t gotypes.Type) bool {
+	return gotypes.Identical(t, gotypes.Universe.Lookup("error").Type())
+}
+
+func isCleanupObject(t gotypes.Type) bool {
+	sig, ok := t.Underlying().(*gotypes.Signature)
+	return ok && sig.Params().Len() == 0 && sig.Results().Len() == 0
+}
+
+func LoadProposed(dir string, provide, invoke []string, resolver types.PackageNameResolver) ([]types.Provider, []types.Invocation, error) {
+	var patterns []string
+	for _, target := range append(append([]string{}, provide...), invoke...) {
+		pkg, name, ok := cutLast(target, ".")
+		if !ok || pkg == "" || !token.IsExported(name) {
+			return nil, nil, fmt.Errorf("invalid target %q: must be <import path>.<Name>", target)
+		}
+		patterns = append(patterns, pkg)
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName | packages.NeedTypes | packages.NeedImports, Dir: dir}, patterns...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading packages: %w", err)
+	}
+	byPath := make(map[string]*packages.Package, len(pkgs))
+	r, canRegister := resolver.(registrar)
+	for _, pkg := range pkgs {
+		byPath[pkg.PkgPath] = pkg
+		if canRegister {
+			r.Register(pkg.PkgPath, pkg.Name)
+			for path, imp := range pkg.Imports {
+				r.Register(path, imp.Name)
+			}
+		}
+	}
+	lookup := func(target string) (gotypes.Object, error) {
+		path, name, _ := cutLast(target, ".")
+		pkg, ok := byPath[path]
+		if !ok || pkg.Types == nil {
+			return nil, fmt.Errorf("%s: package %s not found", target, path)
+		}
+		if len(pkg.Errors) > 0 {
+			return nil, fmt.Errorf("%s: %s", target, pkg.Errors[0])
+		}
+		obj := pkg.Types.Scope().Lookup(name)
+		if obj == nil {
+			return nil, fmt.Errorf("%s: %s not found in %s", target, name, path)
+		}
+		return obj, nil
+	}
+
+	var providers []types.Provider
+	for _, target := range provide {
+		obj, err := lookup(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		var p types.Provider
+		switch obj := obj.(type) {
+		case *gotypes.Func:
+			p, err = funcProvider(obj)
+		case *gotypes.TypeName:
+			p, err = structProvider(obj)
+		default:
+			err = fmt.Errorf("must be a function or struct type")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", target, err)
+		}
+		providers = append(providers, p)
+	}
+
+	var invocations []types.Invocation
+	for _, target := range invoke {
+		obj, err := lookup(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		fn, ok := obj.(*gotypes.Func)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: must be a function", target)
+		}
+		inv, err := funcInvocation(fn)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", target, err)
+		}
+		invocations = append(invocations, inv)
+	}
+	return providers, invocations, nil
+}
+
+func structProvider(tn *gotypes.TypeName) (types.Provider, error) {
+	named, ok := tn.Type().(*gotypes.Named)
+	if !ok || named.TypeParams().Len() > 0 {
+		return types.Provider{}, fmt.Errorf("must be a non-generic defined struct type")
+	}
+	st, ok := named.Underlying().(*gotypes.Struct)
+	if !ok {
+		return types.Provider{}, fmt.Errorf("must be a function or struct type")
+	}
+	var deps []types.Dependency
+	for i := range st.NumFields() {
+		field := st.Field(i)
+		if field.Embedded() || !field.Exported() {
+			continue
+		}
+		t, ok := typeRefOf(field.Type())
+		if !ok {
+			return types.Provider{}, fmt.Errorf("field %s: unsupported type %s", field.Name(), field.Type())
+		}
+		deps = append(deps, types.Dependency{FieldName: field.Name(), Type: t})
+	}
+	return types.Provider{
+		Name:         tn.Name(),
+		Kind:         types.ProviderKindStruct,
+		ProvidedType: types.TypeRef{Name: tn.Name(), ImportPath: tn.Pkg().Path(), IsPointer: true},
+		Dependencies: deps,
+		ImportPath:   tn.Pkg().Path(),
+		VarName:      toLowerCamel(tn.Name()),
+	}, nil
+}
+
+func funcInvocation(fn *gotypes.Func) (types.Invocation, error) {
+	sig := fn.Type().(*gotypes.Signature)
+	if sig.TypeParams().Len() > 0 {
+		return types.Invocation{}, fmt.Errorf("generic functions are not supported")
+	}
+	deps, err := signatureDeps(sig)
+	if err != nil {
+		return types.Invocation{}, err
+	}
+	results := sig.Results()
+	if results.Len() > 1 || results.Len() == 1 && !isErrorObject(results.At(0).Type()) {
+		return types.Invocation{}, fmt.Errorf("invocation may only return an error")
+	}
+	return types.Invocation{
+		Name:         fn.Name(),
+		Dependencies: deps,
+		CanError:     results.Len() == 1,
+		ImportPath:   fn.Pkg().Path(),
+	}, nil
+}
@@ -1,23 +1,42 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	gotypes "go/types"
 	"io/fs"
 	"os"
 	"os/exec"
+	pathpkg "path"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 
+	"github.com/eloonstra/autowire/internal/diag"
 	"github.com/eloonstra/autowire/internal/types"
 )
 
 const (
-	annotationProvide = "//autowire:provide"
-	annotationInvoke  = "//autowire:invoke"
+	DefaultPrefix     = "autowire"
+	directiveProvide  = "provide"
+	directiveInvoke   = "invoke"
+	directiveDefault  = "default"
+	directiveInject   = "inject"
+	directiveValue    = "value"
+	directiveBind     = "bind"
+	directiveConfig   = "config"
+	directiveExternal = "external"
+
+	cliArgs           = "args"
 	goListOutputParts = 2
 )
 
@@ -25,23 +44,154 @@ type fileContext struct {
 	importPath string
 	imports    map[string]string
 	resolver   types.PackageNameResolver
+	prefixes   []string
+	errorTypes map[string]bool
+	fset       *token.FileSet
+	comments   []*ast.CommentGroup
+	info       *gotypes.Info
+	scope      *gotypes.Scope
+}
+
+func (ctx *fileContext) annotation(doc *ast.CommentGroup, directive string) (found bool, arg string) {
+	prefixes := ctx.prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{DefaultPrefix}
+	}
+	for _, prefix := range prefixes {
+		if found, arg := parseAnnotation(doc, "//"+prefix+":"+directive); found {
+			return true, arg
+		}
+	}
+	return false, ""
+}
+
+func (ctx *fileContext) injectArgs(groups ...*ast.CommentGroup) (injectArgs, error) {
+	for _, g := range groups {
+		if found, arg := ctx.annotation(g, directiveInject); found {
+			return parseInjectArgs(arg)
+		}
+	}
+	return injectArgs{}, nil
+}
+
+func (ctx *fileContext) paramComments(params *ast.FieldList) map[*ast.Field][]*ast.CommentGroup {
+	attached := make(map[*ast.Field][]*ast.CommentGroup)
+	if ctx.fset == nil || !params.Opening.IsValid() {
+		return attached
+	}
+	line := func(pos token.Pos) int { return ctx.fset.Position(pos).Line }
+	for _, cg := range ctx.comments {
+		if cg.Pos() < params.Opening || cg.End() > params.Closing {
+			continue
+		}
+		var owner *ast.Field
+		for _, f := range params.List {
+			if f.End() <= cg.Pos() && line(f.End()) == line(cg.Pos()) {
+				owner = f
+				break
+			}
+		}
+		if owner == nil {
+			for _, f := range params.List {
+				if f.Pos() >= cg.End() {
+					owner = f
+					break
+				}
+			}
+		}
+		if owner != nil {
+			attached[owner] = append(attached[owner], cg)
+		}
+	}
+	return attached
+}
+
+func (ctx *fileContext) position(pos token.Pos) types.Position {
+	if ctx.fset == nil {
+		return types.Position{}
+	}
+	p := ctx.fset.Position(pos)
+	return types.Position{File: p.Filename, Line: p.Line}
+}
+
+func (ctx *fileContext) positioned(pos token.Pos, err error) error {
+	if ctx.fset == nil {
+		return err
+	}
+	return fmt.Errorf("%s: %w", ctx.fset.Position(pos), err)
+}
+
+func (ctx *fileContext) hasAnnotation(doc *ast.CommentGroup, directive string) bool {
+	found, _ := ctx.annotation(doc, directive)
+	return found
 }
 
-func GetOutputInfo(outDir string) (packageName, importPath string, err error) {
+func GetOutputInfo(outDir, packageName string, modules Modules) (string, string, error) {
 	absOutDir, err := filepath.Abs(outDir)
 	if err != nil {
 		return "", "", err
 	}
 
-	importPath, err = getBasePath(absOutDir)
+	importPath, err := outputImportPath(absOutDir, modules)
 	if err != nil {
 		return "", "", fmt.Errorf("getting module path: %w", err)
 	}
 
-	entries, err := os.ReadDir(absOutDir)
+	existing := OutputPackage(os.DirFS(absOutDir), "")
+	switch {
+	case packageName == "" && existing != "":
+		return existing, importPath, nil
+	case packageName == "":
+		packageName = sanitizePackageName(filepath.Base(absOutDir))
+		if packageName == "" {
+			return "", "", fmt.Errorf("cannot infer a package name from directory %s", absOutDir)
+		}
+	case !token.IsIdentifier(packageName):
+		return "", "", fmt.Errorf("%q is not a valid package name", packageName)
+	case existing != "" && existing != packageName:
+		return "", "", fmt.Errorf("output directory %s already contains package %s, not %s", absOutDir, existing, packageName)
+	}
+	return packageName, importPath, nil
+}
+
+func outputImportPath(absOutDir string, modules Modules) (string, error) {
+	if _, err := os.Stat(absOutDir); !os.IsNotExist(err) {
+		return modulePath(absOutDir, modules)
+	}
+
+	root, ok := moduleRoot(absOutDir)
+	if !ok {
+		return "", fmt.Errorf("output directory %s is not inside a Go module", absOutDir)
+	}
+	base, err := modulePath(root, modules)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, absOutDir)
+	if err != nil {
+		return "", err
+	}
+	return base + "/" + filepath.ToSlash(rel), nil
+}
+
+func sanitizePackageName(dir string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(dir) {
+		if r == '_' || unicode.IsLetter(r) || (unicode.IsDigit(r) && b.Len() > 0) {
+			b.WriteRune(r)
+		}
+	}
+	name := b.String()
+	if token.IsKeyword(name) {
+		return name + "pkg"
+	}
+	return name
+}
+
+func OutputPackage(fsys fs.FS, fallback string) string {
+	entries, err := fs.ReadDir(fsys, ".")
 	if err != nil {
-		packageName = filepath.Base(absOutDir)
-		return packageName, importPath, nil
+		return fallback
 	}
 
 	for _, entry := range entries {
@@ -55,42 +205,135 @@ func GetOutputInfo(outDir string) (packageName, importPath string, err error) {
 		if !hasGoSuffix || isTestFile || isGenFile {
 			continue
 		}
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			continue
+		}
 		fset := token.NewFileSet()
-		file, err := parser.ParseFile(fset, filepath.Join(absOutDir, name), nil, parser.PackageClauseOnly)
+		file, err := parser.ParseFile(fset, name, src, parser.PackageClauseOnly)
 		if err != nil {
 			continue
 		}
-		return file.Name.Name, importPath, nil
+		return file.Name.Name
 	}
 
-	packageName = filepath.Base(absOutDir)
-	return packageName, importPath, nil
+	return fallback
 }
 
-func Parse(scanDir string, resolver types.PackageNameResolver) (*types.ParseResult, error) {
-	result := &types.ParseResult{}
+type Options struct {
+	Prefixes   []string
+	Progress   func(done, total int)
+	Shuffle    func(n int, swap func(i, j int))
+	Workers    int
+	Cache      Cache
+	Modules    Modules
+	Exclude    []string
+	Shallow    bool
+	ErrorTypes []string
+}
+
+func (o Options) modules() Modules {
+	if o.Cache != nil {
+		return o.Cache
+	}
+	return o.Modules
+}
+
+type sourceFile struct {
+	path       string
+	importPath string
+	src        []byte
+}
+
+func Parse(scanDir string, resolver types.PackageNameResolver, opts Options) (*types.ParseResult, error) {
+	if err := validateOptions(opts); err != nil {
+		return nil, err
+	}
 
 	absDir, err := filepath.Abs(scanDir)
 	if err != nil {
 		return nil, err
 	}
 
-	scanBasePath, err := getBasePath(absDir)
+	scanBasePath, err := modulePath(absDir, opts.modules())
+	if err != nil {
+		return nil, fmt.Errorf("getting module path: %w", err)
+	}
+
+	return scan(os.DirFS(absDir), absDir, scanBasePath, []string{"."}, resolver, opts)
+}
+
+func ParseDirs(root string, dirs []string, resolver types.PackageNameResolver, opts Options) (*types.ParseResult, error) {
+	if err := validateOptions(opts); err != nil {
+		return nil, err
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath, err := modulePath(absRoot, opts.modules())
 	if err != nil {
 		return nil, fmt.Errorf("getting module path: %w", err)
 	}
 
-	err = filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
+	starts := make([]string, len(dirs))
+	for i, dir := range dirs {
+		starts[i] = pathpkg.Clean(filepath.ToSlash(dir))
+		if !fs.ValidPath(starts[i]) {
+			return nil, fmt.Errorf("%s is not a directory inside %s", dir, absRoot)
+		}
+	}
+	opts.Shallow = true
+	return scan(os.DirFS(absRoot), absRoot, basePath, starts, resolver, opts)
+}
+
+func ParseFS(fsys fs.FS, importPath string, resolver types.PackageNameResolver, opts Options) (*types.ParseResult, error) {
+	if err := validateOptions(opts); err != nil {
+		return nil, err
+	}
+	return scan(fsys, "", importPath, []string{"."}, resolver, opts)
+}
+
+func validateOptions(opts Options) error {
+	if err := validatePrefixes(opts.Prefixes); err != nil {
+		return err
+	}
+	if _, err := errorTypeKeys(opts.ErrorTypes); err != nil {
+		return err
+	}
+	return validateExcludes(opts.Exclude)
+}
+
+func validatePrefixes(prefixes []string) error {
+	for _, prefix := range prefixes {
+		if !token.IsIdentifier(prefix) {
+			return fmt.Errorf("invalid directive prefix %q: must be a valid identifier", prefix)
+		}
+	}
+	return nil
+}
+
+func scan(fsys fs.FS, root, scanBasePath string, starts []string, resolver types.PackageNameResolver, opts Options) (*types.ParseResult, error) {
+	result := &types.ParseResult{}
+
+	var packages [][]sourceFile
+	byDir := make(map[string]int)
+	walk := func(start, path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if shouldSkip(d) {
+		if path != start && shouldSkip(relTo(start, path), d, opts.Exclude) {
 			if d.IsDir() {
-				return filepath.SkipDir
+				return fs.SkipDir
 			}
 			return nil
 		}
+		if path != start && d.IsDir() && opts.Shallow {
+			return fs.SkipDir
+		}
 
 		if d.IsDir() || !strings.HasSuffix(path, ".go") {
 			return nil
@@ -100,18 +343,194 @@ func Parse(scanDir string, resolver types.PackageNameResolver) (*types.ParseResu
 		}
 
 		importPath := scanBasePath
-		rel, err := filepath.Rel(absDir, filepath.Dir(path))
+		rel := pathpkg.Dir(path)
+		if rel != "." {
+			importPath = scanBasePath + "/" + rel
+		}
+
+		idx, ok := byDir[rel]
+		if !ok {
+			idx = len(packages)
+			byDir[rel] = idx
+			packages = append(packages, nil)
+		}
+		packages[idx] = append(packages[idx], sourceFile{path: path, importPath: importPath})
+		return nil
+	}
+	var err error
+	for _, start := range starts {
+		err = fs.WalkDir(fsys, start, func(path string, d fs.DirEntry, err error) error {
+			return walk(start, path, d, err)
+		})
 		if err != nil {
-			return fmt.Errorf("computing relative path for %s: %w", path, err)
+			return result, err
 		}
-		if rel != "." {
-			importPath = scanBasePath + "/" + filepath.ToSlash(rel)
+	}
+
+	order := make([]int, len(packages))
+	for i := range order {
+		order[i] = i
+	}
+	if opts.Shuffle != nil {
+		opts.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		for _, files := range packages {
+			opts.Shuffle(len(files), func(i, j int) { files[i], files[j] = files[j], files[i] })
+		}
+	}
+
+	var hashes []string
+	fresh := make([]*types.ParseResult, len(packages))
+	if opts.Cache != nil && root != "" {
+		if hashes, err = hashPackages(fsys, packages, opts.Prefixes, opts.ErrorTypes); err != nil {
+			return result, err
+		}
+		fresh = cachedPackages(opts.Cache, packages, hashes)
+	}
+	var work []int
+	for _, i := range order {
+		if fresh[i] == nil {
+			work = append(work, i)
+		}
+	}
+
+	fset := token.NewFileSet()
+	var loaded map[string]typedFile
+	var imported map[string]map[string]string
+	if root != "" && len(work) > 0 {
+		dirs := make([]string, len(work))
+		for j, i := range work {
+			dirs[j] = pathpkg.Dir(packages[i][0].path)
+		}
+		var diagnostics []diag.Diagnostic
+		loaded, imported, diagnostics = loadTypes(fset, root, dirs, resolver)
+		result.Diagnostics = append(result.Diagnostics, diagnostics...)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	parsed := make([][]typedFile, len(packages))
+	broken := make([][]diag.Diagnostic, len(packages))
+	err = parallel(work, workers, func(i int) error {
+		for _, f := range packages[i] {
+			filename := f.path
+			if root != "" {
+				filename = filepath.Join(root, filepath.FromSlash(f.path))
+			}
+			if tf, ok := loaded[filename]; ok {
+				parsed[i] = append(parsed[i], tf)
+				continue
+			}
+			src := f.src
+			if src == nil {
+				read, err := fs.ReadFile(fsys, f.path)
+				if err != nil {
+					return err
+				}
+				src = read
+			}
+			file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+			if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+				broken[i] = append(broken[i], syntaxWarning(filename, list))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			parsed[i] = append(parsed[i], typedFile{file: file})
 		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	var files []typedFile
+	for _, i := range work {
+		files = append(files, parsed[i]...)
+	}
+	prefetchImports(files, resolver)
 
-		return parseFile(path, importPath, resolver, result)
+	var mu sync.Mutex
+	done := len(packages) - len(work)
+	extracted := make([]*types.ParseResult, len(packages))
+	err = parallel(work, workers, func(i int) error {
+		extracted[i] = &types.ParseResult{Diagnostics: broken[i]}
+		var errs []error
+		for _, tf := range parsed[i] {
+			if err := extractFile(tf.file, fset, tf.info, packages[i][0].importPath, resolver, opts, extracted[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+		if opts.Progress != nil {
+			mu.Lock()
+			done++
+			opts.Progress(done, len(packages))
+			mu.Unlock()
+		}
+		return nil
 	})
+	if err != nil {
+		return result, err
+	}
+	if hashes != nil {
+		storePackages(opts.Cache, packages, hashes, parsed, imported, extracted, fresh)
+	}
+	for _, i := range order {
+		r := extracted[i]
+		if r == nil {
+			r = fresh[i]
+		}
+		result.Merge(r)
+	}
+
+	return result, nil
+}
+
+func relTo(start, path string) string {
+	if start == "." {
+		return path
+	}
+	return strings.TrimPrefix(path, start+"/")
+}
+
+func syntaxWarning(filename string, errs scanner.ErrorList) diag.Diagnostic {
+	message := fmt.Sprintf("skipping %s: %s", filepath.Base(filename), errs[0].Msg)
+	if len(errs) > 1 {
+		message += fmt.Sprintf(" (and %d more syntax errors)", len(errs)-1)
+	}
+	return diag.Diagnostic{
+		Severity: diag.SeverityWarning,
+		Code:     "syntax-error",
+		Message:  message,
+		File:     filename,
+		Line:     errs[0].Pos.Line,
+	}
+}
+
+func parallel(order []int, workers int, fn func(i int) error) error {
+	errs := make([]error, len(order))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(order)) {
+		wg.Go(func() {
+			for pos := range jobs {
+				errs[pos] = fn(order[pos])
+			}
+		})
+	}
+	for pos := range order {
+		jobs <- pos
+	}
+	close(jobs)
+	wg.Wait()
 
-	return result, err
+	return errors.Join(errs...)
 }
 
 func getBasePath(dir string) (string, error) {
@@ -138,172 +557,1073 @@ func getBasePath(dir string) (string, error) {
 	return parts[0] + "/" + filepath.ToSlash(rel), nil
 }
 
-func shouldSkip(d fs.DirEntry) bool {
+func shouldSkip(rel string, d fs.DirEntry, exclude []string) bool {
 	name := d.Name()
 	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
 		return true
 	}
-	if d.IsDir() {
-		return false // TODO: Support excluding of files and folders through flag.
+	return Excluded(rel, exclude)
+}
+
+func Excluded(rel string, patterns []string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := pathpkg.Match(pattern, pathpkg.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+			return true
+		}
 	}
 	return false
 }
 
-func parseFile(path, importPath string, resolver types.PackageNameResolver, result *types.ParseResult) error {
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := pathpkg.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func errorTypeKeys(specs []string) (map[string]bool, error) {
+	keys := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		path, name, ok := cutLast(strings.TrimPrefix(spec, "*"), ".")
+		if !ok || path == "" || !token.IsExported(name) {
+			return nil, fmt.Errorf("invalid error type %q: must be [*]<import path>.<Name>", spec)
+		}
+		keys[spec] = true
+	}
+	return keys, nil
+}
+
+func validateExcludes(patterns []string) error {
+	for _, pattern := range patterns {
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := pathpkg.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func parseFile(path, importPath string, resolver types.PackageNameResolver, prefixes []string, result *types.ParseResult) error {
+	return parseSource(path, nil, importPath, resolver, prefixes, result)
+}
+
+func parseSource(filename string, src any, importPath string, resolver types.PackageNameResolver, prefixes []string, result *types.ParseResult) error {
 	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
 	if err != nil {
 		return err
 	}
+	return extractFile(file, fset, nil, importPath, resolver, Options{Prefixes: prefixes}, result)
+}
+
+func extractFile(file *ast.File, fset *token.FileSet, info *gotypes.Info, importPath string, resolver types.PackageNameResolver, opts Options, result *types.ParseResult) error {
+	if result.PackageNames == nil {
+		result.PackageNames = make(map[string]string)
+	}
+	result.PackageNames[importPath] = file.Name.Name
 
+	errorTypes, err := errorTypeKeys(opts.ErrorTypes)
+	if err != nil {
+		return err
+	}
 	ctx := &fileContext{
 		importPath: importPath,
 		imports:    buildImportMap(file, resolver),
 		resolver:   resolver,
+		prefixes:   opts.Prefixes,
+		errorTypes: errorTypes,
+		fset:       fset,
+		comments:   file.Comments,
+		info:       info,
+	}
+	if info != nil {
+		ctx.scope = info.Scopes[file]
+	}
+
+	var errs []error
+	defaults, err := parseDefaults(file, ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	result.Defaults = append(result.Defaults, defaults...)
+
+	externals, err := parseExternals(file, ctx)
+	if err != nil {
+		errs = append(errs, err)
 	}
+	result.Externals = append(result.Externals, externals...)
+
+	bound, err := parseBindings(file, ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	result.Providers = append(result.Providers, bound...)
 
 	for _, decl := range file.Decls {
 		switch d := decl.(type) {
 		case *ast.GenDecl:
-			if d.Tok != token.TYPE {
+			if d.Tok == token.VAR || d.Tok == token.CONST {
+				providers, err := parseVarProviders(d, ctx)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				result.Providers = append(result.Providers, providers...)
 				continue
 			}
-			hasProvide, provideArg := parseAnnotation(d.Doc, annotationProvide)
-			if !hasProvide {
+			if d.Tok != token.TYPE {
 				continue
 			}
+			declProvide, declArg := ctx.annotation(d.Doc, directiveProvide)
 			for _, spec := range d.Specs {
 				ts, ok := spec.(*ast.TypeSpec)
 				if !ok {
 					continue
 				}
-				st, ok := ts.Type.(*ast.StructType)
-				if !ok {
+				if alias, ok := resolveAlias(ts, ctx); ok {
+					result.Aliases = append(result.Aliases, alias)
+				}
+				if _, ok := ts.Type.(*ast.InterfaceType); ok && !ts.Assign.IsValid() {
+					result.Interfaces = append(result.Interfaces, types.TypeRef{Name: ts.Name.Name, ImportPath: ctx.importPath})
+				}
+				hasProvide, provideArg := declProvide, declArg
+				if found, arg := ctx.annotation(ts.Doc, directiveProvide); found {
+					hasProvide, provideArg = true, arg
+				}
+				if ctx.hasAnnotation(ts.Doc, directiveInvoke) || ctx.hasAnnotation(d.Doc, directiveInvoke) {
+					errs = append(errs, fmt.Errorf("%s: %s: invoke annotation is only supported on functions", fset.Position(ts.Name.Pos()), ts.Name.Name))
+					continue
+				}
+				hasValue, valueArg := ctx.annotation(d.Doc, directiveValue)
+				if found, arg := ctx.annotation(ts.Doc, directiveValue); found {
+					hasValue, valueArg = true, arg
+				}
+				if hasValue {
+					if hasProvide {
+						errs = append(errs, fmt.Errorf("%s: %s: cannot have both provide and value annotations", fset.Position(ts.Name.Pos()), ts.Name.Name))
+						continue
+					}
+					p, err := parseValueProvider(ts, ctx, valueArg)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("%s: %w", fset.Position(ts.Name.Pos()), err))
+						continue
+					}
+					p.Pos = ctx.position(ts.Name.Pos())
+					result.Providers = append(result.Providers, p)
+					continue
+				}
+				hasConfig, configArg := ctx.annotation(d.Doc, directiveConfig)
+				if found, arg := ctx.annotation(ts.Doc, directiveConfig); found {
+					hasConfig, configArg = true, arg
+				}
+				if hasConfig {
+					if hasProvide {
+						errs = append(errs, fmt.Errorf("%s: %s: cannot have both provide and config annotations", fset.Position(ts.Name.Pos()), ts.Name.Name))
+						continue
+					}
+					p, err := parseConfigProvider(ts, ctx, configArg)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("%s: %w", fset.Position(ts.Name.Pos()), err))
+						continue
+					}
+					p.Pos = ctx.position(ts.Name.Pos())
+					result.Providers = append(result.Providers, p)
+					continue
+				}
+				if !hasProvide {
+					continue
+				}
+				if ts.TypeParams != nil {
+					errs = append(errs, fmt.Errorf("%s: %s: provide annotation on generic types is not yet supported; annotate a constructor function returning a concrete instantiation instead", fset.Position(ts.Name.Pos()), ts.Name.Name))
+					continue
+				}
+				st, err := providedStruct(ts)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %s: %w", fset.Position(ts.Name.Pos()), ts.Name.Name, err))
 					continue
 				}
 				p, err := parseStructProvider(ts.Name.Name, st, ctx, provideArg)
 				if err != nil {
-					return err
+					errs = append(errs, fmt.Errorf("%s: %w", fset.Position(ts.Name.Pos()), err))
+					continue
+				}
+				p.Pos = ctx.position(ts.Name.Pos())
+				result.Providers = append(result.Providers, p)
+			}
+
+		case *ast.FuncDecl:
+			hasProvide, provideArg := ctx.annotation(d.Doc, directiveProvide)
+			hasInvoke, invokeArg := ctx.annotation(d.Doc, directiveInvoke)
+			if !hasProvide && !hasInvoke {
+				continue
+			}
+			if err := unsupportedFunc(d); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", fset.Position(d.Name.Pos()), d.Name.Name, err))
+				continue
+			}
+			if hasProvide && hasInvoke {
+				errs = append(errs, fmt.Errorf("%s: %s: cannot have both provide and invoke annotations", fset.Position(d.Name.Pos()), d.Name.Name))
+				continue
+			}
+			if hasProvide {
+				p, err := parseFuncProvider(d, ctx, provideArg)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", fset.Position(d.Name.Pos()), err))
+					continue
 				}
+				p.Pos = ctx.position(d.Name.Pos())
 				result.Providers = append(result.Providers, p)
 			}
+			if hasInvoke {
+				inv, err := parseInvocation(d, ctx, invokeArg)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", fset.Position(d.Name.Pos()), err))
+					continue
+				}
+				inv.Pos = ctx.position(d.Name.Pos())
+				result.Invocations = append(result.Invocations, inv)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func unsupportedFunc(fn *ast.FuncDecl) error {
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		recv := fn.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		var generic ast.Expr
+		switch r := recv.(type) {
+		case *ast.IndexExpr:
+			generic = r.X
+		case *ast.IndexListExpr:
+			generic = r.X
+		}
+		if ident, ok := generic.(*ast.Ident); ok {
+			return fmt.Errorf("annotations on methods of generic type %s are not yet supported; annotate a top-level constructor function instead", ident.Name)
+		}
+		return fmt.Errorf("annotations are not supported on methods; annotate a top-level function instead")
+	}
+	if fn.Type.TypeParams != nil {
+		return fmt.Errorf("annotations on generic functions are not yet supported; annotate a non-generic function that instantiates it instead")
+	}
+	return nil
+}
+
+func providedStruct(ts *ast.TypeSpec) (*ast.StructType, error) {
+	if ts.Assign.IsValid() {
+		return nil, fmt.Errorf("provide annotation is not supported on type aliases; annotate the original struct type or a constructor function returning it")
+	}
+	switch t := ts.Type.(type) {
+	case *ast.StructType:
+		return t, nil
+	case *ast.InterfaceType:
+		return nil, fmt.Errorf("provide annotation is not supported on interface types; annotate an implementation and bind it with //autowire:provide %s", ts.Name.Name)
+	default:
+		return nil, fmt.Errorf("provide annotation is only supported on struct types; annotate a constructor function returning %s instead", ts.Name.Name)
+	}
+}
+
+func resolveAlias(ts *ast.TypeSpec, ctx *fileContext) (types.Alias, bool) {
+	if !ts.Assign.IsValid() || ts.TypeParams != nil {
+		return types.Alias{}, false
+	}
+	target, err := resolveType(ts.Type, ctx)
+	if err != nil || target.IsPointer || target.IsSlice {
+		return types.Alias{}, false
+	}
+	return types.Alias{
+		Alias:  types.TypeRef{Name: ts.Name.Name, ImportPath: ctx.importPath},
+		Target: target,
+	}, true
+}
+
+type prefetcher interface {
+	Prefetch(importPaths ...string)
+}
+
+func prefetchImports(files []typedFile, resolver types.PackageNameResolver) {
+	p, ok := resolver.(prefetcher)
+	if !ok {
+		return
+	}
+	seen := make(map[string]bool)
+	var paths []string
+	for _, tf := range files {
+		if tf.info != nil {
+			continue
+		}
+		for _, imp := range tf.file.Imports {
+			path := strings.Trim(imp.Path.Value, `"`)
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	if len(paths) > 0 {
+		p.Prefetch(paths...)
+	}
+}
+
+func buildImportMap(file *ast.File, resolver types.PackageNameResolver) map[string]string {
+	imports := make(map[string]string)
+	for _, imp := range file.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		name := resolver.ResolveName(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+func parseAnnotation(doc *ast.CommentGroup, annotation string) (found bool, arg string) {
+	if doc == nil {
+		return false, ""
+	}
+	target := strings.TrimPrefix(annotation, "//")
+	for _, c := range doc.List {
+		text := strings.TrimPrefix(c.Text, "//")
+		text = strings.TrimSpace(text)
+		if text == target {
+			return true, ""
+		}
+		if !strings.HasPrefix(text, target+" ") {
+			continue
+		}
+		arg = strings.TrimSpace(strings.TrimPrefix(text, target))
+		return true, arg
+	}
+	return false, ""
+}
+
+type provideArgs struct {
+	iface      string
+	group      string
+	order      int
+	scope      types.Scope
+	embed      bool
+	name       string
+	profile    string
+	containers []string
+}
+
+var scopes = map[string]types.Scope{
+	"singleton": types.ScopeSingleton,
+	"request":   types.ScopeRequest,
+	"transient": types.ScopeTransient,
+	"weak":      types.ScopeWeak,
+	"lazy":      types.ScopeLazy,
+}
+
+func parseProvideArgs(arg string) (provideArgs, error) {
+	var args provideArgs
+	hasOrder := false
+	for _, field := range strings.Fields(arg) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			if args.iface != "" {
+				return provideArgs{}, fmt.Errorf("unexpected argument %q: interface already set to %s", field, args.iface)
+			}
+			args.iface = field
+			continue
+		}
+		switch key {
+		case "group":
+			if !token.IsIdentifier(value) {
+				return provideArgs{}, fmt.Errorf("invalid group name %q: must be a valid identifier", value)
+			}
+			args.group = value
+		case "order":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return provideArgs{}, fmt.Errorf("invalid order %q: must be an integer", value)
+			}
+			args.order = n
+			hasOrder = true
+		case "name":
+			if !token.IsIdentifier(value) {
+				return provideArgs{}, fmt.Errorf("invalid name %q: must be a valid identifier", value)
+			}
+			args.name = value
+		case "profile":
+			if !token.IsIdentifier(value) {
+				return provideArgs{}, fmt.Errorf("invalid profile %q: must be a valid identifier", value)
+			}
+			args.profile = value
+		case "container":
+			containers, err := parseContainers(value)
+			if err != nil {
+				return provideArgs{}, err
+			}
+			args.containers = containers
+		case "embed":
+			embed, err := strconv.ParseBool(value)
+			if err != nil {
+				return provideArgs{}, fmt.Errorf("invalid embed %q: must be true or false", value)
+			}
+			args.embed = embed
+		case "scope":
+			scope, ok := scopes[value]
+			if !ok {
+				return provideArgs{}, fmt.Errorf("invalid scope %q: must be singleton, request, transient, weak or lazy", value)
+			}
+			args.scope = scope
+		default:
+			return provideArgs{}, fmt.Errorf("unknown argument %q", key)
+		}
+	}
+	if hasOrder && args.group == "" {
+		return provideArgs{}, fmt.Errorf("order requires a group")
+	}
+	if args.group != "" && args.scope != types.ScopeSingleton {
+		return provideArgs{}, fmt.Errorf("group members must be singletons")
+	}
+	if args.group != "" && args.name != "" {
+		return provideArgs{}, fmt.Errorf("name cannot be combined with group")
+	}
+	return args, nil
+}
+
+type injectArgs struct {
+	name       string
+	def        string
+	hasDefault bool
+}
+
+func parseInjectArgs(arg string) (injectArgs, error) {
+	var args injectArgs
+	for _, field := range strings.Fields(arg) {
+		key, value, _ := strings.Cut(field, "=")
+		if err := args.set(key, value); err != nil {
+			if errors.Is(err, errUnknownArgument) {
+				return injectArgs{}, fmt.Errorf("unknown inject argument %q", field)
+			}
+			return injectArgs{}, err
+		}
+	}
+	if args.name == "" && !args.hasDefault {
+		return injectArgs{}, fmt.Errorf("inject requires name= or default=")
+	}
+	return args, nil
+}
+
+var errUnknownArgument = errors.New("unknown argument")
+
+func (a *injectArgs) set(key, value string) error {
+	switch key {
+	case "name":
+		if !token.IsIdentifier(value) {
+			return fmt.Errorf("invalid name %q: must be a valid identifier", value)
+		}
+		a.name = value
+	case "default":
+		a.def, a.hasDefault = value, true
+	default:
+		return errUnknownArgument
+	}
+	return nil
+}
+
+func (a injectArgs) apply(t *types.TypeRef) error {
+	t.Qualifier = a.name
+	if !a.hasDefault {
+		return nil
+	}
+	literal, err := defaultLiteral(*t, a.def)
+	if err != nil {
+		return err
+	}
+	t.Default = literal
+	return nil
+}
+
+func defaultLiteral(t types.TypeRef, value string) (string, error) {
+	_, numeric := types.BitSize(t.Name)
+	isBuiltin := t.ImportPath == "" && !t.IsPointer && !t.IsSlice && t.MapKey == nil && t.Func == nil
+	if !isBuiltin || (!numeric && t.Name != "string" && t.Name != "bool") {
+		return "", fmt.Errorf("default= is only supported on string, bool and numeric types, not %s", t.Key())
+	}
+	literal, err := types.Literal(t.Name, value)
+	if err != nil {
+		return "", fmt.Errorf("invalid default %q for %s", value, t.Name)
+	}
+	return literal, nil
+}
+
+type fieldTag struct {
+	injectArgs
+	skip   bool
+	inject bool
+}
+
+func parseFieldTag(field *ast.Field, ctx *fileContext) (fieldTag, error) {
+	args, err := ctx.injectArgs(field.Doc, field.Comment)
+	if err != nil || field.Tag == nil {
+		return fieldTag{injectArgs: args}, err
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return fieldTag{}, fmt.Errorf("invalid struct tag %s", field.Tag.Value)
+	}
+	value, ok := reflect.StructTag(tag).Lookup("autowire")
+	if !ok {
+		return fieldTag{injectArgs: args}, nil
+	}
+	if value == "-" {
+		return fieldTag{skip: true}, nil
+	}
+	ft := fieldTag{injectArgs: args}
+	for _, arg := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		key, v, hasValue := strings.Cut(arg, "=")
+		if key == "inject" && !hasValue {
+			ft.inject = true
+			continue
+		}
+		if err := ft.set(key, v); err != nil {
+			if errors.Is(err, errUnknownArgument) {
+				return fieldTag{}, fmt.Errorf("unknown autowire tag %q: use inject, name=<name>, default=<value> or -", arg)
+			}
+			return fieldTag{}, err
+		}
+	}
+	if !ft.inject && ft.name == "" && !ft.hasDefault {
+		return fieldTag{}, fmt.Errorf("empty autowire tag: use inject, name=<name>, default=<value> or -")
+	}
+	return ft, nil
+}
+
+func structDependencies(st *ast.StructType, ctx *fileContext, embed bool) ([]types.Dependency, error) {
+	if st.Fields == nil {
+		return nil, nil
+	}
+	tags := make([]fieldTag, len(st.Fields.List))
+	optIn := false
+	for i, field := range st.Fields.List {
+		ft, err := parseFieldTag(field, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", fieldLabel(field), err)
+		}
+		tags[i] = ft
+		optIn = optIn || ft.inject
+	}
+
+	var deps []types.Dependency
+	for i, field := range st.Fields.List {
+		ft := tags[i]
+		if ft.skip || optIn && !ft.inject {
+			continue
+		}
+		if len(field.Names) == 0 {
+			if !embed && !ft.inject {
+				continue
+			}
+			star, ok := field.Type.(*ast.StarExpr)
+			fieldName := fieldLabel(field)
+			if !ok || !isExported(fieldName) {
+				if ft.inject {
+					return nil, fmt.Errorf("embedded field %s: only exported embedded pointers can be injected", fieldName)
+				}
+				continue
+			}
+			t, err := resolveType(star, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("embedded field: %w", err)
+			}
+			if err := ft.apply(&t); err != nil {
+				return nil, fmt.Errorf("embedded field %s: %w", fieldName, err)
+			}
+			deps = append(deps, types.Dependency{FieldName: fieldName, Type: t})
+			continue
+		}
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				if ft.inject {
+					return nil, fmt.Errorf("field %s is unexported, so the generated code cannot set it", ident.Name)
+				}
+				continue
+			}
+			t, err := resolveType(field.Type, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", ident.Name, err)
+			}
+			if err := ft.apply(&t); err != nil {
+				return nil, fmt.Errorf("field %s: %w", ident.Name, err)
+			}
+			deps = append(deps, types.Dependency{FieldName: ident.Name, Type: t})
+		}
+	}
+	return deps, nil
+}
+
+func fieldLabel(field *ast.Field) string {
+	if len(field.Names) > 0 {
+		return field.Names[0].Name
+	}
+	if star, ok := field.Type.(*ast.StarExpr); ok {
+		return embeddedName(star.X)
+	}
+	return embeddedName(field.Type)
+}
+
+func parseDefaults(file *ast.File, ctx *fileContext) ([]types.Binding, error) {
+	var defaults []types.Binding
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			found, arg := ctx.annotation(&ast.CommentGroup{List: []*ast.Comment{c}}, directiveDefault)
+			if !found {
+				continue
+			}
+			b, err := parseDefault(arg, ctx)
+			if err != nil {
+				return nil, ctx.positioned(c.Pos(), fmt.Errorf("default %q: %w", arg, err))
+			}
+			defaults = append(defaults, b)
+		}
+	}
+	return defaults, nil
+}
+
+func parseExternals(file *ast.File, ctx *fileContext) ([]types.External, error) {
+	var externals []types.External
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			found, arg := ctx.annotation(&ast.CommentGroup{List: []*ast.Comment{c}}, directiveExternal)
+			if !found {
+				continue
+			}
+			e, err := parseExternal(arg, ctx)
+			if err != nil {
+				return nil, ctx.positioned(c.Pos(), fmt.Errorf("external %q: %w", arg, err))
+			}
+			e.Pos = ctx.position(c.Pos())
+			externals = append(externals, e)
+		}
+	}
+	return externals, nil
+}
+
+func parseExternal(arg string, ctx *fileContext) (types.External, error) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		return types.External{}, fmt.Errorf("expected format: [*]pkg.Type [name=<name>] [required]")
+	}
+	typeName, isPointer := strings.CutPrefix(fields[0], "*")
+	ref, err := resolveInterfaceFromArg(typeName, ctx)
+	if err != nil {
+		return types.External{}, err
+	}
+	ref.IsPointer = isPointer
+	e := types.External{Type: ref, VarName: toLowerCamel(ref.Name)}
+	for _, field := range fields[1:] {
+		if field == "required" {
+			e.Required = true
+			continue
+		}
+		key, value, _ := strings.Cut(field, "=")
+		if key != "name" {
+			return types.External{}, fmt.Errorf("unknown external argument %q", field)
+		}
+		if !token.IsIdentifier(value) {
+			return types.External{}, fmt.Errorf("invalid name %q: must be a valid identifier", value)
+		}
+		e.Type.Qualifier, e.VarName = value, value
+	}
+	return e, nil
+}
+
+func parseBindings(file *ast.File, ctx *fileContext) ([]types.Provider, error) {
+	var providers []types.Provider
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			found, arg := ctx.annotation(&ast.CommentGroup{List: []*ast.Comment{c}}, directiveBind)
+			if !found {
+				continue
+			}
+			p, err := parseBinding(arg, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bind %q: %w", ctx.fset.Position(c.Pos()), arg, err)
+			}
+			p.Pos = ctx.position(c.Pos())
+			providers = append(providers, p)
+		}
+	}
+	return providers, nil
+}
+
+func parseBinding(arg string, ctx *fileContext) (types.Provider, error) {
+	target, rest, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	alias, name, ok := strings.Cut(target, ".")
+	if !ok || !token.IsIdentifier(alias) || !token.IsExported(name) {
+		return types.Provider{}, fmt.Errorf("expected format: pkg.Constructor")
+	}
+	args, err := parseProvideArgs(rest)
+	if err != nil {
+		return types.Provider{}, err
+	}
+	if args.embed {
+		return types.Provider{}, fmt.Errorf("embed is only supported on struct providers")
+	}
+	if ctx.scope == nil {
+		return types.Provider{}, fmt.Errorf("binding requires type information; run autowire inside a Go module where the package builds")
+	}
+	_, obj := ctx.scope.LookupParent(alias, token.NoPos)
+	pkgName, ok := obj.(*gotypes.PkgName)
+	if !ok {
+		return types.Provider{}, fmt.Errorf("unknown package alias: %s", alias)
+	}
+	fn, ok := pkgName.Imported().Scope().Lookup(name).(*gotypes.Func)
+	if !ok {
+		return types.Provider{}, fmt.Errorf("%s is not a function in %s", name, pkgName.Imported().Path())
+	}
+	p, err := funcProvider(fn)
+	if err != nil {
+		return types.Provider{}, err
+	}
+	provided := p.ProvidedType
+
+	var concrete types.TypeRef
+	if args.iface != "" {
+		concrete = provided
+		provided, err = resolveInterfaceFromArg(args.iface, ctx)
+		if err != nil {
+			return types.Provider{}, fmt.Errorf("resolving interface %s: %w", args.iface, err)
+		}
+	}
+	varName := typeVarName(provided)
+	if args.name != "" {
+		provided.Qualifier = args.name
+		varName = args.name
+	}
+
+	p.ProvidedType, p.Concrete, p.VarName = provided, concrete, varName
+	p.Group, p.Order, p.Scope, p.Profile, p.Containers = args.group, args.order, args.scope, args.profile, args.containers
+	return p, nil
+}
+
+func parseDefault(arg string, ctx *fileContext) (types.Binding, error) {
+	iface, target, ok := strings.Cut(arg, "->")
+	iface, target = strings.TrimSpace(iface), strings.TrimSpace(target)
+	if !ok || iface == "" || target == "" {
+		return types.Binding{}, fmt.Errorf("expected format: Interface -> *pkg.Type")
+	}
+
+	ifaceRef, err := resolveInterfaceFromArg(iface, ctx)
+	if err != nil {
+		return types.Binding{}, err
+	}
+	targetName, isPointer := strings.CutPrefix(target, "*")
+	targetRef, err := resolveInterfaceFromArg(targetName, ctx)
+	if err != nil {
+		return types.Binding{}, err
+	}
+	targetRef.IsPointer = isPointer
+
+	return types.Binding{Interface: ifaceRef, Target: targetRef}, nil
+}
+
+func resolveInterfaceFromArg(arg string, ctx *fileContext) (types.TypeRef, error) {
+	parts := strings.SplitN(arg, ".", 2)
+	if len(parts) == 1 {
+		if ctx.scope != nil {
+			if _, obj := ctx.scope.LookupParent(arg, token.NoPos); obj != nil {
+				if tn, ok := obj.(*gotypes.TypeName); ok {
+					if ref, ok := typeRefOf(tn.Type()); ok {
+						return ref, nil
+					}
+				}
+			}
+		}
+		return types.TypeRef{Name: arg, ImportPath: ctx.importPath}, nil
+	}
+	pkgAlias, typeName := parts[0], parts[1]
+	importPath, ok := ctx.imports[pkgAlias]
+	if !ok {
+		return types.TypeRef{}, fmt.Errorf("unknown package alias: %s", pkgAlias)
+	}
+	return types.TypeRef{Name: typeName, ImportPath: importPath}, nil
+}
+
+func parseValueProvider(ts *ast.TypeSpec, ctx *fileContext, arg string) (types.Provider, error) {
+	name := ts.Name.Name
+	if ts.TypeParams != nil || ts.Assign.IsValid() || !isStringType(ts.Type, ctx) {
+		return types.Provider{}, fmt.Errorf("%s: value annotation requires a defined type with underlying type string", name)
+	}
+
+	var ldflag, qualifier string
+	for _, field := range strings.Fields(arg) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "ldflag":
+			pkg, variable, ok := cutLast(value, ".")
+			if !ok || pkg == "" || !token.IsIdentifier(variable) {
+				return types.Provider{}, fmt.Errorf("%s: invalid ldflag %q: must be <package>.<variable>", name, value)
+			}
+			ldflag = value
+		case "name":
+			if !token.IsIdentifier(value) {
+				return types.Provider{}, fmt.Errorf("%s: invalid name %q: must be a valid identifier", name, value)
+			}
+			qualifier = value
+		default:
+			return types.Provider{}, fmt.Errorf("%s: unknown value argument %q", name, field)
+		}
+	}
+	if ldflag == "" {
+		return types.Provider{}, fmt.Errorf("%s: value annotation requires ldflag=<package>.<variable>", name)
+	}
+
+	varName := toLowerCamel(name)
+	if qualifier != "" {
+		varName = qualifier
+	}
+	return types.Provider{
+		Name:         name,
+		Kind:         types.ProviderKindValue,
+		ProvidedType: types.TypeRef{Name: name, ImportPath: ctx.importPath, Qualifier: qualifier},
+		ImportPath:   ctx.importPath,
+		VarName:      varName,
+		Ldflag:       ldflag,
+	}, nil
+}
+
+var configKinds = map[string]bool{
+	"string": true, "bool": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+func parseConfigProvider(ts *ast.TypeSpec, ctx *fileContext, arg string) (types.Provider, error) {
+	name := ts.Name.Name
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok || ts.TypeParams != nil || ts.Assign.IsValid() {
+		return types.Provider{}, fmt.Errorf("%s: config annotation requires a non-generic struct type", name)
+	}
+
+	var prefix, qualifier string
+	for _, field := range strings.Fields(arg) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "prefix":
+			if !isEnvName(value) {
+				return types.Provider{}, fmt.Errorf("%s: invalid prefix %q: must be letters, digits and underscores, e.g. APP_", name, value)
+			}
+			prefix = value
+		case "name":
+			if !token.IsIdentifier(value) {
+				return types.Provider{}, fmt.Errorf("%s: invalid name %q: must be a valid identifier", name, value)
+			}
+			qualifier = value
+		default:
+			return types.Provider{}, fmt.Errorf("%s: unknown config argument %q", name, field)
+		}
+	}
 
-		case *ast.FuncDecl:
-			if d.Recv != nil {
+	var env []types.EnvVar
+	canError := false
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return types.Provider{}, fmt.Errorf("%s: embedded fields are not supported in config structs", name)
+		}
+		kind, ok := configKind(field.Type, ctx)
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			unquoted, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return types.Provider{}, fmt.Errorf("%s: invalid struct tag %s", name, field.Tag.Value)
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+		for _, ident := range field.Names {
+			if !ident.IsExported() || tag.Get("env") == "-" {
 				continue
 			}
-			hasProvide, provideArg := parseAnnotation(d.Doc, annotationProvide)
-			hasInvoke, _ := parseAnnotation(d.Doc, annotationInvoke)
-			if hasProvide && hasInvoke {
-				return fmt.Errorf("%s: cannot have both provide and invoke annotations", d.Name.Name)
+			if !ok {
+				return types.Provider{}, fmt.Errorf("%s.%s: unsupported config field type; use a string, bool, integer, float, time.Duration or []string", name, ident.Name)
 			}
-			if hasProvide {
-				p, err := parseFuncProvider(d, ctx, provideArg)
-				if err != nil {
-					return err
+			v := types.EnvVar{Field: ident.Name, Name: prefix + envName(ident.Name), Type: kind, Default: tag.Get("default")}
+			if explicit := tag.Get("env"); explicit != "" {
+				if !isEnvName(explicit) {
+					return types.Provider{}, fmt.Errorf("%s.%s: invalid env name %q: must be letters, digits and underscores", name, ident.Name, explicit)
 				}
-				result.Providers = append(result.Providers, p)
+				v.Name = prefix + explicit
 			}
-			if hasInvoke {
-				inv, err := parseInvocation(d, ctx)
-				if err != nil {
-					return err
+			if required := tag.Get("required"); required != "" {
+				var err error
+				if v.Required, err = strconv.ParseBool(required); err != nil {
+					return types.Provider{}, fmt.Errorf("%s.%s: invalid required %q: must be true or false", name, ident.Name, required)
 				}
-				result.Invocations = append(result.Invocations, inv)
 			}
+			if v.Required && v.Default != "" {
+				return types.Provider{}, fmt.Errorf("%s.%s: a required field cannot have a default", name, ident.Name)
+			}
+			canError = canError || v.Required || kind != "string" && kind != "[]string"
+			env = append(env, v)
 		}
 	}
 
-	return nil
+	varName := toLowerCamel(name)
+	if qualifier != "" {
+		varName = qualifier
+	}
+	return types.Provider{
+		Name:         name,
+		Kind:         types.ProviderKindConfig,
+		ProvidedType: types.TypeRef{Name: name, ImportPath: ctx.importPath, IsPointer: true, Qualifier: qualifier},
+		CanError:     canError,
+		ImportPath:   ctx.importPath,
+		VarName:      varName,
+		Env:          env,
+	}, nil
 }
 
-func buildImportMap(file *ast.File, resolver types.PackageNameResolver) map[string]string {
-	imports := make(map[string]string)
-	for _, imp := range file.Imports {
-		path := strings.Trim(imp.Path.Value, `"`)
-		name := resolver.ResolveName(path)
-		if imp.Name != nil {
-			name = imp.Name.Name
+func configKind(expr ast.Expr, ctx *fileContext) (string, bool) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name, configKinds[t.Name]
+	case *ast.SelectorExpr:
+		pkg, ok := t.X.(*ast.Ident)
+		if ok && ctx.imports[pkg.Name] == "time" && t.Sel.Name == "Duration" {
+			return "time.Duration", true
 		}
-		if name == "_" || name == "." {
-			continue
+	case *ast.ArrayType:
+		if elt, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && elt.Name == "string" {
+			return "[]string", true
 		}
-		imports[name] = path
 	}
-	return imports
+	return "", false
 }
 
-func parseAnnotation(doc *ast.CommentGroup, annotation string) (found bool, arg string) {
-	if doc == nil {
-		return false, ""
+func isEnvName(s string) bool {
+	if s == "" {
+		return false
 	}
-	target := strings.TrimPrefix(annotation, "//")
-	for _, c := range doc.List {
-		text := strings.TrimPrefix(c.Text, "//")
-		text = strings.TrimSpace(text)
-		if text == target {
-			return true, ""
+	for _, r := range s {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
 		}
-		if !strings.HasPrefix(text, target+" ") {
-			continue
+	}
+	return true
+}
+
+func envName(field string) string {
+	runes := []rune(field)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				b.WriteByte('_')
+			}
 		}
-		arg = strings.TrimSpace(strings.TrimPrefix(text, target))
-		return true, arg
+		b.WriteRune(unicode.ToUpper(r))
 	}
-	return false, ""
+	return b.String()
 }
 
-func resolveInterfaceFromArg(arg string, ctx *fileContext) (types.TypeRef, error) {
-	parts := strings.SplitN(arg, ".", 2)
-	if len(parts) == 1 {
-		return types.TypeRef{Name: arg, ImportPath: ctx.importPath}, nil
+func isStringType(expr ast.Expr, ctx *fileContext) bool {
+	if ctx.info != nil {
+		if t := ctx.info.TypeOf(expr); t != nil {
+			basic, ok := t.Underlying().(*gotypes.Basic)
+			return ok && basic.Kind() == gotypes.String
+		}
 	}
-	pkgAlias, typeName := parts[0], parts[1]
-	importPath, ok := ctx.imports[pkgAlias]
-	if !ok {
-		return types.TypeRef{}, fmt.Errorf("unknown package alias: %s", pkgAlias)
+	id, ok := expr.(*ast.Ident)
+	return ok && id.Name == "string"
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
 	}
-	return types.TypeRef{Name: typeName, ImportPath: importPath}, nil
+	return s, "", false
 }
 
-func parseStructProvider(name string, st *ast.StructType, ctx *fileContext, interfaceArg string) (types.Provider, error) {
-	var deps []types.Dependency
-	if st.Fields != nil {
-		for _, field := range st.Fields.List {
-			if len(field.Names) == 0 || !isExported(field.Names[0].Name) {
-				continue
-			}
-			t, err := resolveType(field.Type, ctx)
-			if err != nil {
-				return types.Provider{}, fmt.Errorf("field %s: %w", field.Names[0].Name, err)
-			}
-			deps = append(deps, types.Dependency{
-				FieldName: field.Names[0].Name,
-				Type:      t,
-			})
-		}
+func parseStructProvider(name string, st *ast.StructType, ctx *fileContext, arg string) (types.Provider, error) {
+	args, err := parseProvideArgs(arg)
+	if err != nil {
+		return types.Provider{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	deps, err := structDependencies(st, ctx, args.embed)
+	if err != nil {
+		return types.Provider{}, fmt.Errorf("%s: %w", name, err)
 	}
 
 	providedType := types.TypeRef{Name: name, ImportPath: ctx.importPath, IsPointer: true}
-	if interfaceArg != "" {
-		resolved, err := resolveInterfaceFromArg(interfaceArg, ctx)
+	var concrete types.TypeRef
+	if args.iface != "" {
+		resolved, err := resolveInterfaceFromArg(args.iface, ctx)
 		if err != nil {
-			return types.Provider{}, fmt.Errorf("resolving interface %s: %w", interfaceArg, err)
+			return types.Provider{}, fmt.Errorf("resolving interface %s: %w", args.iface, err)
 		}
-		providedType = resolved
+		concrete, providedType = providedType, resolved
+	}
+	varName := toLowerCamel(name)
+	if args.name != "" {
+		providedType.Qualifier = args.name
+		varName = args.name
 	}
 
 	return types.Provider{
 		Name:         name,
 		Kind:         types.ProviderKindStruct,
 		ProvidedType: providedType,
+		Concrete:     concrete,
 		Dependencies: deps,
 		ImportPath:   ctx.importPath,
-		VarName:      toLowerCamel(name),
+		VarName:      varName,
+		Group:        args.group,
+		Order:        args.order,
+		Scope:        args.scope,
+		Profile:      args.profile,
+		Containers:   args.containers,
+		Pure:         len(deps) == 0,
 	}, nil
 }
 
-func parseFuncProvider(fn *ast.FuncDecl, ctx *fileContext, interfaceArg string) (types.Provider, error) {
+func parseFuncProvider(fn *ast.FuncDecl, ctx *fileContext, arg string) (types.Provider, error) {
+	args, err := parseProvideArgs(arg)
+	if err != nil {
+		return types.Provider{}, fmt.Errorf("%s: %w", fn.Name.Name, err)
+	}
+	if args.embed {
+		return types.Provider{}, fmt.Errorf("%s: embed is only supported on struct providers", fn.Name.Name)
+	}
+
 	resultCount := 0
 	if fn.Type.Results != nil {
 		resultCount = len(fn.Type.Results.List)
@@ -312,11 +1632,26 @@ func parseFuncProvider(fn *ast.FuncDecl, ctx *fileContext, interfaceArg string)
 	if resultCount == 0 {
 		return types.Provider{}, fmt.Errorf("%s: provider must return a value", fn.Name.Name)
 	}
-	if resultCount > 2 {
-		return types.Provider{}, fmt.Errorf("%s: provider must return 1 or 2 values, got %d", fn.Name.Name, resultCount)
+	if resultCount > 3 {
+		return types.Provider{}, fmt.Errorf("%s: provider must return 1 to 3 values, got %d", fn.Name.Name, resultCount)
 	}
-	if resultCount == 2 && !isErrorType(fn.Type.Results.List[1].Type) {
-		return types.Provider{}, fmt.Errorf("%s: second return value must be error", fn.Name.Name)
+
+	var canError, hasCleanup bool
+	var errorType string
+	results := fn.Type.Results.List
+	switch resultCount {
+	case 2:
+		canError, errorType = ctx.errorResult(results[1].Type)
+		hasCleanup = isCleanupType(results[1].Type)
+		if !canError && !hasCleanup {
+			return types.Provider{}, fmt.Errorf("%s: second return value must be error or a cleanup func()", fn.Name.Name)
+		}
+	case 3:
+		canError, errorType = ctx.errorResult(results[2].Type)
+		if !isCleanupType(results[1].Type) || !canError {
+			return types.Provider{}, fmt.Errorf("%s: provider returning 3 values must return (T, func(), error)", fn.Name.Name)
+		}
+		hasCleanup = true
 	}
 
 	deps, err := parseParams(fn.Type.Params, ctx)
@@ -329,27 +1664,163 @@ func parseFuncProvider(fn *ast.FuncDecl, ctx *fileContext, interfaceArg string)
 		return types.Provider{}, fmt.Errorf("%s return type: %w", fn.Name.Name, err)
 	}
 
-	if interfaceArg != "" {
-		provided, err = resolveInterfaceFromArg(interfaceArg, ctx)
+	var concrete types.TypeRef
+	if args.iface != "" {
+		concrete = provided
+		provided, err = resolveInterfaceFromArg(args.iface, ctx)
 		if err != nil {
-			return types.Provider{}, fmt.Errorf("%s: resolving interface %s: %w", fn.Name.Name, interfaceArg, err)
+			return types.Provider{}, fmt.Errorf("%s: resolving interface %s: %w", fn.Name.Name, args.iface, err)
 		}
 	}
-
-	canError := resultCount == 2
+	varName := typeVarName(provided)
+	if args.name != "" {
+		provided.Qualifier = args.name
+		varName = args.name
+	}
 
 	return types.Provider{
 		Name:         fn.Name.Name,
 		Kind:         types.ProviderKindFunc,
 		ProvidedType: provided,
+		Concrete:     concrete,
 		Dependencies: deps,
 		CanError:     canError,
+		ErrorType:    errorType,
+		HasCleanup:   hasCleanup,
+		ImportPath:   ctx.importPath,
+		VarName:      varName,
+		Group:        args.group,
+		Order:        args.order,
+		Scope:        args.scope,
+		Profile:      args.profile,
+		Containers:   args.containers,
+		Pure:         len(deps) == 0 && !hasCleanup && isPureBody(fn.Body),
+	}, nil
+}
+
+func parseVarProviders(d *ast.GenDecl, ctx *fileContext) ([]types.Provider, error) {
+	declProvide, declArg := ctx.annotation(d.Doc, directiveProvide)
+	var providers []types.Provider
+	for _, spec := range d.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		hasProvide, provideArg := declProvide, declArg
+		if found, arg := ctx.annotation(vs.Doc, directiveProvide); found {
+			hasProvide, provideArg = true, arg
+		}
+		if !hasProvide {
+			continue
+		}
+		for i, name := range vs.Names {
+			p, err := parseVarProvider(vs, i, ctx, provideArg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", ctx.fset.Position(name.Pos()), name.Name, err)
+			}
+			p.Pos = ctx.position(name.Pos())
+			providers = append(providers, p)
+		}
+	}
+	return providers, nil
+}
+
+var embedFSInterfaces = map[string]bool{
+	"fs.FS": true, "fs.ReadDirFS": true, "fs.ReadFileFS": true,
+}
+
+func parseVarProvider(vs *ast.ValueSpec, i int, ctx *fileContext, arg string) (types.Provider, error) {
+	name := vs.Names[i].Name
+	if name == "_" {
+		return types.Provider{}, fmt.Errorf("blank identifier cannot be provided")
+	}
+	args, err := parseProvideArgs(arg)
+	if err != nil {
+		return types.Provider{}, err
+	}
+	if args.embed {
+		return types.Provider{}, fmt.Errorf("embed is only supported on struct providers")
+	}
+	if args.scope != types.ScopeSingleton {
+		return types.Provider{}, fmt.Errorf("variables and constants are always singletons")
+	}
+
+	provided, err := valueSpecType(vs, i, ctx)
+	if err != nil {
+		return types.Provider{}, err
+	}
+
+	var concrete types.TypeRef
+	if args.iface != "" {
+		concrete = provided
+		provided, err = resolveInterfaceFromArg(args.iface, ctx)
+		if err != nil && concrete.Key() == "embed.FS" && embedFSInterfaces[args.iface] {
+			provided, err = types.TypeRef{Name: strings.TrimPrefix(args.iface, "fs."), ImportPath: "io/fs"}, nil
+		}
+		if err != nil {
+			return types.Provider{}, fmt.Errorf("resolving interface %s: %w", args.iface, err)
+		}
+	}
+	varName := toLowerCamel(name)
+	if args.name != "" {
+		provided.Qualifier = args.name
+		varName = args.name
+	}
+
+	return types.Provider{
+		Name:         name,
+		Kind:         types.ProviderKindVar,
+		ProvidedType: provided,
+		Concrete:     concrete,
 		ImportPath:   ctx.importPath,
-		VarName:      toLowerCamel(provided.Name),
+		VarName:      varName,
+		Group:        args.group,
+		Order:        args.order,
+		Profile:      args.profile,
+		Containers:   args.containers,
 	}, nil
 }
 
-func parseInvocation(fn *ast.FuncDecl, ctx *fileContext) (types.Invocation, error) {
+func valueSpecType(vs *ast.ValueSpec, i int, ctx *fileContext) (types.TypeRef, error) {
+	if vs.Type != nil {
+		return resolveType(vs.Type, ctx)
+	}
+	if ctx.info != nil {
+		if obj := ctx.info.Defs[vs.Names[i]]; obj != nil {
+			if ref, ok := typeRefOf(gotypes.Default(obj.Type())); ok {
+				return ref, nil
+			}
+		}
+	}
+	if i < len(vs.Values) {
+		value := vs.Values[i]
+		pointer := false
+		if u, ok := value.(*ast.UnaryExpr); ok && u.Op == token.AND {
+			value, pointer = u.X, true
+		}
+		if lit, ok := value.(*ast.CompositeLit); ok && lit.Type != nil {
+			t, err := resolveType(lit.Type, ctx)
+			if err != nil {
+				return types.TypeRef{}, err
+			}
+			if pointer {
+				if t.IsPointer || t.IsSlice {
+					return types.TypeRef{}, fmt.Errorf("unsupported type: &%s", t.Key())
+				}
+				t.IsPointer = true
+			}
+			return t, nil
+		}
+	}
+	return types.TypeRef{}, fmt.Errorf("cannot infer the provided type; declare it explicitly, e.g. var %s T = ...", vs.Names[i].Name)
+}
+
+func parseInvocation(fn *ast.FuncDecl, ctx *fileContext, arg string) (types.Invocation, error) {
+	args, err := parseInvokeArgs(arg)
+	if err != nil {
+		return types.Invocation{}, fmt.Errorf("%s: %w", fn.Name.Name, err)
+	}
+
 	params, err := parseParams(fn.Type.Params, ctx)
 	if err != nil {
 		return types.Invocation{}, fmt.Errorf("%s: %w", fn.Name.Name, err)
@@ -359,31 +1830,120 @@ func parseInvocation(fn *ast.FuncDecl, ctx *fileContext) (types.Invocation, erro
 	for _, d := range params {
 		deps = append(deps, d.Type)
 	}
+	i := 0
+	for _, field := range fn.Type.Params.List {
+		for _, name := range field.Names {
+			if name.Name == cliArgs && deps[i].Key() == "[]string" {
+				deps[i].Qualifier = cliArgs
+			}
+			i++
+		}
+		if len(field.Names) == 0 {
+			i++
+		}
+	}
 
-	canError := false
+	var canError bool
+	var errorType string
 	if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 {
 		last := fn.Type.Results.List[len(fn.Type.Results.List)-1]
-		canError = isErrorType(last.Type)
+		canError, errorType = ctx.errorResult(last.Type)
 	}
 
 	return types.Invocation{
 		Name:         fn.Name.Name,
 		Dependencies: deps,
 		CanError:     canError,
+		ErrorType:    errorType,
 		ImportPath:   ctx.importPath,
+		Flag:         args.flag,
+		Collector:    args.collector,
+		Containers:   args.containers,
 	}, nil
 }
 
+type invokeArgs struct {
+	flag       string
+	collector  string
+	containers []string
+}
+
+func parseInvokeArgs(arg string) (invokeArgs, error) {
+	var args invokeArgs
+	for _, field := range strings.Fields(arg) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "flag":
+			if !isFlagName(value) {
+				return invokeArgs{}, fmt.Errorf("invalid flag %q: must be lowercase words separated by hyphens, e.g. serve-http", value)
+			}
+			args.flag = value
+		case "collector":
+			if !token.IsIdentifier(value) {
+				return invokeArgs{}, fmt.Errorf("invalid collector %q: must be a group name", value)
+			}
+			args.collector = value
+		case "container":
+			containers, err := parseContainers(value)
+			if err != nil {
+				return invokeArgs{}, err
+			}
+			args.containers = containers
+		default:
+			return invokeArgs{}, fmt.Errorf("unknown invoke argument %q", field)
+		}
+	}
+	return args, nil
+}
+
+func parseContainers(value string) ([]string, error) {
+	var containers []string
+	for _, name := range strings.Split(value, ",") {
+		if !token.IsIdentifier(name) {
+			return nil, fmt.Errorf("invalid container %q: must be a comma-separated list of identifiers, e.g. api,worker", value)
+		}
+		if !slices.Contains(containers, name) {
+			containers = append(containers, name)
+		}
+	}
+	return containers, nil
+}
+
+func isFlagName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, word := range strings.Split(s, "-") {
+		if word == "" || word[0] < 'a' || word[0] > 'z' {
+			return false
+		}
+		for _, r := range word {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func parseParams(params *ast.FieldList, ctx *fileContext) ([]types.Dependency, error) {
 	if params == nil {
 		return nil, nil
 	}
 	var deps []types.Dependency
+	comments := ctx.paramComments(params)
 	for _, p := range params.List {
 		t, err := resolveType(p.Type, ctx)
 		if err != nil {
 			return nil, err
 		}
+		args, err := ctx.injectArgs(comments[p]...)
+		if err != nil {
+			return nil, err
+		}
+		if err := args.apply(&t); err != nil {
+			return nil, err
+		}
 		count := len(p.Names)
 		if count == 0 {
 			count = 1
@@ -396,6 +1956,11 @@ func parseParams(params *ast.FieldList, ctx *fileContext) ([]types.Dependency, e
 }
 
 func resolveType(expr ast.Expr, ctx *fileContext) (types.TypeRef, error) {
+	if ctx.info != nil {
+		if ref, ok := typeRefOf(ctx.info.TypeOf(expr)); ok {
+			return ref, nil
+		}
+	}
 	switch t := expr.(type) {
 	case *ast.Ident:
 		if isBuiltin(t.Name) {
@@ -407,6 +1972,18 @@ func resolveType(expr ast.Expr, ctx *fileContext) (types.TypeRef, error) {
 		if err != nil {
 			return types.TypeRef{}, err
 		}
+		if inner.IsPointer {
+			return types.TypeRef{}, fmt.Errorf("pointer-to-pointer types not supported; use *%s instead", inner.Name)
+		}
+		if inner.IsSlice {
+			return types.TypeRef{}, fmt.Errorf("pointer-to-slice types not supported; use []%s instead", inner.Name)
+		}
+		if inner.MapKey != nil {
+			return types.TypeRef{}, fmt.Errorf("pointer-to-map types not supported; use %s instead", inner.Key())
+		}
+		if inner.Func != nil {
+			return types.TypeRef{}, fmt.Errorf("pointer-to-function types not supported; use %s instead", inner.Key())
+		}
 		inner.IsPointer = true
 		return inner, nil
 	case *ast.SelectorExpr:
@@ -418,19 +1995,125 @@ func resolveType(expr ast.Expr, ctx *fileContext) (types.TypeRef, error) {
 			return types.TypeRef{Name: t.Sel.Name, ImportPath: importPath}, nil
 		}
 	case *ast.ArrayType:
-		return types.TypeRef{}, fmt.Errorf("array types not supported as dependencies")
+		if t.Len != nil {
+			return types.TypeRef{}, fmt.Errorf("array types not supported as dependencies")
+		}
+		elem, err := resolveType(t.Elt, ctx)
+		if err != nil {
+			return types.TypeRef{}, err
+		}
+		if elem.IsSlice {
+			return types.TypeRef{}, fmt.Errorf("nested slice types not supported as dependencies")
+		}
+		if elem.MapKey != nil {
+			return types.TypeRef{}, fmt.Errorf("slices of maps not supported as dependencies")
+		}
+		elem.IsSlice = true
+		return elem, nil
 	case *ast.MapType:
-		return types.TypeRef{}, fmt.Errorf("map types not supported as dependencies")
+		key, err := resolveType(t.Key, ctx)
+		if err != nil {
+			return types.TypeRef{}, err
+		}
+		value, err := resolveType(t.Value, ctx)
+		if err != nil {
+			return types.TypeRef{}, err
+		}
+		return mapTypeRef(key, value)
 	case *ast.ChanType:
 		return types.TypeRef{}, fmt.Errorf("channel types not supported as dependencies")
 	case *ast.InterfaceType:
 		return types.TypeRef{}, fmt.Errorf("anonymous interface types not supported")
 	case *ast.FuncType:
-		return types.TypeRef{}, fmt.Errorf("function types not supported as dependencies")
+		return funcTypeRef(t, ctx)
 	}
 	return types.TypeRef{}, fmt.Errorf("unsupported type expression: %T", expr)
 }
 
+func funcTypeRef(t *ast.FuncType, ctx *fileContext) (types.TypeRef, error) {
+	if t.TypeParams != nil {
+		return types.TypeRef{}, fmt.Errorf("generic function types not supported")
+	}
+	var sig types.Signature
+	for _, field := range t.Params.List {
+		typ := field.Type
+		if ellipsis, ok := typ.(*ast.Ellipsis); ok {
+			typ = ellipsis.Elt
+			sig.Variadic = true
+		}
+		ref, err := resolveType(typ, ctx)
+		if err != nil {
+			return types.TypeRef{}, err
+		}
+		for range max(len(field.Names), 1) {
+			sig.Params = append(sig.Params, ref)
+		}
+	}
+	if t.Results != nil {
+		for _, field := range t.Results.List {
+			ref, err := resolveType(field.Type, ctx)
+			if err != nil {
+				return types.TypeRef{}, err
+			}
+			for range max(len(field.Names), 1) {
+				sig.Results = append(sig.Results, ref)
+			}
+		}
+	}
+	return types.TypeRef{Func: &sig}, nil
+}
+
+func mapTypeRef(key, value types.TypeRef) (types.TypeRef, error) {
+	if key.IsSlice || key.MapKey != nil || key.Func != nil {
+		return types.TypeRef{}, fmt.Errorf("invalid map key type %s", key.Key())
+	}
+	if value.MapKey != nil {
+		return types.TypeRef{}, fmt.Errorf("nested map types not supported as dependencies")
+	}
+	value.MapKey = &key
+	return value, nil
+}
+
+var pureBuiltins = map[string]bool{
+	"append": true, "cap": true, "len": true, "make": true, "new": true,
+}
+
+func isPureBody(body *ast.BlockStmt) bool {
+	if body == nil {
+		return false
+	}
+	for _, stmt := range body.List {
+		switch s := stmt.(type) {
+		case *ast.ReturnStmt, *ast.DeclStmt:
+		case *ast.AssignStmt:
+			if s.Tok != token.DEFINE {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	pure := true
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.CallExpr:
+			id, ok := e.Fun.(*ast.Ident)
+			if !ok || !pureBuiltins[id.Name] {
+				pure = false
+			}
+		case *ast.UnaryExpr:
+			if e.Op == token.ARROW {
+				pure = false
+			}
+		case *ast.FuncLit:
+			return false
+		}
+		return pure
+	})
+	return pure
+}
+
 var builtins = map[string]bool{
 	"any": true, "bool": true, "byte": true, "comparable": true,
 	"complex64": true, "complex128": true, "error": true, "float32": true,
@@ -440,8 +2123,54 @@ var builtins = map[string]bool{
 	"uint64": true, "uintptr": true,
 }
 
+func embeddedName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
 func isBuiltin(name string) bool  { return builtins[name] }
 func isErrorType(e ast.Expr) bool { id, ok := e.(*ast.Ident); return ok && id.Name == "error" }
+func isCleanupType(e ast.Expr) bool {
+	ft, ok := e.(*ast.FuncType)
+	return ok && ft.Params.NumFields() == 0 && ft.Results.NumFields() == 0
+}
+
+func (ctx *fileContext) errorResult(e ast.Expr) (bool, string) {
+	if isErrorType(e) {
+		return true, ""
+	}
+	if len(ctx.errorTypes) == 0 {
+		return false, ""
+	}
+	ref, err := resolveType(e, ctx)
+	if err != nil || !ctx.errorTypes[ref.Key()] {
+		return false, ""
+	}
+	return true, ref.Key()
+}
+
+func typeVarName(t types.TypeRef) string {
+	name := toLowerCamel(t.Name)
+	if t.Func != nil {
+		name = "fn"
+		if len(t.Func.Results) > 0 {
+			name = typeVarName(t.Func.Results[0]) + "Func"
+		}
+	}
+	switch {
+	case t.MapKey != nil:
+		return name + "Map"
+	case t.IsSlice:
+		return name + "Slice"
+	}
+	return name
+}
+
 func isExported(name string) bool { return len(name) > 0 && unicode.IsUpper(rune(name[0])) }
 func toLowerCamel(s string) string {
 	runes := []rune(s)
@@ -1,14 +1,19 @@
 package parser
 
 import (
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
 	"io/fs"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"testing/fstest"
 
+	"github.com/eloonstra/autowire/internal/diag"
 	"github.com/eloonstra/autowire/internal/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -63,12 +68,103 @@ func TestShouldSkip(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			entry := mockDirEntry{name: tt.fileName, isDir: tt.isDir}
-			got := shouldSkip(entry)
+			got := shouldSkip(tt.fileName, entry, nil)
 			assert.Equal(t, tt.expected, got)
 		})
 	}
 }
 
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		patterns []string
+		expected bool
+	}{
+		{"no patterns", "testdata", nil, false},
+		{"base name anywhere", "internal/mocks", []string{"mocks"}, true},
+		{"base name glob", "internal/db/db_mock.go", []string{"*_mock.go"}, true},
+		{"double star matches dir itself", "testdata", []string{"testdata/**"}, true},
+		{"double star matches nested", "examples/basic/main.go", []string{"examples/**"}, true},
+		{"anchored to scan root", "internal/testdata", []string{"testdata/**"}, false},
+		{"leading double star", "internal/testdata/x.go", []string{"**/testdata/**"}, true},
+		{"single segment wildcard", "cmd/tool/main.go", []string{"cmd/*/main.go"}, true},
+		{"single star is one segment", "cmd/a/b/main.go", []string{"cmd/*/main.go"}, false},
+		{"leading dot slash", "examples", []string{"./examples/"}, true},
+		{"no match", "internal/db", []string{"testdata/**", "examples/**"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Excluded(tt.path, tt.patterns))
+		})
+	}
+}
+
+func TestParseFS_Exclude(t *testing.T) {
+	provider := func(name string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("package " + name + "\n\n//autowire:provide\nfunc New" + name + "() *" + name + " { return nil }\n\ntype " + name + " struct{}\n")}
+	}
+	fsys := fstest.MapFS{
+		"app/app.go":          provider("app"),
+		"testdata/td.go":      provider("td"),
+		"examples/demo/ex.go": provider("ex"),
+		"app/mocks/mock.go":   provider("mocks"),
+	}
+
+	result, err := ParseFS(fsys, "example.com/m", nil, Options{Exclude: []string{"testdata/**", "examples/**", "mocks"}})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 1)
+	assert.Equal(t, "Newapp", result.Providers[0].Name)
+
+	_, err = ParseFS(fsys, "example.com/m", nil, Options{Exclude: []string{"[oops"}})
+	assert.ErrorContains(t, err, `invalid exclude pattern "[oops"`)
+}
+
+func TestParseFS_ErrorTypes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/app.go": &fstest.MapFile{Data: []byte(`package app
+
+import "example.com/m/apperr"
+
+type Cache struct{}
+type Pool struct{}
+
+//autowire:provide
+func NewCache() (*Cache, *apperr.Error) { return nil, nil }
+
+//autowire:provide
+func NewPool(c *Cache) (*Pool, func(), *apperr.Error) { return nil, nil, nil }
+
+//autowire:invoke
+func Warm(p *Pool) *apperr.Error { return nil }
+
+//autowire:invoke
+func Check(p *Pool) error { return nil }
+`)},
+	}
+
+	result, err := ParseFS(fsys, "example.com/m", &mockResolver{}, Options{ErrorTypes: []string{"*example.com/m/apperr.Error"}})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 2)
+	for _, p := range result.Providers {
+		assert.True(t, p.CanError, p.Name)
+		assert.Equal(t, "*example.com/m/apperr.Error", p.ErrorType, p.Name)
+	}
+	assert.True(t, result.Providers[1].HasCleanup)
+	require.Len(t, result.Invocations, 2)
+	assert.True(t, result.Invocations[0].CanError)
+	assert.Equal(t, "*example.com/m/apperr.Error", result.Invocations[0].ErrorType)
+	assert.True(t, result.Invocations[1].CanError)
+	assert.Empty(t, result.Invocations[1].ErrorType)
+
+	_, err = ParseFS(fsys, "example.com/m", &mockResolver{}, Options{})
+	assert.ErrorContains(t, err, "app/app.go:9:6: NewCache: second return value must be error or a cleanup func()")
+
+	_, err = ParseFS(fsys, "example.com/m", &mockResolver{}, Options{ErrorTypes: []string{"apperr"}})
+	assert.ErrorContains(t, err, `invalid error type "apperr": must be [*]<import path>.<Name>`)
+}
+
 func TestParseAnnotation(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -80,70 +176,70 @@ func TestParseAnnotation(t *testing.T) {
 		{
 			name:       "exact match provide",
 			comments:   []string{"//autowire:provide"},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  true,
 			wantArg:    "",
 		},
 		{
 			name:       "with space",
 			comments:   []string{"// autowire:provide"},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  true,
 			wantArg:    "",
 		},
 		{
 			name:       "with local interface arg",
 			comments:   []string{"//autowire:provide Reader"},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  true,
 			wantArg:    "Reader",
 		},
 		{
 			name:       "with package interface arg",
 			comments:   []string{"//autowire:provide io.Reader"},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  true,
 			wantArg:    "io.Reader",
 		},
 		{
 			name:       "with space before arg",
 			comments:   []string{"// autowire:provide  Reader"},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  true,
 			wantArg:    "Reader",
 		},
 		{
 			name:       "wrong annotation",
 			comments:   []string{"//autowire:invoke"},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  false,
 			wantArg:    "",
 		},
 		{
 			name:       "invoke annotation",
 			comments:   []string{"//autowire:invoke"},
-			annotation: annotationInvoke,
+			annotation: "//autowire:invoke",
 			wantFound:  true,
 			wantArg:    "",
 		},
 		{
 			name:       "multiple comments with provide",
 			comments:   []string{"// Some comment", "//autowire:provide"},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  true,
 			wantArg:    "",
 		},
 		{
 			name:       "empty comments",
 			comments:   []string{},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  false,
 			wantArg:    "",
 		},
 		{
 			name:       "unrelated comment",
 			comments:   []string{"// This is a comment"},
-			annotation: annotationProvide,
+			annotation: "//autowire:provide",
 			wantFound:  false,
 			wantArg:    "",
 		},
@@ -166,7 +262,7 @@ func TestParseAnnotation(t *testing.T) {
 	}
 
 	t.Run("nil doc", func(t *testing.T) {
-		found, arg := parseAnnotation(nil, annotationProvide)
+		found, arg := parseAnnotation(nil, "//autowire:provide")
 		assert.False(t, found)
 		assert.Empty(t, arg)
 	})
@@ -431,16 +527,69 @@ var x *bar.Foo`,
 		{
 			name: "array type error",
 			src: `package test
-var x []Foo`,
+var x [3]Foo`,
 			wantErr: true,
 			errMsg:  "array types not supported",
 		},
 		{
-			name: "map type error",
+			name: "slice",
+			src: `package test
+import "pkg/bar"
+var x []bar.Foo`,
+			expected: types.TypeRef{Name: "Foo", ImportPath: "pkg/bar", IsSlice: true},
+		},
+		{
+			name: "slice of pointers",
+			src: `package test
+var x []*Foo`,
+			expected: types.TypeRef{Name: "Foo", ImportPath: testImportPath, IsPointer: true, IsSlice: true},
+		},
+		{
+			name: "double pointer error",
+			src: `package test
+var x **Foo`,
+			wantErr: true,
+			errMsg:  "pointer-to-pointer types not supported; use *Foo instead",
+		},
+		{
+			name: "pointer to slice error",
+			src: `package test
+var x *[]Foo`,
+			wantErr: true,
+			errMsg:  "pointer-to-slice types not supported",
+		},
+		{
+			name: "nested slice error",
+			src: `package test
+var x [][]Foo`,
+			wantErr: true,
+			errMsg:  "nested slice types not supported",
+		},
+		{
+			name: "map type",
+			src: `package test
+var x map[string]*Foo`,
+			expected: types.TypeRef{Name: "Foo", ImportPath: testImportPath, IsPointer: true, MapKey: &types.TypeRef{Name: "string"}},
+		},
+		{
+			name: "map of slices keyed by a local type",
+			src: `package test
+var x map[Role][]Foo`,
+			expected: types.TypeRef{Name: "Foo", ImportPath: testImportPath, IsSlice: true, MapKey: &types.TypeRef{Name: "Role", ImportPath: testImportPath}},
+		},
+		{
+			name: "nested map type error",
+			src: `package test
+var x map[string]map[string]Foo`,
+			wantErr: true,
+			errMsg:  "nested map types not supported",
+		},
+		{
+			name: "slice of maps error",
 			src: `package test
-var x map[string]Foo`,
+var x []map[string]Foo`,
 			wantErr: true,
-			errMsg:  "map types not supported",
+			errMsg:  "slices of maps not supported",
 		},
 		{
 			name: "chan type error",
@@ -457,11 +606,45 @@ var x interface{}`,
 			errMsg:  "anonymous interface types not supported",
 		},
 		{
-			name: "func type error",
+			name: "func type",
+			src: `package test
+import "time"
+var x func() time.Time`,
+			expected: types.TypeRef{Func: &types.Signature{Results: []types.TypeRef{{Name: "Time", ImportPath: "time"}}}},
+		},
+		{
+			name: "variadic func type with named parameters",
+			src: `package test
+var x func(ctx, name string, args ...*Foo) (int, error)`,
+			expected: types.TypeRef{Func: &types.Signature{
+				Params: []types.TypeRef{
+					{Name: "string"},
+					{Name: "string"},
+					{Name: "Foo", ImportPath: testImportPath, IsPointer: true},
+				},
+				Results:  []types.TypeRef{{Name: "int"}, {Name: "error"}},
+				Variadic: true,
+			}},
+		},
+		{
+			name: "slice of func types",
+			src: `package test
+var x []func(*Foo)`,
+			expected: types.TypeRef{IsSlice: true, Func: &types.Signature{Params: []types.TypeRef{{Name: "Foo", ImportPath: testImportPath, IsPointer: true}}}},
+		},
+		{
+			name: "pointer to func type error",
 			src: `package test
-var x func()`,
+var x *func()`,
 			wantErr: true,
-			errMsg:  "function types not supported",
+			errMsg:  "pointer-to-function types not supported; use func() instead",
+		},
+		{
+			name: "func map key error",
+			src: `package test
+var x map[func()]string`,
+			wantErr: true,
+			errMsg:  "invalid map key type func()",
 		},
 		{
 			name: "unknown package alias",
@@ -593,6 +776,7 @@ func TestParseStructProvider(t *testing.T) {
 		name        string
 		src         string
 		structName  string
+		arg         string
 		expectedLen int
 		checkDeps   func(t *testing.T, deps []types.Dependency)
 	}{
@@ -643,6 +827,41 @@ type StructEmbedded struct {
 				assert.Equal(t, "Name", deps[0].FieldName)
 			},
 		},
+		{
+			name: "embedded pointer skipped by default",
+			src: `package test
+type Handler struct {
+	*BaseHandler
+}`,
+			structName:  "Handler",
+			expectedLen: 0,
+		},
+		{
+			name: "embedded pointers injected with embed",
+			src: `package test
+import "example.com/web"
+type Handler struct {
+	*BaseHandler
+	*web.Router
+	*base
+	Config
+	Name *Database
+}`,
+			structName:  "Handler",
+			arg:         "embed=true",
+			expectedLen: 3,
+			checkDeps: func(t *testing.T, deps []types.Dependency) {
+				assert.Equal(t, types.Dependency{
+					FieldName: "BaseHandler",
+					Type:      types.TypeRef{Name: "BaseHandler", ImportPath: testImportPath, IsPointer: true},
+				}, deps[0])
+				assert.Equal(t, types.Dependency{
+					FieldName: "Router",
+					Type:      types.TypeRef{Name: "Router", ImportPath: "example.com/web", IsPointer: true},
+				}, deps[1])
+				assert.Equal(t, "Name", deps[2].FieldName)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -671,7 +890,7 @@ type StructEmbedded struct {
 			}
 			require.NotNil(t, st)
 
-			provider, err := parseStructProvider(tt.structName, st, ctx, "")
+			provider, err := parseStructProvider(tt.structName, st, ctx, tt.arg)
 			assert.NoError(t, err)
 			assert.Equal(t, tt.structName, provider.Name)
 			assert.Equal(t, types.ProviderKindStruct, provider.Kind)
@@ -774,6 +993,11 @@ type FileReader struct{}`,
 			provider, err := parseStructProvider(tt.structName, st, ctx, tt.interfaceArg)
 			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedType, provider.ProvidedType)
+			if tt.interfaceArg == "" {
+				assert.Zero(t, provider.Concrete)
+			} else {
+				assert.Equal(t, types.TypeRef{Name: "FileReader", ImportPath: testImportPath, IsPointer: true}, provider.Concrete)
+			}
 		})
 	}
 }
@@ -822,6 +1046,16 @@ func NewWithError(cfg *Config) (*WithError, error) { return nil, nil }`,
 				assert.Len(t, p.Dependencies, 1)
 			},
 		},
+		{
+			name: "provider of a map",
+			src: `package test
+func NewRoutes(cfg *Config) map[string]Handler { return nil }`,
+			funcName: "NewRoutes",
+			checkResult: func(t *testing.T, p types.Provider) {
+				assert.Equal(t, "map[string]example.com/test.Handler", p.ProvidedType.Key())
+				assert.Equal(t, "handlerMap", p.VarName)
+			},
+		},
 		{
 			name: "no return error",
 			src: `package test
@@ -829,19 +1063,55 @@ func NoReturn() {}`,
 			funcName:    "NoReturn",
 			expectedErr: "must return a value",
 		},
+		{
+			name: "provider with cleanup",
+			src: `package test
+func NewFile() (*File, func()) { return nil, nil }`,
+			funcName: "NewFile",
+			checkResult: func(t *testing.T, p types.Provider) {
+				assert.True(t, p.HasCleanup)
+				assert.False(t, p.CanError)
+				assert.False(t, p.Pure)
+			},
+		},
+		{
+			name: "provider with cleanup and error",
+			src: `package test
+func NewDB(cfg *Config) (*DB, func(), error) { return nil, nil, nil }`,
+			funcName: "NewDB",
+			checkResult: func(t *testing.T, p types.Provider) {
+				assert.True(t, p.HasCleanup)
+				assert.True(t, p.CanError)
+				assert.Equal(t, "*example.com/test.DB", p.ProvidedType.Key())
+			},
+		},
 		{
 			name: "three returns error",
 			src: `package test
 func ThreeReturns() (*A, *B, error) { return nil, nil, nil }`,
 			funcName:    "ThreeReturns",
-			expectedErr: "must return 1 or 2 values",
+			expectedErr: "must return (T, func(), error)",
+		},
+		{
+			name: "four returns error",
+			src: `package test
+func FourReturns() (*A, *B, func(), error) { return nil, nil, nil, nil }`,
+			funcName:    "FourReturns",
+			expectedErr: "must return 1 to 3 values",
 		},
 		{
 			name: "wrong second return",
 			src: `package test
 func WrongSecond() (*Config, string) { return nil, "" }`,
 			funcName:    "WrongSecond",
-			expectedErr: "second return value must be error",
+			expectedErr: "second return value must be error or a cleanup func()",
+		},
+		{
+			name: "cleanup with arguments",
+			src: `package test
+func WrongCleanup() (*Config, func(context.Context)) { return nil, nil }`,
+			funcName:    "WrongCleanup",
+			expectedErr: "second return value must be error or a cleanup func()",
 		},
 	}
 
@@ -984,6 +1254,60 @@ func NewReader() *FileReader { return nil }`,
 
 			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedType, provider.ProvidedType)
+			if tt.interfaceArg == "" {
+				assert.Zero(t, provider.Concrete)
+			} else {
+				assert.Equal(t, types.TypeRef{Name: "FileReader", ImportPath: testImportPath, IsPointer: true}, provider.Concrete)
+			}
+		})
+	}
+}
+
+func TestParseProvideArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		arg      string
+		expected provideArgs
+		wantErr  bool
+		errMsg   string
+	}{
+		{name: "empty", arg: "", expected: provideArgs{}},
+		{name: "interface only", arg: "io.Reader", expected: provideArgs{iface: "io.Reader"}},
+		{name: "group", arg: "group=handlers Handler", expected: provideArgs{iface: "Handler", group: "handlers"}},
+		{name: "group with order", arg: "Handler group=handlers order=-5", expected: provideArgs{iface: "Handler", group: "handlers", order: -5}},
+		{name: "order without group", arg: "order=1", wantErr: true, errMsg: "order requires a group"},
+		{name: "invalid order", arg: "group=h order=first", wantErr: true, errMsg: "invalid order"},
+		{name: "invalid group", arg: "group=http-handlers", wantErr: true, errMsg: "invalid group name"},
+		{name: "request scope", arg: "scope=request", expected: provideArgs{scope: types.ScopeRequest}},
+		{name: "singleton scope", arg: "scope=singleton", expected: provideArgs{scope: types.ScopeSingleton}},
+		{name: "transient scope", arg: "scope=transient", expected: provideArgs{scope: types.ScopeTransient}},
+		{name: "lazy scope", arg: "scope=lazy", expected: provideArgs{scope: types.ScopeLazy}},
+		{name: "transient group member", arg: "group=h scope=transient", wantErr: true, errMsg: "group members must be singletons"},
+		{name: "invalid scope", arg: "scope=session", wantErr: true, errMsg: "invalid scope"},
+		{name: "request scoped group member", arg: "group=h scope=request", wantErr: true, errMsg: "group members must be singletons"},
+		{name: "embed", arg: "embed=true", expected: provideArgs{embed: true}},
+		{name: "name", arg: "name=primaryDB", expected: provideArgs{name: "primaryDB"}},
+		{name: "invalid name", arg: "name=primary-db", wantErr: true, errMsg: "invalid name"},
+		{name: "name in group", arg: "name=a group=h", wantErr: true, errMsg: "name cannot be combined with group"},
+		{name: "invalid embed", arg: "embed=yes", wantErr: true, errMsg: "invalid embed"},
+		{name: "profile", arg: "Store profile=integration", expected: provideArgs{iface: "Store", profile: "integration"}},
+		{name: "invalid profile", arg: "profile=e2e-tests", wantErr: true, errMsg: "invalid profile"},
+		{name: "container", arg: "container=worker", expected: provideArgs{containers: []string{"worker"}}},
+		{name: "containers", arg: "container=api,worker,api", expected: provideArgs{containers: []string{"api", "worker"}}},
+		{name: "invalid container", arg: "container=api,", wantErr: true, errMsg: "invalid container"},
+		{name: "unknown key", arg: "color=blue", wantErr: true, errMsg: "unknown argument"},
+		{name: "two interfaces", arg: "Reader Writer", wantErr: true, errMsg: "interface already set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProvideArgs(tt.arg)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
 		})
 	}
 }
@@ -1106,6 +1430,17 @@ func SetupWithDeps(cfg *Config, db *Database) {}`,
 				assert.Len(t, inv.Dependencies, 2)
 			},
 		},
+		{
+			name: "invocation with command-line arguments",
+			src: `package test
+func Run(db *Database, args []string, names []string) error { return nil }`,
+			funcName: "Run",
+			checkResult: func(t *testing.T, inv types.Invocation) {
+				require.Len(t, inv.Dependencies, 3)
+				assert.Equal(t, "[]string@args", inv.Dependencies[1].Key())
+				assert.Equal(t, "[]string", inv.Dependencies[2].Key(), "only a parameter named args is filled from the command line")
+			},
+		},
 		{
 			name: "invocation returning non-error",
 			src: `package test
@@ -1137,7 +1472,7 @@ func SetupReturnsValue() int { return 0 }`,
 			}
 			require.NotNil(t, fn)
 
-			inv, err := parseInvocation(fn, ctx)
+			inv, err := parseInvocation(fn, ctx, "")
 			assert.NoError(t, err)
 
 			if tt.checkResult != nil {
@@ -1165,56 +1500,1562 @@ type Config struct{}
 	tmpFile.Close()
 
 	result := &types.ParseResult{}
-	err = parseFile(tmpFile.Name(), "example.com/test", &mockResolver{}, result)
+	err = parseFile(tmpFile.Name(), "example.com/test", &mockResolver{}, nil, result)
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "cannot have both provide and invoke")
 }
 
-func TestIsErrorType(t *testing.T) {
+func TestParseFile_TypeAnnotations(t *testing.T) {
 	tests := []struct {
-		name     string
-		src      string
-		expected bool
+		name    string
+		src     string
+		wantErr string
+		want    []string
 	}{
 		{
-			name:     "error type",
-			src:      `package test; var x error`,
-			expected: true,
+			name: "interface",
+			src: `package test
+//autowire:provide
+type Store interface{ Get() string }`,
+			wantErr: "Store: provide annotation is not supported on interface types",
 		},
 		{
-			name:     "string type",
-			src:      `package test; var x string`,
-			expected: false,
+			name: "alias",
+			src: `package test
+//autowire:provide
+type Config = other`,
+			wantErr: "Config: provide annotation is not supported on type aliases",
 		},
 		{
-			name:     "custom type",
-			src:      `package test; var x MyError`,
-			expected: false,
+			name: "named non-struct",
+			src: `package test
+//autowire:provide
+type Port int`,
+			wantErr: "Port: provide annotation is only supported on struct types",
+		},
+		{
+			name: "invoke on type",
+			src: `package test
+//autowire:invoke
+type Server struct{}`,
+			wantErr: "Server: invoke annotation is only supported on functions",
+		},
+		{
+			name: "double pointer return",
+			src: `package test
+//autowire:provide
+func NewServer() **Server { return nil }`,
+			wantErr: "NewServer return type: pointer-to-pointer types not supported",
+		},
+		{
+			name: "embed on function",
+			src: `package test
+//autowire:provide embed=true
+func NewServer() *Server { return nil }`,
+			wantErr: "NewServer: embed is only supported on struct providers",
+		},
+		{
+			name: "generic struct",
+			src: `package test
+//autowire:provide
+type Cache[T any] struct{}`,
+			wantErr: "test.go:3:6: Cache: provide annotation on generic types is not yet supported",
+		},
+		{
+			name: "generic function",
+			src: `package test
+//autowire:provide
+func NewCache[T any]() *Cache[T] { return nil }`,
+			wantErr: "test.go:3:6: NewCache: annotations on generic functions are not yet supported",
+		},
+		{
+			name: "method of generic type",
+			src: `package test
+type Cache[K comparable, V any] struct{}
+//autowire:invoke
+func (c *Cache[K, V]) Warm() {}`,
+			wantErr: "test.go:4:23: Warm: annotations on methods of generic type Cache are not yet supported",
+		},
+		{
+			name: "method",
+			src: `package test
+type Server struct{}
+//autowire:provide
+func (s Server) Handler() *Handler { return nil }`,
+			wantErr: "test.go:4:17: Handler: annotations are not supported on methods",
+		},
+		{
+			name: "unannotated methods of generic types are ignored",
+			src: `package test
+type Cache[T any] struct{}
+func (c *Cache[T]) Get() T { var zero T; return zero }
+//autowire:provide
+type Server struct{}`,
+			want: []string{"Server"},
+		},
+		{
+			name: "grouped declaration with spec annotation",
+			src: `package test
+type (
+	//autowire:provide
+	Server struct{}
+
+	Other struct{}
+)`,
+			want: []string{"Server"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			fset := token.NewFileSet()
-			file, err := parser.ParseFile(fset, "", tt.src, 0)
-			require.NoError(t, err)
+			path := filepath.Join(t.TempDir(), "test.go")
+			require.NoError(t, os.WriteFile(path, []byte(tt.src), 0644))
 
-			var varType ast.Expr
-			for _, decl := range file.Decls {
-				if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.VAR {
-					for _, spec := range genDecl.Specs {
-						if valueSpec, ok := spec.(*ast.ValueSpec); ok {
-							varType = valueSpec.Type
-							break
-						}
-					}
-				}
+			result := &types.ParseResult{}
+			err := parseFile(path, "example.com/test", &mockResolver{}, nil, result)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
 			}
-			require.NotNil(t, varType)
 
-			got := isErrorType(varType)
-			assert.Equal(t, tt.expected, got)
+			require.NoError(t, err)
+			var names []string
+			for _, p := range result.Providers {
+				names = append(names, p.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestParseFile_RecordsInterfaces(t *testing.T) {
+	src := `package test
+
+type Store interface{ Get() string }
+
+type StoreAlias = Store
+
+type Server struct{}
+`
+	path := filepath.Join(t.TempDir(), "test.go")
+	require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+	result := &types.ParseResult{}
+	require.NoError(t, parseFile(path, "example.com/test", &mockResolver{}, nil, result))
+	assert.Equal(t, []types.TypeRef{{Name: "Store", ImportPath: "example.com/test"}}, result.Interfaces)
+}
+
+func TestParseFile_RecordsAliases(t *testing.T) {
+	src := `package test
+
+import "go.uber.org/zap"
+
+type Logger = zap.Logger
+
+type LoggerPtr = *zap.Logger
+
+type Named zap.Logger
+`
+	path := filepath.Join(t.TempDir(), "test.go")
+	require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+	result := &types.ParseResult{}
+	require.NoError(t, parseFile(path, "example.com/test", &mockResolver{}, nil, result))
+	assert.Equal(t, []types.Alias{{
+		Alias:  types.TypeRef{Name: "Logger", ImportPath: "example.com/test"},
+		Target: types.TypeRef{Name: "Logger", ImportPath: "go.uber.org/zap"},
+	}}, result.Aliases)
+}
+
+func TestIsPureBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected bool
+	}{
+		{"composite literal", `return &Config{Port: 8080}`, true},
+		{"local vars and builtins", `items := make([]string, 0, 4); var n = len(items); return &Config{Items: items, N: n}`, true},
+		{"function call", `return &Config{Port: env.Port()}`, false},
+		{"method call", `c := &Config{}; c.Load(); return c`, false},
+		{"assignment to global", `counter = 1; return &Config{}`, false},
+		{"control flow", `if debug { return nil }; return &Config{}`, false},
+		{"goroutine", `go run(); return &Config{}`, false},
+		{"channel receive", `v := <-ch; return &Config{V: v}`, false},
+		{"closure body ignored", `f := func() { panic("x") }; return &Config{F: f}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "package test\nfunc NewConfig() *Config { " + tt.body + " }"
+			file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+			require.NoError(t, err)
+
+			fn := file.Decls[0].(*ast.FuncDecl)
+			assert.Equal(t, tt.expected, isPureBody(fn.Body))
 		})
 	}
 }
+
+func TestParseDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []types.Binding
+		errMsg   string
+	}{
+		{
+			name: "imported interface and pointer target",
+			src: `package wiring
+
+import (
+	"example.com/app/postgres"
+	"example.com/app/store"
+)
+
+//autowire:default store.Store -> *postgres.Store
+//autowire:default Cache -> *postgres.Cache
+`,
+			expected: []types.Binding{
+				{
+					Interface: types.TypeRef{Name: "Store", ImportPath: "example.com/app/store"},
+					Target:    types.TypeRef{Name: "Store", ImportPath: "example.com/app/postgres", IsPointer: true},
+				},
+				{
+					Interface: types.TypeRef{Name: "Cache", ImportPath: "example.com/test"},
+					Target:    types.TypeRef{Name: "Cache", ImportPath: "example.com/app/postgres", IsPointer: true},
+				},
+			},
+		},
+		{
+			name: "missing arrow",
+			src: `package wiring
+//autowire:default Store
+`,
+			errMsg: "expected format: Interface -> *pkg.Type",
+		},
+		{
+			name: "unknown package",
+			src: `package wiring
+//autowire:default Store -> *postgres.Store
+`,
+			errMsg: "unknown package alias: postgres",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parser.ParseFile(token.NewFileSet(), "", tt.src, parser.ParseComments)
+			require.NoError(t, err)
+
+			ctx := &fileContext{
+				importPath: "example.com/test",
+				imports:    buildImportMap(file, &mockResolver{}),
+			}
+			got, err := parseDefaults(file, ctx)
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestParseExternals(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []types.External
+		errMsg   string
+	}{
+		{
+			name: "imported pointer and local named",
+			src: `package wiring
+
+import "example.com/app/log"
+
+//autowire:external *log.Logger required
+//autowire:external Region name=region
+`,
+			expected: []types.External{
+				{Type: types.TypeRef{Name: "Logger", ImportPath: "example.com/app/log", IsPointer: true}, VarName: "logger", Required: true, Pos: types.Position{Line: 5}},
+				{Type: types.TypeRef{Name: "Region", ImportPath: "example.com/test", Qualifier: "region"}, VarName: "region", Pos: types.Position{Line: 6}},
+			},
+		},
+		{
+			name: "missing type",
+			src: `package wiring
+//autowire:external
+`,
+			errMsg: "expected format: [*]pkg.Type [name=<name>] [required]",
+		},
+		{
+			name: "unknown argument",
+			src: `package wiring
+//autowire:external Region scope=request
+`,
+			errMsg: `unknown external argument "scope=request"`,
+		},
+		{
+			name: "unknown package",
+			src: `package wiring
+//autowire:external *log.Logger
+`,
+			errMsg: "unknown package alias: log",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "", tt.src, parser.ParseComments)
+			require.NoError(t, err)
+
+			ctx := &fileContext{
+				importPath: "example.com/test",
+				imports:    buildImportMap(file, &mockResolver{}),
+				fset:       fset,
+			}
+			got, err := parseExternals(file, ctx)
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestIsErrorType(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected bool
+	}{
+		{
+			name:     "error type",
+			src:      `package test; var x error`,
+			expected: true,
+		},
+		{
+			name:     "string type",
+			src:      `package test; var x string`,
+			expected: false,
+		},
+		{
+			name:     "custom type",
+			src:      `package test; var x MyError`,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "", tt.src, 0)
+			require.NoError(t, err)
+
+			var varType ast.Expr
+			for _, decl := range file.Decls {
+				if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.VAR {
+					for _, spec := range genDecl.Specs {
+						if valueSpec, ok := spec.(*ast.ValueSpec); ok {
+							varType = valueSpec.Type
+							break
+						}
+					}
+				}
+			}
+			require.NotNil(t, varType)
+
+			got := isErrorType(varType)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestParse_Progress(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":        "module example.com/progress\n\ngo 1.22\n",
+		"a/a.go":        "package a\n\n//autowire:provide\ntype A struct{}\n",
+		"b/b.go":        "package b\n\n//autowire:provide\ntype B struct{}\n",
+		"b/b_extra.go":  "package b\n",
+		"b/b_test.go":   "package b\n",
+		".hidden/h.go":  "package hidden\n",
+		"c/readme.txt":  "not go",
+		"c/nested/c.go": "package nested\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	var calls [][2]int
+	result, err := Parse(dir, &mockResolver{}, Options{Progress: func(done, total int) {
+		calls = append(calls, [2]int{done, total})
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, [][2]int{{1, 3}, {2, 3}, {3, 3}}, calls)
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, "example.com/progress/a", result.Providers[0].ImportPath)
+	assert.Equal(t, "example.com/progress/b", result.Providers[1].ImportPath)
+}
+
+func TestParse_TypesUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/broken\n\nnot a directive\n",
+		"app/app.go": `package app
+
+//autowire:provide
+type Service struct{}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := Parse(dir, &mockResolver{}, Options{Modules: ModuleCache{dir: "example.com/broken"}})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 1)
+	require.Len(t, result.Diagnostics, 1)
+	d := result.Diagnostics[0]
+	assert.Equal(t, diag.SeverityInfo, d.Severity)
+	assert.Equal(t, "types-unavailable", d.Code)
+	assert.Contains(t, d.Message, "loading types of ./app failed")
+	assert.Contains(t, d.Message, "resolving its annotations from syntax only")
+}
+
+func TestParseDirs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                 "module example.com/batch\n\ngo 1.22\n",
+		"models/m.go":            "package models\n\ntype A struct{}\n\ntype Store = A\n",
+		"svc/svc.go":             "package svc\n\nimport \"example.com/batch/models\"\n\ntype S struct{}\n\n//autowire:provide\nfunc NewS(*models.Store) *S { return nil }\n",
+		"svc/mock.go":            "package svc\n\n//autowire:provide\nfunc NewMock() *S { return nil }\n",
+		"svc/nested/n.go":        "package nested\n\n//autowire:provide\ntype N struct{}\n",
+		"api/api.go":             "package api\n\n//autowire:provide\ntype API struct{}\n",
+		"unscanned/unscanned.go": "package unscanned\n\n//autowire:provide\ntype U struct{}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := ParseDirs(dir, []string{"svc", "api"}, &mockResolver{}, Options{Modules: ModuleCache{dir: "example.com/batch"}, Exclude: []string{"mock.go"}})
+	require.NoError(t, err)
+	require.Empty(t, result.Diagnostics)
+
+	var ids []string
+	for _, p := range result.Providers {
+		ids = append(ids, p.ID())
+	}
+	assert.Equal(t, []string{"example.com/batch/svc.NewS", "example.com/batch/api.API"}, ids, "directories are scanned shallowly")
+	assert.Equal(t, types.TypeRef{Name: "A", ImportPath: "example.com/batch/models", IsPointer: true}, result.Providers[0].Dependencies[0].Type)
+
+	_, err = ParseDirs(dir, []string{"../outside"}, &mockResolver{}, Options{Modules: ModuleCache{dir: "example.com/batch"}})
+	assert.ErrorContains(t, err, "../outside is not a directory inside")
+}
+
+func TestParse_TypeInformation(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/typed\n\ngo 1.22\n",
+		"log/log.go": `package log
+
+type Logger struct{}
+
+type Sink interface{ Write(p []byte) (int, error) }
+`,
+		"app/types.go": `package app
+
+import "example.com/typed/log"
+
+type Config struct{}
+
+type Log = log.Logger
+`,
+		"app/app.go": `package app
+
+import . "example.com/typed/log"
+
+//autowire:provide Sink
+type FileSink struct{}
+
+func (f *FileSink) Write(p []byte) (int, error) { return len(p), nil }
+
+//autowire:provide embed=true
+type Service struct {
+	*Log
+	Logger *Logger
+	Config *Config
+}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := Parse(dir, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 2)
+
+	logger := types.TypeRef{Name: "Logger", ImportPath: "example.com/typed/log", IsPointer: true}
+	assert.Equal(t, types.TypeRef{Name: "Sink", ImportPath: "example.com/typed/log"}, result.Providers[0].ProvidedType)
+	assert.Equal(t, []types.Dependency{
+		{FieldName: "Log", Type: logger},
+		{FieldName: "Logger", Type: logger},
+		{FieldName: "Config", Type: types.TypeRef{Name: "Config", ImportPath: "example.com/typed/app", IsPointer: true}},
+	}, result.Providers[1].Dependencies)
+}
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go":           {Data: []byte("package root\n\n//autowire:provide\ntype A struct{}\n")},
+		"api/b.go":       {Data: []byte("package handlers\n\n//autowire:provide\ntype B struct{}\n")},
+		"api/b_test.go":  {Data: []byte("package handlers\n\n//autowire:provide\ntype T struct{}\n")},
+		"_skip/c.go":     {Data: []byte("package skip\n\n//autowire:provide\ntype C struct{}\n")},
+		"api/readme.txt": {Data: []byte("not go")},
+	}
+
+	result, err := ParseFS(fsys, "example.com/virtual", &mockResolver{}, Options{})
+	require.NoError(t, err)
+
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, "example.com/virtual", result.Providers[0].ImportPath)
+	assert.Equal(t, "example.com/virtual/api", result.Providers[1].ImportPath)
+	assert.Equal(t, map[string]string{
+		"example.com/virtual":     "root",
+		"example.com/virtual/api": "handlers",
+	}, result.PackageNames)
+}
+
+type prefetchingResolver struct {
+	mockResolver
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *prefetchingResolver) Prefetch(importPaths ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, path := range importPaths {
+		r.calls = append(r.calls, "prefetch "+path)
+	}
+}
+
+func (r *prefetchingResolver) ResolveName(importPath string) string {
+	r.mu.Lock()
+	r.calls = append(r.calls, "resolve "+importPath)
+	r.mu.Unlock()
+	return r.mockResolver.ResolveName(importPath)
+}
+
+func TestParseFS_PrefetchesImportsBeforeResolving(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a.go": {Data: []byte("package a\n\nimport \"net/http\"\n\n//autowire:provide\nfunc NewA(c *http.Client) *A { return nil }\n\ntype A struct{}\n")},
+		"b/b.go": {Data: []byte("package b\n\nimport (\n\t\"database/sql\"\n\tj \"encoding/json\"\n)\n\nvar _ j.Number\n\n//autowire:provide\nfunc NewB(db *sql.DB) *B { return nil }\n\ntype B struct{}\n")},
+	}
+
+	r := &prefetchingResolver{}
+	_, err := ParseFS(fsys, "example.com/app", r, Options{})
+	require.NoError(t, err)
+
+	require.Len(t, r.calls, 6)
+	assert.ElementsMatch(t, []string{"prefetch net/http", "prefetch database/sql", "prefetch encoding/json"}, r.calls[:3])
+	assert.ElementsMatch(t, []string{"resolve net/http", "resolve database/sql", "resolve encoding/json"}, r.calls[3:])
+}
+
+func TestParseFS_Workers(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := range 20 {
+		src := fmt.Sprintf("package p%d\n\n//autowire:provide\ntype S%d struct{}\n\n//autowire:provide\nfunc NewT%d() *T%d { return nil }\n\ntype T%d struct{}\n", i, i, i, i, i)
+		fsys[fmt.Sprintf("p%02d/p.go", i)] = &fstest.MapFile{Data: []byte(src)}
+	}
+
+	expected, err := ParseFS(fsys, "example.com/app", &mockResolver{}, Options{Workers: 1})
+	require.NoError(t, err)
+	require.Len(t, expected.Providers, 40)
+
+	for range 5 {
+		var calls []int
+		result, err := ParseFS(fsys, "example.com/app", &mockResolver{}, Options{
+			Workers:  8,
+			Progress: func(done, total int) { calls = append(calls, done) },
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, result)
+		assert.Len(t, calls, 20)
+		assert.IsIncreasing(t, calls)
+
+		shuffled, err := ParseFS(fsys, "example.com/app", &mockResolver{}, Options{Workers: 8, Shuffle: rand.Shuffle})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expected.Providers, shuffled.Providers)
+	}
+}
+
+func TestParseFS_ShuffleMergeOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a1.go": {Data: []byte("package a\n\n//autowire:provide\ntype A1 struct{}\n")},
+		"a/a2.go": {Data: []byte("package a\n\n//autowire:provide\ntype A2 struct{}\n")},
+		"b/b.go":  {Data: []byte("package b\n\n//autowire:provide\ntype B struct{}\n")},
+	}
+	reverse := func(n int, swap func(i, j int)) {
+		for i := 0; i < n/2; i++ {
+			swap(i, n-1-i)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		shuffle func(n int, swap func(i, j int))
+		want    []string
+	}{
+		{"declaration order", nil, []string{"A1", "A2", "B"}},
+		{"reversed packages and files", reverse, []string{"B", "A2", "A1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseFS(fsys, "example.com/app", &mockResolver{}, Options{Shuffle: tt.shuffle})
+			require.NoError(t, err)
+			var names []string
+			for _, p := range result.Providers {
+				names = append(names, p.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestParseFS_WorkersCollectErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a.go": {Data: []byte("package a\n\n//autowire:provide\ntype A struct{}\n")},
+		"b/b.go": {Data: []byte("package b\n\n//autowire:invoke\ntype B struct{}\n")},
+		"c/c.go": {Data: []byte("package c\n\n//autowire:invoke\ntype C struct{}\n")},
+	}
+
+	for range 5 {
+		_, err := ParseFS(fsys, "example.com/app", &mockResolver{}, Options{Workers: 4})
+		assert.EqualError(t, err, "b/b.go:4:6: B: invoke annotation is only supported on functions\nc/c.go:4:6: C: invoke annotation is only supported on functions")
+	}
+}
+
+func TestParseFS_CollectErrorsInFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a.go": {Data: []byte("package a\n\n//autowire:invoke\ntype B struct{}\n\n//autowire:provide\ntype A struct{}\n\n//autowire:invoke\ntype C struct{}\n")},
+	}
+
+	_, err := ParseFS(fsys, "example.com/app", &mockResolver{}, Options{})
+	require.Error(t, err)
+	assert.Equal(t, 2, diag.Count(err))
+	assert.EqualError(t, err, "a/a.go:4:6: B: invoke annotation is only supported on functions\na/a.go:10:6: C: invoke annotation is only supported on functions")
+}
+
+func TestParseFS_SyntaxErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"store/store.go": {Data: []byte("package store\n\n//autowire:provide\ntype Store struct{}\n")},
+		"store/wip.go":   {Data: []byte("package store\n\nfunc broken(\n\nfunc alsoBroken( {\n")},
+		"api/api.go":     {Data: []byte("package api\n\n//autowire:provide\ntype API struct{}\n")},
+	}
+
+	result, err := ParseFS(fsys, "example.com/app", &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 2)
+	require.Len(t, result.Diagnostics, 1)
+	assert.Equal(t, "store/wip.go", result.Diagnostics[0].File)
+	assert.Equal(t, 5, result.Diagnostics[0].Line)
+	assert.Equal(t, diag.SeverityWarning, result.Diagnostics[0].Severity)
+	assert.Equal(t, "skipping wip.go: expected '(', found alsoBroken", result.Diagnostics[0].Message)
+}
+
+func TestParse_SyntaxErrorsWithTypes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":         "module example.com/app\n\ngo 1.22\n",
+		"store/store.go": "package store\n\n//autowire:provide\ntype Store struct{}\n",
+		"store/wip.go":   "package store\n\nfunc broken(\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := Parse(dir, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 1)
+	require.Len(t, result.Diagnostics, 1)
+	assert.Equal(t, filepath.Join(dir, "store", "wip.go"), result.Diagnostics[0].File)
+	assert.Equal(t, "syntax-error", result.Diagnostics[0].Code)
+}
+
+func TestOutputPackage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app_gen.go":   {Data: []byte("package stale\n")},
+		"main_test.go": {Data: []byte("package main_test\n")},
+		"main.go":      {Data: []byte("package main\n")},
+	}
+
+	assert.Equal(t, "main", OutputPackage(fsys, "cmd"))
+	assert.Equal(t, "cmd", OutputPackage(fstest.MapFS{}, "cmd"))
+}
+
+func TestGetOutputInfo(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/app\n"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "cmd"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "cmd", "main.go"), []byte("package main\n"), 0644))
+
+	tests := []struct {
+		name        string
+		dir         string
+		pkg         string
+		expectedPkg string
+		expectedImp string
+		expectedErr string
+	}{
+		{"existing package", filepath.Join(root, "cmd"), "", "main", "example.com/app/cmd", ""},
+		{"matching package", filepath.Join(root, "cmd"), "main", "main", "example.com/app/cmd", ""},
+		{"conflicting package", filepath.Join(root, "cmd"), "app", "", "", "already contains package main, not app"},
+		{"new directory", filepath.Join(root, "internal", "wire-up"), "", "wireup", "example.com/app/internal/wire-up", ""},
+		{"new directory with package", filepath.Join(root, "gen"), "wiring", "wiring", "example.com/app/gen", ""},
+		{"keyword directory", filepath.Join(root, "go"), "", "gopkg", "example.com/app/go", ""},
+		{"invalid package", filepath.Join(root, "gen"), "wire-up", "", "", `"wire-up" is not a valid package name`},
+		{"outside module", filepath.Join(t.TempDir(), "gen"), "", "", "", "is not inside a Go module"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg, importPath, err := GetOutputInfo(tt.dir, tt.pkg, ModuleCache{root: "example.com/app"})
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedPkg, pkg)
+			assert.Equal(t, tt.expectedImp, importPath)
+		})
+	}
+	assert.NoDirExists(t, filepath.Join(root, "gen"))
+}
+
+func TestParseFile_Prefixes(t *testing.T) {
+	src := `package test
+//di:provide
+type Config struct{}
+//autowire:provide
+type Server struct{}
+//di:invoke
+func Run(s *Server) {}`
+
+	tests := []struct {
+		name            string
+		prefixes        []string
+		wantProviders   []string
+		wantInvocations int
+	}{
+		{name: "default", wantProviders: []string{"Server"}},
+		{name: "alternate only", prefixes: []string{"di"}, wantProviders: []string{"Config"}, wantInvocations: 1},
+		{name: "migration", prefixes: []string{"autowire", "di"}, wantProviders: []string{"Config", "Server"}, wantInvocations: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.go")
+			require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+			result := &types.ParseResult{}
+			require.NoError(t, parseFile(path, "example.com/test", &mockResolver{}, tt.prefixes, result))
+			var names []string
+			for _, p := range result.Providers {
+				names = append(names, p.Name)
+			}
+			assert.Equal(t, tt.wantProviders, names)
+			assert.Len(t, result.Invocations, tt.wantInvocations)
+		})
+	}
+}
+
+func TestParse_InvalidPrefix(t *testing.T) {
+	_, err := Parse(t.TempDir(), &mockResolver{}, Options{Prefixes: []string{"di:"}})
+	assert.ErrorContains(t, err, `invalid directive prefix "di:"`)
+}
+
+func TestParseInjectArgs(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    injectArgs
+		wantErr string
+	}{
+		{arg: "name=primaryDB", want: injectArgs{name: "primaryDB"}},
+		{arg: "default=8080", want: injectArgs{def: "8080", hasDefault: true}},
+		{arg: "name=port default=", want: injectArgs{name: "port", hasDefault: true}},
+		{arg: "", wantErr: "inject requires name= or default="},
+		{arg: "name=primary-db", wantErr: "invalid name"},
+		{arg: "optional", wantErr: "unknown inject argument"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseInjectArgs(tt.arg)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseInvokeArgs(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    invokeArgs
+		wantErr string
+	}{
+		{arg: "", want: invokeArgs{}},
+		{arg: "flag=serve-http", want: invokeArgs{flag: "serve-http"}},
+		{arg: "flag=grpc2", want: invokeArgs{flag: "grpc2"}},
+		{arg: "flag=Serve", wantErr: "invalid flag"},
+		{arg: "flag=serve--http", wantErr: "invalid flag"},
+		{arg: "flag=", wantErr: "invalid flag"},
+		{arg: "collector=handlers", want: invokeArgs{collector: "handlers"}},
+		{arg: "collector=handlers flag=serve-http", want: invokeArgs{flag: "serve-http", collector: "handlers"}},
+		{arg: "collector=", wantErr: "invalid collector"},
+		{arg: "collector=my-handlers", wantErr: "invalid collector"},
+		{arg: "container=api,cli", want: invokeArgs{containers: []string{"api", "cli"}}},
+		{arg: "container=", wantErr: "invalid container"},
+		{arg: "order=1", wantErr: "unknown invoke argument"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseInvokeArgs(tt.arg)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseFile_Positions(t *testing.T) {
+	src := `package test
+
+//autowire:provide
+type Config struct{}
+
+//autowire:provide
+func NewServer(c *Config) *Server { return nil }
+
+//autowire:invoke
+func Run(s *Server) {}
+`
+	path := filepath.Join(t.TempDir(), "test.go")
+	require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+	result := &types.ParseResult{}
+	require.NoError(t, parseFile(path, "example.com/test", &mockResolver{}, nil, result))
+
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, types.Position{File: path, Line: 4}, result.Providers[0].Pos)
+	assert.Equal(t, types.Position{File: path, Line: 7}, result.Providers[1].Pos)
+	require.Len(t, result.Invocations, 1)
+	assert.Equal(t, types.Position{File: path, Line: 10}, result.Invocations[0].Pos)
+}
+
+func TestParseFile_NamedProviders(t *testing.T) {
+	src := `package test
+
+type DB struct{}
+
+//autowire:provide name=primaryDB
+func NewPrimary() *DB { return nil }
+
+//autowire:provide name=replicaDB
+func NewReplica() *DB { return nil }
+
+//autowire:provide
+func NewRepo(
+	//autowire:inject name=primaryDB
+	primary *DB,
+	replica *DB, //autowire:inject name=replicaDB
+	fallback *DB,
+) *Repo { return nil }
+
+//autowire:provide
+type Service struct {
+	//autowire:inject name=primaryDB
+	Writer *DB
+	Reader *DB ` + "`autowire:\"name=replicaDB\"`" + `
+	Other  *DB
+}
+
+//autowire:invoke
+func Check(db *DB, replica *DB /* plain comment */) {}
+
+//autowire:invoke
+func Sync(
+	primary *DB, //autowire:inject name=primaryDB
+	replica *DB, //autowire:inject name=replicaDB
+) {}
+`
+	path := filepath.Join(t.TempDir(), "test.go")
+	require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+	result := &types.ParseResult{}
+	require.NoError(t, parseFile(path, "example.com/test", &mockResolver{}, nil, result))
+	require.Len(t, result.Providers, 4)
+
+	assert.Equal(t, "*example.com/test.DB@primaryDB", result.Providers[0].ProvidedType.Key())
+	assert.Equal(t, "primaryDB", result.Providers[0].VarName)
+	assert.Equal(t, "*example.com/test.DB@replicaDB", result.Providers[1].ProvidedType.Key())
+
+	qualifiers := func(deps []types.Dependency) []string {
+		var qs []string
+		for _, d := range deps {
+			qs = append(qs, d.Type.Qualifier)
+		}
+		return qs
+	}
+	assert.Equal(t, []string{"primaryDB", "replicaDB", ""}, qualifiers(result.Providers[2].Dependencies))
+	assert.Equal(t, []string{"primaryDB", "replicaDB", ""}, qualifiers(result.Providers[3].Dependencies))
+
+	require.Len(t, result.Invocations, 2)
+	assert.Equal(t, "", result.Invocations[0].Dependencies[0].Qualifier)
+	assert.Equal(t, "", result.Invocations[0].Dependencies[1].Qualifier)
+	assert.Equal(t, "primaryDB", result.Invocations[1].Dependencies[0].Qualifier)
+	assert.Equal(t, "replicaDB", result.Invocations[1].Dependencies[1].Qualifier)
+}
+
+func TestParseFile_StructTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   string
+		expected []string
+		errMsg   string
+	}{
+		{
+			name:     "skip",
+			fields:   "A *DB\n\tB *DB `autowire:\"-\"`\n\tC *DB `json:\"c\"`",
+			expected: []string{"A", "C"},
+		},
+		{
+			name:     "inject opts in",
+			fields:   "A *DB `autowire:\"inject\"`\n\tB *DB\n\tC *DB `autowire:\"inject,name=replica\"`",
+			expected: []string{"A", "C@replica"},
+		},
+		{
+			name:     "name alone keeps other fields",
+			fields:   "A *DB `autowire:\"name=replica\"`\n\tB *DB",
+			expected: []string{"A@replica", "B"},
+		},
+		{
+			name:     "embedded pointer",
+			fields:   "*Base `autowire:\"inject\"`\n\tA *DB",
+			expected: []string{"Base"},
+		},
+		{
+			name:     "multiple names",
+			fields:   "A, B *DB",
+			expected: []string{"A", "B"},
+		},
+		{
+			name:     "defaults",
+			fields:   "Port int `autowire:\"default=8080\"`\n\tHost string `autowire:\"name=host,default=localhost\"`\n\tDebug bool `autowire:\"default=true\"`",
+			expected: []string{"Port=8080", `Host@host="localhost"`, "Debug=true"},
+		},
+		{
+			name:     "canonical defaults",
+			fields:   "Debug bool `autowire:\"default=t\"`\n\tVerbose bool `autowire:\"default=1\"`\n\tRatio float64 `autowire:\"default=.5\"`",
+			expected: []string{"Debug=true", "Verbose=true", "Ratio=0.5"},
+		},
+		{
+			name:   "infinite default",
+			fields: "Ratio float64 `autowire:\"default=inf\"`",
+			errMsg: `Service: field Ratio: invalid default "inf" for float64`,
+		},
+		{
+			name:   "default out of range",
+			fields: "Workers int8 `autowire:\"default=300\"`",
+			errMsg: `Service: field Workers: invalid default "300" for int8`,
+		},
+		{
+			name:   "default on pointer",
+			fields: "A *DB `autowire:\"default=1\"`",
+			errMsg: "Service: field A: default= is only supported on string, bool and numeric types, not *example.com/test.DB",
+		},
+		{
+			name:   "unexported",
+			fields: "db *DB `autowire:\"inject\"`",
+			errMsg: "Service: field db is unexported, so the generated code cannot set it",
+		},
+		{
+			name:   "embedded value",
+			fields: "Base `autowire:\"inject\"`",
+			errMsg: "Service: embedded field Base: only exported embedded pointers can be injected",
+		},
+		{
+			name:   "unknown",
+			fields: "A *DB `autowire:\"optional\"`",
+			errMsg: `Service: field A: unknown autowire tag "optional": use inject, name=<name>, default=<value> or -`,
+		},
+		{
+			name:   "empty",
+			fields: "A *DB `autowire:\"\"`",
+			errMsg: "Service: field A: empty autowire tag: use inject, name=<name>, default=<value> or -",
+		},
+		{
+			name:   "invalid name",
+			fields: "A *DB `autowire:\"name=a-b\"`",
+			errMsg: `Service: field A: invalid name "a-b": must be a valid identifier`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "package test\n\ntype DB struct{}\n\ntype Base struct{}\n\n//autowire:provide\ntype Service struct {\n\t" + tt.fields + "\n}\n"
+			path := filepath.Join(t.TempDir(), "test.go")
+			require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+			result := &types.ParseResult{}
+			err := parseFile(path, "example.com/test", &mockResolver{}, nil, result)
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, result.Providers, 1)
+
+			var got []string
+			for _, d := range result.Providers[0].Dependencies {
+				field := d.FieldName
+				if d.Type.Qualifier != "" {
+					field += "@" + d.Type.Qualifier
+				}
+				if d.Type.Default != "" {
+					field += "=" + d.Type.Default
+				}
+				got = append(got, field)
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestParseFile_Values(t *testing.T) {
+	src := `package build
+
+//autowire:value ldflag=main.version
+type Version string
+
+//autowire:value ldflag=example.com/app/cmd.commit name=commit
+type Revision string
+`
+	path := filepath.Join(t.TempDir(), "build.go")
+	require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+	result := &types.ParseResult{}
+	require.NoError(t, parseFile(path, "example.com/build", &mockResolver{}, nil, result))
+	require.Len(t, result.Providers, 2)
+
+	assert.Equal(t, types.ProviderKindValue, result.Providers[0].Kind)
+	assert.Equal(t, "main.version", result.Providers[0].Ldflag)
+	assert.Equal(t, "version", result.Providers[0].VarName)
+	assert.Equal(t, "example.com/build.Version", result.Providers[0].ProvidedType.Key())
+	assert.Equal(t, "example.com/app/cmd.commit", result.Providers[1].Ldflag)
+	assert.Equal(t, "example.com/build.Revision@commit", result.Providers[1].ProvidedType.Key())
+}
+
+func TestParseFile_ValueErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		errMsg string
+	}{
+		{
+			name:   "missing ldflag",
+			src:    "//autowire:value\ntype Version string",
+			errMsg: "test.go:4:6: Version: value annotation requires ldflag=<package>.<variable>",
+		},
+		{
+			name:   "invalid ldflag",
+			src:    "//autowire:value ldflag=version\ntype Version string",
+			errMsg: `test.go:4:6: Version: invalid ldflag "version": must be <package>.<variable>`,
+		},
+		{
+			name:   "not a string",
+			src:    "//autowire:value ldflag=main.port\ntype Port int",
+			errMsg: "test.go:4:6: Port: value annotation requires a defined type with underlying type string",
+		},
+		{
+			name:   "alias",
+			src:    "//autowire:value ldflag=main.version\ntype Version = string",
+			errMsg: "test.go:4:6: Version: value annotation requires a defined type with underlying type string",
+		},
+		{
+			name:   "unknown argument",
+			src:    "//autowire:value ldflag=main.version group=x\ntype Version string",
+			errMsg: `test.go:4:6: Version: unknown value argument "group=x"`,
+		},
+		{
+			name:   "combined with provide",
+			src:    "//autowire:provide\n//autowire:value ldflag=main.version\ntype Version string",
+			errMsg: "test.go:5:6: Version: cannot have both provide and value annotations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseSource("test.go", "package test\n\n"+tt.src+"\n", "example.com/test", &mockResolver{}, nil, &types.ParseResult{})
+			assert.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestParseFile_Config(t *testing.T) {
+	src := `package settings
+
+import "time"
+
+//autowire:config prefix=APP_
+type Config struct {
+	DatabaseURL string ` + "`required:\"true\"`" + `
+	HTTPPort    int    ` + "`env:\"PORT\" default:\"8080\"`" + `
+	Timeout     time.Duration
+	Hosts       []string
+	Skipped     string ` + "`env:\"-\"`" + `
+	internal    string
+}
+
+//autowire:config name=labels
+type Labels struct {
+	Team string
+}
+`
+	path := filepath.Join(t.TempDir(), "settings.go")
+	require.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+	result := &types.ParseResult{}
+	require.NoError(t, parseFile(path, "example.com/settings", &mockResolver{}, nil, result))
+	require.Len(t, result.Providers, 2)
+
+	cfg := result.Providers[0]
+	assert.Equal(t, types.ProviderKindConfig, cfg.Kind)
+	assert.Equal(t, "*example.com/settings.Config", cfg.ProvidedType.Key())
+	assert.True(t, cfg.CanError)
+	assert.Equal(t, []types.EnvVar{
+		{Field: "DatabaseURL", Name: "APP_DATABASE_URL", Type: "string", Required: true},
+		{Field: "HTTPPort", Name: "APP_PORT", Type: "int", Default: "8080"},
+		{Field: "Timeout", Name: "APP_TIMEOUT", Type: "time.Duration"},
+		{Field: "Hosts", Name: "APP_HOSTS", Type: "[]string"},
+	}, cfg.Env)
+
+	labels := result.Providers[1]
+	assert.False(t, labels.CanError, "string fields cannot fail to parse")
+	assert.Equal(t, "labels", labels.VarName)
+	assert.Equal(t, "*example.com/settings.Labels@labels", labels.ProvidedType.Key())
+	assert.Equal(t, []types.EnvVar{{Field: "Team", Name: "TEAM", Type: "string"}}, labels.Env)
+}
+
+func TestParseFile_ConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		errMsg string
+	}{
+		{
+			name:   "not a struct",
+			src:    "//autowire:config\ntype Port int",
+			errMsg: "test.go:4:6: Port: config annotation requires a non-generic struct type",
+		},
+		{
+			name:   "unsupported field",
+			src:    "//autowire:config\ntype Config struct{ Limits map[string]int }",
+			errMsg: "test.go:4:6: Config.Limits: unsupported config field type; use a string, bool, integer, float, time.Duration or []string",
+		},
+		{
+			name:   "embedded field",
+			src:    "type Base struct{}\n\n//autowire:config\ntype Config struct{ Base }",
+			errMsg: "test.go:6:6: Config: embedded fields are not supported in config structs",
+		},
+		{
+			name:   "required with default",
+			src:    "//autowire:config\ntype Config struct{ Port int `required:\"true\" default:\"80\"` }",
+			errMsg: "test.go:4:6: Config.Port: a required field cannot have a default",
+		},
+		{
+			name:   "invalid env name",
+			src:    "//autowire:config\ntype Config struct{ Port int `env:\"HTTP-PORT\"` }",
+			errMsg: `test.go:4:6: Config.Port: invalid env name "HTTP-PORT": must be letters, digits and underscores`,
+		},
+		{
+			name:   "invalid prefix",
+			src:    "//autowire:config prefix=APP-\ntype Config struct{}",
+			errMsg: `test.go:4:6: Config: invalid prefix "APP-": must be letters, digits and underscores, e.g. APP_`,
+		},
+		{
+			name:   "unknown argument",
+			src:    "//autowire:config scope=request\ntype Config struct{}",
+			errMsg: `test.go:4:6: Config: unknown config argument "scope=request"`,
+		},
+		{
+			name:   "combined with provide",
+			src:    "//autowire:provide\n//autowire:config\ntype Config struct{}",
+			errMsg: "test.go:5:6: Config: cannot have both provide and config annotations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseSource("test.go", "package test\n\n"+tt.src+"\n", "example.com/test", &mockResolver{}, nil, &types.ParseResult{})
+			assert.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"Port":         "PORT",
+		"DatabaseURL":  "DATABASE_URL",
+		"HTTPPort":     "HTTP_PORT",
+		"MaxIdleConns": "MAX_IDLE_CONNS",
+		"S3Bucket":     "S3_BUCKET",
+	}
+	for field, want := range tests {
+		assert.Equal(t, want, envName(field), field)
+	}
+}
+
+func TestParseFile_Vars(t *testing.T) {
+	src := `package registry
+
+import "example.com/metrics"
+
+//autowire:provide
+var DefaultRegistry = &Registry{}
+
+//autowire:provide metrics.Sink
+var Discard Sink
+
+//autowire:provide name=maxConns
+const MaxConns int = 64
+
+var unannotated = 1
+
+//autowire:provide
+var (
+	Primary, Fallback Pool
+)
+`
+	result := &types.ParseResult{}
+	require.NoError(t, parseSource("registry.go", src, "example.com/registry", &mockResolver{}, nil, result))
+	require.Len(t, result.Providers, 5)
+
+	assert.Equal(t, types.ProviderKindVar, result.Providers[0].Kind)
+	assert.Equal(t, "defaultRegistry", result.Providers[0].VarName)
+	assert.Equal(t, "*example.com/registry.Registry", result.Providers[0].ProvidedType.Key())
+	assert.Equal(t, "example.com/metrics.Sink", result.Providers[1].ProvidedType.Key())
+	assert.Equal(t, "example.com/registry.Sink", result.Providers[1].Concrete.Key())
+	assert.Equal(t, "int@maxConns", result.Providers[2].ProvidedType.Key())
+	assert.Equal(t, "MaxConns", result.Providers[2].Name)
+	assert.Equal(t, "Primary", result.Providers[3].Name)
+	assert.Equal(t, "Fallback", result.Providers[4].Name)
+	assert.Equal(t, types.Position{File: "registry.go", Line: 6}, result.Providers[0].Pos)
+}
+
+func TestParseFile_VarErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		errMsg string
+	}{
+		{
+			name:   "untyped",
+			src:    "//autowire:provide\nvar Registry = newRegistry()",
+			errMsg: "test.go:4:5: Registry: cannot infer the provided type; declare it explicitly, e.g. var Registry T = ...",
+		},
+		{
+			name:   "scope",
+			src:    "//autowire:provide scope=transient\nvar Registry *Reg",
+			errMsg: "test.go:4:5: Registry: variables and constants are always singletons",
+		},
+		{
+			name:   "embed",
+			src:    "//autowire:provide embed=true\nvar Registry *Reg",
+			errMsg: "test.go:4:5: Registry: embed is only supported on struct providers",
+		},
+		{
+			name:   "blank",
+			src:    "//autowire:provide\nvar _ *Reg",
+			errMsg: "test.go:4:5: _: blank identifier cannot be provided",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseSource("test.go", "package test\n\n"+tt.src+"\n", "example.com/test", &mockResolver{}, nil, &types.ParseResult{})
+			assert.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestParse_VarTypeInformation(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/typed\n\ngo 1.22\n",
+		"registry/registry.go": `package registry
+
+type Registry struct{}
+
+func New() *Registry { return &Registry{} }
+
+//autowire:provide
+var Default = New()
+
+//autowire:provide name=retries
+const Retries = 3
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := Parse(dir, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, "*example.com/typed/registry.Registry", result.Providers[0].ProvidedType.Key())
+	assert.Equal(t, "int@retries", result.Providers[1].ProvidedType.Key())
+}
+
+func TestParse_EmbedVars(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                "module example.com/web\n\ngo 1.22\n",
+		"web/static/index.html": "<html></html>",
+		"web/assets.go": `package web
+
+import "embed"
+
+//go:embed static
+//autowire:provide name=static
+var Static embed.FS
+
+//autowire:provide fs.FS name=templates
+//go:embed templates
+var Templates embed.FS
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := Parse(dir, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 2)
+	assert.Equal(t, types.ProviderKindVar, result.Providers[0].Kind)
+	assert.Equal(t, "embed.FS@static", result.Providers[0].ProvidedType.Key())
+	assert.Equal(t, "io/fs.FS@templates", result.Providers[1].ProvidedType.Key())
+	assert.Equal(t, "embed.FS", result.Providers[1].Concrete.Key())
+}
+
+func TestParse_Bindings(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/bound\n\ngo 1.22\n",
+		"app/bind.go": `package app
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+)
+
+//autowire:bind http.NewServeMux
+//autowire:bind bufio.NewReader name=input
+//autowire:bind context.WithCancel
+
+var (
+	_ = http.NewServeMux
+	_ = bufio.NewReader
+	_ = context.WithCancel
+)
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := Parse(dir, &mockResolver{}, Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Providers, 3)
+
+	mux := result.Providers[0]
+	assert.Equal(t, "NewServeMux", mux.Name)
+	assert.Equal(t, types.ProviderKindFunc, mux.Kind)
+	assert.Equal(t, "net/http", mux.ImportPath)
+	assert.Equal(t, "*net/http.ServeMux", mux.ProvidedType.Key())
+	assert.Empty(t, mux.Dependencies)
+	assert.Equal(t, 9, mux.Pos.Line)
+
+	reader := result.Providers[1]
+	assert.Equal(t, "*bufio.Reader@input", reader.ProvidedType.Key())
+	assert.Equal(t, "input", reader.VarName)
+	assert.Equal(t, []types.Dependency{{Type: types.TypeRef{Name: "Reader", ImportPath: "io"}}}, reader.Dependencies)
+
+	cancel := result.Providers[2]
+	assert.Equal(t, "context.Context", cancel.ProvidedType.Key())
+	assert.True(t, cancel.HasCleanup)
+	assert.False(t, cancel.CanError)
+}
+
+func TestParseFile_BindingErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		errMsg string
+	}{
+		{
+			name:   "no type information",
+			src:    "//autowire:bind redis.NewClient",
+			errMsg: `test.go:3:1: bind "redis.NewClient": binding requires type information; run autowire inside a Go module where the package builds`,
+		},
+		{
+			name:   "invalid target",
+			src:    "//autowire:bind NewClient",
+			errMsg: `test.go:3:1: bind "NewClient": expected format: pkg.Constructor`,
+		},
+		{
+			name:   "embed",
+			src:    "//autowire:bind redis.NewClient embed=true",
+			errMsg: `test.go:3:1: bind "redis.NewClient embed=true": embed is only supported on struct providers`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseSource("test.go", "package test\n\n"+tt.src+"\n", "example.com/test", &mockResolver{}, nil, &types.ParseResult{})
+			assert.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestLoadProposed(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/proposed\n\ngo 1.22\n",
+		"store/store.go": `package store
+
+type Config struct {
+	DSN  string
+	port int
+}
+
+type DB struct{}
+
+func NewDB(c *Config) (*DB, error) { return &DB{}, nil }
+
+func Migrate(db *DB) error { return nil }
+
+func Count(db *DB) int { return 0 }
+
+func Map[T any]() T { return *new(T) }
+
+var Default = &Config{}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	providers, invocations, err := LoadProposed(dir, []string{"example.com/proposed/store.NewDB", "example.com/proposed/store.Config"}, []string{"example.com/proposed/store.Migrate"}, &mockResolver{})
+	require.NoError(t, err)
+	require.Len(t, providers, 2)
+	assert.Equal(t, "NewDB", providers[0].Name)
+	assert.True(t, providers[0].CanError)
+	assert.Equal(t, "*example.com/proposed/store.Config", providers[0].Dependencies[0].Type.Key())
+	assert.Equal(t, types.ProviderKindStruct, providers[1].Kind)
+	assert.Equal(t, "*example.com/proposed/store.Config", providers[1].ProvidedType.Key())
+	require.Len(t, providers[1].Dependencies, 1, "unexported fields are not injected")
+	assert.Equal(t, "DSN", providers[1].Dependencies[0].FieldName)
+	require.Len(t, invocations, 1)
+	assert.True(t, invocations[0].CanError)
+
+	tests := []struct {
+		name    string
+		provide []string
+		invoke  []string
+		wantErr string
+	}{
+		{"no package", []string{"NewDB"}, nil, `invalid target "NewDB"`},
+		{"unexported", []string{"example.com/proposed/store.newDB"}, nil, "must be <import path>.<Name>"},
+		{"missing name", []string{"example.com/proposed/store.Missing"}, nil, "Missing not found in example.com/proposed/store"},
+		{"generic", []string{"example.com/proposed/store.Map"}, nil, "generic functions are not supported"},
+		{"variable", []string{"example.com/proposed/store.Default"}, nil, "must be a function or struct type"},
+		{"invoke value", nil, []string{"example.com/proposed/store.Count"}, "may only return an error"},
+		{"invoke type", nil, []string{"example.com/proposed/store.DB"}, "must be a function"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := LoadProposed(dir, tt.provide, tt.invoke, &mockResolver{})
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":        "module example.com/mods\n\ngo 1.22\n",
+		"a/b/b.go":      "package b\n",
+		"nested/go.mod": "module example.com/nested\n\ngo 1.22\n",
+		"nested/c/c.go": "package c\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	modules := ModuleCache{}
+	for rel, expected := range map[string]string{
+		".":        "example.com/mods",
+		"a":        "example.com/mods/a",
+		"a/b":      "example.com/mods/a/b",
+		"nested/c": "example.com/nested/c",
+	} {
+		path, err := modulePath(filepath.Join(dir, rel), modules)
+		require.NoError(t, err)
+		assert.Equal(t, expected, path, rel)
+	}
+	assert.Equal(t, "example.com/nested", modules[filepath.Join(dir, "nested")])
+
+	seeded := ModuleCache{dir: "example.com/seeded"}
+	path, err := modulePath(filepath.Join(dir, "a", "b"), seeded)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/seeded/a/b", path, "directories below a known module root do not run go list")
+}
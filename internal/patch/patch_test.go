@@ -0,0 +1,161 @@
+package patch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func numbered(from, to int) string {
+	var b strings.Builder
+	for i := from; i <= to; i++ {
+		b.WriteString(strings.Repeat("x", i%3) + string(rune('a'+i%26)) + "\n")
+	}
+	return b.String()
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		expected string
+	}{
+		{
+			name:     "equal",
+			before:   "a\nb\n",
+			after:    "a\nb\n",
+			expected: "",
+		},
+		{
+			name:   "new file",
+			before: "",
+			after:  "a\nb\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -0,0 +1,2 @@\n" +
+				"+a\n" +
+				"+b\n",
+		},
+		{
+			name:   "changed line with context",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			after:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -2,7 +2,7 @@\n" +
+				" 2\n" +
+				" 3\n" +
+				" 4\n" +
+				"-5\n" +
+				"+five\n" +
+				" 6\n" +
+				" 7\n" +
+				" 8\n",
+		},
+		{
+			name:   "separate hunks",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			after:  "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n" +
+				"-1\n" +
+				"+one\n" +
+				" 2\n" +
+				" 3\n" +
+				" 4\n" +
+				"@@ -9,4 +9,3 @@\n" +
+				" 9\n" +
+				" 10\n" +
+				" 11\n" +
+				"-12\n",
+		},
+		{
+			name:   "nearby changes share a hunk",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			after:  "one\n2\n3\n4\n5\n6\n7\neight\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,8 +1,8 @@\n" +
+				"-1\n" +
+				"+one\n" +
+				" 2\n" +
+				" 3\n" +
+				" 4\n" +
+				" 5\n" +
+				" 6\n" +
+				" 7\n" +
+				"-8\n" +
+				"+eight\n",
+		},
+		{
+			name:   "missing trailing newline",
+			before: "a\nb",
+			after:  "a\nb\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				" a\n" +
+				"-b\n" +
+				"\\ No newline at end of file\n" +
+				"+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(Unified("old", "new", []byte(tt.before), []byte(tt.after))))
+		})
+	}
+}
+
+func TestUnified_RoundTrip(t *testing.T) {
+	before := numbered(0, 80)
+	tests := []struct {
+		name  string
+		after string
+	}{
+		{name: "replace", after: strings.Replace(before, "xxc\n", "changed\n", 1)},
+		{name: "delete and append", after: strings.Replace(before, "xk\n", "", 1) + "tail\n"},
+		{name: "insert at start", after: "head\n" + before},
+		{name: "rewrite", after: numbered(40, 120)},
+		{name: "empty", after: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := Unified("old", "new", []byte(before), []byte(tt.after))
+			assert.Equal(t, tt.after, apply(t, before, string(diff)))
+		})
+	}
+}
+
+func apply(t *testing.T, before, diff string) string {
+	t.Helper()
+	src := strings.SplitAfter(before, "\n")
+	var out []string
+	next := 0
+	for _, hunk := range strings.Split(diff, "@@ -")[1:] {
+		var start int
+		_, err := fmt.Sscanf(hunk, "%d", &start)
+		require.NoError(t, err)
+		lines := strings.SplitAfter(hunk, "\n")
+		if strings.HasPrefix(hunk, fmt.Sprintf("%d,0 ", start)) {
+			start++
+		}
+		out = append(out, src[next:start-1]...)
+		next = start - 1
+		for _, line := range lines[1:] {
+			switch {
+			case line == "":
+			case line[0] == '+':
+				out = append(out, line[1:])
+			case line[0] == '-':
+				next++
+			default:
+				out = append(out, line[1:])
+				next++
+			}
+		}
+	}
+	return strings.Join(append(out, src[next:]...), "")
+}
@@ -0,0 +1,748 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/bundle"
+	"github.com/eloonstra/autowire/internal/cache"
+	"github.com/eloonstra/autowire/internal/diag"
+	"github.com/eloonstra/autowire/internal/generator"
+	"github.com/eloonstra/autowire/internal/parser"
+	"github.com/eloonstra/autowire/internal/patch"
+	"github.com/eloonstra/autowire/internal/resolver"
+	"github.com/eloonstra/autowire/internal/shard"
+	"github.com/eloonstra/autowire/internal/typecheck"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+const DefaultFileMode os.FileMode = 0644
+
+type Config struct {
+	ScanDirs         []string
+	OutDir           string
+	OutputName       string
+	Package          string
+	Prefixes         []string
+	Exclude          []string
+	ErrorTypes       []string
+	Analyzer         analyzer.Options
+	Generator        generator.Options
+	Source           fs.FS
+	SourceImportPath string
+	Replay           *bundle.Bundle
+	Shards           []*shard.Shard
+	Resolver         *resolver.Resolver
+	ScanOnly         bool
+	Patch            io.Writer
+	Cache            bool
+	FileMode         os.FileMode
+	FileOwner        *Owner
+	Shuffle          func(n int, swap func(i, j int))
+	Progress         func(dir string, done, total int)
+	Logf             func(format string, args ...any)
+}
+
+type Pipeline struct {
+	cfg      Config
+	resolver *resolver.Resolver
+	cache    parser.Cache
+	outDir   string
+	parsed   *types.ParseResult
+	result   *analyzer.Result
+	code     []byte
+}
+
+func New(cfg Config) *Pipeline {
+	r := cfg.Resolver
+	if cfg.Replay != nil {
+		r = resolver.NewStatic(cfg.Replay.Packages)
+	} else if r == nil {
+		r = resolver.New()
+	}
+	return &Pipeline{
+		cfg:      cfg,
+		resolver: r,
+	}
+}
+
+func (p *Pipeline) Resolver() types.PackageNameResolver {
+	return p.resolver
+}
+
+func (p *Pipeline) OutputPath() string {
+	return filepath.Join(p.outDir, p.cfg.OutputName)
+}
+
+func (p *Pipeline) Parse() (*types.ParseResult, error) {
+	if p.parsed != nil {
+		return p.parsed, nil
+	}
+	if p.cfg.Source != nil {
+		return p.parseSource()
+	}
+
+	absOutDir, err := filepath.Abs(p.cfg.OutDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving output directory: %w", err)
+	}
+	p.outDir = absOutDir
+	p.logf("output dir: %s\n", absOutDir)
+
+	if p.cfg.Replay != nil {
+		p.logf("replaying recorded scan of: %s\n", strings.Join(p.cfg.Replay.Settings.ScanDirs, ", "))
+		p.parsed = p.cfg.Replay.Parsed
+		return p.parsed, nil
+	}
+
+	var c *cache.Cache
+	if p.cfg.Cache {
+		if root, ok := cache.ModuleRoot(absOutDir); ok {
+			c = cache.Open(root)
+			for path, name := range c.Names() {
+				p.resolver.Register(path, name)
+			}
+			p.cache = c
+		}
+	}
+
+	var modules parser.Modules = parser.ModuleCache{}
+	if p.cache != nil {
+		modules = p.cache
+	}
+	outputPackage, outputImportPath, err := parser.GetOutputInfo(absOutDir, p.cfg.Package, modules)
+	if err != nil {
+		return nil, fmt.Errorf("getting output info: %w", err)
+	}
+
+	output := types.ParseResult{
+		OutputPath:       absOutDir,
+		OutputPackage:    outputPackage,
+		OutputImportPath: outputImportPath,
+	}
+	if len(p.cfg.Shards) > 0 {
+		for _, s := range p.cfg.Shards {
+			p.logf("merging shard of: %s\n", strings.Join(s.ScanDirs, ", "))
+			for path, name := range s.Packages {
+				p.resolver.Register(path, name)
+			}
+		}
+		return p.finishParse(p.cfg.Shards, output)
+	}
+
+	targets, err := expandScanDirs(p.cfg.ScanDirs)
+	if err != nil {
+		return nil, err
+	}
+	batches := batchTargets(targets)
+	parsed := make([]*shard.Shard, len(batches))
+	failed := make([]error, len(parsed))
+	order := p.scanOrder(len(batches))
+	for _, i := range order {
+		batch := batches[i]
+		rels := make([]string, len(batch.dirs))
+		var absDir string
+		for j, dir := range batch.dirs {
+			if absDir, err = filepath.Abs(dir); err != nil {
+				return nil, fmt.Errorf("resolving directory %s: %w", dir, err)
+			}
+			p.logf("scanning: %s\n", absDir)
+			if batch.root != "" {
+				if rels[j], err = filepath.Rel(batch.root, absDir); err != nil {
+					return nil, fmt.Errorf("resolving directory %s: %w", dir, err)
+				}
+			}
+		}
+
+		opts := parser.Options{Prefixes: p.cfg.Prefixes, Exclude: p.cfg.Exclude, ErrorTypes: p.cfg.ErrorTypes, Shuffle: p.cfg.Shuffle, Cache: p.cache, Modules: modules, Shallow: batch.shallow}
+		if p.cfg.Progress != nil {
+			opts.Progress = func(done, total int) { p.cfg.Progress(batch.name, done, total) }
+		}
+		var r *types.ParseResult
+		if batch.root != "" {
+			r, err = parser.ParseDirs(batch.root, rels, p.resolver, opts)
+		} else {
+			r, err = parser.Parse(absDir, p.resolver, opts)
+		}
+		if err != nil {
+			failed[i] = fmt.Errorf("parsing %s: %w", batch.name, err)
+			continue
+		}
+		parsed[i] = &shard.Shard{Name: batch.name, ScanDirs: batch.dirs, Parsed: r}
+	}
+	if err := errors.Join(failed...); err != nil {
+		return nil, err
+	}
+
+	result, err := p.finishParse(inOrder(parsed, order), output)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		if err := c.Save(p.resolver.Names()); err != nil {
+			p.logf("warning: saving cache: %v\n", err)
+		}
+	}
+	return result, nil
+}
+
+func (p *Pipeline) parseSource() (*types.ParseResult, error) {
+	outDir, outImportPath, err := p.sourcePath(p.cfg.OutDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving output directory: %w", err)
+	}
+	p.outDir = outDir
+	p.logf("output dir: %s\n", outDir)
+
+	outFS, err := fs.Sub(p.cfg.Source, outDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving output directory: %w", err)
+	}
+	output := types.ParseResult{
+		OutputPath:       outDir,
+		OutputPackage:    parser.OutputPackage(outFS, path.Base(outImportPath)),
+		OutputImportPath: outImportPath,
+	}
+
+	parsed := make([]*shard.Shard, len(p.cfg.ScanDirs))
+	failed := make([]error, len(parsed))
+	order := p.scanOrder(len(p.cfg.ScanDirs))
+	for _, i := range order {
+		dir := p.cfg.ScanDirs[i]
+		scanDir, importPath, err := p.sourcePath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("resolving directory %s: %w", dir, err)
+		}
+		p.logf("scanning: %s\n", scanDir)
+
+		sub, err := fs.Sub(p.cfg.Source, scanDir)
+		if err != nil {
+			return nil, fmt.Errorf("resolving directory %s: %w", dir, err)
+		}
+		opts := parser.Options{Prefixes: p.cfg.Prefixes, Exclude: p.cfg.Exclude, ErrorTypes: p.cfg.ErrorTypes, Shuffle: p.cfg.Shuffle}
+		if p.cfg.Progress != nil {
+			opts.Progress = func(done, total int) { p.cfg.Progress(dir, done, total) }
+		}
+		r, err := parser.ParseFS(sub, importPath, p.resolver, opts)
+		if err != nil {
+			failed[i] = fmt.Errorf("parsing %s: %w", dir, err)
+			continue
+		}
+		parsed[i] = &shard.Shard{Name: dir, ScanDirs: []string{dir}, Parsed: r}
+	}
+	if err := errors.Join(failed...); err != nil {
+		return nil, err
+	}
+
+	return p.finishParse(inOrder(parsed, order), output)
+}
+
+func (p *Pipeline) scanOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	if p.cfg.Shuffle != nil {
+		p.cfg.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+	return order
+}
+
+func inOrder(shards []*shard.Shard, order []int) []*shard.Shard {
+	ordered := make([]*shard.Shard, len(order))
+	for j, i := range order {
+		ordered[j] = shards[i]
+	}
+	return ordered
+}
+
+func (p *Pipeline) sourcePath(dir string) (string, string, error) {
+	if p.cfg.SourceImportPath == "" {
+		return "", "", fmt.Errorf("an import path for the source file system is required")
+	}
+	dir = path.Clean(filepath.ToSlash(dir))
+	if !fs.ValidPath(dir) {
+		return "", "", fmt.Errorf("%s is not a valid path inside the source file system", dir)
+	}
+	if dir == "." {
+		return dir, p.cfg.SourceImportPath, nil
+	}
+	return dir, p.cfg.SourceImportPath + "/" + dir, nil
+}
+
+func (p *Pipeline) finishParse(shards []*shard.Shard, output types.ParseResult) (*types.ParseResult, error) {
+	merged, err := shard.Merge(shards)
+	if err != nil {
+		return nil, err
+	}
+	merged.OutputPath = output.OutputPath
+	merged.OutputPackage = output.OutputPackage
+	merged.OutputImportPath = output.OutputImportPath
+
+	if len(merged.Providers) == 0 && len(merged.Invocations) == 0 && !p.cfg.ScanOnly {
+		var dirs []string
+		for _, s := range shards {
+			dirs = append(dirs, s.ScanDirs...)
+		}
+		return nil, fmt.Errorf("no autowire annotations found in: %s", strings.Join(dirs, ", "))
+	}
+
+	for importPath, name := range merged.PackageNames {
+		p.resolver.Register(importPath, name)
+	}
+	p.parsed = merged
+	return merged, nil
+}
+
+func (p *Pipeline) Analyze() (*analyzer.Result, error) {
+	if p.result != nil {
+		return p.result, nil
+	}
+
+	parsed, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := analyzer.Analyze(parsed, p.resolver, p.cfg.Analyzer)
+	if err != nil {
+		if note := skippedFiles(parsed.Diagnostics); note != "" {
+			return nil, fmt.Errorf("analyzing: %w\n%s", err, note)
+		}
+		return nil, fmt.Errorf("analyzing: %w", err)
+	}
+	result.Diagnostics = append(append([]diag.Diagnostic{}, parsed.Diagnostics...), result.Diagnostics...)
+	if p.cfg.Source == nil && p.cfg.Replay == nil {
+		providers := append(append(append(append(append([]types.Provider{}, result.Providers...), result.RequestProviders...), result.TransientProviders...), result.WeakProviders...), result.LazyProviders...)
+		bindings, err := typecheck.Bindings(p.outDir, providers)
+		if err != nil {
+			return nil, fmt.Errorf("verifying interface bindings: %w", err)
+		}
+		result.Diagnostics = append(result.Diagnostics, bindings...)
+	}
+
+	p.result = result
+	return result, nil
+}
+
+func skippedFiles(diagnostics []diag.Diagnostic) string {
+	var sb strings.Builder
+	for _, d := range diagnostics {
+		if d.Code != "syntax-error" {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("note: providers in these files were not seen:")
+		}
+		sb.WriteString("\n  " + d.String())
+	}
+	return sb.String()
+}
+
+func (p *Pipeline) Generate() ([]byte, error) {
+	if p.code != nil {
+		return p.code, nil
+	}
+
+	result, err := p.Analyze()
+	if err != nil {
+		return nil, err
+	}
+
+	emitter, err := generator.LookupEmitter(p.cfg.Generator.Emit)
+	if err != nil {
+		return nil, err
+	}
+	code, err := emitter.Emit(result, p.resolver, p.cfg.Generator)
+	if err != nil {
+		return nil, fmt.Errorf("generating: %w", err)
+	}
+
+	p.code = code
+	return code, nil
+}
+
+func (p *Pipeline) Write() (string, error) {
+	code, err := p.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	outputPath := p.OutputPath()
+	if err := p.writeFile(outputPath, code); err != nil {
+		return "", fmt.Errorf("writing output: %w", err)
+	}
+	return outputPath, nil
+}
+
+func (p *Pipeline) SelfCheck() error {
+	var outputs [2][]byte
+	for i := range outputs {
+		cfg := p.cfg
+		cfg.Shuffle = rand.Shuffle
+		cfg.Cache = false
+		cfg.Progress = nil
+		cfg.Logf = nil
+		code, err := New(cfg).Generate()
+		if err != nil {
+			return fmt.Errorf("self-check run %d: %w", i+1, err)
+		}
+		outputs[i] = code
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		return fmt.Errorf("self-check: generated output differs between runs:\n%s",
+			patch.Unified("first run", "second run", outputs[0], outputs[1]))
+	}
+	return nil
+}
+
+func (p *Pipeline) UpToDate() (bool, error) {
+	code, err := p.Generate()
+	if err != nil {
+		return false, err
+	}
+
+	existing, err := os.ReadFile(p.OutputPath())
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading existing output: %w", err)
+	}
+	return bytes.Equal(existing, code), nil
+}
+
+func (p *Pipeline) Drift() ([]diag.Diagnostic, error) {
+	code, err := p.Generate()
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.Generator.Partial || p.cfg.Generator.Emit != "" && p.cfg.Generator.Emit != generator.EmitGo {
+		return nil, nil
+	}
+
+	existing, err := os.ReadFile(p.OutputPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading existing output: %w", err)
+	}
+
+	initializer := generator.InitializerName(p.cfg.Generator)
+	before, err := generator.ExtractWiring(existing, initializer)
+	if err != nil {
+		return []diag.Diagnostic{{
+			Severity: diag.SeverityWarning,
+			Code:     "stale-output",
+			Message:  fmt.Sprintf("%s: cannot compare with existing wiring: %s", p.cfg.OutputName, err),
+		}}, nil
+	}
+	after, err := generator.ExtractWiring(code, initializer)
+	if err != nil {
+		return nil, fmt.Errorf("extracting generated wiring: %w", err)
+	}
+
+	var diagnostics []diag.Diagnostic
+	for _, d := range generator.DiffWiring(before, after) {
+		diagnostics = append(diagnostics, diag.Diagnostic{
+			Severity: diag.SeverityWarning,
+			Code:     "stale-output",
+			Message:  fmt.Sprintf("%s: %s", p.cfg.OutputName, d),
+		})
+	}
+	return diagnostics, nil
+}
+
+type WhatIf struct {
+	Providers   []types.Provider
+	Invocations []types.Invocation
+	Resolved    []string
+	Changes     []string
+	Err         error
+}
+
+func (p *Pipeline) WhatIf(provide, invoke []string) (*WhatIf, error) {
+	parsed, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.Source != nil || p.cfg.Replay != nil {
+		return nil, fmt.Errorf("what-if loads the proposed functions from disk and cannot run on a replayed or in-memory scan")
+	}
+	providers, invocations, err := parser.LoadProposed(p.outDir, provide, invoke, p.resolver)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := p.cfg.Analyzer
+	opts.AllowMissing = false
+	genOpts := p.cfg.Generator
+	genOpts.Partial = false
+	before, beforeErr := p.wiring(parsed, opts, genOpts)
+
+	proposed := *parsed
+	proposed.Providers = append(append([]types.Provider{}, parsed.Providers...), providers...)
+	proposed.Invocations = append(append([]types.Invocation{}, parsed.Invocations...), invocations...)
+	after, afterErr := p.wiring(&proposed, opts, genOpts)
+
+	w := &WhatIf{Providers: providers, Invocations: invocations, Err: afterErr}
+	remaining := make(map[string]bool)
+	for _, line := range problems(afterErr) {
+		remaining[line] = true
+	}
+	for _, line := range problems(beforeErr) {
+		if !remaining[line] {
+			w.Resolved = append(w.Resolved, line)
+		}
+	}
+	if afterErr == nil {
+		w.Changes = generator.DiffWiring(before, after)
+	}
+	return w, nil
+}
+
+func (p *Pipeline) wiring(parsed *types.ParseResult, opts analyzer.Options, genOpts generator.Options) ([]generator.Step, error) {
+	result, err := analyzer.Analyze(parsed, p.resolver, opts)
+	if err != nil {
+		return nil, err
+	}
+	code, err := generator.Generate(result, p.resolver, genOpts)
+	if err != nil {
+		return nil, err
+	}
+	return generator.ExtractWiring(code, generator.InitializerName(genOpts))
+}
+
+func problems(err error) []string {
+	if err == nil {
+		return nil
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) == 1 {
+		return lines
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines[1:]
+}
+
+func (p *Pipeline) SummaryPath() string {
+	return p.siblingPath(".md")
+}
+
+func (p *Pipeline) BenchmarkPath() string {
+	return p.siblingPath("_bench_test.go")
+}
+
+func (p *Pipeline) TestAppPath() string {
+	return p.siblingPath("_test.go")
+}
+
+func (p *Pipeline) siblingPath(suffix string) string {
+	return strings.TrimSuffix(p.OutputPath(), filepath.Ext(p.cfg.OutputName)) + suffix
+}
+
+func (p *Pipeline) WriteSummary() (string, error) {
+	result, err := p.Analyze()
+	if err != nil {
+		return "", err
+	}
+
+	summaryPath := p.SummaryPath()
+	if err := p.writeFile(summaryPath, generator.Summary(result)); err != nil {
+		return "", fmt.Errorf("writing summary: %w", err)
+	}
+	return summaryPath, nil
+}
+
+func (p *Pipeline) WriteBenchmark() (string, error) {
+	result, err := p.Analyze()
+	if err != nil {
+		return "", err
+	}
+
+	code, err := generator.Benchmark(result, p.cfg.Generator)
+	if err != nil {
+		return "", fmt.Errorf("generating benchmark: %w", err)
+	}
+
+	benchPath := p.BenchmarkPath()
+	if err := p.writeFile(benchPath, code); err != nil {
+		return "", fmt.Errorf("writing benchmark: %w", err)
+	}
+	return benchPath, nil
+}
+
+func (p *Pipeline) WriteTestApp() (string, error) {
+	result, err := p.Analyze()
+	if err != nil {
+		return "", err
+	}
+
+	code, err := generator.OverrideInitializer(result, p.resolver, p.cfg.Generator)
+	if err != nil {
+		return "", fmt.Errorf("generating test initializer: %w", err)
+	}
+
+	testPath := p.TestAppPath()
+	if err := p.writeFile(testPath, code); err != nil {
+		return "", fmt.Errorf("writing test initializer: %w", err)
+	}
+	return testPath, nil
+}
+
+func (p *Pipeline) writeFile(path string, content []byte) error {
+	if p.cfg.Patch == nil {
+		mode := p.cfg.FileMode
+		if mode == 0 {
+			mode = DefaultFileMode
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := WriteFile(path, content, mode); err != nil {
+			return err
+		}
+		if p.cfg.FileOwner != nil {
+			return p.cfg.FileOwner.Chown(path)
+		}
+		return nil
+	}
+
+	name := path
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = filepath.ToSlash(rel)
+		}
+	}
+	oldName := "a/" + name
+	existing, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		oldName = patch.DevNull
+	} else if err != nil {
+		return err
+	}
+	_, err = p.cfg.Patch.Write(patch.Unified(oldName, "b/"+name, existing, content))
+	return err
+}
+
+func (p *Pipeline) Bundle() (*bundle.Bundle, error) {
+	if p.parsed == nil {
+		return nil, fmt.Errorf("nothing to record: scanning did not complete")
+	}
+	return &bundle.Bundle{
+		Settings: bundle.Settings{
+			ScanDirs:   p.cfg.ScanDirs,
+			OutDir:     p.cfg.OutDir,
+			OutputName: p.cfg.OutputName,
+			Prefixes:   p.cfg.Prefixes,
+			Exclude:    p.cfg.Exclude,
+			ErrorTypes: p.cfg.ErrorTypes,
+			Analyzer:   p.cfg.Analyzer,
+			Generator:  p.cfg.Generator,
+		},
+		Parsed:   p.parsed,
+		Packages: p.resolver.Names(),
+	}, nil
+}
+
+func (p *Pipeline) Shard() (*shard.Shard, error) {
+	parsed, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return &shard.Shard{
+		ScanDirs: p.cfg.ScanDirs,
+		Parsed:   parsed,
+		Packages: p.resolver.Names(),
+	}, nil
+}
+
+func (p *Pipeline) logf(format string, args ...any) {
+	if p.cfg.Logf != nil {
+		p.cfg.Logf(format, args...)
+	}
+}
+
+func WriteFile(path string, content []byte, mode os.FileMode) error {
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0200 == 0 {
+		if err := os.Chmod(path, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, content, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+type Owner struct {
+	UID int
+	GID int
+}
+
+func ParseOwner(s string) (*Owner, error) {
+	name, group, hasGroup := strings.Cut(s, ":")
+	if name == "" && (!hasGroup || group == "") {
+		return nil, fmt.Errorf("invalid owner %q: must be user, user:group or :group", s)
+	}
+	o := &Owner{UID: -1, GID: -1}
+	if name != "" {
+		id, err := lookupID(name, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid owner %q: %w", s, err)
+		}
+		o.UID = id
+	}
+	if group != "" {
+		id, err := lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid owner %q: %w", s, err)
+		}
+		o.GID = id
+	}
+	return o, nil
+}
+
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+func (o *Owner) Chown(path string) error {
+	if o.UID < 0 && o.GID < 0 {
+		return nil
+	}
+	return os.Chown(path, o.UID, o.GID)
+}
@@ -0,0 +1,564 @@
+package pipeline
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/eloonstra/autowire/internal/shard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestPipeline_SharesPasses(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":            "package main\n\nfunc main() {}\n",
+		"internal/config/cfg.go": "package config\n\ntype Config struct{}\n\n//autowire:provide\nfunc NewConfig() *Config { return &Config{} }\n",
+	})
+
+	var scanned []string
+	p := New(Config{
+		ScanDirs:   []string{filepath.Join(dir, "internal")},
+		OutDir:     filepath.Join(dir, "cmd"),
+		OutputName: "app_gen.go",
+		Logf: func(format string, args ...any) {
+			if format == "scanning: %s\n" {
+				scanned = append(scanned, args[0].(string))
+			}
+		},
+	})
+
+	parsed, err := p.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, "main", parsed.OutputPackage)
+	assert.Len(t, parsed.Providers, 1)
+
+	result, err := p.Analyze()
+	require.NoError(t, err)
+	again, err := p.Analyze()
+	require.NoError(t, err)
+	assert.Same(t, result, again)
+
+	code, err := p.Generate()
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "config := config.NewConfig()")
+
+	outputPath, err := p.Write()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "cmd", "app_gen.go"), outputPath)
+	written, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, code, written)
+
+	summaryPath, err := p.WriteSummary()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "cmd", "app_gen.md"), summaryPath)
+	summary, err := os.ReadFile(summaryPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(summary), "`example.com/app/internal/config.NewConfig`")
+
+	benchPath, err := p.WriteBenchmark()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "cmd", "app_gen_bench_test.go"), benchPath)
+
+	assert.Len(t, scanned, 1, "scan directories are parsed once")
+}
+
+func TestPipeline_NoAnnotations(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.22\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	})
+
+	p := New(Config{ScanDirs: []string{dir}, OutDir: dir, OutputName: "app_gen.go"})
+	_, err := p.Analyze()
+	assert.ErrorContains(t, err, "no autowire annotations found")
+}
+
+func TestPipeline_RecordReplay(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":            "package main\n\nfunc main() {}\n",
+		"internal/config/cfg.go": "package config\n\ntype Config struct{}\n\n//autowire:provide\nfunc NewConfig() *Config { return &Config{} }\n",
+	})
+
+	recorded := New(Config{
+		ScanDirs:   []string{filepath.Join(dir, "internal")},
+		OutDir:     filepath.Join(dir, "cmd"),
+		OutputName: "app_gen.go",
+	})
+	code, err := recorded.Generate()
+	require.NoError(t, err)
+	b, err := recorded.Bundle()
+	require.NoError(t, err)
+	assert.Equal(t, "config", b.Packages["example.com/app/internal/config"])
+
+	replayed := New(Config{
+		OutDir:     t.TempDir(),
+		OutputName: "app_gen.go",
+		Replay:     b,
+	})
+	replayedCode, err := replayed.Generate()
+	require.NoError(t, err)
+	assert.Equal(t, code, replayedCode)
+}
+
+func TestPipeline_Shards(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":            "package main\n\nfunc main() {}\n",
+		"internal/config/cfg.go": "package config\n\ntype Config struct{}\n\n//autowire:provide\nfunc NewConfig() *Config { return &Config{} }\n",
+		"internal/server/srv.go": "package server\n\nimport \"example.com/app/internal/config\"\n\ntype Server struct{}\n\n//autowire:provide\nfunc New(cfg *config.Config) *Server { return &Server{} }\n",
+		"internal/empty/doc.go":  "package empty\n",
+	})
+	cfg := Config{
+		ScanDirs:   []string{filepath.Join(dir, "internal")},
+		OutDir:     filepath.Join(dir, "cmd"),
+		OutputName: "app_gen.go",
+	}
+	code, err := New(cfg).Generate()
+	require.NoError(t, err)
+
+	var shards []*shard.Shard
+	for _, pkg := range []string{"config", "server", "empty"} {
+		scan := cfg
+		scan.ScanDirs = []string{filepath.Join(dir, "internal", pkg)}
+		scan.ScanOnly = true
+		s, err := New(scan).Shard()
+		require.NoError(t, err)
+		shards = append(shards, s)
+	}
+	assert.Empty(t, shards[2].Parsed.Providers, "a shard without annotations is not an error")
+
+	merged := cfg
+	merged.ScanDirs = nil
+	merged.Shards = shards
+	mergedCode, err := New(merged).Generate()
+	require.NoError(t, err)
+	assert.Equal(t, code, mergedCode)
+
+	merged.Shards = shards[2:]
+	_, err = New(merged).Generate()
+	assert.ErrorContains(t, err, "no autowire annotations found in: "+filepath.Join(dir, "internal", "empty"))
+}
+
+func TestPipeline_BundleBeforeParse(t *testing.T) {
+	_, err := New(Config{}).Bundle()
+	assert.ErrorContains(t, err, "nothing to record")
+}
+
+func TestPipeline_Drift(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":      "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go": "package main\n\nfunc main() {}\n",
+		"internal/store/store.go": `package store
+
+type Config struct{}
+
+type DB struct{}
+
+//autowire:provide
+func NewConfig() *Config { return &Config{} }
+
+//autowire:provide
+func NewDB(c *Config) *DB { return &DB{} }
+`,
+	})
+	cfg := Config{
+		ScanDirs:   []string{filepath.Join(dir, "internal")},
+		OutDir:     filepath.Join(dir, "cmd"),
+		OutputName: "app_gen.go",
+	}
+
+	drift, err := New(cfg).Drift()
+	require.NoError(t, err)
+	assert.Empty(t, drift, "missing output file is not drift")
+
+	_, err = New(cfg).Write()
+	require.NoError(t, err)
+	drift, err = New(cfg).Drift()
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+
+	store := filepath.Join(dir, "internal", "store", "store.go")
+	src, err := os.ReadFile(store)
+	require.NoError(t, err)
+	src = append(src, "\n//autowire:invoke\nfunc Migrate(db *DB) {}\n"...)
+	require.NoError(t, os.WriteFile(store, src, 0644))
+
+	drift, err = New(cfg).Drift()
+	require.NoError(t, err)
+	require.Len(t, drift, 1)
+	assert.Equal(t, "warning: app_gen.go: invocation store.Migrate added: store.Migrate(db) [stale-output]", drift[0].String())
+}
+
+func TestPipeline_WhatIf(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":      "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go": "package main\n\nfunc main() {}\n",
+		"internal/store/store.go": `package store
+
+type Config struct{}
+
+type DB struct{}
+
+type Cache struct{}
+
+//autowire:provide
+func NewConfig() *Config { return &Config{} }
+
+//autowire:provide
+func NewDB(c *Config) *DB { return &DB{} }
+
+func NewCache(db *DB) *Cache { return &Cache{} }
+
+func Warm(c *Cache) {}
+`,
+	})
+	cfg := Config{
+		ScanDirs:   []string{filepath.Join(dir, "internal")},
+		OutDir:     filepath.Join(dir, "cmd"),
+		OutputName: "app_gen.go",
+	}
+
+	w, err := New(cfg).WhatIf(nil, []string{"example.com/app/internal/store.Warm"})
+	require.NoError(t, err)
+	assert.Empty(t, w.Resolved)
+	require.Error(t, w.Err)
+	assert.Contains(t, w.Err.Error(), "Warm requires *example.com/app/internal/store.Cache")
+
+	w, err = New(cfg).WhatIf([]string{"example.com/app/internal/store.NewCache"}, []string{"example.com/app/internal/store.Warm"})
+	require.NoError(t, err)
+	require.NoError(t, w.Err)
+	assert.Equal(t, []string{
+		"provider cache added: store.NewCache(db)",
+		"invocation store.Warm added: store.Warm(cache)",
+	}, w.Changes)
+
+	_, err = New(cfg).WhatIf([]string{"example.com/app/internal/store.Missing"}, nil)
+	assert.ErrorContains(t, err, "Missing not found in example.com/app/internal/store")
+
+	store := filepath.Join(dir, "internal", "store", "store.go")
+	src, err := os.ReadFile(store)
+	require.NoError(t, err)
+	src = bytes.Replace(src, []byte("func Warm"), []byte("//autowire:invoke\nfunc Warm"), 1)
+	require.NoError(t, os.WriteFile(store, src, 0644))
+
+	w, err = New(cfg).WhatIf([]string{"example.com/app/internal/store.NewCache"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Err)
+	assert.Equal(t, []string{"Warm (" + store + ":18) requires *example.com/app/internal/store.Cache"}, w.Resolved)
+}
+
+func TestPipeline_UpToDate(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":            "package main\n\nfunc main() {}\n",
+		"internal/config/cfg.go": "package config\n\ntype Config struct{}\n\n//autowire:provide\nfunc NewConfig() *Config { return &Config{} }\n",
+	})
+	cfg := Config{
+		ScanDirs:   []string{filepath.Join(dir, "internal")},
+		OutDir:     filepath.Join(dir, "cmd"),
+		OutputName: "app_gen.go",
+	}
+
+	upToDate, err := New(cfg).UpToDate()
+	require.NoError(t, err)
+	assert.False(t, upToDate, "missing output is not up to date")
+
+	outputPath, err := New(cfg).Write()
+	require.NoError(t, err)
+	upToDate, err = New(cfg).UpToDate()
+	require.NoError(t, err)
+	assert.True(t, upToDate)
+
+	require.NoError(t, os.WriteFile(outputPath, []byte("package main\n"), 0644))
+	upToDate, err = New(cfg).UpToDate()
+	require.NoError(t, err)
+	assert.False(t, upToDate)
+}
+
+func TestPipeline_Patch(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":            "package main\n\nfunc main() {}\n",
+		"internal/config/cfg.go": "package config\n\ntype Config struct{}\n\n//autowire:provide\nfunc NewConfig() *Config { return &Config{} }\n",
+	})
+	t.Chdir(dir)
+
+	var out bytes.Buffer
+	cfg := Config{
+		ScanDirs:   []string{"internal"},
+		OutDir:     "cmd",
+		OutputName: "app_gen.go",
+		Patch:      &out,
+	}
+
+	outputPath, err := New(cfg).Write()
+	require.NoError(t, err)
+	assert.NoFileExists(t, outputPath)
+	assert.True(t, strings.HasPrefix(out.String(), "--- /dev/null\n+++ b/cmd/app_gen.go\n@@ -0,0 +1,"), out.String())
+
+	cfg.Patch = nil
+	_, err = New(cfg).Write()
+	require.NoError(t, err)
+	code, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+
+	out.Reset()
+	cfg.Patch = &out
+	_, err = New(cfg).Write()
+	require.NoError(t, err)
+	assert.Empty(t, out.String(), "up to date output produces an empty patch")
+
+	stale := strings.Replace(string(code), "config.NewConfig()", "config.Old()", 1)
+	require.NoError(t, os.WriteFile(outputPath, []byte(stale), 0644))
+	_, err = New(cfg).Write()
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "--- a/cmd/app_gen.go\n+++ b/cmd/app_gen.go\n")
+	assert.Contains(t, out.String(), "\n-\tconfig := config.Old()\n+\tconfig := config.NewConfig()\n")
+
+	current, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, stale, string(current))
+}
+
+func TestPipeline_SelfCheck(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":            "package main\n\nfunc main() {}\n",
+		"internal/config/cfg.go": "package config\n\ntype Config struct{}\n\n//autowire:provide\nfunc NewConfig() *Config { return &Config{} }\n\n//autowire:invoke\nfunc Load(c *Config) {}\n",
+		"internal/store/db.go":   "package store\n\nimport \"example.com/app/internal/config\"\n\ntype DB struct{}\n\n//autowire:provide\nfunc NewDB(c *config.Config) *DB { return &DB{} }\n\n//autowire:invoke\nfunc Migrate(db *DB) {}\n",
+		"internal/http/srv.go":   "package http\n\nimport \"example.com/app/internal/store\"\n\n//autowire:provide group=handlers\nfunc NewUsers(db *store.DB) Handler { return nil }\n\n//autowire:provide group=handlers\nfunc NewHealth() Handler { return nil }\n\ntype Handler interface{}\n\n//autowire:invoke\nfunc Serve(h []Handler) {}\n",
+		"internal/log/log.go":    "package log\n\ntype Logger struct{}\n\n//autowire:provide\nfunc New() *Logger { return &Logger{} }\n",
+		"internal/mail/mail.go":  "package mail\n\ntype Mailer struct{}\n\n//autowire:provide\nfunc New() *Mailer { return &Mailer{} }\n",
+		"pkg/clock/clock.go":     "package clock\n\ntype Clock struct{}\n\n//autowire:provide\nfunc New() *Clock { return &Clock{} }\n",
+	})
+	cfg := Config{
+		ScanDirs:   []string{filepath.Join(dir, "internal"), filepath.Join(dir, "pkg")},
+		OutDir:     filepath.Join(dir, "cmd"),
+		OutputName: "app_gen.go",
+	}
+
+	require.NoError(t, New(cfg).SelfCheck())
+
+	reverse := func(n int, swap func(i, j int)) {
+		for i := 0; i < n/2; i++ {
+			swap(i, n-1-i)
+		}
+	}
+	unshuffled := New(cfg)
+	expected, err := unshuffled.Generate()
+	require.NoError(t, err)
+	cfg.Shuffle = reverse
+	reversed := New(cfg)
+	shuffled, err := reversed.Generate()
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(shuffled))
+
+	packages := func(p *Pipeline) []string {
+		parsed, err := p.Parse()
+		require.NoError(t, err)
+		var paths []string
+		for _, provider := range parsed.Providers {
+			paths = append(paths, provider.ImportPath)
+		}
+		return slices.Compact(paths)
+	}
+	forward := packages(unshuffled)
+	backward := packages(reversed)
+	slices.Reverse(backward)
+	assert.Equal(t, forward, backward, "the shuffled order reaches the merged parse result")
+}
+
+func TestPipeline_Cache(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":            "package main\n\nfunc main() {}\n",
+		"internal/config/cfg.go": "package config\n\ntype Config struct{}\n\n//autowire:provide\nfunc NewConfig() *Config { return &Config{} }\n",
+		"internal/db/db.go":      "package db\n\nimport \"example.com/app/internal/config\"\n\ntype Settings = config.Config\n\ntype DB struct{}\n\n//autowire:provide\nfunc NewDB(s *Settings) *DB { return &DB{} }\n",
+		"internal/log/log.go":    "package log\n\ntype Logger struct{}\n\n//autowire:provide\nfunc NewLogger() *Logger { return &Logger{} }\n",
+	})
+	t.Chdir(dir)
+
+	var calls [][2]int
+	cfg := Config{
+		ScanDirs:   []string{"internal"},
+		OutDir:     "cmd",
+		OutputName: "app_gen.go",
+		Cache:      true,
+		Progress:   func(_ string, done, total int) { calls = append(calls, [2]int{done, total}) },
+	}
+	run := func() string {
+		t.Helper()
+		calls = nil
+		code, err := New(cfg).Generate()
+		require.NoError(t, err)
+		return string(code)
+	}
+
+	first := run()
+	assert.Len(t, calls, 3)
+	assert.FileExists(t, filepath.Join(dir, ".autowire", "cache.json"))
+	assert.FileExists(t, filepath.Join(dir, ".autowire", ".gitignore"))
+
+	assert.Equal(t, first, run())
+	assert.Empty(t, calls, "unchanged packages are not parsed again")
+
+	cfgFile := filepath.Join(dir, "internal", "config", "cfg.go")
+	require.NoError(t, os.WriteFile(cfgFile, []byte("package config\n\ntype Config struct{}\n\n//autowire:provide\nfunc LoadConfig() *Config { return &Config{} }\n"), 0644))
+	updated := run()
+	assert.Equal(t, [][2]int{{2, 3}, {3, 3}}, calls, "the changed package and its importer are parsed again")
+	assert.Contains(t, updated, "config.LoadConfig()")
+
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, ".autowire")))
+	cfg.Cache = false
+	assert.Equal(t, updated, run())
+	assert.Len(t, calls, 3)
+	assert.NoDirExists(t, filepath.Join(dir, ".autowire"))
+}
+
+func TestPipeline_CacheUnscannedTypes(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":            "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":       "package main\n\nfunc main() {}\n",
+		"models/m.go":       "package models\n\ntype A struct{}\n\ntype B struct{}\n\ntype Store = A\n",
+		"internal/a/a.go":   "package a\n\nimport \"example.com/app/models\"\n\n//autowire:provide\nfunc NewA() *models.A { return nil }\n",
+		"internal/b/b.go":   "package b\n\nimport \"example.com/app/models\"\n\n//autowire:provide\nfunc NewB() *models.B { return nil }\n",
+		"internal/svc/s.go": "package svc\n\nimport \"example.com/app/models\"\n\ntype S struct{}\n\n//autowire:provide\nfunc NewS(*models.Store) *S { return nil }\n",
+	})
+	t.Chdir(dir)
+
+	cfg := Config{ScanDirs: []string{"internal"}, OutDir: "cmd", OutputName: "app_gen.go", Cache: true}
+	code, err := New(cfg).Generate()
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "svc.NewS(a)")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "models", "m.go"), []byte("package models\n\ntype A struct{}\n\ntype B struct{}\n\ntype Store = B\n"), 0644))
+	code, err = New(cfg).Generate()
+	require.NoError(t, err)
+	assert.Contains(t, string(code), "svc.NewS(b)", "a changed alias in an unscanned package invalidates the cache")
+}
+
+func TestPipeline_SyntaxErrors(t *testing.T) {
+	source := fstest.MapFS{
+		"cmd/main.go":            {Data: []byte("package main\n")},
+		"internal/store/db.go":   {Data: []byte("package store\n\ntype DB struct{}\n\n//autowire:provide\nfunc NewDB() *DB { return nil }\n")},
+		"internal/store/wip.go":  {Data: []byte("package store\n\nfunc wip(\n")},
+		"internal/api/api.go":    {Data: []byte("package api\n\nimport \"example.com/app/internal/store\"\n\n//autowire:provide\nfunc NewAPI(db *store.DB, c *Cache) *API { return nil }\n\ntype API struct{}\n")},
+		"internal/api/cache.go":  {Data: []byte("package api\n\ntype Cache struct{}\n")},
+		"internal/api/broken.go": {Data: []byte("package api\n\n//autowire:provide\nfunc NewCache() *Cache {\n")},
+	}
+	cfg := Config{Source: source, SourceImportPath: "example.com/app", ScanDirs: []string{"internal/store"}, OutDir: "cmd", OutputName: "app_gen.go"}
+
+	result, err := New(cfg).Analyze()
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Diagnostics)
+	assert.Equal(t, "wip.go:3: warning: skipping wip.go: expected ')', found 'EOF' [syntax-error]", result.Diagnostics[0].String())
+
+	cfg.ScanDirs = []string{"internal"}
+	_, err = New(cfg).Analyze()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "note: providers in these files were not seen:\n  api/broken.go:4: warning: skipping broken.go")
+}
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing os.FileMode
+		mode     os.FileMode
+	}{
+		{"new file", 0, 0644},
+		{"read-only", 0, 0444},
+		{"overwrite read-only", 0444, 0444},
+		{"make writable", 0444, 0644},
+		{"make read-only", 0644, 0400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app_gen.go")
+			if tt.existing != 0 {
+				require.NoError(t, os.WriteFile(path, []byte("old"), tt.existing))
+				require.NoError(t, os.Chmod(path, tt.existing))
+			}
+			require.NoError(t, WriteFile(path, []byte("new"), tt.mode))
+
+			content, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, "new", string(content))
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.mode, info.Mode().Perm())
+		})
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Owner
+		wantErr string
+	}{
+		{"uid", "1000", Owner{UID: 1000, GID: -1}, ""},
+		{"uid and gid", "1000:100", Owner{UID: 1000, GID: 100}, ""},
+		{"gid only", ":100", Owner{UID: -1, GID: 100}, ""},
+		{"empty", ":", Owner{}, `invalid owner ":"`},
+		{"too many parts", "1:2:3", Owner{}, `invalid owner "1:2:3"`},
+		{"unknown user", "no-such-user-autowire", Owner{}, "no-such-user-autowire"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOwner(tt.in)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *got)
+		})
+	}
+}
+
+func TestPipeline_FileOwner(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":      "module example.com/app\n\ngo 1.22\n",
+		"svc/svc.go":  "package svc\n\ntype S struct{}\n\n//autowire:provide\nfunc NewS() *S { return &S{} }\n",
+		"cmd/main.go": "package main\n\nimport \"example.com/app/svc\"\n\n//autowire:invoke\nfunc Run(*svc.S) {}\n",
+	})
+	owner, err := ParseOwner(":" + strconv.Itoa(os.Getgid()))
+	require.NoError(t, err)
+
+	path, err := New(Config{
+		ScanDirs:   []string{filepath.Join(dir, "svc"), filepath.Join(dir, "cmd")},
+		OutDir:     filepath.Join(dir, "cmd"),
+		OutputName: "app_gen.go",
+		FileMode:   0644,
+		FileOwner:  owner,
+	}).Write()
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
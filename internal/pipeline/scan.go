@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/cache"
+)
+
+type scanTarget struct {
+	dir     string
+	shallow bool
+	pattern string
+}
+
+type scanBatch struct {
+	name    string
+	dirs    []string
+	root    string
+	shallow bool
+}
+
+func isPattern(dir string) bool {
+	return strings.Contains(dir, "...") || strings.ContainsAny(dir, "*?[")
+}
+
+func ScanRoot(pattern string) string {
+	if !isPattern(pattern) {
+		return pattern
+	}
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, part := range parts {
+		if isPattern(part) {
+			if i == 0 {
+				return "."
+			}
+			return filepath.FromSlash(strings.Join(parts[:i], "/"))
+		}
+	}
+	return pattern
+}
+
+func expandScanDirs(patterns []string) ([]scanTarget, error) {
+	var targets []scanTarget
+	for _, pattern := range patterns {
+		switch {
+		case strings.Contains(pattern, "..."):
+			dirs, err := listPackageDirs(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, dir := range dirs {
+				targets = append(targets, scanTarget{dir: dir, shallow: true, pattern: pattern})
+			}
+		case isPattern(pattern):
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid scan pattern %s: %w", pattern, err)
+			}
+			n := len(targets)
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.IsDir() {
+					targets = append(targets, scanTarget{dir: match, shallow: true, pattern: pattern})
+				}
+			}
+			if len(targets) == n {
+				return nil, fmt.Errorf("scan pattern %s matched no directories", pattern)
+			}
+		default:
+			targets = append(targets, scanTarget{dir: pattern})
+		}
+	}
+	return dedupeTargets(targets), nil
+}
+
+func batchTargets(targets []scanTarget) []scanBatch {
+	var batches []scanBatch
+	byKey := make(map[string]int)
+	for _, t := range targets {
+		if !t.shallow {
+			batches = append(batches, scanBatch{name: t.dir, dirs: []string{t.dir}})
+			continue
+		}
+		abs, err := filepath.Abs(t.dir)
+		if err != nil {
+			batches = append(batches, scanBatch{name: t.dir, dirs: []string{t.dir}, shallow: true})
+			continue
+		}
+		root, ok := cache.ModuleRoot(abs)
+		if !ok {
+			batches = append(batches, scanBatch{name: t.dir, dirs: []string{t.dir}, shallow: true})
+			continue
+		}
+		key := t.pattern + "\x00" + root
+		if i, ok := byKey[key]; ok {
+			batches[i].dirs = append(batches[i].dirs, t.dir)
+			continue
+		}
+		byKey[key] = len(batches)
+		batches = append(batches, scanBatch{name: t.pattern, dirs: []string{t.dir}, root: root, shallow: true})
+	}
+	return batches
+}
+
+func listPackageDirs(pattern string) ([]string, error) {
+	out, err := exec.Command("go", "list", "-e", "-f", "{{.Dir}}", pattern).Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok && len(exit.Stderr) > 0 {
+			return nil, fmt.Errorf("expanding scan pattern %s: %s", pattern, strings.TrimSpace(string(exit.Stderr)))
+		}
+		return nil, fmt.Errorf("expanding scan pattern %s: %w", pattern, err)
+	}
+	var dirs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if dir := strings.TrimSpace(line); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("scan pattern %s matched no packages", pattern)
+	}
+	return dirs, nil
+}
+
+func dedupeTargets(targets []scanTarget) []scanTarget {
+	abs := make([]string, len(targets))
+	for i, t := range targets {
+		abs[i] = t.dir
+		if dir, err := filepath.Abs(t.dir); err == nil {
+			abs[i] = dir
+		}
+	}
+
+	var recursive []string
+	for i, t := range targets {
+		if !t.shallow {
+			recursive = append(recursive, abs[i])
+		}
+	}
+	covered := func(dir string) bool {
+		return slices.ContainsFunc(recursive, func(root string) bool {
+			rel, err := filepath.Rel(root, dir)
+			return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+		})
+	}
+
+	seen := make(map[string]bool)
+	var result []scanTarget
+	for i, t := range targets {
+		if seen[abs[i]] || t.shallow && covered(abs[i]) {
+			continue
+		}
+		seen[abs[i]] = true
+		result = append(result, t)
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanRoot(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{pattern: "./internal", expected: "./internal"},
+		{pattern: "./...", expected: "."},
+		{pattern: "...", expected: "."},
+		{pattern: "./internal/...", expected: "./internal"},
+		{pattern: "../services/*/api", expected: filepath.FromSlash("../services")},
+		{pattern: "/src/app/...", expected: filepath.FromSlash("/src/app")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ScanRoot(tt.pattern))
+		})
+	}
+}
+
+func TestExpandScanDirs(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                   "module example.com/app\n\ngo 1.22\n",
+		"internal/a/a.go":          "package a\n",
+		"internal/a/nested/n.go":   "package nested\n",
+		"internal/b/b.go":          "package b\n",
+		"internal/testdata/t.go":   "package testdata\n",
+		"services/billing/b.go":    "package billing\n",
+		"services/search/s.go":     "package search\n",
+		"services/README.md":       "services\n",
+		"services/search/api/a.go": "package api\n",
+	})
+	t.Chdir(dir)
+
+	tests := []struct {
+		name        string
+		patterns    []string
+		expected    []scanTarget
+		expectedErr string
+	}{
+		{
+			name:     "literal directories are scanned recursively",
+			patterns: []string{"./internal"},
+			expected: []scanTarget{{dir: "./internal"}},
+		},
+		{
+			name:     "package pattern",
+			patterns: []string{"./internal/..."},
+			expected: []scanTarget{
+				{dir: filepath.Join(dir, "internal", "a"), shallow: true, pattern: "./internal/..."},
+				{dir: filepath.Join(dir, "internal", "a", "nested"), shallow: true, pattern: "./internal/..."},
+				{dir: filepath.Join(dir, "internal", "b"), shallow: true, pattern: "./internal/..."},
+			},
+		},
+		{
+			name:     "glob",
+			patterns: []string{"services/*"},
+			expected: []scanTarget{
+				{dir: filepath.Join("services", "billing"), shallow: true, pattern: "services/*"},
+				{dir: filepath.Join("services", "search"), shallow: true, pattern: "services/*"},
+			},
+		},
+		{
+			name:     "packages covered by a recursive directory",
+			patterns: []string{"./services/...", "services", "services/*"},
+			expected: []scanTarget{{dir: "services"}},
+		},
+		{
+			name:        "pattern without packages",
+			patterns:    []string{"./missing/..."},
+			expectedErr: "scan pattern ./missing/... matched no packages",
+		},
+		{
+			name:        "glob without directories",
+			patterns:    []string{"services/*.txt"},
+			expectedErr: "scan pattern services/*.txt matched no directories",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := expandScanDirs(tt.patterns)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, targets)
+		})
+	}
+}
+
+func TestBatchTargets(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":           "module example.com/app\n\ngo 1.22\n",
+		"tools/go.mod":     "module example.com/tools\n\ngo 1.22\n",
+		"internal/a/a.go":  "package a\n",
+		"internal/b/b.go":  "package b\n",
+		"tools/gen/gen.go": "package gen\n",
+	})
+	outside := t.TempDir()
+
+	targets := []scanTarget{
+		{dir: "./cmd"},
+		{dir: filepath.Join(dir, "internal", "a"), shallow: true, pattern: "./..."},
+		{dir: filepath.Join(dir, "tools", "gen"), shallow: true, pattern: "./..."},
+		{dir: filepath.Join(dir, "internal", "b"), shallow: true, pattern: "./..."},
+		{dir: filepath.Join(dir, "internal", "b"), shallow: true, pattern: "internal/*"},
+		{dir: outside, shallow: true, pattern: "*"},
+	}
+	assert.Equal(t, []scanBatch{
+		{name: "./cmd", dirs: []string{"./cmd"}},
+		{name: "./...", dirs: []string{filepath.Join(dir, "internal", "a"), filepath.Join(dir, "internal", "b")}, root: dir, shallow: true},
+		{name: "./...", dirs: []string{filepath.Join(dir, "tools", "gen")}, root: filepath.Join(dir, "tools"), shallow: true},
+		{name: "internal/*", dirs: []string{filepath.Join(dir, "internal", "b")}, root: dir, shallow: true},
+		{name: outside, dirs: []string{outside}, shallow: true},
+	}, batchTargets(targets))
+}
+
+func TestPipeline_ScanPattern(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":                   "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go":              "package main\n\nfunc main() {}\n",
+		"internal/config/cfg.go":   "package config\n\n//autowire:provide\ntype Config struct{}\n",
+		"internal/config/x/x.go":   "package x\n\n//autowire:provide\ntype X struct{}\n",
+		"internal/server/srv.go":   "package server\n\n//autowire:provide\ntype Server struct{}\n",
+		"internal/server/old/o.go": "package old\n\n//autowire:provide\ntype Old struct{}\n",
+	})
+	t.Chdir(dir)
+
+	totals := make(map[string]int)
+	p := New(Config{
+		ScanDirs:   []string{"./internal/config/...", "internal/*"},
+		OutDir:     "cmd",
+		OutputName: "app_gen.go",
+		Progress:   func(name string, _, total int) { totals[name] = total },
+	})
+	parsed, err := p.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"./internal/config/...": 2, "internal/*": 1}, totals, "the packages of a pattern are scanned as one batch")
+
+	var names []string
+	for _, provider := range parsed.Providers {
+		names = append(names, provider.Name)
+	}
+	assert.ElementsMatch(t, []string{"Config", "X", "Server"}, names)
+}
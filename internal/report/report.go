@@ -0,0 +1,228 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/diag"
+)
+
+type Format int
+
+const (
+	FormatText Format = iota
+	FormatGitHub
+	FormatGitLab
+	FormatJSON
+)
+
+const errorCode = "wiring-error"
+
+var positionPattern = regexp.MustCompile(`([^\s(]+\.go):(\d+)(?::\d+)?(?:: |\))`)
+
+var gitlabSeverities = map[diag.Severity]string{
+	diag.SeverityInfo:    "info",
+	diag.SeverityWarning: "minor",
+	diag.SeverityError:   "critical",
+}
+
+type Reporter struct {
+	format      Format
+	out         io.Writer
+	errOut      io.Writer
+	base        string
+	defaultPath string
+	collected   []diag.Diagnostic
+}
+
+func New(format Format, out, errOut io.Writer, base string) *Reporter {
+	return &Reporter{format: format, out: out, errOut: errOut, base: base}
+}
+
+func (r *Reporter) SetDefaultPath(path string) {
+	r.defaultPath = path
+}
+
+func (r *Reporter) Report(d diag.Diagnostic) {
+	d.File = r.relative(d.File)
+	switch r.format {
+	case FormatText:
+		fmt.Fprintf(r.errOut, "autowire: %s\n", d)
+	case FormatGitHub:
+		fmt.Fprintln(r.out, githubCommand(d))
+	case FormatGitLab, FormatJSON:
+		r.collected = append(r.collected, d)
+	}
+}
+
+func (r *Reporter) Fail(err error) {
+	if r.format == FormatText {
+		return
+	}
+	for _, d := range FromError(err) {
+		r.Report(d)
+	}
+}
+
+func (r *Reporter) Flush() error {
+	switch r.format {
+	case FormatGitLab:
+		return r.encode(r.gitlabIssues())
+	case FormatJSON:
+		return r.encode(r.jsonDiagnostics())
+	}
+	return nil
+}
+
+func (r *Reporter) encode(v any) error {
+	enc := json.NewEncoder(r.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (r *Reporter) jsonDiagnostics() []jsonDiagnostic {
+	diagnostics := make([]jsonDiagnostic, 0, len(r.collected))
+	for _, d := range r.collected {
+		diagnostics = append(diagnostics, jsonDiagnostic{
+			Severity: d.Severity.String(),
+			Code:     d.Code,
+			Message:  d.Message,
+			File:     filepath.ToSlash(d.File),
+			Line:     d.Line,
+		})
+	}
+	return diagnostics
+}
+
+func (r *Reporter) gitlabIssues() []gitlabIssue {
+	issues := make([]gitlabIssue, 0, len(r.collected))
+	for _, d := range r.collected {
+		path := d.File
+		if path == "" {
+			path = r.relative(r.defaultPath)
+		}
+		line := max(d.Line, 1)
+		sum := sha256.Sum256([]byte(d.Code + "\x00" + path + "\x00" + d.Message))
+		issue := gitlabIssue{
+			Description: d.Message,
+			CheckName:   d.Code,
+			Fingerprint: hex.EncodeToString(sum[:]),
+			Severity:    gitlabSeverities[d.Severity],
+		}
+		issue.Location.Path = filepath.ToSlash(path)
+		issue.Location.Lines.Begin = line
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+func (r *Reporter) relative(path string) string {
+	if path == "" || r.base == "" {
+		return path
+	}
+	if !filepath.IsAbs(path) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return path
+		}
+		path = abs
+	}
+	if rel, err := filepath.Rel(r.base, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+type jsonDiagnostic struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+type gitlabIssue struct {
+	Description string `json:"description"`
+	CheckName   string `json:"check_name"`
+	Fingerprint string `json:"fingerprint"`
+	Severity    string `json:"severity"`
+	Location    struct {
+		Path  string `json:"path"`
+		Lines struct {
+			Begin int `json:"begin"`
+		} `json:"lines"`
+	} `json:"location"`
+}
+
+func FromError(err error) []diag.Diagnostic {
+	var diagnostics []diag.Diagnostic
+	walkLeaves(err, "", func(message string) {
+		d := diag.Diagnostic{Severity: diag.SeverityError, Code: errorCode, Message: message}
+		if m := positionPattern.FindStringSubmatch(message); m != nil {
+			d.File = m[1]
+			d.Line, _ = strconv.Atoi(m[2])
+		}
+		diagnostics = append(diagnostics, d)
+	})
+	return diagnostics
+}
+
+func walkLeaves(err error, prefix string, leaf func(message string)) {
+	switch e := err.(type) {
+	case *diag.List:
+		for _, child := range e.Errors {
+			walkLeaves(child, prefix+e.Title+": ", leaf)
+		}
+		return
+	case interface{ Unwrap() []error }:
+		for _, child := range e.Unwrap() {
+			walkLeaves(child, prefix, leaf)
+		}
+		return
+	case interface{ Unwrap() error }:
+		inner := e.Unwrap()
+		if inner != nil && strings.HasSuffix(err.Error(), inner.Error()) {
+			walkLeaves(inner, prefix+strings.TrimSuffix(err.Error(), inner.Error()), leaf)
+			return
+		}
+	}
+	leaf(prefix + err.Error())
+}
+
+func githubCommand(d diag.Diagnostic) string {
+	command := "notice"
+	switch d.Severity {
+	case diag.SeverityWarning:
+		command = "warning"
+	case diag.SeverityError:
+		command = "error"
+	}
+
+	props := []string{"title=" + escapeProperty("autowire "+d.Code)}
+	if d.File != "" {
+		props = append(props, "file="+escapeProperty(filepath.ToSlash(d.File)))
+		if d.Line > 0 {
+			props = append(props, "line="+strconv.Itoa(d.Line))
+		}
+	}
+	return fmt.Sprintf("::%s %s::%s", command, strings.Join(props, ","), escapeData(d.Message))
+}
+
+func escapeData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+func escapeProperty(s string) string {
+	s = escapeData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
@@ -0,0 +1,211 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/diag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromError(t *testing.T) {
+	located := func(message, file string, line int) diag.Diagnostic {
+		return diag.Diagnostic{Severity: diag.SeverityError, Code: errorCode, Message: message, File: file, Line: line}
+	}
+	tests := []struct {
+		name     string
+		err      error
+		expected []diag.Diagnostic
+	}{
+		{
+			name:     "without position",
+			err:      errors.New("analyzing: missing dependencies"),
+			expected: []diag.Diagnostic{located("analyzing: missing dependencies", "", 0)},
+		},
+		{
+			name: "with position",
+			err:  errors.New("parsing ./internal: /src/app/store/db.go:12:6: Cache: not supported"),
+			expected: []diag.Diagnostic{
+				located("parsing ./internal: /src/app/store/db.go:12:6: Cache: not supported", "/src/app/store/db.go", 12),
+			},
+		},
+		{
+			name: "with located name",
+			err:  errors.New("analyzing: missing dependencies:\n  NewCache (/src/app/store/cache.go:8) requires *store.DB"),
+			expected: []diag.Diagnostic{
+				located("analyzing: missing dependencies:\n  NewCache (/src/app/store/cache.go:8) requires *store.DB", "/src/app/store/cache.go", 8),
+			},
+		},
+		{
+			name: "list",
+			err: fmt.Errorf("analyzing: %w", diag.NewList("missing dependencies", []string{
+				"NewA (/src/app/a.go:9) requires *store.DB",
+				"NewB (/src/app/b.go:4) requires *cache.Cache",
+			})),
+			expected: []diag.Diagnostic{
+				located("analyzing: missing dependencies: NewA (/src/app/a.go:9) requires *store.DB", "/src/app/a.go", 9),
+				located("analyzing: missing dependencies: NewB (/src/app/b.go:4) requires *cache.Cache", "/src/app/b.go", 4),
+			},
+		},
+		{
+			name: "join",
+			err: fmt.Errorf("parsing ./internal: %w", errors.Join(
+				errors.New("/src/app/a.go:3:1: bad"),
+				errors.New("/src/app/b.go:5:2: worse"),
+			)),
+			expected: []diag.Diagnostic{
+				located("parsing ./internal: /src/app/a.go:3:1: bad", "/src/app/a.go", 3),
+				located("parsing ./internal: /src/app/b.go:5:2: worse", "/src/app/b.go", 5),
+			},
+		},
+		{
+			name:     "wrapped with suffix",
+			err:      fmt.Errorf("%w (see above)", errors.Join(errors.New("a"), errors.New("b"))),
+			expected: []diag.Diagnostic{located("a\nb (see above)", "", 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FromError(tt.err))
+		})
+	}
+}
+
+func TestReporter_Text(t *testing.T) {
+	var out, errOut bytes.Buffer
+	r := New(FormatText, &out, &errOut, "/src/app")
+
+	r.Report(diag.Diagnostic{Severity: diag.SeverityWarning, Code: "deep-chain", Message: "too deep"})
+	r.Fail(errors.New("broken"))
+	require.NoError(t, r.Flush())
+
+	assert.Empty(t, out.String())
+	assert.Equal(t, "autowire: warning: too deep [deep-chain]\n", errOut.String())
+}
+
+func TestReporter_GitHub(t *testing.T) {
+	var out, errOut bytes.Buffer
+	r := New(FormatGitHub, &out, &errOut, "/src/app")
+
+	r.Report(diag.Diagnostic{Severity: diag.SeverityInfo, Code: "hint", Message: "50% done"})
+	r.Report(diag.Diagnostic{Severity: diag.SeverityWarning, Code: "deep-chain", Message: "a:\n  b, c"})
+	r.Fail(errors.New("parsing: /src/app/store/db.go:12:6: bad"))
+	require.NoError(t, r.Flush())
+
+	assert.Equal(t, "::notice title=autowire hint::50%25 done\n"+
+		"::warning title=autowire deep-chain::a:%0A  b, c\n"+
+		"::error title=autowire wiring-error,file=store/db.go,line=12::parsing: /src/app/store/db.go:12:6: bad\n", out.String())
+	assert.Empty(t, errOut.String())
+}
+
+func TestReporter_GitLab(t *testing.T) {
+	var out, errOut bytes.Buffer
+	r := New(FormatGitLab, &out, &errOut, "/src/app")
+	r.SetDefaultPath("/src/app/cmd/app_gen.go")
+
+	r.Report(diag.Diagnostic{Severity: diag.SeverityWarning, Code: "deep-chain", Message: "too deep"})
+	r.Fail(errors.New("parsing: /src/app/store/db.go:12:6: bad"))
+	assert.Empty(t, out.String(), "issues are written on flush")
+	require.NoError(t, r.Flush())
+
+	expected := `[
+  {
+    "description": "too deep",
+    "check_name": "deep-chain",
+    "fingerprint": "%s",
+    "severity": "minor",
+    "location": {
+      "path": "cmd/app_gen.go",
+      "lines": {
+        "begin": 1
+      }
+    }
+  },
+  {
+    "description": "parsing: /src/app/store/db.go:12:6: bad",
+    "check_name": "wiring-error",
+    "fingerprint": "%s",
+    "severity": "critical",
+    "location": {
+      "path": "store/db.go",
+      "lines": {
+        "begin": 12
+      }
+    }
+  }
+]
+`
+	assert.Len(t, r.collected, 2)
+	var issues []gitlabIssue
+	require.NoError(t, json.Unmarshal(out.Bytes(), &issues))
+	require.Len(t, issues, 2)
+	assert.NotEqual(t, issues[0].Fingerprint, issues[1].Fingerprint)
+	assert.Equal(t, fmt.Sprintf(expected, issues[0].Fingerprint, issues[1].Fingerprint), out.String())
+}
+
+func TestReporter_GitLabEmpty(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, New(FormatGitLab, &out, &out, "").Flush())
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestReporter_JSON(t *testing.T) {
+	var out, errOut bytes.Buffer
+	r := New(FormatJSON, &out, &errOut, "/src/app")
+
+	r.Report(diag.Diagnostic{Severity: diag.SeverityWarning, Code: "deep-chain", Message: "too deep"})
+	r.Fail(errors.New("parsing: /src/app/store/db.go:12:6: bad"))
+	assert.Empty(t, out.String(), "diagnostics are written on flush")
+	require.NoError(t, r.Flush())
+
+	expected := `[
+  {
+    "severity": "warning",
+    "code": "deep-chain",
+    "message": "too deep"
+  },
+  {
+    "severity": "error",
+    "code": "wiring-error",
+    "message": "parsing: /src/app/store/db.go:12:6: bad",
+    "file": "store/db.go",
+    "line": 12
+  }
+]
+`
+	assert.Equal(t, expected, out.String())
+	assert.Empty(t, errOut.String())
+}
+
+func TestReporter_JSONEmpty(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, New(FormatJSON, &out, &out, "").Flush())
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestReporter_RelativeToBase(t *testing.T) {
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	var out bytes.Buffer
+	r := New(FormatGitHub, &out, &out, filepath.Dir(cwd))
+
+	r.Report(diag.Diagnostic{Severity: diag.SeverityWarning, Code: "deep-chain", Message: "too deep", File: "report.go", Line: 3})
+	r.Fail(errors.Join(
+		fmt.Errorf("%s:9:1: a", filepath.Join(cwd, "a.go")),
+		fmt.Errorf("%s:4:1: b", filepath.Join(cwd, "b.go")),
+	))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "file=report/report.go,line=3")
+	assert.Contains(t, lines[1], "file=report/a.go,line=9")
+	assert.Contains(t, lines[2], "file=report/b.go,line=4")
+}
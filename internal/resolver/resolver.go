@@ -3,6 +3,7 @@ package resolver
 import (
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/eloonstra/autowire/internal/xsync"
@@ -11,17 +12,78 @@ import (
 const goListOutputParts = 2
 
 type Resolver struct {
-	cache xsync.Map[string, string]
+	cache   xsync.ShardedMap[string, string]
+	pending xsync.ShardedMap[string, chan struct{}]
+	limit   chan struct{}
+	offline bool
 }
 
 func New() *Resolver {
-	return &Resolver{}
+	return &Resolver{limit: make(chan struct{}, runtime.NumCPU())}
+}
+
+func NewStatic(names map[string]string) *Resolver {
+	r := &Resolver{offline: true}
+	for path, name := range names {
+		r.cache.Store(path, name)
+	}
+	return r
+}
+
+func (r *Resolver) Names() map[string]string {
+	names := make(map[string]string)
+	r.cache.Range(func(path, name string) bool {
+		names[path] = name
+		return true
+	})
+	return names
+}
+
+func (r *Resolver) Register(importPath, name string) {
+	r.cache.Store(importPath, name)
+}
+
+func (r *Resolver) Prefetch(importPaths ...string) {
+	if r.offline {
+		return
+	}
+	var batch []string
+	var pending []chan struct{}
+	for _, path := range importPaths {
+		if _, ok := r.cache.Load(path); ok {
+			continue
+		}
+		done := make(chan struct{})
+		if _, loaded := r.pending.LoadOrStore(path, done); loaded {
+			continue
+		}
+		batch = append(batch, path)
+		pending = append(pending, done)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	go func() {
+		r.limit <- struct{}{}
+		names := r.resolveBatch(batch)
+		<-r.limit
+		for i, path := range batch {
+			r.cache.LoadOrStore(path, names[path])
+			close(pending[i])
+		}
+	}()
 }
 
 func (r *Resolver) ResolveName(importPath string) string {
 	if name, ok := r.cache.Load(importPath); ok {
 		return name
 	}
+	if done, ok := r.pending.Load(importPath); ok {
+		<-done
+		name, _ := r.cache.Load(importPath)
+		return name
+	}
 
 	name := r.resolve(importPath)
 	actual, _ := r.cache.LoadOrStore(importPath, name)
@@ -29,6 +91,10 @@ func (r *Resolver) ResolveName(importPath string) string {
 }
 
 func (r *Resolver) resolve(path string) string {
+	if r.offline {
+		return fallbackName(path)
+	}
+
 	cmd := exec.Command("go", "list", "-e", "-f", "{{.ImportPath}} {{.Name}}", path)
 	out, err := cmd.Output()
 	if err != nil {
@@ -44,6 +110,26 @@ func (r *Resolver) resolve(path string) string {
 	return parts[1]
 }
 
+func (r *Resolver) resolveBatch(paths []string) map[string]string {
+	names := make(map[string]string, len(paths))
+	args := append([]string{"list", "-e", "-f", "{{.ImportPath}} {{.Name}}"}, paths...)
+	if out, err := exec.Command("go", args...).Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			parts := strings.SplitN(strings.TrimSpace(line), " ", goListOutputParts)
+			if len(parts) == goListOutputParts && parts[1] != "" {
+				names[parts[0]] = parts[1]
+			}
+		}
+	}
+
+	for _, path := range paths {
+		if _, ok := names[path]; !ok {
+			names[path] = r.resolve(path)
+		}
+	}
+	return names
+}
+
 func fallbackName(importPath string) string {
 	base := filepath.Base(importPath)
 	if isVersionSuffix(base) {
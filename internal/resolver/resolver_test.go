@@ -1,9 +1,14 @@
 package resolver
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestResolver_ResolveName_VersionedPath(t *testing.T) {
@@ -51,6 +56,78 @@ func TestResolver_ResolveName_UnknownPackageFallsBackWithVersionStripped(t *test
 	assert.Equal(t, "package", name)
 }
 
+func TestResolver_Static(t *testing.T) {
+	r := NewStatic(map[string]string{"example.com/lib/go-yaml": "yaml"})
+
+	assert.Equal(t, "yaml", r.ResolveName("example.com/lib/go-yaml"))
+	assert.Equal(t, "pkg", r.ResolveName("example.com/pkg/v2"))
+	assert.Equal(t, map[string]string{
+		"example.com/lib/go-yaml": "yaml",
+		"example.com/pkg/v2":      "pkg",
+	}, r.Names())
+}
+
+func TestResolver_Register(t *testing.T) {
+	r := NewStatic(nil)
+	assert.Equal(t, "api", r.ResolveName("example.com/app/api"))
+
+	r.Register("example.com/app/api", "handlers")
+	assert.Equal(t, "handlers", r.ResolveName("example.com/app/api"))
+}
+
+func TestResolver_Prefetch(t *testing.T) {
+	r := New()
+
+	r.Prefetch("net/http", "encoding/json", "net/http")
+
+	assert.Equal(t, "http", r.ResolveName("net/http"))
+	assert.Equal(t, "json", r.ResolveName("encoding/json"))
+	assert.Equal(t, map[string]string{"net/http": "http", "encoding/json": "json"}, r.Names())
+}
+
+func TestResolver_PrefetchBatches(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake go binary is a shell script")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls.log")
+	script := `#!/bin/sh
+echo "$*" >> "` + log + `"
+shift 4
+for p in "$@"; do
+	case "$p" in
+	example.com/broken) echo "$p " ;;
+	*) echo "$p ${p##*/}x" ;;
+	esac
+done
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go"), []byte(script), 0755))
+	t.Setenv("PATH", dir)
+
+	r := New()
+	r.Prefetch("example.com/a", "example.com/b", "example.com/broken")
+
+	assert.Equal(t, "ax", r.ResolveName("example.com/a"))
+	assert.Equal(t, "bx", r.ResolveName("example.com/b"))
+	assert.Equal(t, "broken", r.ResolveName("example.com/broken"))
+
+	calls, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"list -e -f {{.ImportPath}} {{.Name}} example.com/a example.com/b example.com/broken",
+		"list -e -f {{.ImportPath}} {{.Name}} example.com/broken",
+	}, strings.Split(strings.TrimSpace(string(calls)), "\n"))
+}
+
+func TestResolver_PrefetchOffline(t *testing.T) {
+	r := NewStatic(nil)
+
+	r.Prefetch("example.com/pkg/v2")
+
+	assert.Empty(t, r.Names())
+	assert.Equal(t, "pkg", r.ResolveName("example.com/pkg/v2"))
+}
+
 func TestFallbackName(t *testing.T) {
 	tests := []struct {
 		name       string
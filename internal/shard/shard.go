@@ -0,0 +1,134 @@
+package shard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+const formatVersion = 1
+
+type Shard struct {
+	Name     string
+	ScanDirs []string
+	Parsed   *types.ParseResult
+	Packages map[string]string
+}
+
+type file struct {
+	Version  int                `json:"version"`
+	ScanDirs []string           `json:"scanDirs"`
+	Parsed   *types.ParseResult `json:"parsed"`
+	Packages map[string]string  `json:"packages"`
+}
+
+func Write(path string, s *Shard) error {
+	data, err := json.MarshalIndent(file{
+		Version:  formatVersion,
+		ScanDirs: s.ScanDirs,
+		Parsed:   s.Parsed,
+		Packages: s.Packages,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding shard: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func Read(path string) (*Shard, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	if f.Version != formatVersion {
+		return nil, fmt.Errorf("%s: unsupported shard version %d, expected %d", path, f.Version, formatVersion)
+	}
+	if f.Parsed == nil {
+		return nil, fmt.Errorf("%s: missing parse result", path)
+	}
+	return &Shard{Name: path, ScanDirs: f.ScanDirs, Parsed: f.Parsed, Packages: f.Packages}, nil
+}
+
+func Merge(shards []*Shard) (*types.ParseResult, error) {
+	merged := &types.ParseResult{}
+	providers := make(map[string]origin)
+	invocations := make(map[string]origin)
+	seen := make(map[string]bool)
+	var conflicts []string
+
+	for _, s := range shards {
+		for _, p := range s.Parsed.Providers {
+			def := p
+			def.Pos = types.Position{}
+			if prev, ok := providers[p.ID()]; ok {
+				if prev.definition != fmt.Sprintf("%+v", def) {
+					conflicts = append(conflicts, fmt.Sprintf("provider %s: %s differs from %s", p.ID(), prev.where, where(s, p.Pos)))
+				}
+				continue
+			}
+			providers[p.ID()] = origin{definition: fmt.Sprintf("%+v", def), where: where(s, p.Pos)}
+			merged.Providers = append(merged.Providers, p)
+		}
+		for _, inv := range s.Parsed.Invocations {
+			id := inv.ImportPath + "." + inv.Name
+			def := inv
+			def.Pos = types.Position{}
+			if prev, ok := invocations[id]; ok {
+				if prev.definition != fmt.Sprintf("%+v", def) {
+					conflicts = append(conflicts, fmt.Sprintf("invocation %s: %s differs from %s", id, prev.where, where(s, inv.Pos)))
+				}
+				continue
+			}
+			invocations[id] = origin{definition: fmt.Sprintf("%+v", def), where: where(s, inv.Pos)}
+			merged.Invocations = append(merged.Invocations, inv)
+		}
+
+		merged.Interfaces = appendUnique(merged.Interfaces, s.Parsed.Interfaces, seen)
+		merged.Aliases = appendUnique(merged.Aliases, s.Parsed.Aliases, seen)
+		merged.Defaults = appendUnique(merged.Defaults, s.Parsed.Defaults, seen)
+		merged.Externals = appendUnique(merged.Externals, s.Parsed.Externals, seen)
+		merged.Diagnostics = appendUnique(merged.Diagnostics, s.Parsed.Diagnostics, seen)
+		for path, name := range s.Parsed.PackageNames {
+			if merged.PackageNames == nil {
+				merged.PackageNames = make(map[string]string)
+			}
+			merged.PackageNames[path] = name
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("conflicting definitions across shards, which were likely scanned from different revisions:\n  %s", strings.Join(conflicts, "\n  "))
+	}
+	return merged, nil
+}
+
+type origin struct {
+	definition string
+	where      string
+}
+
+func where(s *Shard, pos types.Position) string {
+	if pos.File == "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%s:%d (%s)", pos.File, pos.Line, s.Name)
+}
+
+func appendUnique[T any](dst, src []T, seen map[string]bool) []T {
+	for _, v := range src {
+		key := fmt.Sprintf("%T%+v", v, v)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		dst = append(dst, v)
+	}
+	return dst
+}
@@ -0,0 +1,100 @@
+package shard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	s := &Shard{
+		ScanDirs: []string{"./internal/db"},
+		Parsed: &types.ParseResult{
+			Providers: []types.Provider{
+				{
+					Name:         "NewDatabase",
+					Kind:         types.ProviderKindFunc,
+					ProvidedType: types.TypeRef{Name: "Database", ImportPath: "pkg/db", IsPointer: true},
+					CanError:     true,
+					ImportPath:   "pkg/db",
+				},
+			},
+			PackageNames: map[string]string{"pkg/db": "db"},
+		},
+		Packages: map[string]string{"pkg/db": "db"},
+	}
+
+	path := filepath.Join(t.TempDir(), "ir.json")
+	require.NoError(t, Write(path, s))
+	got, err := Read(path)
+	require.NoError(t, err)
+	s.Name = path
+	assert.Equal(t, s, got)
+}
+
+func TestRead_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "unsupported version", content: `{"version": 99, "parsed": {}}`, expected: "unsupported shard version 99, expected 1"},
+		{name: "missing parse result", content: `{"version": 1}`, expected: "missing parse result"},
+		{name: "malformed", content: `{`, expected: "decoding"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ir.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+			_, err := Read(path)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	config := types.Provider{Name: "NewConfig", ImportPath: "pkg/config", Pos: types.Position{File: "/a/config.go", Line: 3}}
+	merged, err := Merge([]*Shard{
+		{Name: "config.json", Parsed: &types.ParseResult{
+			Providers:    []types.Provider{config},
+			Interfaces:   []types.TypeRef{{Name: "Store", ImportPath: "pkg/store"}},
+			PackageNames: map[string]string{"pkg/config": "config"},
+		}},
+		{Name: "server.json", Parsed: &types.ParseResult{
+			Providers:    []types.Provider{{Name: "NewServer", ImportPath: "pkg/server"}},
+			Invocations:  []types.Invocation{{Name: "Run", ImportPath: "pkg/server"}},
+			PackageNames: map[string]string{"pkg/server": "server"},
+		}},
+		{Name: "overlap.json", Parsed: &types.ParseResult{
+			Providers:  []types.Provider{{Name: "NewConfig", ImportPath: "pkg/config", Pos: types.Position{File: "/b/config.go", Line: 3}}},
+			Interfaces: []types.TypeRef{{Name: "Store", ImportPath: "pkg/store"}},
+		}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.Provider{config, {Name: "NewServer", ImportPath: "pkg/server"}}, merged.Providers, "identical definitions from overlapping shards are merged")
+	assert.Equal(t, []types.Invocation{{Name: "Run", ImportPath: "pkg/server"}}, merged.Invocations)
+	assert.Equal(t, []types.TypeRef{{Name: "Store", ImportPath: "pkg/store"}}, merged.Interfaces)
+	assert.Equal(t, map[string]string{"pkg/config": "config", "pkg/server": "server"}, merged.PackageNames)
+}
+
+func TestMerge_Conflicts(t *testing.T) {
+	_, err := Merge([]*Shard{
+		{Name: "old.json", Parsed: &types.ParseResult{
+			Providers:   []types.Provider{{Name: "NewConfig", ImportPath: "pkg/config", Pos: types.Position{File: "config.go", Line: 3}}},
+			Invocations: []types.Invocation{{Name: "Run", ImportPath: "pkg/server"}},
+		}},
+		{Name: "new.json", Parsed: &types.ParseResult{
+			Providers:   []types.Provider{{Name: "NewConfig", ImportPath: "pkg/config", CanError: true, Pos: types.Position{File: "config.go", Line: 5}}},
+			Invocations: []types.Invocation{{Name: "Run", ImportPath: "pkg/server", CanError: true}},
+		}},
+	})
+	assert.EqualError(t, err, `conflicting definitions across shards, which were likely scanned from different revisions:
+  provider pkg/config.NewConfig: config.go:3 (old.json) differs from config.go:5 (new.json)
+  invocation pkg/server.Run: old.json differs from new.json`)
+}
@@ -0,0 +1,40 @@
+package shellwords
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+		errMsg   string
+	}{
+		{name: "plain", input: "go tool sqlc  generate", expected: []string{"go", "tool", "sqlc", "generate"}},
+		{name: "double quotes", input: `go run ./gen "-tags=a b"`, expected: []string{"go", "run", "./gen", "-tags=a b"}},
+		{name: "single quotes", input: `echo 'a "b" \c'`, expected: []string{"echo", `a "b" \c`}},
+		{name: "escaped space", input: `ls my\ dir`, expected: []string{"ls", "my dir"}},
+		{name: "escapes in double quotes", input: `echo "a \"b\" \n"`, expected: []string{"echo", `a "b" \n`}},
+		{name: "empty argument", input: `printf ""`, expected: []string{"printf", ""}},
+		{name: "adjacent quotes", input: `a"b c"'d'`, expected: []string{"ab cd"}},
+		{name: "blank", input: "  ", expected: nil},
+		{name: "unterminated", input: `echo "a`, errMsg: `unterminated " quote`},
+		{name: "trailing backslash", input: `echo a\`, errMsg: "trailing backslash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Split(tt.input)
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package typecheck
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/importer"
+	"go/token"
+	gotypes "go/types"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/diag"
+	"github.com/eloonstra/autowire/internal/types"
+)
+
+const codeBinding = "interface-binding"
+
+func Bindings(dir string, providers []types.Provider) ([]diag.Diagnostic, error) {
+	var bound []types.Provider
+	paths := make(map[string]struct{})
+	for _, p := range providers {
+		if p.Concrete.Name == "" {
+			continue
+		}
+		bound = append(bound, p)
+		for _, path := range []string{p.Concrete.ImportPath, p.ProvidedType.ImportPath} {
+			if path != "" {
+				paths[path] = struct{}{}
+			}
+		}
+	}
+	if len(bound) == 0 {
+		return nil, nil
+	}
+
+	exports, err := listExports(dir, paths)
+	if err != nil {
+		return nil, fmt.Errorf("loading export data: %w", err)
+	}
+	imp := importer.ForCompiler(token.NewFileSet(), "gc", func(path string) (io.ReadCloser, error) {
+		file, ok := exports[path]
+		if !ok {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(file)
+	})
+
+	var diagnostics []diag.Diagnostic
+	for _, p := range bound {
+		iface, ok := lookup(imp, p.ProvidedType)
+		if !ok {
+			continue
+		}
+		concrete, ok := lookup(imp, p.Concrete)
+		if !ok {
+			continue
+		}
+
+		ifaceName := interfaceName(p.ProvidedType)
+		var message string
+		if it, isInterface := iface.Underlying().(*gotypes.Interface); !isInterface {
+			message = fmt.Sprintf("%s is bound to %s, which is not an interface", p.Name, ifaceName)
+		} else if !gotypes.Implements(concrete, it) {
+			message = fmt.Sprintf("%s: %s does not implement %s (%s)",
+				p.Name, p.Concrete.Key(), ifaceName, strings.Join(missingMethods(concrete, it), "; "))
+		} else {
+			continue
+		}
+		diagnostics = append(diagnostics, diag.Diagnostic{
+			Severity: diag.SeverityError,
+			Code:     codeBinding,
+			Message:  message,
+			File:     p.Pos.File,
+			Line:     p.Pos.Line,
+		})
+	}
+	return diagnostics, nil
+}
+
+func listExports(dir string, paths map[string]struct{}) (map[string]string, error) {
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	args := append([]string{"list", "-e", "-export", "-deps", "-f", "{{.ImportPath}} {{.Export}}"}, sorted...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	exports := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		path, file, ok := strings.Cut(scanner.Text(), " ")
+		if ok && file != "" {
+			exports[path] = file
+		}
+	}
+	return exports, scanner.Err()
+}
+
+func lookup(imp gotypes.Importer, ref types.TypeRef) (gotypes.Type, bool) {
+	var obj gotypes.Object
+	if ref.ImportPath == "" {
+		obj = gotypes.Universe.Lookup(ref.Name)
+	} else {
+		pkg, err := imp.Import(ref.ImportPath)
+		if err != nil {
+			return nil, false
+		}
+		obj = pkg.Scope().Lookup(ref.Name)
+	}
+	tn, ok := obj.(*gotypes.TypeName)
+	if !ok {
+		return nil, false
+	}
+
+	t := tn.Type()
+	if ref.IsPointer {
+		t = gotypes.NewPointer(t)
+	}
+	return t, true
+}
+
+func missingMethods(t gotypes.Type, iface *gotypes.Interface) []string {
+	var problems []string
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		obj, _, _ := gotypes.LookupFieldOrMethod(t, false, m.Pkg(), m.Name())
+		fn, ok := obj.(*gotypes.Func)
+		switch {
+		case !ok && hasPointerMethod(t, m):
+			problems = append(problems, fmt.Sprintf("method %s has a pointer receiver", m.Name()))
+		case !ok:
+			problems = append(problems, "missing method "+m.Name())
+		case !gotypes.Identical(fn.Type(), m.Type()):
+			problems = append(problems, fmt.Sprintf("method %s has signature %s, want %s",
+				m.Name(), signature(fn), signature(m)))
+		}
+	}
+	return problems
+}
+
+func hasPointerMethod(t gotypes.Type, m *gotypes.Func) bool {
+	obj, _, _ := gotypes.LookupFieldOrMethod(t, true, m.Pkg(), m.Name())
+	_, ok := obj.(*gotypes.Func)
+	return ok
+}
+
+func signature(fn *gotypes.Func) string {
+	return strings.TrimPrefix(gotypes.TypeString(fn.Type(), func(p *gotypes.Package) string { return p.Name() }), "func")
+}
+
+func interfaceName(ref types.TypeRef) string {
+	ref.Qualifier = ""
+	return ref.Key()
+}
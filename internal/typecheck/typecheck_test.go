@@ -0,0 +1,129 @@
+package typecheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eloonstra/autowire/internal/diag"
+	"github.com/eloonstra/autowire/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const source = `package store
+
+import "io"
+
+type Store interface {
+	Get(key string) (string, error)
+	Close() error
+}
+
+type FileReader struct{}
+
+type Cache struct{}
+
+func (c *Cache) Get(key string) string { return "" }
+
+type Memory struct{}
+
+func (m *Memory) Get(key string) (string, error) { return "", nil }
+func (m *Memory) Close() error                   { return nil }
+
+type Config struct{}
+
+var _ io.Reader = (*Buffer)(nil)
+
+type Buffer struct{}
+
+func (b *Buffer) Read(p []byte) (int, error) { return 0, nil }
+`
+
+func writeModule(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\ngo 1.22\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "store"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "store.go"), []byte(source), 0644))
+	return dir
+}
+
+func TestBindings(t *testing.T) {
+	dir := writeModule(t)
+	local := func(name string, pointer bool) types.TypeRef {
+		return types.TypeRef{Name: name, ImportPath: "example.com/app/store", IsPointer: pointer}
+	}
+	reader := types.TypeRef{Name: "Reader", ImportPath: "io"}
+
+	tests := []struct {
+		name     string
+		provider types.Provider
+		expected string
+	}{
+		{
+			name:     "implemented",
+			provider: types.Provider{Name: "Buffer", ProvidedType: reader, Concrete: local("Buffer", true)},
+		},
+		{
+			name:     "implemented with qualifier",
+			provider: types.Provider{Name: "NewMemory", ProvidedType: types.TypeRef{Name: "Store", ImportPath: "example.com/app/store", Qualifier: "primary"}, Concrete: local("Memory", true)},
+		},
+		{
+			name:     "missing method",
+			provider: types.Provider{Name: "FileReader", ProvidedType: reader, Concrete: local("FileReader", true), Pos: types.Position{File: "store.go", Line: 9}},
+			expected: "store.go:9: error: FileReader: *example.com/app/store.FileReader does not implement io.Reader (missing method Read) [interface-binding]",
+		},
+		{
+			name:     "wrong signature and missing method",
+			provider: types.Provider{Name: "NewCache", ProvidedType: local("Store", false), Concrete: local("Cache", true)},
+			expected: "error: NewCache: *example.com/app/store.Cache does not implement example.com/app/store.Store (missing method Close; method Get has signature (key string) string, want (key string) (string, error)) [interface-binding]",
+		},
+		{
+			name:     "pointer receiver",
+			provider: types.Provider{Name: "NewMemory", ProvidedType: local("Store", false), Concrete: local("Memory", false)},
+			expected: "error: NewMemory: example.com/app/store.Memory does not implement example.com/app/store.Store (method Close has a pointer receiver; method Get has a pointer receiver) [interface-binding]",
+		},
+		{
+			name:     "not an interface",
+			provider: types.Provider{Name: "NewMemory", ProvidedType: local("Config", false), Concrete: local("Memory", true)},
+			expected: "error: NewMemory is bound to example.com/app/store.Config, which is not an interface [interface-binding]",
+		},
+		{
+			name:     "unknown type is left to the compiler",
+			provider: types.Provider{Name: "NewMissing", ProvidedType: reader, Concrete: local("Missing", true)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics, err := Bindings(dir, []types.Provider{tt.provider})
+			require.NoError(t, err)
+			if tt.expected == "" {
+				assert.Empty(t, diagnostics)
+				return
+			}
+			require.Len(t, diagnostics, 1)
+			assert.Equal(t, tt.expected, diagnostics[0].String())
+		})
+	}
+}
+
+func TestBindings_NoBindings(t *testing.T) {
+	diagnostics, err := Bindings(t.TempDir(), []types.Provider{{Name: "NewConfig"}})
+	require.NoError(t, err)
+	assert.Empty(t, diagnostics)
+}
+
+func TestBindings_BrokenPackage(t *testing.T) {
+	dir := writeModule(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "broken.go"), []byte("package store\n\nvar x int = \"\"\n"), 0644))
+
+	diagnostics, err := Bindings(dir, []types.Provider{{
+		Name:         "FileReader",
+		ProvidedType: types.TypeRef{Name: "Reader", ImportPath: "io"},
+		Concrete:     types.TypeRef{Name: "FileReader", ImportPath: "example.com/app/store", IsPointer: true},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []diag.Diagnostic(nil), diagnostics)
+}
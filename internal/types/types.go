@@ -1,5 +1,14 @@
 package types
 
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/eloonstra/autowire/internal/diag"
+)
+
 type PackageNameResolver interface {
 	ResolveName(importPath string) string
 }
@@ -9,23 +18,87 @@ type ProviderKind int
 const (
 	ProviderKindStruct ProviderKind = iota
 	ProviderKindFunc
+	ProviderKindGroup
+	ProviderKindValue
+	ProviderKindVar
+	ProviderKindConfig
+)
+
+type Scope int
+
+const (
+	ScopeSingleton Scope = iota
+	ScopeRequest
+	ScopeTransient
+	ScopeWeak
+	ScopeLazy
 )
 
 type TypeRef struct {
 	Name       string
 	ImportPath string
 	IsPointer  bool
+	IsSlice    bool
+	MapKey     *TypeRef
+	Func       *Signature
+	Qualifier  string
+	Default    string
+}
+
+type Signature struct {
+	Params   []TypeRef
+	Results  []TypeRef
+	Variadic bool
+}
+
+func (s Signature) Key() string {
+	params := make([]string, len(s.Params))
+	for i, p := range s.Params {
+		params[i] = p.Key()
+	}
+	if s.Variadic && len(params) > 0 {
+		params[len(params)-1] = "..." + params[len(params)-1]
+	}
+	results := make([]string, len(s.Results))
+	for i, r := range s.Results {
+		results[i] = r.Key()
+	}
+	key := "func(" + strings.Join(params, ", ") + ")"
+	switch len(results) {
+	case 0:
+		return key
+	case 1:
+		return key + " " + results[0]
+	}
+	return key + " (" + strings.Join(results, ", ") + ")"
 }
 
 func (t TypeRef) Key() string {
-	prefix := ""
+	var mapKey, slice, pointer, dot, at string
+	if t.MapKey != nil {
+		mapKey = "map[" + t.MapKey.Key() + "]"
+	}
+	if t.IsSlice {
+		slice = "[]"
+	}
 	if t.IsPointer {
-		prefix = "*"
+		pointer = "*"
 	}
-	if t.ImportPath == "" {
-		return prefix + t.Name
+	if t.ImportPath != "" {
+		dot = "."
 	}
-	return prefix + t.ImportPath + "." + t.Name
+	if t.Qualifier != "" {
+		at = "@"
+	}
+	if t.Func != nil {
+		return mapKey + slice + pointer + t.Func.Key() + at + t.Qualifier
+	}
+	return mapKey + slice + pointer + t.ImportPath + dot + t.Name + at + t.Qualifier
+}
+
+type Position struct {
+	File string
+	Line int
 }
 
 type Dependency struct {
@@ -37,23 +110,136 @@ type Provider struct {
 	Name         string
 	Kind         ProviderKind
 	ProvidedType TypeRef
+	Concrete     TypeRef
 	Dependencies []Dependency
 	CanError     bool
+	ErrorType    string
+	HasCleanup   bool
 	ImportPath   string
 	VarName      string
+	Group        string
+	Order        int
+	Members      []Provider
+	Scope        Scope
+	Profile      string
+	Containers   []string
+	Ldflag       string
+	Env          []EnvVar
+	Pure         bool
+	Pos          Position
+}
+
+type EnvVar struct {
+	Field    string
+	Name     string
+	Type     string
+	Default  string
+	Required bool
+}
+
+func (p Provider) ID() string {
+	return p.ImportPath + "." + p.Name
+}
+
+func Accessor(t TypeRef, canError bool) TypeRef {
+	sig := Signature{Results: []TypeRef{t}}
+	if canError {
+		sig.Results = append(sig.Results, TypeRef{Name: "error"})
+	}
+	return TypeRef{Func: &sig}
 }
 
 type Invocation struct {
 	Name         string
 	Dependencies []TypeRef
 	CanError     bool
+	ErrorType    string
 	ImportPath   string
+	Flag         string
+	Collector    string
+	Collect      int
+	Containers   []string
+	Pos          Position
+}
+
+type Alias struct {
+	Alias  TypeRef
+	Target TypeRef
+}
+
+type Binding struct {
+	Interface TypeRef
+	Target    TypeRef
+}
+
+type External struct {
+	Type     TypeRef
+	VarName  string
+	Required bool
+	Pos      Position
 }
 
 type ParseResult struct {
 	Providers        []Provider
 	Invocations      []Invocation
+	Interfaces       []TypeRef
+	Aliases          []Alias
+	Defaults         []Binding
+	Externals        []External
+	Diagnostics      []diag.Diagnostic
+	PackageNames     map[string]string
 	OutputPackage    string
 	OutputImportPath string
 	OutputPath       string
 }
+
+func (r *ParseResult) Merge(other *ParseResult) {
+	r.Providers = append(r.Providers, other.Providers...)
+	r.Invocations = append(r.Invocations, other.Invocations...)
+	r.Interfaces = append(r.Interfaces, other.Interfaces...)
+	r.Aliases = append(r.Aliases, other.Aliases...)
+	r.Defaults = append(r.Defaults, other.Defaults...)
+	r.Externals = append(r.Externals, other.Externals...)
+	r.Diagnostics = append(r.Diagnostics, other.Diagnostics...)
+	for path, name := range other.PackageNames {
+		if r.PackageNames == nil {
+			r.PackageNames = make(map[string]string)
+		}
+		r.PackageNames[path] = name
+	}
+}
+
+var literalBits = map[string]int{
+	"int": 0, "int8": 8, "int16": 16, "int32": 32, "rune": 32, "int64": 64,
+	"uint": 0, "uint8": 8, "byte": 8, "uint16": 16, "uint32": 32, "uint64": 64, "uintptr": 0,
+	"float32": 32, "float64": 64,
+}
+
+func BitSize(kind string) (int, bool) {
+	bits, ok := literalBits[kind]
+	return bits, ok
+}
+
+func Literal(kind, value string) (string, error) {
+	switch bits, numeric := literalBits[kind]; {
+	case kind == "string":
+		return strconv.Quote(value), nil
+	case kind == "bool":
+		b, err := strconv.ParseBool(value)
+		return strconv.FormatBool(b), err
+	case !numeric:
+		return "", fmt.Errorf("unsupported type %s", kind)
+	case strings.HasPrefix(kind, "float"):
+		f, err := strconv.ParseFloat(value, bits)
+		if err == nil && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			err = fmt.Errorf("must be a finite number")
+		}
+		return strconv.FormatFloat(f, 'g', -1, bits), err
+	case strings.HasPrefix(kind, "u") || kind == "byte":
+		n, err := strconv.ParseUint(value, 10, bits)
+		return strconv.FormatUint(n, 10), err
+	default:
+		n, err := strconv.ParseInt(value, 10, bits)
+		return strconv.FormatInt(n, 10), err
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTypeRef_Key(t *testing.T) {
@@ -37,11 +38,58 @@ func TestTypeRef_Key(t *testing.T) {
 			typeRef:  TypeRef{Name: "string"},
 			expected: "string",
 		},
+		{
+			name:     "func type",
+			typeRef:  TypeRef{Func: &Signature{Results: []TypeRef{{Name: "Time", ImportPath: "time"}}}},
+			expected: "func() time.Time",
+		},
+		{
+			name: "qualified variadic func type",
+			typeRef: TypeRef{
+				Func: &Signature{
+					Params:   []TypeRef{{Name: "string"}, {Name: "Option", ImportPath: "pkg/bar"}},
+					Results:  []TypeRef{{Name: "Foo", ImportPath: "pkg/bar", IsPointer: true}, {Name: "error"}},
+					Variadic: true,
+				},
+				Qualifier: "primary",
+			},
+			expected: "func(string, ...pkg/bar.Option) (*pkg/bar.Foo, error)@primary",
+		},
+		{
+			name:     "map type",
+			typeRef:  TypeRef{Name: "Handler", ImportPath: "pkg/http", IsPointer: true, MapKey: &TypeRef{Name: "string"}},
+			expected: "map[string]*pkg/http.Handler",
+		},
+		{
+			name:     "named map of slices",
+			typeRef:  TypeRef{Name: "Foo", IsSlice: true, MapKey: &TypeRef{Name: "Role", ImportPath: "pkg/auth"}, Qualifier: "admin"},
+			expected: "map[pkg/auth.Role][]Foo@admin",
+		},
 		{
 			name:     "nested import path",
 			typeRef:  TypeRef{Name: "Config", ImportPath: "github.com/example/pkg/config"},
 			expected: "github.com/example/pkg/config.Config",
 		},
+		{
+			name:     "slice type",
+			typeRef:  TypeRef{Name: "Handler", ImportPath: "pkg/http", IsSlice: true},
+			expected: "[]pkg/http.Handler",
+		},
+		{
+			name:     "qualified type",
+			typeRef:  TypeRef{Name: "DB", ImportPath: "pkg/db", IsPointer: true, Qualifier: "primaryDB"},
+			expected: "*pkg/db.DB@primaryDB",
+		},
+		{
+			name:     "qualified builtin",
+			typeRef:  TypeRef{Name: "string", Qualifier: "dsn"},
+			expected: "string@dsn",
+		},
+		{
+			name:     "slice of pointers",
+			typeRef:  TypeRef{Name: "Foo", ImportPath: "pkg/bar", IsPointer: true, IsSlice: true},
+			expected: "[]*pkg/bar.Foo",
+		},
 	}
 
 	for _, tt := range tests {
@@ -51,3 +99,60 @@ func TestTypeRef_Key(t *testing.T) {
 		})
 	}
 }
+
+func TestTypeRef_KeyAllocations(t *testing.T) {
+	tests := []struct {
+		name     string
+		ref      TypeRef
+		expected float64
+	}{
+		{name: "builtin", ref: TypeRef{Name: "string"}, expected: 0},
+		{name: "pointer", ref: TypeRef{Name: "Config", ImportPath: "example.com/app/config", IsPointer: true}, expected: 1},
+		{name: "qualified slice", ref: TypeRef{Name: "Route", ImportPath: "example.com/app/http", IsSlice: true, IsPointer: true, Qualifier: "admin"}, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocs := testing.AllocsPerRun(100, func() { _ = tt.ref.Key() })
+			assert.Equal(t, tt.expected, allocs)
+		})
+	}
+}
+
+func BenchmarkTypeRef_Key(b *testing.B) {
+	ref := TypeRef{Name: "Route", ImportPath: "github.com/example/service/internal/http", IsSlice: true, IsPointer: true}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = ref.Key()
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		kind, value, want string
+		wantErr           bool
+	}{
+		{kind: "string", value: "a b", want: `"a b"`},
+		{kind: "bool", value: "t", want: "true"},
+		{kind: "bool", value: "1", want: "true"},
+		{kind: "bool", value: "F", want: "false"},
+		{kind: "float32", value: "1.50", want: "1.5"},
+		{kind: "float64", value: "inf", wantErr: true},
+		{kind: "float64", value: "NaN", wantErr: true},
+		{kind: "byte", value: "256", wantErr: true},
+		{kind: "int", value: "+7", want: "7"},
+		{kind: "complex128", value: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind+" "+tt.value, func(t *testing.T) {
+			got, err := Literal(tt.kind, tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package xsync
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+const shardCount = 32
+
+var seed = maphash.MakeSeed()
+
+type shard[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+	_  [32]byte
+}
+
+type ShardedMap[K comparable, V any] struct {
+	shards [shardCount]shard[K, V]
+}
+
+func (m *ShardedMap[K, V]) shard(key K) *shard[K, V] {
+	return &m.shards[maphash.Comparable(seed, key)%shardCount]
+}
+
+func (m *ShardedMap[K, V]) Load(key K) (V, bool) {
+	s := m.shard(key)
+	s.mu.RLock()
+	val, ok := s.m[key]
+	s.mu.RUnlock()
+	return val, ok
+}
+
+func (m *ShardedMap[K, V]) Store(key K, value V) {
+	s := m.shard(key)
+	s.mu.Lock()
+	if s.m == nil {
+		s.m = make(map[K]V)
+	}
+	s.m[key] = value
+	s.mu.Unlock()
+}
+
+func (m *ShardedMap[K, V]) LoadOrStore(key K, value V) (V, bool) {
+	s := m.shard(key)
+	s.mu.RLock()
+	actual, ok := s.m[key]
+	s.mu.RUnlock()
+	if ok {
+		return actual, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if actual, ok := s.m[key]; ok {
+		return actual, true
+	}
+	if s.m == nil {
+		s.m = make(map[K]V)
+	}
+	s.m[key] = value
+	return value, false
+}
+
+func (m *ShardedMap[K, V]) LoadAndDelete(key K) (V, bool) {
+	s := m.shard(key)
+	s.mu.Lock()
+	val, ok := s.m[key]
+	delete(s.m, key)
+	s.mu.Unlock()
+	return val, ok
+}
+
+func (m *ShardedMap[K, V]) Delete(key K) {
+	s := m.shard(key)
+	s.mu.Lock()
+	delete(s.m, key)
+	s.mu.Unlock()
+}
+
+func (m *ShardedMap[K, V]) Len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		n += len(s.m)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+func (m *ShardedMap[K, V]) Range(f func(key K, value V) bool) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		keys := make([]K, 0, len(s.m))
+		values := make([]V, 0, len(s.m))
+		for k, v := range s.m {
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+		s.mu.RUnlock()
+		for j, k := range keys {
+			if !f(k, values[j]) {
+				return
+			}
+		}
+	}
+}
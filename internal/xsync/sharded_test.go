@@ -0,0 +1,179 @@
+package xsync
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedMap_StoreAndLoad(t *testing.T) {
+	var m ShardedMap[string, int]
+
+	m.Store("key", 42)
+	val, ok := m.Load("key")
+
+	assert.True(t, ok)
+	assert.Equal(t, 42, val)
+
+	_, ok = m.Load("missing")
+	assert.False(t, ok)
+}
+
+func TestShardedMap_LoadOrStore(t *testing.T) {
+	var m ShardedMap[string, string]
+
+	val, loaded := m.LoadOrStore("key", "first")
+	assert.False(t, loaded)
+	assert.Equal(t, "first", val)
+
+	val, loaded = m.LoadOrStore("key", "second")
+	assert.True(t, loaded)
+	assert.Equal(t, "first", val)
+}
+
+func TestShardedMap_Delete(t *testing.T) {
+	var m ShardedMap[string, int]
+	m.Store("a", 1)
+	m.Store("b", 2)
+
+	val, ok := m.LoadAndDelete("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, val)
+
+	_, ok = m.LoadAndDelete("a")
+	assert.False(t, ok)
+
+	m.Delete("b")
+	m.Delete("missing")
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestShardedMap_Range(t *testing.T) {
+	var m ShardedMap[int, int]
+	for i := range 100 {
+		m.Store(i, i)
+	}
+
+	sum := 0
+	m.Range(func(key, value int) bool {
+		sum += value
+		return true
+	})
+	assert.Equal(t, 4950, sum)
+
+	count := 0
+	m.Range(func(key, value int) bool {
+		count++
+		m.Store(key+1000, value)
+		return count < 3
+	})
+	assert.Equal(t, 3, count)
+}
+
+func TestShardedMap_ConcurrentAccess(t *testing.T) {
+	var m ShardedMap[int, int]
+	var wg sync.WaitGroup
+
+	iterations := 1000
+	goroutines := 10
+
+	for i := range goroutines {
+		wg.Add(1)
+		go func(base int) {
+			defer wg.Done()
+			for j := range iterations {
+				key := base*iterations + j
+				m.Store(key, key*2)
+				m.Load(key)
+				m.LoadOrStore(key, 0)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	assert.Equal(t, goroutines*iterations, m.Len())
+}
+
+func TestShardedMap_LoadDoesNotAllocate(t *testing.T) {
+	var m ShardedMap[string, string]
+	m.Store("key", "value")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Load("key")
+	})
+	assert.Zero(t, allocs)
+}
+
+func benchmarkKeys() []string {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "github.com/example/service/internal/pkg" + strconv.Itoa(i) + ".Handler"
+	}
+	return keys
+}
+
+func BenchmarkMap_Load(b *testing.B) {
+	var m Map[string, string]
+	keys := benchmarkKeys()
+	for _, k := range keys {
+		m.Store(k, k)
+	}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Load(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func BenchmarkShardedMap_Load(b *testing.B) {
+	var m ShardedMap[string, string]
+	keys := benchmarkKeys()
+	for _, k := range keys {
+		m.Store(k, k)
+	}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			m.Load(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func BenchmarkMap_LoadOrStore(b *testing.B) {
+	var m Map[string, string]
+	keys := benchmarkKeys()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := keys[i%len(keys)]
+			m.LoadOrStore(k, k)
+			i++
+		}
+	})
+}
+
+func BenchmarkShardedMap_LoadOrStore(b *testing.B) {
+	var m ShardedMap[string, string]
+	keys := benchmarkKeys()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := keys[i%len(keys)]
+			m.LoadOrStore(k, k)
+			i++
+		}
+	})
+}
@@ -2,46 +2,225 @@ package main
 
 import (
 	"fmt"
+	"go/token"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/bundle"
+	"github.com/eloonstra/autowire/internal/cache"
+	"github.com/eloonstra/autowire/internal/diag"
 	"github.com/eloonstra/autowire/internal/generator"
 	"github.com/eloonstra/autowire/internal/parser"
+	"github.com/eloonstra/autowire/internal/pipeline"
+	"github.com/eloonstra/autowire/internal/report"
 	"github.com/eloonstra/autowire/internal/resolver"
+	"github.com/eloonstra/autowire/internal/shard"
+	"github.com/eloonstra/autowire/internal/shellwords"
 	"github.com/eloonstra/autowire/internal/types"
 	"github.com/spf13/cobra"
 )
 
 const (
 	defaultOutputFileName = "app_gen.go"
-	filePermission        = 0644
+	progressThreshold     = 500 * time.Millisecond
 )
 
 var (
 	scanDirs   []string
 	outDir     string
 	outputName string
+	outPackage string
 	verbose    bool
+	debugDump  bool
+	partial    bool
+	after      []string
+	commandDir string
+	fieldOrder string
+	container  string
+	quiet      bool
+	summary    bool
+	builtins   string
+	bench      bool
+	testApp    bool
+	testShared []string
+	ctxAccess  bool
+	rootRel    bool
+	prefixes   []string
+	exclude    []string
+	errorTypes []string
+	record     string
+	replay     string
+	chainWarn  int
+	maxErrors  int
+	strict     bool
+	onlyInvoke []string
+	skipInvoke []string
+	nolint     []string
+	fieldTags  []string
+	cleanup    bool
+	lifecycle  bool
+	runFuncs   bool
+	initOpts   bool
+	recoverFns bool
+	getters    bool
+	services   bool
+	format     string
+	watchMode  bool
+	profile    string
+	funcPrefix string
+	structPkgs []string
+	invokePkgs []string
+	configPath string
+	emitPatch  bool
+	emit       string
+	selfCheck  bool
+	noCache    bool
+	irPath     string
+	from       []string
+	fileMode   string
+	fileOwner  string
+	proposed   []string
+	invokes    []string
+
+	graphFormat generator.GraphFormat
+)
+
+var fieldOrders = map[string]generator.FieldOrder{
+	"topological": generator.FieldOrderTopological,
+	"type":        generator.FieldOrderType,
+	"package":     generator.FieldOrderPackage,
+}
+
+var formats = map[string]report.Format{
+	"text":   report.FormatText,
+	"github": report.FormatGitHub,
+	"gitlab": report.FormatGitLab,
+	"json":   report.FormatJSON,
+}
+
+var graphFormats = map[string]generator.GraphFormat{
+	"dot":     generator.GraphFormatDOT,
+	"mermaid": generator.GraphFormatMermaid,
+	"json":    generator.GraphFormatJSON,
+}
+
+var builtinPolicies = map[string]analyzer.BuiltinPolicy{
+	"allow":      analyzer.BuiltinPolicyAllow,
+	"named-only": analyzer.BuiltinPolicyNamedOnly,
+	"forbid":     analyzer.BuiltinPolicyForbid,
+}
+
+const (
+	commandCheck    = "check"
+	commandList     = "list"
+	commandGenerate = "generate"
+	commandGraph    = "graph"
+	commandScan     = "scan"
+	commandWhatIf   = "what-if"
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "autowire",
+	Use:   "autowire [check|list|graph|generate|scan|what-if]...",
 	Short: "Autowire generates dependency injection code from annotations",
 	Long: `Autowire scans Go source files for autowire annotations and generates
 dependency injection wiring code automatically.
 
 It parses provider and invocation annotations, analyzes dependencies,
-and generates a single output file containing all the wiring code.`,
-	RunE: run,
+and generates a single output file containing all the wiring code.
+
+Commands can be chained and share a single parse and analysis pass:
+  check     validate the wiring and that the output is up to date, without writing
+  list      print providers and invocations in initialization order
+  graph     print the dependency graph (--format dot, mermaid or json)
+  generate  write the generated file (default)
+
+Scanning can also run on its own, e.g. one shard per part of a monorepo:
+  scan      write the parsed annotations to --ir for a later run with --from
+
+Proposed annotations can be tried out before editing any code:
+  what-if   report what --provide and --invoke would resolve and change`,
+	ValidArgs: []string{commandCheck, commandList, commandGraph, commandGenerate, commandScan, commandWhatIf},
+	Args:      cobra.OnlyValidArgs,
+	RunE:      run,
 }
 
 func init() {
-	rootCmd.Flags().StringArrayVarP(&scanDirs, "scan", "s", []string{"."}, "directories to scan for autowire annotations (can be specified multiple times)")
+	rootCmd.Flags().StringVar(&configPath, "config", "", "config file with flag values (default: autowire.yaml, autowire.yml or autowire.toml at the module root)")
+	rootCmd.Flags().StringArrayVarP(&scanDirs, "scan", "s", []string{"."}, "directories to scan recursively for autowire annotations, or package patterns like ./internal/... and globs like ./services/* selecting individual packages (can be specified multiple times)")
 	rootCmd.Flags().StringVarP(&outDir, "out", "o", ".", "output directory for generated code")
+	rootCmd.Flags().BoolVar(&rootRel, "module-root-relative", false, "resolve relative --scan and --out paths against the module root instead of the working directory, so //go:generate directives work from any package")
 	rootCmd.Flags().StringVarP(&outputName, "name", "n", defaultOutputFileName, "output filename")
+	rootCmd.Flags().StringVar(&outPackage, "package", "", "package name of the generated code when --out has no Go files yet (default: the package found in --out, or its directory name)")
+	rootCmd.Flags().StringVar(&fileMode, "file-mode", "0644", "octal permissions of written files, e.g. 0444 for read-only files that are made writable again before each overwrite")
+	rootCmd.Flags().StringVar(&fileOwner, "file-owner", "", "owner of written files as user, user:group or :group, by name or numeric ID (Unix only; changing the user usually requires root)")
+	rootCmd.Flags().StringSliceVar(&nolint, "nolint", nil, "linters to suppress on generated functions, e.g. funlen,gocyclo (all suppresses every linter)")
+	rootCmd.Flags().StringArrayVar(&exclude, "exclude", nil, "glob of files or directories to skip, relative to each scan directory, e.g. 'testdata/**' (can be specified multiple times)")
+	rootCmd.Flags().StringArrayVar(&errorTypes, "error-type", nil, "additional type to treat as an error result, e.g. '*example.com/app/apperr.Error' (can be specified multiple times)")
+	rootCmd.Flags().StringArrayVar(&prefixes, "prefix", []string{parser.DefaultPrefix}, "directive prefix to accept, e.g. di for //di:provide (can be specified multiple times)")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output")
+	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "suppress progress and success output")
+	rootCmd.Flags().StringVar(&format, "format", "text", "diagnostics format: text, github (workflow commands), gitlab (code quality JSON on stdout) or json (a JSON array of diagnostics on stdout); with graph: dot, mermaid or json")
+	rootCmd.Flags().BoolVar(&debugDump, "debug-dump", false, "generate DebugDump and String methods on App")
+	rootCmd.Flags().BoolVar(&partial, "partial", false, "generate per-provider wire helpers instead of InitializeApp")
+	rootCmd.MarkFlagsMutuallyExclusive("debug-dump", "partial")
+	rootCmd.Flags().BoolVar(&cleanup, "cleanup", false, "generate a Cleanup method closing every io.Closer on App in reverse initialization order, except values whose provider returns a cleanup function")
+	rootCmd.MarkFlagsMutuallyExclusive("cleanup", "partial")
+	rootCmd.Flags().BoolVar(&lifecycle, "lifecycle", false, "generate Start and Stop methods on App calling Start(ctx) error and Stop(ctx) error of every provided value that has them, in initialization order and its reverse")
+	rootCmd.MarkFlagsMutuallyExclusive("lifecycle", "partial")
+	rootCmd.Flags().BoolVar(&runFuncs, "run-funcs", false, "also generate a Run<Invocation>() error function per invocation that builds only the providers the invocation depends on")
+	rootCmd.MarkFlagsMutuallyExclusive("run-funcs", "partial")
+	rootCmd.Flags().BoolVar(&initOpts, "init-options", false, "pass the command-line arguments and externals to InitializeApp in an InitOptions struct instead of as separate parameters")
+	rootCmd.MarkFlagsMutuallyExclusive("init-options", "partial")
+	rootCmd.Flags().BoolVar(&recoverFns, "recover", false, "turn panics in provider functions into errors naming the provider")
+	rootCmd.MarkFlagsMutuallyExclusive("recover", "partial")
+	rootCmd.Flags().BoolVar(&getters, "getters", false, "make App fields unexported and generate a getter method for each")
+	rootCmd.MarkFlagsMutuallyExclusive("getters", "partial")
+	rootCmd.Flags().BoolVar(&ctxAccess, "context-accessors", false, "generate <Field>FromContext and With<Field> helpers for request-scoped values, and RequestScope.WithContext storing them all on a context")
+	rootCmd.MarkFlagsMutuallyExclusive("context-accessors", "partial")
+	rootCmd.Flags().BoolVar(&services, "services", false, "also generate an AppServices interface listing the getters and factory methods of App (requires --getters)")
+	rootCmd.Flags().StringArrayVar(&fieldTags, "field-tag", nil, "struct tag to add to every App field: key=value for a fixed value (json=-) or key alone for the provided type (di) (can be specified multiple times)")
+	rootCmd.MarkFlagsMutuallyExclusive("getters", "field-tag")
+	rootCmd.Flags().StringVar(&fieldOrder, "field-order", "topological", "order of App fields: topological, type or package")
+	rootCmd.Flags().BoolVar(&bench, "bench", false, "also write a benchmark of the initializer to <name>_bench_test.go")
+	rootCmd.MarkFlagsMutuallyExclusive("bench", "partial")
+	rootCmd.Flags().BoolVar(&testApp, "test-app", false, "also write InitializeTestApp, which replaces providers with fakes passed as overrides, to <name>_test.go")
+	rootCmd.MarkFlagsMutuallyExclusive("test-app", "partial")
+	rootCmd.Flags().StringArrayVar(&testShared, "test-shared", nil, "App field that InitializeTestApp builds only once per test binary, together with everything it depends on, e.g. for containers started by tests (requires --test-app, can be specified multiple times)")
+	rootCmd.Flags().IntVar(&chainWarn, "chain-threshold", 0, "warn when an invocation depends on a provider chain longer than this (0 disables)")
+	rootCmd.Flags().StringArrayVar(&onlyInvoke, "only-invoke", nil, "generate only this invocation and the providers it depends on, as Name, package.Name or import/path.Name (can be specified multiple times)")
+	rootCmd.Flags().StringArrayVar(&skipInvoke, "skip-invoke", nil, "leave out this invocation and generate only the remaining invocations and the providers they depend on, as Name, package.Name or import/path.Name (can be specified multiple times)")
+	rootCmd.Flags().BoolVar(&strict, "strict", false, "fail on dead wiring: singleton providers and interface bindings nothing depends on, and defaults that are unused or shadowed by a provider")
+	rootCmd.Flags().IntVar(&maxErrors, "max-errors", 20, "maximum number of errors to print before summarizing the rest (0 shows all)")
+	rootCmd.Flags().StringVar(&funcPrefix, "rule-func-prefix", "", "require function providers to be named with this prefix, e.g. New")
+	rootCmd.Flags().StringArrayVar(&structPkgs, "rule-struct-package", nil, "require struct providers to live in this package; a trailing /... includes subpackages (can be specified multiple times)")
+	rootCmd.Flags().StringArrayVar(&invokePkgs, "rule-invoke-package", nil, "only allow invocations in this package, e.g. example.com/app/cmd/...; a trailing /... includes subpackages (can be specified multiple times)")
+	rootCmd.Flags().StringVar(&builtins, "builtins", "allow", "injection policy for unnamed builtin types like string and int: allow, named-only or forbid")
+	rootCmd.Flags().StringVar(&profile, "profile", "", "wire providers marked profile=<name> behind a //go:build <name> constraint (output defaults to app_<name>_gen.go)")
+	rootCmd.Flags().StringVar(&container, "container", "", "container name used to namespace generated identifiers (e.g. worker generates WorkerApp) and to select annotations marked container=<name>")
+	rootCmd.Flags().StringVar(&emit, "emit", generator.EmitGo, "what generate writes: go (the wiring code), plan (a JSON plan of the initialization steps) or dot (the dependency graph); the default output name gets the matching extension")
+	rootCmd.Flags().BoolVar(&emitPatch, "emit-patch", false, "print a unified diff of the files generate would write to stdout instead of writing them (implies --quiet)")
+	rootCmd.Flags().BoolVar(&summary, "summary", false, "also write a markdown summary of providers and invocations beside the generated file")
+	rootCmd.Flags().BoolVar(&selfCheck, "self-check", false, "generate twice in-process with shuffled scan and merge order and fail if the outputs differ")
+	rootCmd.Flags().BoolVar(&noCache, "no-cache", false, "reparse every package and rerun go list instead of reusing results from .autowire/cache.json at the module root")
+	rootCmd.Flags().StringVar(&record, "record", "", "write parsed inputs, package names and settings to a zip bundle for bug reports")
+	rootCmd.Flags().StringVar(&replay, "replay", "", "reproduce a run from a bundle written by --record instead of scanning")
+	rootCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	rootCmd.Flags().StringVar(&irPath, "ir", "autowire.ir.json", "file the scan command writes parsed annotations to")
+	rootCmd.Flags().StringArrayVar(&from, "from", nil, "read parsed annotations from files written by scan instead of scanning, merging them in order (can be specified multiple times)")
+	rootCmd.MarkFlagsMutuallyExclusive("from", "replay")
+	rootCmd.Flags().BoolVarP(&watchMode, "watch", "w", false, "keep running and rerun the commands whenever a scanned .go file changes")
+	rootCmd.MarkFlagsMutuallyExclusive("watch", "record")
+	rootCmd.MarkFlagsMutuallyExclusive("watch", "replay")
+	rootCmd.MarkFlagsMutuallyExclusive("watch", "from")
+	rootCmd.Flags().StringArrayVar(&proposed, "provide", nil, "function or struct to treat as annotated with //autowire:provide, as import path and name, e.g. example.com/app/db.NewPool (what-if only, can be specified multiple times)")
+	rootCmd.Flags().StringArrayVar(&invokes, "invoke", nil, "function to treat as annotated with //autowire:invoke, as import path and name (what-if only, can be specified multiple times)")
+	rootCmd.Flags().StringArrayVar(&after, "after", nil, "command to run before scanning, e.g. code generators producing providers, split into arguments like a shell does and run in the module root with --module-root-relative (can be specified multiple times)")
 }
 
 func main() {
@@ -50,85 +229,519 @@ func main() {
 	}
 }
 
-func run(*cobra.Command, []string) error {
-	absOutDir, err := filepath.Abs(outDir)
+func run(cmd *cobra.Command, args []string) error {
+	if err := loadConfig(cmd); err != nil {
+		return err
+	}
+	if rootRel {
+		if err := resolveModuleRoot(); err != nil {
+			return err
+		}
+	}
+	order, ok := fieldOrders[fieldOrder]
+	if !ok {
+		return fmt.Errorf("invalid field order %q: must be topological, type or package", fieldOrder)
+	}
+	if maxErrors < 0 {
+		return fmt.Errorf("invalid max errors %d: must be 0 or more", maxErrors)
+	}
+	policy, ok := builtinPolicies[builtins]
+	if !ok {
+		return fmt.Errorf("invalid builtin policy %q: must be allow, named-only or forbid", builtins)
+	}
+	mode, err := strconv.ParseUint(fileMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("invalid file mode %q: must be octal permissions such as 0644 or 0444", fileMode)
+	}
+	if mode&0400 == 0 {
+		return fmt.Errorf("invalid file mode %q: the owner must be able to read generated files", fileMode)
+	}
+	var owner *pipeline.Owner
+	if fileOwner != "" {
+		if owner, err = pipeline.ParseOwner(fileOwner); err != nil {
+			return err
+		}
+	}
+	if container != "" && !token.IsIdentifier(container) {
+		return fmt.Errorf("invalid container name %q: must be a valid identifier", container)
+	}
+	if profile != "" {
+		if !token.IsIdentifier(profile) {
+			return fmt.Errorf("invalid profile %q: must be a valid identifier", profile)
+		}
+		if !cmd.Flags().Changed("name") {
+			outputName = "app_" + profile + "_gen.go"
+		}
+	}
+	if len(testShared) > 0 && !testApp {
+		return fmt.Errorf("--test-shared requires --test-app")
+	}
+	emitter, err := generator.LookupEmitter(emit)
 	if err != nil {
-		return fmt.Errorf("resolving output directory: %w", err)
+		return err
 	}
-
-	if verbose {
-		fmt.Printf("output dir: %s\n", absOutDir)
+	if emit != generator.EmitGo {
+		if partial || bench || testApp {
+			return fmt.Errorf("--partial, --bench and --test-app generate Go code and cannot be combined with --emit %s", emit)
+		}
+		if !cmd.Flags().Changed("name") {
+			outputName = strings.TrimSuffix(outputName, filepath.Ext(outputName)) + emitter.Extension()
+		}
 	}
-
-	outputPackage, outputImportPath, err := parser.GetOutputInfo(absOutDir)
+	commands := args
+	if len(commands) == 0 {
+		commands = []string{commandGenerate}
+	}
+	if slices.Contains(commands, commandScan) {
+		if len(commands) > 1 {
+			return fmt.Errorf("scan cannot be combined with other commands")
+		}
+		if len(from) > 0 {
+			return fmt.Errorf("scan reads the scan directories and cannot be combined with --from")
+		}
+	}
+	if slices.Contains(commands, commandWhatIf) {
+		if len(commands) > 1 {
+			return fmt.Errorf("what-if cannot be combined with other commands")
+		}
+		if len(from) > 0 || replay != "" {
+			return fmt.Errorf("what-if loads the proposed functions from disk and cannot be combined with --from or --replay")
+		}
+		if len(proposed) == 0 && len(invokes) == 0 {
+			return fmt.Errorf("what-if requires at least one --provide or --invoke")
+		}
+	} else if len(proposed) > 0 || len(invokes) > 0 {
+		return fmt.Errorf("--provide and --invoke are only used by the what-if command")
+	}
+	if slices.Contains(commands, commandGraph) {
+		graphFormat = generator.GraphFormatDOT
+		if cmd.Flags().Changed("format") {
+			if graphFormat, ok = graphFormats[format]; !ok {
+				return fmt.Errorf("invalid graph format %q: must be dot, mermaid or json", format)
+			}
+		}
+		format = "text"
+	}
+	reportFormat, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("invalid format %q: must be text, github, gitlab or json", format)
+	}
+	if reportFormat == report.FormatGitLab || reportFormat == report.FormatJSON || emitPatch {
+		quiet = true
+	}
+	cwd, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("getting output info: %w", err)
+		return err
+	}
+	reportBase := cwd
+	if reportFormat != report.FormatText {
+		if root, ok := cache.ModuleRoot(cwd); ok {
+			reportBase = root
+		}
 	}
 
-	pkgResolver := resolver.New()
-
-	merged := &types.ParseResult{
-		OutputPath:       absOutDir,
-		OutputPackage:    outputPackage,
-		OutputImportPath: outputImportPath,
+	tracker := &progress{enabled: !quiet && !verbose && isTerminal(os.Stderr)}
+	cfg := pipeline.Config{
+		ScanDirs:   scanDirs,
+		OutDir:     outDir,
+		OutputName: outputName,
+		Package:    outPackage,
+		Prefixes:   prefixes,
+		Exclude:    exclude,
+		ErrorTypes: errorTypes,
+		Analyzer: analyzer.Options{
+			AllowMissing:   partial,
+			Builtins:       policy,
+			ChainThreshold: chainWarn,
+			Strict:         strict,
+			Profile:        profile,
+			Container:      container,
+			OnlyInvoke:     onlyInvoke,
+			SkipInvoke:     skipInvoke,
+			Rules:          analyzer.Rules{FuncPrefix: funcPrefix, StructPackages: structPkgs, InvokePackages: invokePkgs},
+		},
+		Generator: generator.Options{
+			DebugDump:        debugDump,
+			Partial:          partial,
+			FieldOrder:       order,
+			FieldTags:        fieldTags,
+			Container:        container,
+			NoLint:           nolint,
+			Cleanup:          cleanup,
+			Lifecycle:        lifecycle,
+			RunFuncs:         runFuncs,
+			InitOptions:      initOpts,
+			Recover:          recoverFns,
+			Getters:          getters,
+			Services:         services,
+			Profile:          profile,
+			Emit:             emit,
+			TestShared:       testShared,
+			ContextAccessors: ctxAccess,
+		},
+		ScanOnly:  slices.Contains(commands, commandScan),
+		Cache:     !noCache,
+		FileMode:  os.FileMode(mode),
+		FileOwner: owner,
+		Progress:  tracker.update,
+		Logf:      logf,
+	}
+	if emitPatch {
+		cfg.Patch = os.Stdout
 	}
 
-	for _, dir := range scanDirs {
-		absDir, err := filepath.Abs(dir)
+	runOnce := func() error {
+		reporter := report.New(reportFormat, os.Stdout, os.Stderr, reportBase)
+		reporter.SetDefaultPath(filepath.Join(outDir, outputName))
+		err := runPipeline(cfg, reporter, commands)
 		if err != nil {
-			return fmt.Errorf("resolving directory %s: %w", dir, err)
+			reporter.Fail(err)
+		}
+		if limited, omitted := diag.Truncate(err, maxErrors); omitted > 0 {
+			err = fmt.Errorf("%w\n... and %d more errors (use --max-errors 0 to show all)", limited, omitted)
+		}
+		if ferr := reporter.Flush(); ferr != nil && err == nil {
+			err = ferr
 		}
+		return err
+	}
+	if watchMode {
+		cfg.Resolver = resolver.New()
+		return watch(cfg, runOnce)
+	}
+	return runOnce()
+}
 
-		if verbose {
-			fmt.Printf("scanning: %s\n", absDir)
+func resolveModuleRoot() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	root, ok := cache.ModuleRoot(cwd)
+	if !ok {
+		return fmt.Errorf("--module-root-relative: no go.mod found in %s or any parent directory", cwd)
+	}
+	for i, dir := range scanDirs {
+		if !filepath.IsAbs(dir) {
+			scanDirs[i] = filepath.Join(root, dir)
 		}
+	}
+	if !filepath.IsAbs(outDir) {
+		outDir = filepath.Join(root, outDir)
+	}
+	commandDir = root
+	logf("module root: %s\n", root)
+	return nil
+}
 
-		parsed, err := parser.Parse(absDir, pkgResolver)
+func runPipeline(cfg pipeline.Config, reporter *report.Reporter, commands []string) error {
+	if replay != "" {
+		b, err := bundle.Read(replay)
 		if err != nil {
-			return fmt.Errorf("parsing %s: %w", dir, err)
+			return fmt.Errorf("reading bundle: %w", err)
+		}
+		cfg.ScanDirs = b.Settings.ScanDirs
+		cfg.OutputName = b.Settings.OutputName
+		cfg.Prefixes = b.Settings.Prefixes
+		cfg.Exclude = b.Settings.Exclude
+		cfg.ErrorTypes = b.Settings.ErrorTypes
+		cfg.Analyzer = b.Settings.Analyzer
+		cfg.Generator = b.Settings.Generator
+		cfg.Replay = b
+	} else if len(from) > 0 {
+		for _, path := range from {
+			s, err := shard.Read(path)
+			if err != nil {
+				return fmt.Errorf("reading shard: %w", err)
+			}
+			cfg.Shards = append(cfg.Shards, s)
+		}
+	} else {
+		for _, command := range after {
+			if err := runCommand(command); err != nil {
+				return fmt.Errorf("running %q: %w", command, err)
+			}
 		}
-
-		merged.Providers = append(merged.Providers, parsed.Providers...)
-		merged.Invocations = append(merged.Invocations, parsed.Invocations...)
 	}
 
-	if len(merged.Providers) == 0 && len(merged.Invocations) == 0 {
-		return fmt.Errorf("no autowire annotations found in: %s", strings.Join(scanDirs, ", "))
+	p := pipeline.New(cfg)
+	err := execute(p, reporter, commands)
+	if record != "" {
+		if rerr := recordBundle(p); rerr != nil && err == nil {
+			err = rerr
+		}
 	}
+	return err
+}
 
+func execute(p *pipeline.Pipeline, reporter *report.Reporter, commands []string) error {
 	if verbose {
-		fmt.Printf("found %d providers:\n", len(merged.Providers))
-		for _, p := range merged.Providers {
-			fmt.Printf("  - %s -> %s\n", p.Name, p.ProvidedType.Key())
+		parsed, err := p.Parse()
+		if err != nil {
+			return err
 		}
-		fmt.Printf("found %d invocations:\n", len(merged.Invocations))
-		for _, inv := range merged.Invocations {
+		fmt.Printf("found %d providers:\n", len(parsed.Providers))
+		for _, pr := range parsed.Providers {
+			fmt.Printf("  - %s -> %s\n", pr.Name, pr.ProvidedType.Key())
+		}
+		fmt.Printf("found %d invocations:\n", len(parsed.Invocations))
+		for _, inv := range parsed.Invocations {
 			fmt.Printf("  - %s\n", inv.Name)
 		}
 	}
 
-	result, err := analyzer.Analyze(merged, pkgResolver)
+	if slices.Contains(commands, commandScan) {
+		return writeShard(p)
+	}
+	if slices.Contains(commands, commandWhatIf) {
+		return runPipelineCommand(p, reporter, commands, commandWhatIf)
+	}
+
+	result, err := p.Analyze()
 	if err != nil {
-		return fmt.Errorf("analyzing: %w", err)
+		return err
+	}
+
+	errors := 0
+	for _, d := range result.Diagnostics {
+		if d.Severity == diag.SeverityInfo && !verbose {
+			continue
+		}
+		if d.Severity == diag.SeverityError {
+			errors++
+			if maxErrors > 0 && errors > maxErrors {
+				continue
+			}
+		}
+		reporter.Report(d)
+	}
+	if maxErrors > 0 && errors > maxErrors {
+		return fmt.Errorf("found %d errors in the wiring, %d not shown (use --max-errors 0 to show all)", errors, errors-maxErrors)
+	}
+	if errors > 0 {
+		return fmt.Errorf("found %d errors in the wiring", errors)
 	}
 
 	if verbose {
 		fmt.Printf("initialization order:\n")
-		for i, p := range result.Providers {
-			fmt.Printf("  %d. %s (%s)\n", i+1, p.Name, p.VarName)
+		for i, pr := range result.Providers {
+			fmt.Printf("  %d. %s (%s)\n", i+1, pr.Name, pr.VarName)
+		}
+	}
+
+	if selfCheck {
+		if err := p.SelfCheck(); err != nil {
+			return err
 		}
+		logf("self-check: output is deterministic\n")
 	}
 
-	code, err := generator.Generate(result, pkgResolver)
+	for _, command := range commands {
+		if err := runPipelineCommand(p, reporter, commands, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeShard(p *pipeline.Pipeline) error {
+	s, err := p.Shard()
 	if err != nil {
-		return fmt.Errorf("generating: %w", err)
+		return err
+	}
+	if err := shard.Write(irPath, s); err != nil {
+		return fmt.Errorf("writing shard: %w", err)
 	}
+	if !quiet {
+		fmt.Printf("autowire: wrote %s (%d providers, %d invocations)\n", irPath, len(s.Parsed.Providers), len(s.Parsed.Invocations))
+	}
+	return nil
+}
 
-	outputPath := filepath.Join(absOutDir, outputName)
-	if err := os.WriteFile(outputPath, code, filePermission); err != nil {
-		return fmt.Errorf("writing output: %w", err)
+func recordBundle(p *pipeline.Pipeline) error {
+	b, err := p.Bundle()
+	if err != nil {
+		return err
+	}
+	if err := bundle.Write(record, b); err != nil {
+		return fmt.Errorf("writing bundle: %w", err)
+	}
+	if !quiet {
+		fmt.Printf("autowire: recorded %s\n", record)
 	}
+	return nil
+}
 
-	fmt.Printf("autowire: generated %s\n", outputPath)
+func runPipelineCommand(p *pipeline.Pipeline, reporter *report.Reporter, commands []string, command string) error {
+	switch command {
+	case commandCheck:
+		drift, err := p.Drift()
+		if err != nil {
+			return err
+		}
+		for _, d := range drift {
+			reporter.Report(d)
+		}
+		if !slices.Contains(commands, commandGenerate) {
+			upToDate, err := p.UpToDate()
+			if err != nil {
+				return err
+			}
+			if !upToDate {
+				return fmt.Errorf("%s is out of date: run autowire generate", p.OutputPath())
+			}
+		}
+		if !quiet {
+			fmt.Println("autowire: wiring is valid")
+		}
+	case commandList:
+		result, err := p.Analyze()
+		if err != nil {
+			return err
+		}
+		for _, pr := range result.Providers {
+			if pr.Kind == types.ProviderKindGroup {
+				fmt.Printf("group %s -> %s (%d members)\n", pr.Name, pr.ProvidedType.Key(), len(pr.Members))
+				continue
+			}
+			fmt.Printf("provide %s.%s -> %s\n", pr.ImportPath, pr.Name, pr.ProvidedType.Key())
+		}
+		for _, pr := range result.RequestProviders {
+			fmt.Printf("provide %s.%s -> %s (request)\n", pr.ImportPath, pr.Name, pr.ProvidedType.Key())
+		}
+		for _, pr := range result.TransientProviders {
+			fmt.Printf("provide %s.%s -> %s (transient)\n", pr.ImportPath, pr.Name, pr.ProvidedType.Key())
+		}
+		for _, pr := range result.WeakProviders {
+			fmt.Printf("provide %s.%s -> %s (weak)\n", pr.ImportPath, pr.Name, pr.ProvidedType.Key())
+		}
+		for _, pr := range result.LazyProviders {
+			fmt.Printf("provide %s.%s -> %s (lazy)\n", pr.ImportPath, pr.Name, pr.ProvidedType.Key())
+		}
+		for _, inv := range result.Invocations {
+			if inv.Flag != "" {
+				fmt.Printf("invoke %s.%s (flag %s)\n", inv.ImportPath, inv.Name, inv.Flag)
+				continue
+			}
+			fmt.Printf("invoke %s.%s\n", inv.ImportPath, inv.Name)
+		}
+	case commandGraph:
+		result, err := p.Analyze()
+		if err != nil {
+			return err
+		}
+		out, err := generator.DependencyGraph(result, graphFormat)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stdout.Write(out); err != nil {
+			return err
+		}
+	case commandGenerate:
+		outputPath, err := p.Write()
+		if err != nil {
+			return err
+		}
+		if !quiet {
+			fmt.Printf("autowire: generated %s\n", outputPath)
+		}
+		if summary {
+			summaryPath, err := p.WriteSummary()
+			if err != nil {
+				return err
+			}
+			if !quiet {
+				fmt.Printf("autowire: generated %s\n", summaryPath)
+			}
+		}
+		if bench {
+			benchPath, err := p.WriteBenchmark()
+			if err != nil {
+				return err
+			}
+			if !quiet {
+				fmt.Printf("autowire: generated %s\n", benchPath)
+			}
+		}
+		if testApp {
+			testPath, err := p.WriteTestApp()
+			if err != nil {
+				return err
+			}
+			if !quiet {
+				fmt.Printf("autowire: generated %s\n", testPath)
+			}
+		}
+	case commandWhatIf:
+		w, err := p.WhatIf(proposed, invokes)
+		if err != nil {
+			return err
+		}
+		for _, line := range w.Resolved {
+			fmt.Printf("resolves: %s\n", line)
+		}
+		for _, change := range w.Changes {
+			fmt.Printf("wiring: %s\n", change)
+		}
+		if w.Err != nil {
+			return fmt.Errorf("with the proposed annotations: %w", w.Err)
+		}
+		if !quiet {
+			fmt.Println("autowire: wiring is valid")
+		}
+	}
 	return nil
 }
+
+func logf(format string, args ...any) {
+	if verbose {
+		fmt.Printf(format, args...)
+	}
+}
+
+type progress struct {
+	enabled bool
+	start   time.Time
+	shown   bool
+}
+
+func (p *progress) update(dir string, done, total int) {
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	elapsed := time.Since(p.start)
+	if !p.enabled || elapsed < progressThreshold {
+		return
+	}
+	p.shown = true
+	fmt.Fprintf(os.Stderr, "\rautowire: scanning %s: %d/%d packages (%s)", dir, done, total, elapsed.Round(100*time.Millisecond))
+	if done == total {
+		fmt.Fprintln(os.Stderr)
+		p.shown = false
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func runCommand(command string) error {
+	args, err := shellwords.Split(command)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	if verbose {
+		fmt.Printf("running: %s\n", command)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = commandDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,59 @@
+package autowire
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/eloonstra/autowire/internal/analyzer"
+	"github.com/eloonstra/autowire/internal/diag"
+	"github.com/eloonstra/autowire/internal/generator"
+	"github.com/eloonstra/autowire/internal/pipeline"
+)
+
+const defaultOutputName = "app_gen.go"
+
+type Config struct {
+	Source     fs.FS
+	ImportPath string
+	ScanDirs   []string
+	OutDir     string
+	Prefixes   []string
+	Exclude    []string
+	ErrorTypes []string
+	Container  string
+	Partial    bool
+}
+
+func Generate(cfg Config) ([]byte, error) {
+	scanDirs := cfg.ScanDirs
+	if len(scanDirs) == 0 {
+		scanDirs = []string{"."}
+	}
+	outDir := cfg.OutDir
+	if outDir == "" {
+		outDir = "."
+	}
+
+	p := pipeline.New(pipeline.Config{
+		ScanDirs:         scanDirs,
+		OutDir:           outDir,
+		OutputName:       defaultOutputName,
+		Prefixes:         cfg.Prefixes,
+		Exclude:          cfg.Exclude,
+		ErrorTypes:       cfg.ErrorTypes,
+		Analyzer:         analyzer.Options{AllowMissing: cfg.Partial, Container: cfg.Container},
+		Generator:        generator.Options{Partial: cfg.Partial, Container: cfg.Container},
+		Source:           cfg.Source,
+		SourceImportPath: cfg.ImportPath,
+	})
+	result, err := p.Analyze()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range result.Diagnostics {
+		if d.Severity == diag.SeverityError {
+			return nil, errors.New(d.String())
+		}
+	}
+	return p.Generate()
+}
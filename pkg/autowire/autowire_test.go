@@ -0,0 +1,195 @@
+package autowire
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate_Source(t *testing.T) {
+	source := fstest.MapFS{
+		"cmd/main.go": {Data: []byte("package main\n")},
+		"internal/store/store.go": {Data: []byte(`package store
+
+//autowire:provide
+type Store struct{}
+`)},
+		"internal/api/api.go": {Data: []byte(`package handlers
+
+import "example.com/app/internal/store"
+
+//autowire:provide
+func NewHandler(s *store.Store) *Handler { return &Handler{} }
+
+type Handler struct{}
+`)},
+	}
+
+	code, err := Generate(Config{
+		Source:     source,
+		ImportPath: "example.com/app",
+		ScanDirs:   []string{"./internal"},
+		OutDir:     "cmd",
+	})
+	require.NoError(t, err)
+
+	output := string(code)
+	assert.Contains(t, output, "package main\n")
+	assert.Contains(t, output, "\"example.com/app/internal/api\"")
+	assert.Contains(t, output, "handler := handlers.NewHandler(store)")
+}
+
+func TestGenerate_SourceErrors(t *testing.T) {
+	source := fstest.MapFS{"a.go": {Data: []byte("package a\n")}}
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		errMsg string
+	}{
+		{
+			name:   "missing import path",
+			cfg:    Config{Source: source},
+			errMsg: "an import path for the source file system is required",
+		},
+		{
+			name:   "path outside source",
+			cfg:    Config{Source: source, ImportPath: "example.com/a", ScanDirs: []string{"../other"}},
+			errMsg: "../other is not a valid path inside the source file system",
+		},
+		{
+			name:   "no annotations",
+			cfg:    Config{Source: source, ImportPath: "example.com/a"},
+			errMsg: "no autowire annotations found in: .",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Generate(tt.cfg)
+			assert.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestGenerate_DiskBindingError(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      "module example.com/app\n\ngo 1.22\n",
+		"cmd/main.go": "package main\n\nfunc main() {}\n",
+		"internal/store/store.go": `package store
+
+import "io"
+
+var _ = io.EOF
+
+//autowire:provide io.Reader
+type FileReader struct{}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	t.Chdir(dir)
+
+	_, err := Generate(Config{ScanDirs: []string{"internal"}, OutDir: "cmd"})
+	assert.ErrorContains(t, err, "FileReader: *example.com/app/internal/store.FileReader does not implement io.Reader (missing method Read)")
+}
+
+func TestWrite(t *testing.T) {
+	source := fstest.MapFS{
+		"cmd/main.go":             {Data: []byte("package main\n")},
+		"internal/store/store.go": {Data: []byte("package store\n\n//autowire:provide\ntype Store struct{}\n")},
+	}
+	cfg := Config{Source: source, ImportPath: "example.com/app", ScanDirs: []string{"internal"}, OutDir: "cmd"}
+	code, err := Generate(cfg)
+	require.NoError(t, err)
+
+	t.Run("memory", func(t *testing.T) {
+		w := NewMemoryWriter()
+		name, err := Write(cfg, w)
+		require.NoError(t, err)
+		assert.Equal(t, "cmd/app_gen.go", name)
+		assert.Equal(t, map[string][]byte{"cmd/app_gen.go": code}, w.Files())
+	})
+
+	t.Run("disk", func(t *testing.T) {
+		root := t.TempDir()
+		_, err := Write(cfg, DiskWriter(root))
+		require.NoError(t, err)
+		written, err := os.ReadFile(filepath.Join(root, "cmd", "app_gen.go"))
+		require.NoError(t, err)
+		assert.Equal(t, code, written)
+	})
+
+	t.Run("disk read-only", func(t *testing.T) {
+		root := t.TempDir()
+		for range 2 {
+			_, err := Write(cfg, DiskWriterMode(root, 0444))
+			require.NoError(t, err)
+		}
+		info, err := os.Stat(filepath.Join(root, "cmd", "app_gen.go"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0444), info.Mode().Perm())
+	})
+
+	t.Run("disk owner", func(t *testing.T) {
+		root := t.TempDir()
+		_, err := Write(cfg, DiskWriterOwner(root, 0640, os.Getuid(), os.Getgid()))
+		require.NoError(t, err)
+		info, err := os.Stat(filepath.Join(root, "cmd", "app_gen.go"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Write(cfg, StreamWriter(&buf))
+		require.NoError(t, err)
+		assert.Equal(t, code, buf.Bytes())
+	})
+
+	t.Run("http", func(t *testing.T) {
+		var method, path string
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path = r.Method, r.URL.Path
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+
+		_, err := Write(cfg, HTTPWriter(server.URL+"/artifacts/", nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.MethodPut, method)
+		assert.Equal(t, "/artifacts/cmd/app_gen.go", path)
+		assert.Equal(t, code, body)
+	})
+
+	t.Run("http error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "read-only", http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		_, err := Write(cfg, HTTPWriter(server.URL, server.Client()))
+		assert.ErrorContains(t, err, "writing cmd/app_gen.go: PUT "+server.URL+"/cmd/app_gen.go: 403 Forbidden: read-only")
+	})
+
+	t.Run("generate error", func(t *testing.T) {
+		w := NewMemoryWriter()
+		_, err := Write(Config{Source: source}, w)
+		assert.Error(t, err)
+		assert.Empty(t, w.Files())
+	})
+}
@@ -0,0 +1,127 @@
+package autowire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/eloonstra/autowire/internal/pipeline"
+)
+
+type Writer interface {
+	WriteFile(name string, content []byte) error
+}
+
+type WriterFunc func(name string, content []byte) error
+
+func (f WriterFunc) WriteFile(name string, content []byte) error {
+	return f(name, content)
+}
+
+func Write(cfg Config, w Writer) (string, error) {
+	code, err := Generate(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	outDir := cfg.OutDir
+	if outDir == "" {
+		outDir = "."
+	}
+	name := path.Join(filepath.ToSlash(outDir), defaultOutputName)
+	if err := w.WriteFile(name, code); err != nil {
+		return "", fmt.Errorf("writing %s: %w", name, err)
+	}
+	return name, nil
+}
+
+func DiskWriter(root string) Writer {
+	return DiskWriterMode(root, pipeline.DefaultFileMode)
+}
+
+func DiskWriterMode(root string, mode fs.FileMode) Writer {
+	return DiskWriterOwner(root, mode, -1, -1)
+}
+
+func DiskWriterOwner(root string, mode fs.FileMode, uid, gid int) Writer {
+	owner := &pipeline.Owner{UID: uid, GID: gid}
+	return WriterFunc(func(name string, content []byte) error {
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := pipeline.WriteFile(target, content, mode); err != nil {
+			return err
+		}
+		return owner.Chown(target)
+	})
+}
+
+func StreamWriter(w io.Writer) Writer {
+	return WriterFunc(func(_ string, content []byte) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+type MemoryWriter struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewMemoryWriter() *MemoryWriter {
+	return &MemoryWriter{files: make(map[string][]byte)}
+}
+
+func (m *MemoryWriter) WriteFile(name string, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = bytes.Clone(content)
+	return nil
+}
+
+func (m *MemoryWriter) Files() map[string][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := make(map[string][]byte, len(m.files))
+	for name, content := range m.files {
+		files[name] = content
+	}
+	return files
+}
+
+func HTTPWriter(baseURL string, client *http.Client) Writer {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return WriterFunc(func(name string, content []byte) error {
+		target, err := url.JoinPath(strings.TrimSuffix(baseURL, "/"), name)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPut, target, bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/x-go; charset=utf-8")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("PUT %s: %s: %s", target, resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil
+	})
+}
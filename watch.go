@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eloonstra/autowire/internal/parser"
+	"github.com/eloonstra/autowire/internal/pipeline"
+	"github.com/fsnotify/fsnotify"
+)
+
+const watchDebounce = 200 * time.Millisecond
+
+func watch(cfg pipeline.Config, rebuild func() error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("starting watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	sources := make(sourceHashes)
+	for _, dir := range cfg.ScanDirs {
+		if err := watchTree(watcher, pipeline.ScanRoot(dir), cfg, sources); err != nil {
+			return fmt.Errorf("watching %s: %w", dir, err)
+		}
+	}
+	output, err := filepath.Abs(filepath.Join(cfg.OutDir, cfg.OutputName))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	reportWatchError(rebuild())
+	if !quiet {
+		fmt.Printf("autowire: watching %s for changes\n", strings.Join(cfg.ScanDirs, ", "))
+	}
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && !skipDir(info.Name()) && !excluded(cfg, event.Name) {
+					known := len(sources)
+					reportWatchError(watchTree(watcher, event.Name, cfg, sources))
+					if len(sources) > known {
+						debounce.Reset(watchDebounce)
+					}
+				}
+			}
+			if isSourceChange(event.Name, output) && !excluded(cfg, event.Name) && sources.changed(event.Name) {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "autowire: watch: %v\n", err)
+		case <-debounce.C:
+			reportWatchError(rebuild())
+		}
+	}
+}
+
+func watchTree(watcher *fsnotify.Watcher, root string, cfg pipeline.Config, sources sourceHashes) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			if isSourceChange(path, "") && !excluded(cfg, path) {
+				sources.changed(path)
+			}
+			return nil
+		}
+		if path != root && (skipDir(d.Name()) || excluded(cfg, path)) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+func excluded(cfg pipeline.Config, path string) bool {
+	for _, dir := range cfg.ScanDirs {
+		rel, err := filepath.Rel(pipeline.ScanRoot(dir), path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if parser.Excluded(rel, cfg.Exclude) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSourceChange(path, output string) bool {
+	if abs, err := filepath.Abs(path); err == nil && abs == output {
+		return false
+	}
+	name := filepath.Base(path)
+	if skipDir(name) || !strings.HasSuffix(name, ".go") {
+		return false
+	}
+	return !strings.HasSuffix(name, "_test.go") && !strings.HasSuffix(name, "_gen.go")
+}
+
+type sourceHashes map[string][sha256.Size]byte
+
+func (h sourceHashes) changed(path string) bool {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		delete(h, path)
+		return true
+	}
+	sum := sha256.Sum256(src)
+	if old, ok := h[path]; ok && old == sum {
+		return false
+	}
+	h[path] = sum
+	return true
+}
+
+func reportWatchError(err error) {
+	if err != nil && format == "text" {
+		fmt.Fprintf(os.Stderr, "autowire: error: %v\n", err)
+	}
+}